@@ -30,9 +30,8 @@ export class AuthGuardService {
         const expectedRole = route.data.expectedRole;
         if (expectedRole) {
             if (expectedRole === 'administrator') {
-                const hasRoleAdmin = this._user.userRoles.reduce((acc, cur) => {
-                    return acc || cur.roleId == 1;
-                  }, false);
+                // Any permission (roster editor, tag moderator, etc) gets access to the admin pages
+                const hasRoleAdmin = this._user.userPermissions != null && this._user.userPermissions.length > 0;
 
                 if (!this._isAuthenticated() || !hasRoleAdmin) {
                     this.router.navigate(['/home']);
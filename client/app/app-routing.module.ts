@@ -8,6 +8,7 @@ import { HomeComponent } from './page-components/home/home.component';
 import { AdminComponent } from './page-components/admin/admin.component';
 import { RequestResetComponent } from './page-components/reset-password/request-reset.component';
 import { PasswordResetComponent } from './page-components/reset-password/reset.component';
+import { TeamInviteComponent } from './page-components/team-invite/team-invite.component';
 import { AuthGuardService as AuthGuard } from './app-auth-guard.service';
 
 
@@ -50,6 +51,16 @@ const routes: Routes = [
       },
     ]
   },
+  {
+    // No guard for team invites either; the page asks logged out users to log in first
+    path: 'team',
+    children: [
+      {
+        path: 'invite',
+        component: TeamInviteComponent,
+      },
+    ]
+  },
   {
     path: 'admin',
     canActivate: [AuthGuard],
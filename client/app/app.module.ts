@@ -30,6 +30,7 @@ import { AdminCharacterComponent } from './page-components/admin/admin-character
 import { ProfileComponent } from './page-components/profiles/profile.component';
 import { RequestResetComponent } from './page-components/reset-password/request-reset.component';
 import { PasswordResetComponent } from './page-components/reset-password/reset.component';
+import { TeamInviteComponent } from './page-components/team-invite/team-invite.component';
 import { PageNotFoundComponent } from './page-components/page-not-found/page-not-found.component';
 
 // Services
@@ -52,6 +53,7 @@ import { CommonUxService } from './modules/common-ux/common-ux.service';
     ProfileComponent,
     RequestResetComponent,
     PasswordResetComponent,
+    TeamInviteComponent,
     AdminTagComponent,
     AdminCharacterComponent,
     TagRowComponent,
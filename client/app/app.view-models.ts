@@ -52,6 +52,10 @@ export interface IUserViewModel {
     userCharacters: IUserCharacterViewModel[];
     isAuthenticated: boolean;
     userRoles: IUserRoleViewModel[];
+    userPermissions: string[];
+    publicProfile: boolean;
+    twoFactorEnabled: boolean;
+    feedOptOut: boolean;
 }
 export class UserViewModel implements IUserViewModel {
     constructor(
@@ -67,6 +71,10 @@ export class UserViewModel implements IUserViewModel {
         public userCharacters: IUserCharacterViewModel[] = [],
         public isAuthenticated: boolean = false,
         public userRoles: IUserRoleViewModel[] = [],
+        public userPermissions: string[] = [],
+        public publicProfile: boolean = false,
+        public twoFactorEnabled: boolean = false,
+        public feedOptOut: boolean = false,
     ) {
     }
 }
@@ -90,7 +98,16 @@ export interface ICharacterViewModel {
     characterName: string;
     characterStockImg: string;
     characterImg: string;
-    characterArchetype: string;
+    characterArchetypes: IArchetypeViewModel[];
+    characterSeries: ISeriesViewModel[];
+}
+export interface IArchetypeViewModel {
+    archetypeId: number;
+    archetypeName: string;
+}
+export interface ISeriesViewModel {
+    seriesId: number;
+    seriesName: string;
 }
 export interface ITypeAheadViewModel {
     text: string;
@@ -153,3 +170,6 @@ export interface IPasswordResetModel {
     token: string;
     newPassword: string;
 }
+export interface ITeamInviteAcceptModel {
+    token: string;
+}
@@ -41,6 +41,10 @@ export class UserManagementModule {
             provide: 'UserCharacterApiUrl',
             useValue: '/api/user/character'
           },
+          {
+            provide: 'TeamApiUrl',
+            useValue: '/api/team'
+          },
         ]
     };
   }
@@ -4,7 +4,7 @@ import { CommonUxService } from '../../modules/common-ux/common-ux.service';
 import { HttpClient } from '@angular/common/http';
 import { Observable, BehaviorSubject, of } from 'rxjs';
 import { publish, refCount, tap, map } from 'rxjs/operators';
-import { IUserViewModel, LogInViewModel, IServerResponse, IUserCharacterViewModel, IChartUserViewModel, IPasswordResetRequestModel, IPasswordResetModel } from '../../app.view-models';
+import { IUserViewModel, LogInViewModel, IServerResponse, IUserCharacterViewModel, IChartUserViewModel, IPasswordResetRequestModel, IPasswordResetModel, ITeamInviteAcceptModel } from '../../app.view-models';
 
 @Injectable()
 export class UserManagementService {
@@ -20,6 +20,7 @@ export class UserManagementService {
         @Inject('UserApiUrl') private apiUrl: string,
         @Inject('AuthApiUrl') private authApiUrl: string,
         @Inject('UserCharacterApiUrl') private userCharacterApiUrl: string,
+        @Inject('TeamApiUrl') private teamApiUrl: string,
     ) {
         // Start interval for login check (runs once a minute)
         this._startIntervalSessionCheck();
@@ -116,6 +117,17 @@ export class UserManagementService {
         );
     }
 
+    /*-----------------------
+              Teams
+    ------------------------*/
+
+    public acceptTeamInvite(urlToken: string): Observable<IServerResponse> {
+        const acceptModel: ITeamInviteAcceptModel = {
+            token: urlToken
+        };
+        return this.httpClient.post<IServerResponse>(`${this.teamApiUrl}/accept_invite`, acceptModel);
+    }
+
     /*-----------------------
          User characters
     ------------------------*/
@@ -278,6 +290,11 @@ export class UserManagementService {
                         if (res && res.success && res.data) {
                             // Set the new updated access expiration date
                             localStorage.setItem('smush_access_expire', JSON.stringify(new Date(res.data.accessExpiration)));
+                            // Pick up any role changes made since the user logged in
+                            const refreshedUser: IUserViewModel = this.cachedUser.value;
+                            refreshedUser.userRoles = res.data.userRoles;
+                            refreshedUser.userPermissions = res.data.userPermissions;
+                            this._updateCachedUser(refreshedUser, true);
                             if (isInitialCheck) {
                                 // If this is on pageload, change isAuthenticated to true so we know to load the static data etc
                                 this._setUserAuthenticated();
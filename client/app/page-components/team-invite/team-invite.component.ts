@@ -0,0 +1,59 @@
+import { Component, OnInit } from '@angular/core';
+import { ActivatedRoute } from '@angular/router';
+import { UserManagementService } from 'client/app/modules/user-management/user-management.service';
+import { IUserViewModel, IServerResponse } from 'client/app/app.view-models';
+
+@Component({
+  selector: 'team-invite',
+  templateUrl: './team-invite.component.html',
+})
+export class TeamInviteComponent implements OnInit {
+  public token: string = '';
+  public user: IUserViewModel = null;
+  public teamName: string = '';
+
+  public requestSent: boolean = false;
+  public acceptSuccessful: boolean = false;
+  public acceptFailed: boolean = false;
+  public errorMessage: string = '';
+
+  constructor(private route: ActivatedRoute, private userService: UserManagementService) {
+  }
+
+  ngOnInit() {
+    // No guard for this page; it would send logged out users home and lose the invite's token
+    this.userService.cachedUser.subscribe(
+      res => {
+        this.user = res;
+      }
+    );
+    this.route.queryParams.subscribe(params => {
+        this.token = params.t;
+    });
+  }
+
+  public acceptInvite() {
+    if (!this.token || !this.user) {
+      return;
+    }
+    this.requestSent = true;
+    this.userService.acceptTeamInvite(this.token).subscribe(
+      (res: IServerResponse) => {
+        if (res && res.success) {
+          this.acceptSuccessful = true;
+          this.teamName = res.data.team.teamName;
+          setTimeout(() => {
+            window.location.href = '/home';
+          }, 3000);
+        } else {
+          this.acceptFailed = true;
+        }
+      },
+      error => {
+        this.acceptFailed = true;
+        // The server says why (wrong account, expired invite, etc) in plain text
+        this.errorMessage = typeof error.error === 'string' ? error.error : '';
+      }
+    );
+  }
+}
@@ -37,10 +37,8 @@ export class TopNavBarComponent implements OnInit {
       this.userService.cachedUser.subscribe({
         next: res => {
           this.user = res;
-          if (res && res.userRoles && res.userRoles) {
-            this.hasRoleAdmin = this.user.userRoles.reduce((acc, cur) => {
-              return acc || cur.roleId === 1;
-            }, false);
+          if (res && res.userPermissions) {
+            this.hasRoleAdmin = res.userPermissions.length > 0;
           }
         },
         error: err => {
@@ -0,0 +1,74 @@
+package main
+
+import (
+  "encoding/json"
+  "flag"
+  "log"
+  "os"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+// runCommand runs one of our maintenance subcommands instead of the web server,
+// i.e. `bin/smush sync-roster --dry-run`
+func runCommand(command string, args []string) {
+  switch command {
+  case "sync-roster":
+    runSyncRoster(args)
+  default:
+    log.Fatalf("Unknown command %s; available commands: sync-roster", command)
+  }
+}
+
+
+// runSyncRoster upserts the bundled roster manifest into the characters table and prints the diff
+func runSyncRoster(args []string) {
+  flags := flag.NewFlagSet("sync-roster", flag.ExitOnError)
+  manifestPath := flags.String("manifest", db.DefaultRosterManifestPath, "path to the roster manifest")
+  dryRun := flags.Bool("dry-run", false, "report what would change without saving anything")
+  flags.Parse(args)
+
+  rosterManifest, err := db.LoadRosterManifest(*manifestPath)
+  if err != nil {
+    log.Fatalf("Error loading roster manifest %s: %s", *manifestPath, err.Error())
+  }
+
+  database, err := db.New()
+  if err != nil {
+    log.Fatalf("Error opening database: %s", err.Error())
+  }
+  defer database.Close()
+
+  rosterDiff, err := database.SyncRoster(rosterManifest, *dryRun)
+  if err != nil {
+    log.Fatalf("Error syncing roster: %s", err.Error())
+  }
+
+  log.Printf(
+    "Roster %s (previously %s): %d added, %d updated, %d unchanged, %d not in manifest",
+    rosterDiff.RosterVersion,
+    rosterDiff.PreviousVersion.String,
+    len(rosterDiff.Added),
+    len(rosterDiff.Updated),
+    rosterDiff.NumUnchanged,
+    len(rosterDiff.Unmanaged),
+  )
+  for _, character := range rosterDiff.Added {
+    log.Printf("  + %d %s", character.CharacterID, character.CharacterName)
+  }
+  for _, change := range rosterDiff.Updated {
+    log.Printf("  ~ %d %s: %v", change.After.CharacterID, change.After.CharacterName, change.ChangedFields)
+  }
+  for _, character := range rosterDiff.Unmanaged {
+    log.Printf("  ? %d %s", character.CharacterID, character.CharacterName)
+  }
+  if rosterDiff.DryRun {
+    log.Printf("Dry run; no changes were saved")
+  }
+
+  // Also print the full diff for anything that wants to consume it
+  encoder := json.NewEncoder(os.Stdout)
+  encoder.SetIndent("", "  ")
+  encoder.Encode(rosterDiff)
+}
@@ -10,6 +10,12 @@ import (
 
 
 func main() {
+  // Maintenance subcommands run instead of the server
+  if len(os.Args) > 1 {
+    runCommand(os.Args[1], os.Args[2:])
+    return
+  }
+
   port := os.Getenv("PORT")
   if port == "" {
     log.Fatal("$PORT must be set")
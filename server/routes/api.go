@@ -1,7 +1,14 @@
 package routes
 
 import (
+  "context"
+  "database/sql"
+  "fmt"
+  "log"
   "net/http"
+  "strings"
+
+  "github.com/cakebin/smush/server/services/db"
 )
 
 
@@ -17,6 +24,120 @@ type Response struct {
 }
 
 
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// getUserIDFromAccessToken gets the ID of the logged in user making the request from
+// their access token cookie, or from their api token if they sent one instead
+func getUserIDFromAccessToken(services *Services, req *http.Request) (int64, error) {
+  apiToken := getAPIToken(req)
+  if apiToken != nil {
+    return apiToken.UserID, nil
+  }
+
+  accessCookie, err := req.Cookie(accessTokenCookieName)
+  if err != nil {
+    return 0, err
+  }
+
+  return services.Auth.GetUserIDFromJWTToken(accessCookie.Value)
+}
+
+
+// checkPermission makes sure the logged in user has a given permission through one
+// of their roles. Writes the error response and returns false otherwise
+func checkPermission(services *Services, res http.ResponseWriter, req *http.Request, permissionName string) bool {
+  userID, err := getUserIDFromAccessToken(services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return false
+  }
+
+  hasPermission, err := services.Auth.HasPermission(req.Context(), userID, permissionName)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user permissions from db: %s", err.Error()), http.StatusInternalServerError)
+    return false
+  }
+  if !hasPermission {
+    http.Error(res, fmt.Sprintf("User not authorized; missing permission %s", permissionName), http.StatusUnauthorized)
+    return false
+  }
+
+  return true
+}
+
+
+// setUserRolesAndPermissions fills in a user profile's roles and permissions. The front end
+// keeps whichever user we last sent it, so every response with the logged in user's own
+// profile needs these; otherwise role changes made since login never reach their session
+func setUserRolesAndPermissions(services *Services, req *http.Request, userProfileView *db.UserProfileView) error {
+  userRoleViews, err := services.Database.GetUserRoleViewsByUserID(userProfileView.UserID)
+  if err != nil {
+    return fmt.Errorf("Error fetching user roles from database: %s", err.Error())
+  }
+  userProfileView.UserRoles = userRoleViews
+
+  userPermissionNames, err := services.Auth.GetPermissionNames(req.Context(), userProfileView.UserID)
+  if err != nil {
+    return fmt.Errorf("Error fetching user permissions from database: %s", err.Error())
+  }
+  userProfileView.UserPermissions = userPermissionNames
+
+  return nil
+}
+
+
+// apiTokenKey is the context key for the api token a request was authenticated with
+type apiTokenKey struct{}
+
+
+// getBearerToken gets the token from a request's "Authorization: Bearer" header, if it has one
+func getBearerToken(req *http.Request) (string, bool) {
+  authorization := req.Header.Get("Authorization")
+  if !strings.HasPrefix(authorization, "Bearer ") {
+    return "", false
+  }
+
+  token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+  return token, token != ""
+}
+
+
+// getAPIToken gets the api token a request was authenticated with;
+// nil when the request came from a logged in browser instead
+func getAPIToken(req *http.Request) *db.APIToken {
+  apiToken, _ := req.Context().Value(apiTokenKey{}).(*db.APIToken)
+  return apiToken
+}
+
+
+// checkAPIToken makes sure an api token is active and has a given scope, and records that it was used.
+// Writes the error response and returns false otherwise
+func checkAPIToken(services *Services, res http.ResponseWriter, token string, scope string) (*db.APIToken, bool) {
+  apiToken, err := services.Database.GetAPITokenByHashedToken(services.Auth.HashSecretToken(token))
+  if err == sql.ErrNoRows {
+    http.Error(res, "API token is invalid, expired, or revoked", http.StatusUnauthorized)
+    return nil, false
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting API token from database: %s", err.Error()), http.StatusInternalServerError)
+    return nil, false
+  }
+
+  if !apiToken.HasScope(scope) {
+    http.Error(res, fmt.Sprintf("API token not authorized; missing scope %s", scope), http.StatusForbidden)
+    return nil, false
+  }
+
+  err = services.Database.UpdateAPITokenLastUsed(apiToken.APITokenID)
+  if err != nil {
+    log.Printf("Error updating last use of API token %d: %s", apiToken.APITokenID, err.Error())
+  }
+
+  return apiToken, true
+}
+
+
 /*---------------------------------
              Router
 ----------------------------------*/
@@ -30,24 +151,75 @@ type APIRouter struct {
   UserRouter       *UserRouter
   CharacterRouter  *CharacterRouter
   TagRouter        *TagRouter
+  StageRouter      *StageRouter
+  StatsRouter      *StatsRouter
+  OpponentRouter   *OpponentRouter
+  RoleRouter       *RoleRouter
+  AdminRouter      *AdminRouter
+  PublicRouter     *PublicRouter
+  ShareRouter      *ShareRouter
+  APITokenRouter   *APITokenRouter
+  LiveRouter       *LiveRouter
+  FeedRouter       *FeedRouter
+  TeamRouter       *TeamRouter
 }
 
 
 
 func (r *APIRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  req = withRequestID(res, req)
+
   var head string
   head, req.URL.Path = ShiftPath(req.URL.Path)
 
+  // Browsers send our cookies along with requests other sites make, but never an Authorization
+  // header; so everything but api token requests has to pass the CSRF check
+  bearerToken, hasBearerToken := getBearerToken(req)
+  ensureCSRFCookie(res, req)
+  if !hasBearerToken && !checkCSRFToken(res, req) {
+    return
+  }
+
   if head == "auth" {
     r.AuthRouter.ServeHTTP(res, req)
     return
   }
 
+  // Public profiles and share links are readable without logging in
+  if head == "public" {
+    r.PublicRouter.ServeHTTP(res, req)
+    return
+  }
+
+  // Stream overlays can't send cookies or headers, so live sessions check their own api token on upgrade
+  if head == "live" {
+    r.LiveRouter.ServeHTTP(res, req)
+    return
+  }
+
   /*-----------------------------------------
          API Route Authentication
   ------------------------------------------*/
+  // Scripts and bots send a personal api token instead of the auth cookies
+  if hasBearerToken {
+    requiredScope, ok := getAPITokenScope(head, req.Method)
+    if !ok {
+      http.Error(res, fmt.Sprintf("API tokens can't be used for %s /api/%s", req.Method, head), http.StatusForbidden)
+      return
+    }
+
+    apiToken, ok := checkAPIToken(r.Services, res, bearerToken, requiredScope)
+    if !ok {
+      return
+    }
+
+    req = req.WithContext(context.WithValue(req.Context(), apiTokenKey{}, apiToken))
+    r.serveAuthorized(res, req, head)
+    return
+  }
+
   // Check the access token
-  accessCookie, err := req.Cookie("smush-access-token")
+  accessCookie, err := req.Cookie(accessTokenCookieName)
 
   // If the access token exists, check the token value
   if err == nil {
@@ -63,6 +235,15 @@ func (r *APIRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  r.serveAuthorized(res, req, head)
+}
+
+
+// serveAuthorized hands an authorized request off to the right sub api-router
+func (r *APIRouter) serveAuthorized(res http.ResponseWriter, req *http.Request, head string) {
+  // Permissions are looked up at most once per request
+  req = req.WithContext(r.Services.Auth.WithPermissionCache(req.Context()))
+
   // Once we're authorized, allow api requests
   switch head {
   case "match":
@@ -73,6 +254,24 @@ func (r *APIRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     r.CharacterRouter.ServeHTTP(res, req)
   case "tag":
     r.TagRouter.ServeHTTP(res, req)
+  case "stage":
+    r.StageRouter.ServeHTTP(res, req)
+  case "stats":
+    r.StatsRouter.ServeHTTP(res, req)
+  case "opponent":
+    r.OpponentRouter.ServeHTTP(res, req)
+  case "role":
+    r.RoleRouter.ServeHTTP(res, req)
+  case "admin":
+    r.AdminRouter.ServeHTTP(res, req)
+  case "share":
+    r.ShareRouter.ServeHTTP(res, req)
+  case "token":
+    r.APITokenRouter.ServeHTTP(res, req)
+  case "feed":
+    r.FeedRouter.ServeHTTP(res, req)
+  case "team":
+    r.TeamRouter.ServeHTTP(res, req)
   default:
     http.Error(res, "404 Not Found", http.StatusNotFound)
   }
@@ -90,6 +289,17 @@ func NewAPIRouter(routerServices *Services) *APIRouter {
   router.UserRouter = NewUserRouter(routerServices)
   router.CharacterRouter = NewCharacterRouter(routerServices)
   router.TagRouter = NewTagRouter(routerServices)
+  router.StageRouter = NewStageRouter(routerServices)
+  router.StatsRouter = NewStatsRouter(routerServices)
+  router.OpponentRouter = NewOpponentRouter(routerServices)
+  router.RoleRouter = NewRoleRouter(routerServices)
+  router.AdminRouter = NewAdminRouter(routerServices)
+  router.PublicRouter = NewPublicRouter(routerServices)
+  router.ShareRouter = NewShareRouter(routerServices)
+  router.APITokenRouter = NewAPITokenRouter(routerServices)
+  router.LiveRouter = NewLiveRouter(routerServices)
+  router.FeedRouter = NewFeedRouter(routerServices)
+  router.TeamRouter = NewTeamRouter(routerServices)
 
   return router
 }
@@ -0,0 +1,73 @@
+package routes
+
+import (
+  "fmt"
+  "net/http"
+  "net/url"
+  "strconv"
+)
+
+
+// parsePaging reads the page (starting at 1) and page size for the admin
+// searches from the query string (i.e. ?page=2&pageSize=50)
+func parsePaging(query url.Values, defaultPageSize int64, maxPageSize int64) (int64, int64, error) {
+  page := int64(1)
+  if query.Get("page") != "" {
+    parsedPage, err := strconv.ParseInt(query.Get("page"), 10, 64)
+    if err != nil || parsedPage < 1 {
+      return 0, 0, fmt.Errorf("invalid page %s", query.Get("page"))
+    }
+    page = parsedPage
+  }
+
+  pageSize := defaultPageSize
+  if query.Get("pageSize") != "" {
+    parsedPageSize, err := strconv.ParseInt(query.Get("pageSize"), 10, 64)
+    if err != nil || parsedPageSize < 1 || parsedPageSize > maxPageSize {
+      return 0, 0, fmt.Errorf("invalid pageSize %s; must be between 1 and %d", query.Get("pageSize"), maxPageSize)
+    }
+    pageSize = parsedPageSize
+  }
+
+  return page, pageSize, nil
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// AdminRouter is responsible for serving "/api/admin" or delegating to the
+// appropriate admin sub router; each sub router checks its own permission
+type AdminRouter struct {
+  Services          *Services
+  AdminUserRouter   *AdminUserRouter
+  AdminAuditRouter  *AdminAuditRouter
+}
+
+
+func (r *AdminRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch head {
+  case "users":
+    r.AdminUserRouter.ServeHTTP(res, req)
+  case "audit":
+    r.AdminAuditRouter.ServeHTTP(res, req)
+  default:
+    http.Error(res, "404 Not Found", http.StatusNotFound)
+  }
+}
+
+
+// NewAdminRouter makes a new api/admin router and hooks up its services
+func NewAdminRouter(routerServices *Services) *AdminRouter {
+  router := new(AdminRouter)
+
+  router.Services = routerServices
+  router.AdminUserRouter = NewAdminUserRouter(routerServices)
+  router.AdminAuditRouter = NewAdminAuditRouter(routerServices)
+
+  return router
+}
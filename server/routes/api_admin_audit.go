@@ -0,0 +1,176 @@
+package routes
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "time"
+
+  "github.com/cakebin/smush/server/services/auth"
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+// The page size we use for audit logs when the client doesn't ask for one, and the most we'll send at once
+const (
+  defaultAuditLogPageSize = 50
+  maxAuditLogPageSize     = 200
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// AdminAuditSearchResponseData is the data we send back
+// after successfully searching through the audit log
+type AdminAuditSearchResponseData struct {
+  AuditLogs       []*db.AuditLog  `json:"auditLogs"`
+  TotalAuditLogs  int64           `json:"totalAuditLogs"`
+  Page            int64           `json:"page"`
+  PageSize        int64           `json:"pageSize"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// AdminAuditRouter is responsible for serving "/api/admin/audit";
+// everything here needs the audit:view permission
+type AdminAuditRouter struct {
+  Services  *Services
+}
+
+
+func (r *AdminAuditRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  if !checkPermission(r.Services, res, req, auth.PermissionViewAudit) {
+    return
+  }
+
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "search":
+      r.handleSearch(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewAdminAuditRouter makes a new api/admin/audit router and hooks up its services
+func NewAdminAuditRouter(routerServices *Services) *AdminAuditRouter {
+  router := new(AdminAuditRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *AdminAuditRouter) handleSearch(res http.ResponseWriter, req *http.Request) {
+  auditLogFilter, err := parseAuditLogFilter(req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid search: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  auditLogs, totalAuditLogs, err := r.Services.Database.GetAuditLogs(auditLogFilter)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error searching audit log in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     AdminAuditSearchResponseData{
+      AuditLogs:       auditLogs,
+      TotalAuditLogs:  totalAuditLogs,
+      Page:            auditLogFilter.Page,
+      PageSize:        auditLogFilter.PageSize,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// parseAuditLogFilter reads the filters and paging for admin/audit/search from the query string
+// (i.e. ?actor=3&entityType=match&entityId=12&from=2020-01-01T00:00:00Z&to=2020-02-01T00:00:00Z)
+func parseAuditLogFilter(req *http.Request) (*db.AuditLogFilter, error) {
+  auditLogFilter := new(db.AuditLogFilter)
+  query := req.URL.Query()
+
+  actorUserID, err := parseOptionalID(query.Get("actor"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid actor %s", query.Get("actor"))
+  }
+  auditLogFilter.ActorUserID = actorUserID
+
+  auditLogFilter.EntityType = query.Get("entityType")
+  entityID, err := parseOptionalID(query.Get("entityId"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid entityId %s", query.Get("entityId"))
+  }
+  auditLogFilter.EntityID = entityID
+
+  from, err := parseOptionalTime(query.Get("from"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid from %s; must be an RFC 3339 time", query.Get("from"))
+  }
+  auditLogFilter.From = from
+
+  to, err := parseOptionalTime(query.Get("to"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid to %s; must be an RFC 3339 time", query.Get("to"))
+  }
+  auditLogFilter.To = to
+
+  page, pageSize, err := parsePaging(query, defaultAuditLogPageSize, maxAuditLogPageSize)
+  if err != nil {
+    return nil, err
+  }
+  auditLogFilter.Page = page
+  auditLogFilter.PageSize = pageSize
+
+  return auditLogFilter, nil
+}
+
+
+// parseOptionalTime parses an RFC 3339 time from a query param, treating an empty param as null
+func parseOptionalTime(param string) (db.NullTimeJSON, error) {
+  nullTime := db.NullTimeJSON{}
+  if param == "" {
+    return nullTime, nil
+  }
+
+  parsedTime, err := time.Parse(time.RFC3339, param)
+  if err != nil {
+    return nullTime, err
+  }
+
+  nullTime.Valid = true
+  nullTime.Time = parsedTime
+
+  return nullTime, nil
+}
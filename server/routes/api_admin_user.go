@@ -0,0 +1,525 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strconv"
+
+  "github.com/cakebin/smush/server/services/auth"
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+// The page size we use for users when the client doesn't ask for one, and the most we'll send at once
+const (
+  defaultAdminUserPageSize = 25
+  maxAdminUserPageSize     = 100
+)
+
+
+/*---------------------------------
+          Request Data
+----------------------------------*/
+
+// AdminUserRequestData describes the data we're expecting
+// for any admin action on a single user
+type AdminUserRequestData struct {
+  UserID  int64  `json:"userId"`
+}
+
+
+// AdminUserDeleteRequestData describes the data we're expecting when an admin deletes a user;
+// soft deletes hide the user but keep their data, hard deletes remove the user and their matches
+type AdminUserDeleteRequestData struct {
+  UserID  int64  `json:"userId"`
+  Hard    bool   `json:"hard"`
+}
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// AdminUserSearchResponseData is the data we send back
+// after successfully searching through users
+type AdminUserSearchResponseData struct {
+  Users       []*db.AdminUserView  `json:"users"`
+  TotalUsers  int64                `json:"totalUsers"`
+  Page        int64                `json:"page"`
+  PageSize    int64                `json:"pageSize"`
+}
+
+
+// AdminUserResponseData is the data we send back after
+// successfully getting or changing a single user
+type AdminUserResponseData struct {
+  User  *db.AdminUserView  `json:"user"`
+}
+
+
+// AdminUserDeleteResponseData is the data we send
+// back after successfully deleting a user
+type AdminUserDeleteResponseData struct {
+  UserID  int64  `json:"userId"`
+  Hard    bool   `json:"hard"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// AdminUserRouter is responsible for serving "/api/admin/users";
+// everything here needs the users:manage permission
+type AdminUserRouter struct {
+  Services  *Services
+}
+
+
+func (r *AdminUserRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  if !checkPermission(r.Services, res, req, auth.PermissionManageUsers) {
+    return
+  }
+
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "search":
+      r.handleSearch(res, req)
+    case "get":
+      r.handleGetByID(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "disable":
+      r.handleSetDisabled(res, req, true)
+    case "enable":
+      r.handleSetDisabled(res, req, false)
+    case "roles":
+      r.handleSetRoles(res, req)
+    case "logout":
+      r.handleLogout(res, req)
+    case "reset-password":
+      r.handleResetPassword(res, req)
+    case "reset-two-factor":
+      r.handleResetTwoFactor(res, req)
+    case "delete":
+      r.handleDelete(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewAdminUserRouter makes a new api/admin/users router and hooks up its services
+func NewAdminUserRouter(routerServices *Services) *AdminUserRouter {
+  router := new(AdminUserRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *AdminUserRouter) handleSearch(res http.ResponseWriter, req *http.Request) {
+  adminUserFilter, err := parseAdminUserFilter(req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid search: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  adminUserViews, totalUsers, err := r.Services.Database.GetAdminUserViews(adminUserFilter)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error searching users in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     AdminUserSearchResponseData{
+      Users:       adminUserViews,
+      TotalUsers:  totalUsers,
+      Page:        adminUserFilter.Page,
+      PageSize:    adminUserFilter.PageSize,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *AdminUserRouter) handleGetByID(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  userID, err := strconv.ParseInt(head, 10, 64)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid user id: %s", head), http.StatusBadRequest)
+    return
+  }
+
+  adminUserView, ok := r.getAdminUserView(res, userID)
+  if !ok {
+    return
+  }
+
+  r.sendAdminUserView(res, adminUserView)
+}
+
+
+func (r *AdminUserRouter) handleSetDisabled(res http.ResponseWriter, req *http.Request, disabled bool) {
+  adminUserRequestData, ok := r.decodeOtherUser(res, req)
+  if !ok {
+    return
+  }
+
+  existingAdminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+
+  userDisabledUpdate := new(db.UserDisabledUpdate)
+  userDisabledUpdate.UserID = adminUserRequestData.UserID
+  userDisabledUpdate.Disabled = disabled
+  _, err := r.Services.Database.UpdateUserDisabled(userDisabledUpdate)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d does not exist or has been deleted", adminUserRequestData.UserID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Disabled users shouldn't be able to keep refreshing their current session either
+  if disabled {
+    err = clearUserRefreshToken(r.Services, adminUserRequestData.UserID)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error removing refresh token from database: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+  }
+
+  action := auditActionEnable
+  if disabled {
+    action = auditActionDisable
+  }
+  adminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+  recordAudit(r.Services, req, action, auditEntityUser, adminUserView.UserID, existingAdminUserView, adminUserView)
+
+  r.sendAdminUserView(res, adminUserView)
+}
+
+
+func (r *AdminUserRouter) handleSetRoles(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  userRoleSet := new(db.UserRoleSet)
+
+  err := decoder.Decode(userRoleSet)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Changing roles is also gated by roles:manage, like the rest of api/role
+  if !checkPermission(r.Services, res, req, auth.PermissionManageRoles) {
+    return
+  }
+  // Otherwise an admin could take away their own roles:manage, and leave no one who can give it back
+  if !r.checkOtherUser(res, req, userRoleSet.UserID) {
+    return
+  }
+
+  existingAdminUserView, ok := r.getAdminUserView(res, userRoleSet.UserID)
+  if !ok {
+    return
+  }
+
+  err = r.Services.Database.SetUserRoles(userRoleSet)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error setting user roles in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  adminUserView, ok := r.getAdminUserView(res, userRoleSet.UserID)
+  if !ok {
+    return
+  }
+  recordAudit(r.Services, req, auditActionSetRoles, auditEntityUser, adminUserView.UserID, existingAdminUserView, adminUserView)
+
+  r.sendAdminUserView(res, adminUserView)
+}
+
+
+func (r *AdminUserRouter) handleLogout(res http.ResponseWriter, req *http.Request) {
+  adminUserRequestData, ok := r.decodeOtherUser(res, req)
+  if !ok {
+    return
+  }
+
+  existingAdminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+
+  // Without their refresh token, the user gets logged out as soon as their access token expires
+  err := clearUserRefreshToken(r.Services, adminUserRequestData.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error removing refresh token from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  adminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+  recordAudit(r.Services, req, auditActionLogout, auditEntityUser, adminUserView.UserID, existingAdminUserView, adminUserView)
+
+  r.sendAdminUserView(res, adminUserView)
+}
+
+
+func (r *AdminUserRouter) handleResetPassword(res http.ResponseWriter, req *http.Request) {
+  adminUserRequestData, ok := r.decodeOtherUser(res, req)
+  if !ok {
+    return
+  }
+
+  adminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+
+  // Log them out too, so whoever has their current session has to use the new password
+  err := clearUserRefreshToken(r.Services, adminUserView.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error removing refresh token from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  success, err := sendResetPasswordEmail(r.Services, adminUserView.UserID, adminUserView.EmailAddress)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error when attempting to send reset password email: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionResetPassword, auditEntityUser, adminUserView.UserID, nil, nil)
+
+  response := &Response{
+    Success:  success,
+    Error:    nil,
+    Data:     AdminUserResponseData{
+      User:  adminUserView,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *AdminUserRouter) handleResetTwoFactor(res http.ResponseWriter, req *http.Request) {
+  adminUserRequestData, ok := r.decodeOtherUser(res, req)
+  if !ok {
+    return
+  }
+
+  existingAdminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+
+  // For users who've lost both their authenticator and their recovery codes;
+  // this turns two-factor off and throws away their secret and recovery codes
+  _, err := r.Services.Database.ResetUserTwoFactor(adminUserRequestData.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error resetting two-factor auth in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  adminUserView, ok := r.getAdminUserView(res, adminUserRequestData.UserID)
+  if !ok {
+    return
+  }
+  recordAudit(r.Services, req, auditActionResetTwoFactor, auditEntityUser, adminUserView.UserID, existingAdminUserView, adminUserView)
+
+  r.sendAdminUserView(res, adminUserView)
+}
+
+
+func (r *AdminUserRouter) handleDelete(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  adminUserDeleteRequestData := new(AdminUserDeleteRequestData)
+
+  err := decoder.Decode(adminUserDeleteRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+  if !r.checkOtherUser(res, req, adminUserDeleteRequestData.UserID) {
+    return
+  }
+
+  existingAdminUserView, ok := r.getAdminUserView(res, adminUserDeleteRequestData.UserID)
+  if !ok {
+    return
+  }
+
+  var deletedUserID int64
+  if adminUserDeleteRequestData.Hard {
+    deletedUserID, err = r.Services.Database.DeleteUserByUserID(adminUserDeleteRequestData.UserID)
+  } else {
+    deletedUserID, err = r.Services.Database.SoftDeleteUserByUserID(adminUserDeleteRequestData.UserID)
+  }
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d does not exist or has already been deleted", adminUserDeleteRequestData.UserID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Soft deleted users are still around, so record what they look like now
+  var deletedAdminUserView *db.AdminUserView
+  if !adminUserDeleteRequestData.Hard {
+    deletedAdminUserView, ok = r.getAdminUserView(res, deletedUserID)
+    if !ok {
+      return
+    }
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityUser, deletedUserID, existingAdminUserView, deletedAdminUserView)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     AdminUserDeleteResponseData{
+      UserID:  deletedUserID,
+      Hard:    adminUserDeleteRequestData.Hard,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// parseAdminUserFilter reads the search and paging for admin/users/search
+// from the query string (i.e. ?q=cake&page=2&pageSize=50&includeDeleted=true)
+func parseAdminUserFilter(req *http.Request) (*db.AdminUserFilter, error) {
+  adminUserFilter := new(db.AdminUserFilter)
+  query := req.URL.Query()
+
+  adminUserFilter.Search = query.Get("q")
+  adminUserFilter.IncludeDeleted = query.Get("includeDeleted") == "true"
+
+  page, pageSize, err := parsePaging(query, defaultAdminUserPageSize, maxAdminUserPageSize)
+  if err != nil {
+    return nil, err
+  }
+  adminUserFilter.Page = page
+  adminUserFilter.PageSize = pageSize
+
+  return adminUserFilter, nil
+}
+
+
+// clearUserRefreshToken removes a user's stored refresh token,
+// so their current session can't be refreshed anymore
+func clearUserRefreshToken(services *Services, userID int64) error {
+  userRefreshUpdate := new(db.UserRefreshUpdate)
+  userRefreshUpdate.UserID = userID
+  userRefreshUpdate.RefreshToken = ""
+
+  _, err := services.Database.UpdateUserRefreshToken(userRefreshUpdate)
+  return err
+}
+
+
+// decodeOtherUser decodes an AdminUserRequestData and makes sure it isn't for the admin making
+// the request. Writes the error response and returns false otherwise
+func (r *AdminUserRouter) decodeOtherUser(res http.ResponseWriter, req *http.Request) (*AdminUserRequestData, bool) {
+  decoder := json.NewDecoder(req.Body)
+  adminUserRequestData := new(AdminUserRequestData)
+
+  err := decoder.Decode(adminUserRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return nil, false
+  }
+
+  return adminUserRequestData, r.checkOtherUser(res, req, adminUserRequestData.UserID)
+}
+
+
+// checkOtherUser makes sure admins don't disable, log out, delete or change the roles of themselves by accident.
+// Writes the error response and returns false otherwise
+func (r *AdminUserRouter) checkOtherUser(res http.ResponseWriter, req *http.Request, userID int64) bool {
+  adminUserID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return false
+  }
+  if adminUserID == userID {
+    http.Error(res, fmt.Sprintf("Admins can't do this to their own account"), http.StatusBadRequest)
+    return false
+  }
+
+  return true
+}
+
+
+// getAdminUserView gets a user's admin view. Writes the error
+// response and returns false if we can't get it
+func (r *AdminUserRouter) getAdminUserView(res http.ResponseWriter, userID int64) (*db.AdminUserView, bool) {
+  adminUserView, err := r.Services.Database.GetAdminUserViewByUserID(userID)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d does not exist", userID), http.StatusNotFound)
+    return nil, false
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user from database: %s", err.Error()), http.StatusInternalServerError)
+    return nil, false
+  }
+
+  return adminUserView, true
+}
+
+
+// sendAdminUserView sends back a single user's admin view
+func (r *AdminUserRouter) sendAdminUserView(res http.ResponseWriter, adminUserView *db.AdminUserView) {
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     AdminUserResponseData{
+      User:  adminUserView,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
@@ -1,18 +1,30 @@
 package routes
 
 import (
+  "crypto/subtle"
   "database/sql"
   "encoding/json"
   "fmt"
+  "log"
   "net/http"
   "strconv"
+  "strings"
   "time"
 
+  "github.com/cakebin/smush/server/services/auth"
   "github.com/cakebin/smush/server/services/db"
   "github.com/cakebin/smush/server/services/email"
 )
 
 
+// How many wrong two-factor codes in a row a user can send while logging in,
+// and how long they're locked out of the second step of logging in after that
+const (
+  maxTwoFactorAttempts  = 5
+  twoFactorLockout      = 15 * time.Minute
+)
+
+
 /*---------------------------------
           Request Data
 ----------------------------------*/
@@ -61,6 +73,31 @@ type ResetPasswordRequestData struct {
   NewPassword  string  `json:"newPassword"`
 }
 
+
+// LoginTwoFactorRequestData describes the data we're expecting for the second step of logging in
+// with two-factor auth on; either a code from the user's authenticator app or one of their recovery codes
+type LoginTwoFactorRequestData struct {
+  TwoFactorToken  string  `json:"twoFactorToken"`
+  Code            string  `json:"code"`
+  RecoveryCode    string  `json:"recoveryCode"`
+}
+
+
+// ChangePasswordRequestData describes the data we're expecting
+// when a logged in user changes their password
+type ChangePasswordRequestData struct {
+  CurrentPassword  string  `json:"currentPassword"`
+  NewPassword      string  `json:"newPassword"`
+}
+
+
+// OIDCCallbackRequestData describes the data we're expecting when the front end passes
+// along what the OpenID Connect provider sent back after a user logged in with it
+type OIDCCallbackRequestData struct {
+  Code   string  `json:"code"`
+  State  string  `json:"state"`
+}
+
 /*---------------------------------
           Response Data
 ----------------------------------*/
@@ -75,6 +112,15 @@ type LoginResponseData struct {
 }
 
 
+// LoginTwoFactorResponseData is the data we send back after the first step of logging in when
+// a user has two-factor auth on; the token has to be sent back along with their code
+type LoginTwoFactorResponseData struct {
+  TwoFactorRequired    bool       `json:"twoFactorRequired"`
+  TwoFactorToken       string     `json:"twoFactorToken"`
+  TwoFactorExpiration  time.Time  `json:"twoFactorExpiration"`
+}
+
+
 // LogoutResponseData is the data we
 // send back after a successful log out
 type LogoutResponseData struct {
@@ -92,7 +138,112 @@ type RegisterResponseData struct {
 // RefreshResponseData is the data we
 // send back after a successful refresh
 type RefreshResponseData struct {
-  AccessExpiration  time.Time  `json:"accessExpiration"`
+  AccessExpiration  time.Time           `json:"accessExpiration"`
+  UserRoles         []*db.UserRoleView  `json:"userRoles"`
+  UserPermissions   []string            `json:"userPermissions"`
+}
+
+
+// OIDCLoginResponseData is the data we send back when a user starts
+// logging in with OpenID Connect; the front end sends them to the URL
+type OIDCLoginResponseData struct {
+  AuthorizationURL  string  `json:"authorizationUrl"`
+}
+
+
+// useTOTPCode checks a code from a user's authenticator app against their TOTP secret, and
+// records it as used so the same code can't be used again (i.e. by someone watching them type it)
+func useTOTPCode(services *Services, userTwoFactor *db.UserTwoFactor, code string) (bool, error) {
+  if !userTwoFactor.TOTPSecret.Valid {
+    return false, nil
+  }
+
+  step, ok := services.Auth.CheckTOTPCode(userTwoFactor.TOTPSecret.String, code)
+  if !ok {
+    return false, nil
+  }
+
+  totpStepUpdate := new(db.UserTOTPStepUpdate)
+  totpStepUpdate.UserID = userTwoFactor.UserID
+  totpStepUpdate.Step = step
+  _, err := services.Database.UpdateUserTOTPLastStep(totpStepUpdate)
+  if err == sql.ErrNoRows {
+    return false, nil
+  } else if err != nil {
+    return false, err
+  }
+
+  return true, nil
+}
+
+
+// checkTwoFactorLockout makes sure a user isn't locked out of two-factor log in for sending too
+// many wrong codes. Writes the error response and returns false otherwise
+func checkTwoFactorLockout(res http.ResponseWriter, userTwoFactor *db.UserTwoFactor) bool {
+  if userTwoFactor.LockedUntil.Valid && time.Now().Before(userTwoFactor.LockedUntil.Time) {
+    retryAfter := time.Until(userTwoFactor.LockedUntil.Time)
+    res.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+    http.Error(res, "Too many failed two-factor attempts; try again later", http.StatusTooManyRequests)
+    return false
+  }
+
+  return true
+}
+
+
+// rehashPassword hashes a user's password again with our current settings; the user is already
+// logged in with the old hash by now, so failing to upgrade it is only logged
+func rehashPassword(services *Services, userID int64, password string) {
+  newHashedPassword, err := services.Auth.HashPassword(password)
+  if err != nil {
+    log.Printf("Error rehashing password for userID %d: %s", userID, err.Error())
+    return
+  }
+
+  hashedPasswordUpdate := new(db.UserHashedPasswordUpdate)
+  hashedPasswordUpdate.UserID = userID
+  hashedPasswordUpdate.HashedPassword = newHashedPassword
+  _, err = services.Database.UpdateUserHashedPassword(hashedPasswordUpdate)
+  if err != nil {
+    log.Printf("Error saving rehashed password for userID %d: %s", userID, err.Error())
+  }
+}
+
+
+// sendResetPasswordEmail gives a user a new reset password token and emails them a link to use it;
+// used both for "forgot password" and when an admin forces a user to reset their password
+func sendResetPasswordEmail(services *Services, userID int64, userEmail string) (bool, error) {
+  resetPasswordRequest, err := http.NewRequest("GET", "https://smush-tracker.herokuapp.com/reset-password/token", nil)
+  if err != nil {
+    return false, err
+  }
+
+  queryParam := resetPasswordRequest.URL.Query()
+  resetExpirationTime := time.Now().Add(15 * time.Minute)
+  resetPasswordToken, err := services.Auth.GetNewJWTToken(userID, resetExpirationTime)
+  if err != nil {
+    return false, err
+  }
+
+  // Update the user's reset_password_token for validation later
+  resetPasswordUpdate := new(db.UserResetPasswordUpdate)
+  resetPasswordUpdate.UserID = userID
+  resetPasswordUpdate.ResetPasswordToken = resetPasswordToken
+  _, err = services.Database.UpdateUserResetPasswordToken(resetPasswordUpdate)
+  if err != nil {
+    return false, err
+  }
+
+  queryParam.Add("t", resetPasswordToken)
+  queryParam.Add("e", strconv.FormatInt(resetExpirationTime.Unix() * 1000, 10))
+  resetPasswordRequest.URL.RawQuery = queryParam.Encode()
+  resetURL := resetPasswordRequest.URL.String()
+
+  resetPWInfo := new(email.ResetPWInfo)
+  resetPWInfo.UserEmail = userEmail
+  resetPWInfo.ResetURL = resetURL
+
+  return services.Email.SendResetPWEmail(resetPWInfo)
 }
 
 
@@ -113,6 +264,8 @@ func (r *AuthRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
   switch head {
   case "login":
     r.handleLogin(res, req)
+  case "login-two-factor":
+    r.handleLoginTwoFactor(res, req)
   case "logout":
     r.handleLogout(res, req)
   case "register":
@@ -123,6 +276,18 @@ func (r *AuthRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     r.handleForgotPassword(res, req)
   case "reset-password":
     r.handleResetPassword(res, req)
+  case "change-password":
+    r.handleChangePassword(res, req)
+  case "oidc":
+    head, req.URL.Path = ShiftPath(req.URL.Path)
+    switch head {
+    case "login":
+      r.handleOIDCLogin(res, req)
+    case "callback":
+      r.handleOIDCCallback(res, req)
+    default:
+      http.Error(res, "404 Not found", http.StatusNotFound)
+    }
   default:
     http.Error(res, "404 Not found", http.StatusNotFound)
   }
@@ -156,7 +321,11 @@ func (r *AuthRouter) handleRefresh(res http.ResponseWriter, req *http.Request) {
   // The refresh token should not be expired, because this endpoint is only being hit
   // BEFORE the refresh token expires. If it's already expired, the front end
   // will instead take care of the logout and prompt another login.
-  refreshCookie, err := req.Cookie("smush-refresh-token")
+  refreshCookie, err := req.Cookie(refreshTokenCookieName)
+  if err != nil {
+    http.Error(res, "Session expired. Please log in again", http.StatusUnauthorized)
+    return
+  }
   _, err = r.Services.Auth.CheckJWTToken(refreshCookie.Value)
   if err != nil {
     // Refresh token is also invalid. This block should never be run in practice.
@@ -164,12 +333,24 @@ func (r *AuthRouter) handleRefresh(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  // The refresh token also has to be the one we last stored for the user; it gets
+  // cleared when they log out, or when an admin logs them out or disables them
+  currentRefreshToken, err := r.Services.Database.GetUserRefreshTokenByUserID(refreshRequestData.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user's current refresh token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if currentRefreshToken == "" || currentRefreshToken != refreshCookie.Value {
+    http.Error(res, "Session expired. Please log in again", http.StatusUnauthorized)
+    return
+  }
+
   // Whether or not we have a cookie, the new/updated one will need an expiration time of five minutes from now
   newExpirationTime := time.Now().Add(5 * time.Minute)
 
   // Check the access token to see if we need a new cookie. We DON'T need to check the access token value.
   // It won't have a value if it's already expired (we won't be sent one to update)
-  accessCookie, err := req.Cookie("smush-access-token")
+  accessCookie, err := req.Cookie(accessTokenCookieName)
 
   if err != nil {
     // We DO NOT HAVE A COOKIE ANYMORE! So we need to make a new one.
@@ -178,15 +359,7 @@ func (r *AuthRouter) handleRefresh(res http.ResponseWriter, req *http.Request) {
       http.Error(res, fmt.Sprintf("Error creating new access token: %s", err.Error()), http.StatusInternalServerError)
       return
     }
-    http.SetCookie(
-      res,
-      &http.Cookie{
-        Name:    "smush-access-token",
-        Value:   accessTokenStr,
-        Expires: newExpirationTime,
-        Path:    "/api/",
-      },
-    )
+    setAuthCookie(res, accessTokenCookieName, accessTokenStr, newExpirationTime)
   } else {
     // We DO HAVE A COOKIE! Update the existing one!
     newAccessToken, err := r.Services.Auth.RefreshJWTAccessToken(accessCookie.Value, newExpirationTime)
@@ -194,15 +367,20 @@ func (r *AuthRouter) handleRefresh(res http.ResponseWriter, req *http.Request) {
       http.Error(res, fmt.Sprintf("Error updating existing access token: %s", err.Error()), http.StatusInternalServerError)
       return
     }
-    http.SetCookie(
-      res,
-      &http.Cookie{
-        Name:    "smush-access-token",
-        Value:   newAccessToken,
-        Expires: newExpirationTime,
-        Path:    "/api/",
-      },
-    )
+    setAuthCookie(res, accessTokenCookieName, newAccessToken, newExpirationTime)
+  }
+
+  // Send the user's current roles along too, so role changes made since they
+  // logged in reach their session instead of waiting for the next login
+  userRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(refreshRequestData.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user roles from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  userPermissionNames, err := r.Services.Auth.GetPermissionNames(req.Context(), refreshRequestData.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user permissions from database: %s", err.Error()), http.StatusInternalServerError)
+    return
   }
 
   // We are finally done! Send a new Response with the updated expiration time
@@ -211,6 +389,8 @@ func (r *AuthRouter) handleRefresh(res http.ResponseWriter, req *http.Request) {
     Error:    nil,
     Data:     RefreshResponseData{
       AccessExpiration:  newExpirationTime,
+      UserRoles:         userRoleViews,
+      UserPermissions:   userPermissionNames,
     },
   }
 
@@ -245,88 +425,110 @@ func (r *AuthRouter) handleLogin(res http.ResponseWriter, req *http.Request) {
     http.Error(res, "Invalid email/password", http.StatusUnauthorized)
     return
   }
-
-  // Short lifespan access token
-  accessExpiration := time.Now().Add(5 * time.Minute)
-  accessTokenStr, err := r.Services.Auth.GetNewJWTToken(userCredentialsView.UserID, accessExpiration)
-  if err != nil {
-    http.Error(res, fmt.Sprintf("Error creating new access token: %s", err.Error()), http.StatusInternalServerError)
+  if userCredentialsView.Disabled {
+    http.Error(res, "This account has been disabled", http.StatusForbidden)
     return
   }
 
-  // Longer lifespan refresh token
-  refreshExpiration := time.Now().Add(time.Hour * 24)
-  refreshTokenStr, err := r.Services.Auth.GetNewJWTToken(userCredentialsView.UserID, refreshExpiration)
-  if err != nil {
-    http.Error(res, fmt.Sprintf("Error creating new refresh token: %s", err.Error()), http.StatusInternalServerError)
+  // We have the plain password now, so this is our chance to move an older or weaker hash to our preferred algorithm
+  if r.Services.Auth.PasswordNeedsRehash(userCredentialsView.HashedPassword) {
+    rehashPassword(r.Services, userCredentialsView.UserID, loginRequestData.Password)
+  }
+
+  // Users with two-factor auth on don't get logged in until they've also sent a code
+  if userCredentialsView.TwoFactorEnabled {
+    r.sendTwoFactorRequired(res, userCredentialsView.UserID)
     return
   }
 
-  // Also store this refresh token in the user table
-  userRefreshUpdate := new(db.UserRefreshUpdate)
-  userRefreshUpdate.UserID = userCredentialsView.UserID
-  userRefreshUpdate.RefreshToken = refreshTokenStr
+  r.completeLogin(res, req, userCredentialsView.UserID)
+}
 
-  _, err = r.Services.Database.UpdateUserRefreshToken(userRefreshUpdate)
+
+func (r *AuthRouter) handleLoginTwoFactor(res http.ResponseWriter, req *http.Request) {
+  var loginTwoFactorRequestData LoginTwoFactorRequestData
+  decoder := json.NewDecoder(req.Body)
+  err := decoder.Decode(&loginTwoFactorRequestData)
   if err != nil {
-    http.Error(res, fmt.Sprintf("Error adding new refresh token to database: %s", err.Error()), http.StatusInternalServerError)
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
     return
   }
 
-  http.SetCookie(
-    res,
-    &http.Cookie{
-      Name:    "smush-access-token",
-      Value:   accessTokenStr,
-      Expires: accessExpiration,
-      Path:    "/api/",
-    },
-  )
-  http.SetCookie(
-    res,
-    &http.Cookie{
-      Name:    "smush-refresh-token",
-      Value:   refreshTokenStr,
-      Expires: refreshExpiration,
-      Path:    "/api/",
-    },
-  )
-
-  // Get the basic user profile information
-  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userCredentialsView.UserID)
+  userID, err := r.Services.Auth.GetUserIDFromScopedJWTToken(loginTwoFactorRequestData.TwoFactorToken, auth.ScopeTwoFactor)
   if err != nil {
-    http.Error(res, fmt.Sprintf("Could not get user data for id %d: %s", userCredentialsView.UserID, err.Error()), http.StatusBadRequest)
+    http.Error(res, "Two-factor log in has expired. Please log in again", http.StatusUnauthorized)
     return
   }
 
-  // Also get the user's saved characters
-  userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userCredentialsView.UserID)
+  userTwoFactor, err := r.Services.Database.GetUserTwoFactorByUserID(userID)
   if err != nil {
-    http.Error(res, fmt.Sprintf("Error getting user's saved characters with userID %d: %s", userCredentialsView.UserID, err.Error()), http.StatusInternalServerError)
+    http.Error(res, fmt.Sprintf("Database error: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
-  // Finally get the user roles after authentication
-  userRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userCredentialsView.UserID)
-  if err != nil {
-    http.Error(res, fmt.Sprintf("Error fetching user roles from database: %s", err.Error()), http.StatusInternalServerError)
+  // The token has to be the user's latest one, and not used up yet (by logging in, or by too many wrong codes)
+  hashedLoginToken := r.Services.Auth.HashSecretToken(loginTwoFactorRequestData.TwoFactorToken)
+  if !userTwoFactor.LoginToken.Valid || subtle.ConstantTimeCompare([]byte(userTwoFactor.LoginToken.String), []byte(hashedLoginToken)) != 1 {
+    http.Error(res, "Two-factor log in has expired. Please log in again", http.StatusUnauthorized)
+    return
+  }
+  if !checkTwoFactorLockout(res, userTwoFactor) {
     return
   }
-  userProfileView.UserRoles = userRoleViews
 
-  response := &Response{
-    Success:           true,
-    Error:             nil,
-    Data:  LoginResponseData{
-      User:               userProfileView,
-      UserCharacters:     userCharViews,
-      AccessExpiration:   accessExpiration,
-      RefreshExpiration:  refreshExpiration,
-    },
+  if loginTwoFactorRequestData.RecoveryCode != "" {
+    recoveryCodeUse := new(db.RecoveryCodeUse)
+    recoveryCodeUse.UserID = userID
+    recoveryCodeUse.HashedCode = r.Services.Auth.HashRecoveryCode(loginTwoFactorRequestData.RecoveryCode)
+    _, err = r.Services.Database.UseRecoveryCode(recoveryCodeUse)
+    if err == sql.ErrNoRows {
+      r.sendTwoFactorFailure(res, userID, "Invalid recovery code")
+      return
+    } else if err != nil {
+      http.Error(res, fmt.Sprintf("Error using recovery code: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+  } else {
+    ok, err := useTOTPCode(r.Services, userTwoFactor, loginTwoFactorRequestData.Code)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error checking two-factor code: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    if !ok {
+      r.sendTwoFactorFailure(res, userID, "Invalid two-factor code")
+      return
+    }
   }
 
-  res.Header().Set("Content-Type", "application/json")
-  json.NewEncoder(res).Encode(response)
+  // Use the token up, so it can't log anyone in again
+  loginTokenUpdate := new(db.UserTwoFactorLoginTokenUpdate)
+  loginTokenUpdate.UserID = userID
+  loginTokenUpdate.HashedLoginToken = hashedLoginToken
+  _, err = r.Services.Database.UseUserTwoFactorLoginToken(loginTokenUpdate)
+  if err == sql.ErrNoRows {
+    http.Error(res, "Two-factor log in has expired. Please log in again", http.StatusUnauthorized)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error using two-factor token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // The user could have been disabled, or had their two-factor auth reset, since they sent their password
+  userCredentialsView, err := r.Services.Database.GetUserCredentialsViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Database error: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if userCredentialsView.Disabled {
+    http.Error(res, "This account has been disabled", http.StatusForbidden)
+    return
+  }
+  if !userCredentialsView.TwoFactorEnabled {
+    http.Error(res, "Two-factor log in has expired. Please log in again", http.StatusUnauthorized)
+    return
+  }
+
+  r.completeLogin(res, req, userID)
 }
 
 
@@ -345,6 +547,13 @@ func (r *AuthRouter) handleRegister(res http.ResponseWriter, req *http.Request)
     return
   }
 
+  // User names are public (i.e. public profiles are found by them), so they can't be shared either
+  _, err = r.Services.Database.GetUserIDByUserName(registerRequestData.UserName)
+  if err != sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User already exists with user name %s", registerRequestData.UserName), http.StatusBadRequest)
+    return
+  }
+
   hashedPassword, err := r.Services.Auth.HashPassword(registerRequestData.Password)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error when hashing password: %s", err.Error()), http.StatusInternalServerError)
@@ -362,6 +571,13 @@ func (r *AuthRouter) handleRegister(res http.ResponseWriter, req *http.Request)
     return
   }
 
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Could not get user data for id %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionRegister, auditEntityUser, userID, nil, userProfileView)
+
   response := &Response{
     Success: true,
     Error:   nil,
@@ -396,22 +612,7 @@ func (r *AuthRouter) handleLogout(res http.ResponseWriter, req *http.Request) {
   }
 
   // Delete existing Access/Refresh tokens in cookies
-  http.SetCookie(
-    res,
-    &http.Cookie{
-      Name:   "smush-access-token",
-      Value:  "",
-      MaxAge: -1,
-    },
-  )
-  http.SetCookie(
-    res,
-    &http.Cookie{
-      Name:   "smush-refresh-token",
-      Value:  "",
-      MaxAge: -1,
-    },
-  )
+  clearAuthCookies(res)
 
   response := &Response{
     Success: true,
@@ -442,41 +643,9 @@ func (r *AuthRouter) handleForgotPassword(res http.ResponseWriter, req *http.Req
     return
   }
 
-  resetPasswordRequest, err := http.NewRequest("GET", "https://smush-tracker.herokuapp.com/reset-password/token", nil)
+  success, err := sendResetPasswordEmail(r.Services, userID, forgotPasswordRequestData.UserEmail)
   if err != nil {
-    http.Error(res, fmt.Sprintf("Error when attempting to build reset password url: %s", err.Error()), http.StatusInternalServerError)
-    return
-  }
-
-  queryParam := resetPasswordRequest.URL.Query()
-  resetExpirationTime := time.Now().Add(15 * time.Minute)
-  resetPasswordToken, err := r.Services.Auth.GetNewJWTToken(userID, resetExpirationTime)
-  if err != nil {
-    http.Error(res, fmt.Sprintf("Error creating new access token: %s", err.Error()), http.StatusInternalServerError)
-    return
-  }
-
-  // Update the user's reset_password_token for validation later
-  resetPasswordUpdate := new(db.UserResetPasswordUpdate)
-  resetPasswordUpdate.UserID = userID
-  resetPasswordUpdate.ResetPasswordToken = resetPasswordToken
-  userID, err = r.Services.Database.UpdateUserResetPasswordToken(resetPasswordUpdate)
-  if err != nil {
-    http.Error(res, fmt.Sprintf("Error saving reset_password_token :%s for userID: %d", err.Error(), userID), http.StatusInternalServerError)
-    return
-  }
-
-  queryParam.Add("t", resetPasswordToken)
-  queryParam.Add("e", strconv.FormatInt(resetExpirationTime.Unix() * 1000, 10))
-  resetPasswordRequest.URL.RawQuery = queryParam.Encode()
-  resetURL := resetPasswordRequest.URL.String()
-
-  resetPWInfo := new(email.ResetPWInfo)
-  resetPWInfo.UserEmail = forgotPasswordRequestData.UserEmail
-  resetPWInfo.ResetURL = resetURL
-  success, err := r.Services.Email.SendResetPWEmail(resetPWInfo)
-  if err != nil {
-    http.Error(res, fmt.Sprintf("Error when attempting to send email to: %s", err.Error()), http.StatusInternalServerError)
+    http.Error(res, fmt.Sprintf("Error when attempting to send reset password email: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
@@ -549,6 +718,7 @@ func (r *AuthRouter) handleResetPassword(res http.ResponseWriter, req *http.Requ
     http.Error(res, fmt.Sprintf("Error clearing reset_password_token :%s for userID: %d", err.Error(), userID), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionResetPassword, auditEntityUser, userID, nil, nil)
 
   // Send a success response, which would have the front end prompt them to log in
   response := &Response{
@@ -559,3 +729,374 @@ func (r *AuthRouter) handleResetPassword(res http.ResponseWriter, req *http.Requ
   res.Header().Set("Content-Type", "application/json")
   json.NewEncoder(res).Encode(response)
 }
+
+
+func (r *AuthRouter) handleChangePassword(res http.ResponseWriter, req *http.Request) {
+  var changePasswordRequest ChangePasswordRequestData
+  decoder := json.NewDecoder(req.Body)
+  err := decoder.Decode(&changePasswordRequest)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+  if changePasswordRequest.NewPassword == "" {
+    http.Error(res, "New password can't be empty", http.StatusBadRequest)
+    return
+  }
+
+  // Unlike the rest of /api/auth, this is only for users who are already logged in
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, "Session expired. Please log in again", http.StatusUnauthorized)
+    return
+  }
+
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Could not get user data for id %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  userCredentialsView, err := r.Services.Database.GetUserCredentialsViewByEmail(userProfileView.EmailAddress)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Database error: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  _, err = r.Services.Auth.CheckPassword(userCredentialsView.HashedPassword, changePasswordRequest.CurrentPassword)
+  if err != nil {
+    http.Error(res, "Invalid current password", http.StatusUnauthorized)
+    return
+  }
+
+  newHashedPassword, err := r.Services.Auth.HashPassword(changePasswordRequest.NewPassword)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error when hashing new password: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  hashedPasswordUpdate := new(db.UserHashedPasswordUpdate)
+  hashedPasswordUpdate.UserID = userID
+  hashedPasswordUpdate.HashedPassword = newHashedPassword
+  userID, err = r.Services.Database.UpdateUserHashedPassword(hashedPasswordUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error when updating user's hashed password: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionChangePassword, auditEntityUser, userID, nil, nil)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *AuthRouter) handleOIDCLogin(res http.ResponseWriter, req *http.Request) {
+  if req.Method != http.MethodGet {
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+    return
+  }
+  if !r.Services.Auth.OIDCEnabled() {
+    http.Error(res, auth.ErrOIDCDisabled.Error(), http.StatusNotFound)
+    return
+  }
+
+  // The state ties the provider's response to this browser, the nonce ties the ID token
+  // to this log in, and the code verifier proves we're the ones who started it (PKCE)
+  oidcSecrets := make([]string, 0)
+  for i := 0; i < 3; i++ {
+    oidcSecret, _, err := r.Services.Auth.GetNewSecretToken()
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error generating OpenID Connect state: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    oidcSecrets = append(oidcSecrets, oidcSecret)
+  }
+  state, nonce, codeVerifier := oidcSecrets[0], oidcSecrets[1], oidcSecrets[2]
+
+  authorizationURL, err := r.Services.Auth.GetOIDCAuthorizationURL(state, nonce, codeVerifier)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting OpenID Connect authorization URL: %s", err.Error()), http.StatusBadGateway)
+    return
+  }
+  setOIDCStateCookie(res, strings.Join(oidcSecrets, "."), time.Now().Add(10 * time.Minute))
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     OIDCLoginResponseData{
+      AuthorizationURL:  authorizationURL,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *AuthRouter) handleOIDCCallback(res http.ResponseWriter, req *http.Request) {
+  if req.Method != http.MethodPost {
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+    return
+  }
+
+  var oidcCallbackRequestData OIDCCallbackRequestData
+  decoder := json.NewDecoder(req.Body)
+  err := decoder.Decode(&oidcCallbackRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Each log in attempt's state can only be used once
+  oidcStateCookie, err := req.Cookie(oidcStateCookieName)
+  clearOIDCStateCookie(res)
+  if err != nil {
+    http.Error(res, "OpenID Connect log in expired. Please try again", http.StatusUnauthorized)
+    return
+  }
+  oidcSecrets := strings.Split(oidcStateCookie.Value, ".")
+  if len(oidcSecrets) != 3 || subtle.ConstantTimeCompare([]byte(oidcSecrets[0]), []byte(oidcCallbackRequestData.State)) != 1 {
+    http.Error(res, "OpenID Connect state does not match this log in. Please try again", http.StatusUnauthorized)
+    return
+  }
+  nonce, codeVerifier := oidcSecrets[1], oidcSecrets[2]
+
+  identity, err := r.Services.Auth.ExchangeOIDCCode(oidcCallbackRequestData.Code, codeVerifier, nonce)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error verifying OpenID Connect log in: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  userIdentity, err := r.Services.Database.GetUserIdentityByIssuerAndSubject(identity.Issuer, identity.Subject)
+  if err == sql.ErrNoRows {
+    // The first time someone logs in with the provider, we link them to the user with the same
+    // email; only if the provider has verified it, or anyone could claim anyone's account
+    userIdentity, err = r.linkOIDCIdentity(res, req, identity)
+    if err != nil {
+      return
+    }
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user identity from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userCredentialsView, err := r.Services.Database.GetUserCredentialsViewByUserID(userIdentity.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Database error: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if userCredentialsView.Disabled {
+    http.Error(res, "This account has been disabled", http.StatusForbidden)
+    return
+  }
+
+  err = r.Services.Database.UpdateUserIdentityLastLogin(userIdentity.UserIdentityID)
+  if err != nil {
+    log.Printf("Error updating last log in of user identity %d: %s", userIdentity.UserIdentityID, err.Error())
+  }
+
+  // The provider stands in for the password, not the second factor
+  if userCredentialsView.TwoFactorEnabled {
+    r.sendTwoFactorRequired(res, userCredentialsView.UserID)
+    return
+  }
+
+  r.completeLogin(res, req, userCredentialsView.UserID)
+}
+
+
+// linkOIDCIdentity links an OpenID Connect identity to the existing user with its verified email.
+// Writes the error response and returns the error if it can't be linked
+func (r *AuthRouter) linkOIDCIdentity(res http.ResponseWriter, req *http.Request, identity *auth.OIDCIdentity) (*db.UserIdentity, error) {
+  if identity.EmailAddress == "" || !identity.EmailVerified {
+    err := fmt.Errorf("Your %s account has no verified email address to find your account with", identity.Issuer)
+    http.Error(res, err.Error(), http.StatusForbidden)
+    return nil, err
+  }
+
+  // Providers don't keep the case an email was registered with, so case doesn't count; if that
+  // leaves more than one account, only one typed exactly the same way can be linked
+  userCredentialsViews, err := r.Services.Database.GetUserCredentialsViewsByEmailIgnoringCase(identity.EmailAddress)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Database error: %s", err.Error()), http.StatusInternalServerError)
+    return nil, err
+  }
+  if len(userCredentialsViews) == 0 {
+    http.Error(res, fmt.Sprintf("No account uses %s; register first, then log in with %s", identity.EmailAddress, identity.Issuer), http.StatusNotFound)
+    return nil, sql.ErrNoRows
+  }
+
+  var userCredentialsView *db.UserCredentialsView
+  for _, matchingUserCredentialsView := range userCredentialsViews {
+    if matchingUserCredentialsView.EmailAddress == identity.EmailAddress {
+      userCredentialsView = matchingUserCredentialsView
+    }
+  }
+  if userCredentialsView == nil && len(userCredentialsViews) == 1 {
+    userCredentialsView = userCredentialsViews[0]
+  }
+  if userCredentialsView == nil {
+    err = fmt.Errorf("More than one account uses %s; contact the administrators to link your %s account", identity.EmailAddress, identity.Issuer)
+    http.Error(res, err.Error(), http.StatusConflict)
+    return nil, err
+  }
+
+  userIdentityCreate := new(db.UserIdentityCreate)
+  userIdentityCreate.UserID = userCredentialsView.UserID
+  userIdentityCreate.Issuer = identity.Issuer
+  userIdentityCreate.Subject = identity.Subject
+  userIdentityCreate.EmailAddress.Valid = true
+  userIdentityCreate.EmailAddress.String = identity.EmailAddress
+  userIdentityID, err := r.Services.Database.CreateUserIdentity(userIdentityCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error linking user identity in database: %s", err.Error()), http.StatusInternalServerError)
+    return nil, err
+  }
+
+  userIdentity, err := r.Services.Database.GetUserIdentityByIssuerAndSubject(identity.Issuer, identity.Subject)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user identity from database: %s", err.Error()), http.StatusInternalServerError)
+    return nil, err
+  }
+  recordAudit(r.Services, req, auditActionLinkIdentity, auditEntityUserIdentity, userIdentityID, nil, userIdentity)
+
+  return userIdentity, nil
+}
+
+
+// sendTwoFactorRequired sends back the token a user with two-factor auth on needs to finish logging in;
+// they don't get their access and refresh tokens until they've sent it back along with a code. Only the
+// latest token works, and only once
+func (r *AuthRouter) sendTwoFactorRequired(res http.ResponseWriter, userID int64) {
+  userTwoFactor, err := r.Services.Database.GetUserTwoFactorByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Database error: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !checkTwoFactorLockout(res, userTwoFactor) {
+    return
+  }
+
+  twoFactorExpiration := time.Now().Add(5 * time.Minute)
+  twoFactorTokenStr, err := r.Services.Auth.GetNewScopedJWTToken(userID, auth.ScopeTwoFactor, twoFactorExpiration)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new two-factor token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  loginTokenUpdate := new(db.UserTwoFactorLoginTokenUpdate)
+  loginTokenUpdate.UserID = userID
+  loginTokenUpdate.HashedLoginToken = r.Services.Auth.HashSecretToken(twoFactorTokenStr)
+  _, err = r.Services.Database.UpdateUserTwoFactorLoginToken(loginTokenUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error saving two-factor token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     LoginTwoFactorResponseData{
+      TwoFactorRequired:    true,
+      TwoFactorToken:       twoFactorTokenStr,
+      TwoFactorExpiration:  twoFactorExpiration,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+// sendTwoFactorFailure counts a wrong two-factor code or recovery code against a user, and tells them
+// whether they've been locked out for it; their token stops working once they are
+func (r *AuthRouter) sendTwoFactorFailure(res http.ResponseWriter, userID int64, message string) {
+  twoFactorFailure := new(db.UserTwoFactorFailure)
+  twoFactorFailure.UserID = userID
+  twoFactorFailure.MaxAttempts = maxTwoFactorAttempts
+  twoFactorFailure.LockedUntil = time.Now().Add(twoFactorLockout)
+  locked, err := r.Services.Database.RecordTwoFactorFailure(twoFactorFailure)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error recording failed two-factor attempt: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  if locked {
+    http.Error(res, fmt.Sprintf("%s. Too many failed attempts; try logging in again in %d minutes", message, int(twoFactorLockout.Minutes())), http.StatusTooManyRequests)
+    return
+  }
+
+  http.Error(res, message, http.StatusUnauthorized)
+}
+
+
+// completeLogin gives a user whose credentials all check out their access and refresh
+// tokens, and sends back everything the front end needs about them
+func (r *AuthRouter) completeLogin(res http.ResponseWriter, req *http.Request, userID int64) {
+  // Short lifespan access token
+  accessExpiration := time.Now().Add(5 * time.Minute)
+  accessTokenStr, err := r.Services.Auth.GetNewJWTToken(userID, accessExpiration)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new access token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Longer lifespan refresh token
+  refreshExpiration := time.Now().Add(time.Hour * 24)
+  refreshTokenStr, err := r.Services.Auth.GetNewJWTToken(userID, refreshExpiration)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new refresh token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Also store this refresh token in the user table
+  userRefreshUpdate := new(db.UserRefreshUpdate)
+  userRefreshUpdate.UserID = userID
+  userRefreshUpdate.RefreshToken = refreshTokenStr
+
+  _, err = r.Services.Database.UpdateUserRefreshToken(userRefreshUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error adding new refresh token to database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  setAuthCookie(res, accessTokenCookieName, accessTokenStr, accessExpiration)
+  setAuthCookie(res, refreshTokenCookieName, refreshTokenStr, refreshExpiration)
+
+  // Get the basic user profile information
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Could not get user data for id %d: %s", userID, err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Also get the user's saved characters
+  userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user's saved characters with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Finally get the user roles after authentication
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:           true,
+    Error:             nil,
+    Data:  LoginResponseData{
+      User:               userProfileView,
+      UserCharacters:     userCharViews,
+      AccessExpiration:   accessExpiration,
+      RefreshExpiration:  refreshExpiration,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
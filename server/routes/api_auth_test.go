@@ -0,0 +1,350 @@
+package routes
+
+import (
+  "bytes"
+  "database/sql"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+
+  "github.com/cakebin/smush/server/services/auth"
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+            Test Stubs
+----------------------------------*/
+
+// stubOIDCAuth uses our real auth for everything but the OpenID Connect provider,
+// which always says the user is whoever the test sets identity to
+type stubOIDCAuth struct {
+  *auth.Auth
+  identity           *auth.OIDCIdentity
+  exchangedNonce     string
+  exchangedVerifier  string
+  exchanged          bool
+}
+
+
+func (a *stubOIDCAuth) OIDCEnabled() bool {
+  return true
+}
+
+
+func (a *stubOIDCAuth) ExchangeOIDCCode(code string, codeVerifier string, nonce string) (*auth.OIDCIdentity, error) {
+  a.exchanged = true
+  a.exchangedNonce = nonce
+  a.exchangedVerifier = codeVerifier
+  return a.identity, nil
+}
+
+
+// stubOIDCDatabase keeps just enough users and identities in memory for logging in
+// with OpenID Connect; anything else it's asked for panics on the nil DatabaseManager
+type stubOIDCDatabase struct {
+  db.DatabaseManager
+  users              []*db.UserCredentialsView
+  identities         []*db.UserIdentity
+  identitiesCreated  []*db.UserIdentityCreate
+  auditLogs          []*db.AuditLogCreate
+  refreshUpdates     []*db.UserRefreshUpdate
+}
+
+
+func (d *stubOIDCDatabase) GetUserIdentityByIssuerAndSubject(issuer string, subject string) (*db.UserIdentity, error) {
+  for _, userIdentity := range d.identities {
+    if userIdentity.Issuer == issuer && userIdentity.Subject == subject {
+      return userIdentity, nil
+    }
+  }
+  return nil, sql.ErrNoRows
+}
+
+
+func (d *stubOIDCDatabase) CreateUserIdentity(userIdentityCreate *db.UserIdentityCreate) (int64, error) {
+  d.identitiesCreated = append(d.identitiesCreated, userIdentityCreate)
+
+  userIdentity := &db.UserIdentity{
+    UserIdentityID:  int64(len(d.identities) + 1),
+    UserID:          userIdentityCreate.UserID,
+    Issuer:          userIdentityCreate.Issuer,
+    Subject:         userIdentityCreate.Subject,
+    EmailAddress:    userIdentityCreate.EmailAddress,
+  }
+  d.identities = append(d.identities, userIdentity)
+
+  return userIdentity.UserIdentityID, nil
+}
+
+
+func (d *stubOIDCDatabase) UpdateUserIdentityLastLogin(userIdentityID int64) error {
+  return nil
+}
+
+
+func (d *stubOIDCDatabase) GetUserCredentialsViewsByEmailIgnoringCase(email string) ([]*db.UserCredentialsView, error) {
+  users := make([]*db.UserCredentialsView, 0)
+  for _, user := range d.users {
+    if strings.EqualFold(user.EmailAddress, email) {
+      users = append(users, user)
+    }
+  }
+  return users, nil
+}
+
+
+func (d *stubOIDCDatabase) GetUserCredentialsViewByUserID(userID int64) (*db.UserCredentialsView, error) {
+  for _, user := range d.users {
+    if user.UserID == userID {
+      return user, nil
+    }
+  }
+  return nil, sql.ErrNoRows
+}
+
+
+func (d *stubOIDCDatabase) UpdateUserRefreshToken(userRefreshUpdate *db.UserRefreshUpdate) (int64, error) {
+  d.refreshUpdates = append(d.refreshUpdates, userRefreshUpdate)
+  return userRefreshUpdate.UserID, nil
+}
+
+
+func (d *stubOIDCDatabase) GetUserProfileViewByUserID(userID int64) (*db.UserProfileView, error) {
+  return &db.UserProfileView{UserID: userID}, nil
+}
+
+
+func (d *stubOIDCDatabase) GetUserCharacterViewsByUserID(userID int64) ([]*db.UserCharacterView, error) {
+  return make([]*db.UserCharacterView, 0), nil
+}
+
+
+func (d *stubOIDCDatabase) GetUserRoleViewsByUserID(userID int64) ([]*db.UserRoleView, error) {
+  return make([]*db.UserRoleView, 0), nil
+}
+
+
+func (d *stubOIDCDatabase) GetPermissionNamesByUserID(userID int64) ([]string, error) {
+  return make([]string, 0), nil
+}
+
+
+func (d *stubOIDCDatabase) CreateAuditLog(auditLogCreate *db.AuditLogCreate) (int64, error) {
+  d.auditLogs = append(d.auditLogs, auditLogCreate)
+  return int64(len(d.auditLogs)), nil
+}
+
+
+// newStubOIDCRouter makes an auth router whose provider says the user is the given identity
+func newStubOIDCRouter(database *stubOIDCDatabase, identity *auth.OIDCIdentity) (*AuthRouter, *stubOIDCAuth) {
+  stubAuth := &stubOIDCAuth{Auth: auth.New(database), identity: identity}
+  services := &Services{Database: database, Auth: stubAuth}
+
+  return NewAuthRouter(services), stubAuth
+}
+
+
+// postOIDCCallback sends the provider's response to the callback route, with the given state cookie
+func postOIDCCallback(router *AuthRouter, state string, stateCookie string) *httptest.ResponseRecorder {
+  body, _ := json.Marshal(OIDCCallbackRequestData{Code: "test-code", State: state})
+  req := httptest.NewRequest(http.MethodPost, "/oidc/callback", bytes.NewReader(body))
+  if stateCookie != "" {
+    req.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: stateCookie})
+  }
+
+  res := httptest.NewRecorder()
+  router.ServeHTTP(res, req)
+  return res
+}
+
+
+func testOIDCIdentity() *auth.OIDCIdentity {
+  return &auth.OIDCIdentity{
+    Issuer:         "https://id.example",
+    Subject:        "user-123",
+    EmailAddress:   "player@smush.example",
+    EmailVerified:  true,
+  }
+}
+
+
+/*---------------------------------
+              Tests
+----------------------------------*/
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+  tests := []struct {
+    name         string
+    state        string
+    stateCookie  string
+  }{
+    {"no state cookie", "test-state", ""},
+    {"state from another log in", "test-state", "other-state.test-nonce.test-verifier"},
+    {"no state", "", "test-state.test-nonce.test-verifier"},
+    {"malformed state cookie", "test-state", "test-state.test-nonce"},
+  }
+  for _, test := range tests {
+    database := &stubOIDCDatabase{}
+    router, stubAuth := newStubOIDCRouter(database, testOIDCIdentity())
+
+    res := postOIDCCallback(router, test.state, test.stateCookie)
+    if res.Code != http.StatusUnauthorized {
+      t.Errorf("OIDC callback with %s returned %d, expected %d", test.name, res.Code, http.StatusUnauthorized)
+    }
+    if stubAuth.exchanged {
+      t.Errorf("OIDC callback with %s should not have exchanged the code", test.name)
+    }
+
+    // The state cookie only works once, whether or not it matched
+    cleared := false
+    for _, cookie := range res.Result().Cookies() {
+      if cookie.Name == oidcStateCookieName && cookie.Value == "" && cookie.MaxAge < 0 {
+        cleared = true
+      }
+    }
+    if !cleared {
+      t.Errorf("OIDC callback with %s should have cleared the state cookie", test.name)
+    }
+  }
+}
+
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+  database := &stubOIDCDatabase{
+    users: []*db.UserCredentialsView{{UserID: 7, EmailAddress: "player@smush.example"}},
+  }
+  router, stubAuth := newStubOIDCRouter(database, testOIDCIdentity())
+
+  res := postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusOK {
+    t.Fatalf("OIDC callback returned %d: %s", res.Code, res.Body.String())
+  }
+  if stubAuth.exchangedNonce != "test-nonce" || stubAuth.exchangedVerifier != "test-verifier" {
+    t.Errorf("Code should be exchanged with the state cookie's nonce and verifier, got %s %s", stubAuth.exchangedNonce, stubAuth.exchangedVerifier)
+  }
+
+  if len(database.identitiesCreated) != 1 {
+    t.Fatalf("Expected one identity to be linked, got %d", len(database.identitiesCreated))
+  }
+  userIdentityCreate := database.identitiesCreated[0]
+  if userIdentityCreate.UserID != 7 || userIdentityCreate.Issuer != "https://id.example" || userIdentityCreate.Subject != "user-123" {
+    t.Errorf("Identity was linked wrong: %+v", userIdentityCreate)
+  }
+  if len(database.auditLogs) != 1 || database.auditLogs[0].Action != auditActionLinkIdentity {
+    t.Errorf("Linking an identity should be audited once, got %d audit logs", len(database.auditLogs))
+  }
+  if len(database.refreshUpdates) != 1 || database.refreshUpdates[0].UserID != 7 {
+    t.Error("The linked user should have been logged in")
+  }
+
+  // The next log in finds the identity instead of linking it again
+  res = postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusOK {
+    t.Fatalf("Second OIDC callback returned %d: %s", res.Code, res.Body.String())
+  }
+  if len(database.identitiesCreated) != 1 {
+    t.Errorf("An already linked identity should not be linked again, got %d links", len(database.identitiesCreated))
+  }
+}
+
+
+func TestOIDCCallbackLinksEmailIgnoringCase(t *testing.T) {
+  identity := testOIDCIdentity()
+  identity.EmailAddress = "Player@Smush.example"
+  database := &stubOIDCDatabase{
+    users: []*db.UserCredentialsView{{UserID: 7, EmailAddress: "player@smush.example"}},
+  }
+  router, _ := newStubOIDCRouter(database, identity)
+
+  res := postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusOK {
+    t.Fatalf("OIDC callback returned %d: %s", res.Code, res.Body.String())
+  }
+  if len(database.identitiesCreated) != 1 || database.identitiesCreated[0].UserID != 7 {
+    t.Error("An email differing only in case should link to the existing user")
+  }
+}
+
+
+func TestOIDCCallbackAmbiguousEmail(t *testing.T) {
+  identity := testOIDCIdentity()
+  identity.EmailAddress = "PLAYER@smush.example"
+  database := &stubOIDCDatabase{
+    users: []*db.UserCredentialsView{
+      {UserID: 7, EmailAddress: "player@smush.example"},
+      {UserID: 8, EmailAddress: "Player@smush.example"},
+    },
+  }
+  router, _ := newStubOIDCRouter(database, identity)
+
+  res := postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusConflict {
+    t.Errorf("OIDC callback matching more than one account returned %d, expected %d", res.Code, http.StatusConflict)
+  }
+  if len(database.identitiesCreated) != 0 {
+    t.Error("An email matching more than one account should not be linked to any of them")
+  }
+
+  // One typed exactly the same way is still the right account
+  identity.EmailAddress = "Player@smush.example"
+  res = postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusOK {
+    t.Fatalf("OIDC callback returned %d: %s", res.Code, res.Body.String())
+  }
+  if len(database.identitiesCreated) != 1 || database.identitiesCreated[0].UserID != 8 {
+    t.Error("An email matching one account exactly should link to that account")
+  }
+}
+
+
+func TestOIDCCallbackDoesNotLinkUnverifiedEmail(t *testing.T) {
+  identity := testOIDCIdentity()
+  identity.EmailVerified = false
+  database := &stubOIDCDatabase{
+    users: []*db.UserCredentialsView{{UserID: 7, EmailAddress: "player@smush.example"}},
+  }
+  router, _ := newStubOIDCRouter(database, identity)
+
+  res := postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusForbidden {
+    t.Errorf("OIDC callback with an unverified email returned %d, expected %d", res.Code, http.StatusForbidden)
+  }
+  if len(database.identitiesCreated) != 0 || len(database.refreshUpdates) != 0 {
+    t.Error("An unverified email should never be linked to or logged in as an existing user")
+  }
+}
+
+
+func TestOIDCCallbackUnknownEmail(t *testing.T) {
+  database := &stubOIDCDatabase{
+    users: []*db.UserCredentialsView{{UserID: 7, EmailAddress: "someone-else@smush.example"}},
+  }
+  router, _ := newStubOIDCRouter(database, testOIDCIdentity())
+
+  res := postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusNotFound {
+    t.Errorf("OIDC callback with an email no one uses returned %d, expected %d", res.Code, http.StatusNotFound)
+  }
+  if len(database.identitiesCreated) != 0 {
+    t.Error("An identity should not be linked when no user has its email")
+  }
+}
+
+
+func TestOIDCCallbackDisabledUser(t *testing.T) {
+  database := &stubOIDCDatabase{
+    users: []*db.UserCredentialsView{{UserID: 7, EmailAddress: "player@smush.example", Disabled: true}},
+  }
+  router, _ := newStubOIDCRouter(database, testOIDCIdentity())
+
+  res := postOIDCCallback(router, "test-state", "test-state.test-nonce.test-verifier")
+  if res.Code != http.StatusForbidden {
+    t.Errorf("OIDC callback for a disabled user returned %d, expected %d", res.Code, http.StatusForbidden)
+  }
+  if len(database.refreshUpdates) != 0 {
+    t.Error("A disabled user should not be logged in")
+  }
+}
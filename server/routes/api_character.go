@@ -4,7 +4,9 @@ import (
   "encoding/json"
   "fmt"
   "net/http"
+  "strconv"
 
+  "github.com/cakebin/smush/server/services/auth"
   "github.com/cakebin/smush/server/services/db"
 )
 
@@ -34,6 +36,62 @@ type CharacterUpdateResponseData struct {
 }
 
 
+// CharacterCostumesResponseData is the data we send back
+// after successfully getting all of a character's costumes
+type CharacterCostumesResponseData struct {
+  Costumes  []*db.CharacterCostume  `json:"costumes"`
+}
+
+
+// CharacterCostumeUpdateResponseData is the data we send
+// back after successfully updating a character costume
+type CharacterCostumeUpdateResponseData struct {
+  Costume  *db.CharacterCostume  `json:"costume"`
+}
+
+
+// ArchetypeGetAllResponseData is the data we send back
+// after successfully getting all archetypes
+type ArchetypeGetAllResponseData struct {
+  Archetypes  []*db.Archetype  `json:"archetypes"`
+}
+
+
+// ArchetypeCreateResponseData is the data we send
+// back after successfully creating a new archetype
+type ArchetypeCreateResponseData struct {
+  Archetype  *db.Archetype  `json:"archetype"`
+}
+
+
+// ArchetypeUpdateResponseData is the data we send
+// back after successfully updating an archetype
+type ArchetypeUpdateResponseData struct {
+  Archetype  *db.Archetype  `json:"archetype"`
+}
+
+
+// SeriesGetAllResponseData is the data we send back
+// after successfully getting all series
+type SeriesGetAllResponseData struct {
+  Series  []*db.Series  `json:"series"`
+}
+
+
+// SeriesCreateResponseData is the data we send
+// back after successfully creating a new series
+type SeriesCreateResponseData struct {
+  Series  *db.Series  `json:"series"`
+}
+
+
+// SeriesUpdateResponseData is the data we send
+// back after successfully updating a series
+type SeriesUpdateResponseData struct {
+  Series  *db.Series  `json:"series"`
+}
+
+
 /*---------------------------------
              Router
 ----------------------------------*/
@@ -56,27 +114,40 @@ func (r *CharacterRouter) ServeHTTP(res http.ResponseWriter, req *http.Request)
     switch head {
     case "getall":
       r.handleGetAll(res, req)
+    case "archetype", "series":
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      if subHead != "getall" {
+        http.Error(res, fmt.Sprintf("Unsupported GET path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
+
+      if head == "archetype" {
+        r.handleGetAllArchetypes(res, req)
+      } else {
+        r.handleGetAllSeries(res, req)
+      }
     default:
-      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
-      return
+      // Otherwise we're expecting /api/character/{id}/costumes
+      characterID, err := strconv.ParseInt(head, 10, 64)
+      if err != nil {
+        http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+        return
+      }
+
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "costumes":
+        r.handleGetCostumes(res, req, characterID)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported GET path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
     }
   // POST Request Handlers
   case http.MethodPost:
-    // Check for admin role
-    accessCookie, err := req.Cookie("smush-access-token")
-    if err != nil {
-      http.Error(res, fmt.Sprintf("Access token expired; can't get user ID from cookie"), http.StatusUnauthorized)
-      return
-    }
-    userID, err := r.Services.Auth.GetUserIDFromJWTToken(accessCookie.Value)
-    userRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userID)
-    if err != nil {
-      http.Error(res, fmt.Sprintf("Error fetching user role from db: %s", err.Error()), http.StatusInternalServerError)
-      return
-    }
-    hasRoleAdmin := r.Services.Auth.HasRoleAdmin(userRoleViews)
-    if !hasRoleAdmin {
-      http.Error(res, fmt.Sprintf("User not authorized to POST to api/tag"), http.StatusUnauthorized)
+    if !checkPermission(r.Services, res, req, auth.PermissionManageCharacters) {
       return
     }
 
@@ -85,6 +156,44 @@ func (r *CharacterRouter) ServeHTTP(res http.ResponseWriter, req *http.Request)
       r.handleCreate(res, req)
     case "update":
       r.handleUpdate(res, req)
+    case "costume":
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "update":
+        r.handleUpdateCostume(res, req)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported POST path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
+    case "archetype":
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "create":
+        r.handleCreateArchetype(res, req)
+      case "update":
+        r.handleUpdateArchetype(res, req)
+      case "delete":
+        r.handleDeleteArchetype(res, req)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported POST path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
+    case "series":
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "create":
+        r.handleCreateSeries(res, req)
+      case "update":
+        r.handleUpdateSeries(res, req)
+      case "delete":
+        r.handleDeleteSeries(res, req)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported POST path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
     default:
       http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
       return
@@ -146,6 +255,17 @@ func (r *CharacterRouter) handleCreate(res http.ResponseWriter, req *http.Reques
     return
   }
 
+  // New characters get the default set of costumes, which admins can rename afterwards
+  if character.CharacterStockImg.Valid {
+    characterCostumesCreate := db.MakeDefaultCharacterCostumes(character.CharacterID, character.CharacterStockImg.String)
+    _, err = r.Services.Database.CreateCharacterCostumes(characterCostumesCreate)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error creating new character costumes in database: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityCharacter, character.CharacterID, nil, character)
+
   response := &Response{
     Success:  true,
     Error:    nil,
@@ -169,11 +289,18 @@ func (r *CharacterRouter) handleUpdate(res http.ResponseWriter, req *http.Reques
     return
   }
 
+  existingCharacter, err := r.Services.Database.GetCharacterByCharacterID(characterUpdate.CharacterID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting character from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
   character, err := r.Services.Database.UpdateCharacter(characterUpdate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error updating character in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityCharacter, character.CharacterID, existingCharacter, character)
 
   response := &Response{
     Success:  true,
@@ -186,3 +313,297 @@ func (r *CharacterRouter) handleUpdate(res http.ResponseWriter, req *http.Reques
   res.Header().Set("Content-Type", "application/json")
   json.NewEncoder(res).Encode(response)
 }
+
+
+func (r *CharacterRouter) handleGetCostumes(res http.ResponseWriter, req *http.Request, characterID int64) {
+  characterCostumes, err := r.Services.Database.GetCharacterCostumesByCharacterID(characterID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting costumes for characterID %d from DB: %s", characterID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     CharacterCostumesResponseData{
+      Costumes:  characterCostumes,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleUpdateCostume(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  characterCostumeUpdate := new(db.CharacterCostumeUpdate)
+
+  err := decoder.Decode(characterCostumeUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingCharacterCostume, err := r.Services.Database.GetCharacterCostumeByCharacterCostumeID(characterCostumeUpdate.CharacterCostumeID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting character costume from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  characterCostume, err := r.Services.Database.UpdateCharacterCostume(characterCostumeUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating character costume in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityCostume, characterCostume.CharacterCostumeID, existingCharacterCostume, characterCostume)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     CharacterCostumeUpdateResponseData{
+      Costume:  characterCostume,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleGetAllArchetypes(res http.ResponseWriter, req *http.Request) {
+  archetypes, err := r.Services.Database.GetAllArchetypes()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all archetypes from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     ArchetypeGetAllResponseData{
+      Archetypes:  archetypes,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleCreateArchetype(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  archetypeCreate := new(db.ArchetypeCreate)
+
+  err := decoder.Decode(archetypeCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  archetype, err := r.Services.Database.CreateArchetype(archetypeCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new archetype in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityArchetype, archetype.ArchetypeID, nil, archetype)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     ArchetypeCreateResponseData{
+      Archetype:  archetype,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleUpdateArchetype(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  archetypeUpdate := new(db.ArchetypeUpdate)
+
+  err := decoder.Decode(archetypeUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingArchetype, err := r.Services.Database.GetArchetypeByArchetypeID(archetypeUpdate.ArchetypeID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting archetype from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  archetype, err := r.Services.Database.UpdateArchetype(archetypeUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating archetype in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityArchetype, archetype.ArchetypeID, existingArchetype, archetype)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     ArchetypeUpdateResponseData{
+      Archetype:  archetype,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleDeleteArchetype(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  archetypeDelete := new(db.ArchetypeDelete)
+
+  err := decoder.Decode(archetypeDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingArchetype, err := r.Services.Database.GetArchetypeByArchetypeID(archetypeDelete.ArchetypeID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting archetype from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  _, err = r.Services.Database.DeleteArchetypeByArchetypeID(archetypeDelete.ArchetypeID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting archetype in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityArchetype, archetypeDelete.ArchetypeID, existingArchetype, nil)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleGetAllSeries(res http.ResponseWriter, req *http.Request) {
+  allSeries, err := r.Services.Database.GetAllSeries()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all series from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     SeriesGetAllResponseData{
+      Series:  allSeries,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleCreateSeries(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  seriesCreate := new(db.SeriesCreate)
+
+  err := decoder.Decode(seriesCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  series, err := r.Services.Database.CreateSeries(seriesCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new series in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntitySeries, series.SeriesID, nil, series)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     SeriesCreateResponseData{
+      Series:  series,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleUpdateSeries(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  seriesUpdate := new(db.SeriesUpdate)
+
+  err := decoder.Decode(seriesUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingSeries, err := r.Services.Database.GetSeriesBySeriesID(seriesUpdate.SeriesID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting series from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  series, err := r.Services.Database.UpdateSeries(seriesUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating series in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntitySeries, series.SeriesID, existingSeries, series)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     SeriesUpdateResponseData{
+      Series:  series,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *CharacterRouter) handleDeleteSeries(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  seriesDelete := new(db.SeriesDelete)
+
+  err := decoder.Decode(seriesDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingSeries, err := r.Services.Database.GetSeriesBySeriesID(seriesDelete.SeriesID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting series from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  _, err = r.Services.Database.DeleteSeriesBySeriesID(seriesDelete.SeriesID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting series in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntitySeries, seriesDelete.SeriesID, existingSeries, nil)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
@@ -0,0 +1,271 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+// The page size we use for feeds when the client doesn't ask for one, and the most we'll send at once
+const (
+  defaultFeedPageSize = 25
+  maxFeedPageSize     = 100
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// FeedGetResponseData is the data we send back
+// after successfully getting a page of a user's feed
+type FeedGetResponseData struct {
+  FeedItems       []*db.FeedItem  `json:"feedItems"`
+  TotalFeedItems  int64           `json:"totalFeedItems"`
+  Page            int64           `json:"page"`
+  PageSize        int64           `json:"pageSize"`
+}
+
+
+// FeedGetFollowingResponseData is the data we send back after
+// successfully getting everyone a user follows or is followed by
+type FeedGetFollowingResponseData struct {
+  Following  []*db.FollowUser  `json:"following"`
+  Followers  []*db.FollowUser  `json:"followers"`
+}
+
+
+// FeedFollowResponseData is the data we send back after
+// successfully following or unfollowing another user
+type FeedFollowResponseData struct {
+  Following  []*db.FollowUser  `json:"following"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// FeedRouter is responsible for serving "/api/feed"; the logged in
+// user's activity feed, and following the users that show up in it
+type FeedRouter struct {
+  Services  *Services
+}
+
+
+func (r *FeedRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "":
+      r.handleGetFeed(res, req)
+    case "following":
+      r.handleGetFollowing(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "follow":
+      r.handleFollow(res, req)
+    case "unfollow":
+      r.handleUnfollow(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewFeedRouter makes a new api/feed router and hooks up its services
+func NewFeedRouter(routerServices *Services) *FeedRouter {
+  router := new(FeedRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+// handleGetFeed gets one page of the matches and GSP changes from everyone the logged
+// in user follows, newest first (i.e. ?page=2&pageSize=25)
+func (r *FeedRouter) handleGetFeed(res http.ResponseWriter, req *http.Request) {
+  feedFilter := new(db.FeedFilter)
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+  feedFilter.UserID = userID
+
+  page, pageSize, err := parsePaging(req.URL.Query(), defaultFeedPageSize, maxFeedPageSize)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid paging: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+  feedFilter.Page = page
+  feedFilter.PageSize = pageSize
+
+  feedItems, totalFeedItems, err := r.Services.Database.GetFeedItems(feedFilter)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting feed from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     FeedGetResponseData{
+      FeedItems:       feedItems,
+      TotalFeedItems:  totalFeedItems,
+      Page:            feedFilter.Page,
+      PageSize:        feedFilter.PageSize,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *FeedRouter) handleGetFollowing(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  following, err := r.Services.Database.GetFollowedUsersByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting followed users from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  followers, err := r.Services.Database.GetFollowersByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting followers from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     FeedGetFollowingResponseData{
+      Following:  following,
+      Followers:  followers,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *FeedRouter) handleFollow(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  followCreate := new(db.FollowCreate)
+
+  err := decoder.Decode(followCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Users can only follow people themselves
+  followCreate.FollowerUserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+  if followCreate.FollowedUserID == followCreate.FollowerUserID {
+    http.Error(res, "Users can't follow themselves", http.StatusBadRequest)
+    return
+  }
+
+  followedUserID, err := r.Services.Database.CreateFollow(followCreate)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d not found", followCreate.FollowedUserID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating follow in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityFollow, followedUserID, nil, followCreate)
+
+  r.sendFollowing(res, followCreate.FollowerUserID)
+}
+
+
+func (r *FeedRouter) handleUnfollow(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  followDelete := new(db.FollowDelete)
+
+  err := decoder.Decode(followDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Users can only unfollow people themselves
+  followDelete.FollowerUserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  followedUserID, err := r.Services.Database.DeleteFollow(followDelete)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Not following user %d", followDelete.FollowedUserID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting follow in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityFollow, followedUserID, followDelete, nil)
+
+  r.sendFollowing(res, followDelete.FollowerUserID)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// sendFollowing sends back everyone a user follows after they've followed or unfollowed someone
+func (r *FeedRouter) sendFollowing(res http.ResponseWriter, userID int64) {
+  following, err := r.Services.Database.GetFollowedUsersByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting followed users from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     FeedFollowResponseData{
+      Following:  following,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
@@ -0,0 +1,320 @@
+package routes
+
+import (
+  "database/sql"
+  "fmt"
+  "log"
+  "net/http"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/gorilla/websocket"
+)
+
+
+// The limits we put on live session connections: how long a write can take before we give up
+// on a slow client, how often we ping (and check the token is still good), how long we wait
+// for the pong, the most a client can send us, and how many connections a user can have open
+const (
+  liveWriteWait           = 10 * time.Second
+  livePingInterval        = 30 * time.Second
+  livePongWait            = 60 * time.Second
+  liveMaxMessageSize      = 512
+  maxLiveConnectionsUser  = 5
+)
+
+
+// Browsers can't set headers on WebSocket requests, but they can ask for subprotocols, so overlays
+// send their api token as one: new WebSocket(url, ["smush-live", "smush-token." + token]). We only
+// ever answer with smush-live, so the token isn't echoed back. Tokens are never taken from the URL,
+// since URLs end up in access logs, proxy logs and browser history
+const (
+  liveSubprotocol             = "smush-live"
+  liveTokenSubprotocolPrefix  = "smush-token."
+)
+
+
+// liveUpgrader turns live session requests into WebSocket connections. Overlays run from all sorts
+// of origins (i.e. OBS browser sources), and they're authed with an api token instead of cookies,
+// so another site can't ride along on a logged in browser; any origin is fine
+var liveUpgrader = websocket.Upgrader{
+  ReadBufferSize:   1024,
+  WriteBufferSize:  1024,
+  Subprotocols:     []string{liveSubprotocol},
+  CheckOrigin:      func(req *http.Request) bool { return true },
+}
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// LiveMessage is every message we send down a live session connection
+type LiveMessage struct {
+  Type  string       `json:"type"`
+  Data  interface{}  `json:"data"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// LiveRouter is responsible for serving "/api/live"; WebSocket connections for stream overlays,
+// authed with one of the user's api tokens (matches:read) instead of the auth cookies
+type LiveRouter struct {
+  Services     *Services
+  mutex        sync.Mutex
+  connections  map[int64]int
+}
+
+
+func (r *LiveRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "session":
+      r.handleSession(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewLiveRouter makes a new api/live router and hooks up its services
+func NewLiveRouter(routerServices *Services) *LiveRouter {
+  router := new(LiveRouter)
+
+  router.Services = routerServices
+  router.connections = make(map[int64]int)
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *LiveRouter) handleSession(res http.ResponseWriter, req *http.Request) {
+  query := req.URL.Query()
+
+  if query.Get("token") != "" {
+    http.Error(res, "API tokens can't be sent in the URL; send it as a Bearer token or a smush-token. WebSocket subprotocol", http.StatusBadRequest)
+    return
+  }
+  token, ok := getBearerToken(req)
+  if !ok {
+    token, ok = getLiveSubprotocolToken(req)
+  }
+  if !ok || token == "" {
+    http.Error(res, "Live sessions need an API token", http.StatusUnauthorized)
+    return
+  }
+  apiToken, ok := checkAPIToken(r.Services, res, token, apiTokenScopeReadMatches)
+  if !ok {
+    return
+  }
+
+  since, err := parseOptionalTime(query.Get("since"))
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid since %s", query.Get("since")), http.StatusBadRequest)
+    return
+  }
+  numResults := defaultLiveSessionResults
+  if query.Get("results") != "" {
+    numResults, err = strconv.Atoi(query.Get("results"))
+    if err != nil || numResults < 0 || numResults > maxLiveSessionResults {
+      http.Error(res, fmt.Sprintf("Results must be between 0 and %d", maxLiveSessionResults), http.StatusBadRequest)
+      return
+    }
+  }
+
+  if !r.addConnection(apiToken.UserID) {
+    http.Error(res, fmt.Sprintf("Too many live sessions open; the most is %d", maxLiveConnectionsUser), http.StatusTooManyRequests)
+    return
+  }
+  defer r.removeConnection(apiToken.UserID)
+
+  // Subscribe before picking up the session, so no match logged in between gets missed
+  subscription, _, _ := r.Services.Events.Subscribe(0)
+  defer r.Services.Events.Unsubscribe(subscription)
+
+  tracker, err := newLiveSessionTracker(r.Services, apiToken.UserID, since.Time, numResults)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting live session matches from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // The upgrader writes its own error response
+  conn, err := liveUpgrader.Upgrade(res, req, nil)
+  if err != nil {
+    return
+  }
+  defer conn.Close()
+
+  closed := readLiveConnection(conn)
+
+  err = writeLiveSession(conn, tracker)
+  if err != nil {
+    return
+  }
+
+  pingTicker := time.NewTicker(livePingInterval)
+  defer pingTicker.Stop()
+
+  for {
+    select {
+    case <-closed:
+      return
+    case event, ok := <-subscription.Events:
+      // We fell too far behind the events hub; the overlay should reconnect and pick the session up again
+      if !ok {
+        closeLiveConnection(conn, websocket.CloseTryAgainLater, "Fell behind; please reconnect")
+        return
+      }
+      if event.UserID != apiToken.UserID {
+        continue
+      }
+      changed := tracker.apply(event)
+
+      // A slow overlay only ever needs the latest session, so apply everything that's
+      // piled up before sending one update instead of one per event
+      for pending := len(subscription.Events); pending > 0; pending-- {
+        event, ok := <-subscription.Events
+        if !ok {
+          break
+        }
+        if event.UserID == apiToken.UserID && tracker.apply(event) {
+          changed = true
+        }
+      }
+
+      if !changed {
+        continue
+      }
+      err := writeLiveSession(conn, tracker)
+      if err != nil {
+        return
+      }
+    case <-pingTicker.C:
+      // Revoking or expiring the token ends the session it opened
+      _, err := r.Services.Database.GetAPITokenByHashedToken(r.Services.Auth.HashSecretToken(token))
+      if err == sql.ErrNoRows {
+        closeLiveConnection(conn, websocket.ClosePolicyViolation, "API token is invalid, expired, or revoked")
+        return
+      } else if err != nil {
+        log.Printf("Error rechecking API token %d for live session: %s", apiToken.APITokenID, err.Error())
+      }
+
+      err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait))
+      if err != nil {
+        return
+      }
+    }
+  }
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// addConnection counts a new live session connection for a user;
+// returns false if they already have as many open as they can
+func (r *LiveRouter) addConnection(userID int64) bool {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  if r.connections[userID] >= maxLiveConnectionsUser {
+    return false
+  }
+  r.connections[userID]++
+
+  return true
+}
+
+
+// removeConnection stops counting a closed live session connection
+func (r *LiveRouter) removeConnection(userID int64) {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.connections[userID]--
+  if r.connections[userID] <= 0 {
+    delete(r.connections, userID)
+  }
+}
+
+
+// readLiveConnection reads (and ignores) everything the client sends, which keeps pongs and close
+// frames flowing; the returned channel is closed once the connection is gone or stops answering pings
+func readLiveConnection(conn *websocket.Conn) <-chan struct{} {
+  closed := make(chan struct{})
+
+  conn.SetReadLimit(liveMaxMessageSize)
+  conn.SetReadDeadline(time.Now().Add(livePongWait))
+  conn.SetPongHandler(func(string) error {
+    return conn.SetReadDeadline(time.Now().Add(livePongWait))
+  })
+
+  go func() {
+    defer close(closed)
+    for {
+      _, _, err := conn.ReadMessage()
+      if err != nil {
+        return
+      }
+    }
+  }()
+
+  return closed
+}
+
+
+// writeLiveSession sends the current session down a live session connection
+func writeLiveSession(conn *websocket.Conn, tracker *liveSessionTracker) error {
+  conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+
+  return conn.WriteJSON(&LiveMessage{
+    Type:  "session",
+    Data:  tracker.session(),
+  })
+}
+
+
+// closeLiveConnection tells the client why we're closing the connection before we do
+func closeLiveConnection(conn *websocket.Conn, closeCode int, reason string) {
+  err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(liveWriteWait))
+  if err != nil && err != websocket.ErrCloseSent {
+    log.Printf("Error closing live session connection: %s", err.Error())
+  }
+}
+
+
+// getLiveSubprotocolToken gets the api token an overlay sent as a WebSocket subprotocol;
+// they have to ask for the smush-live subprotocol too, since that's the one we answer with
+func getLiveSubprotocolToken(req *http.Request) (string, bool) {
+  token := ""
+  hasLiveSubprotocol := false
+  for _, subprotocol := range websocket.Subprotocols(req) {
+    if subprotocol == liveSubprotocol {
+      hasLiveSubprotocol = true
+    } else if strings.HasPrefix(subprotocol, liveTokenSubprotocolPrefix) {
+      token = strings.TrimPrefix(subprotocol, liveTokenSubprotocolPrefix)
+    }
+  }
+
+  return token, hasLiveSubprotocol && token != ""
+}
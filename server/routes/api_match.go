@@ -1,9 +1,12 @@
 package routes
 
 import (
+  "database/sql"
   "encoding/json"
   "fmt"
   "net/http"
+  "strconv"
+  "time"
 
   "github.com/cakebin/smush/server/services/db"
 )
@@ -34,6 +37,21 @@ type MatchUpdateResponseData struct {
 }
 
 
+// MatchUndeleteResponseData is the data we send
+// back after successfully restoring a match from the trash
+type MatchUndeleteResponseData struct {
+  Match  *db.MatchView  `json:"match"`
+}
+
+
+// MatchTrashResponseData is the data we send back after successfully
+// getting the matches a user has in the trash
+type MatchTrashResponseData struct {
+  Matches        []*db.MatchView  `json:"matches"`
+  RetentionDays  int64            `json:"retentionDays"`
+}
+
+
 // AddMatchTagViewsToMatchViews adds the matchTagViews to their corresponding matchViews
 func addMatchTagViewsToMatchViews(allMatchViews []*db.MatchView, allMatchTagViews []*db.MatchTagView) []*db.MatchView {
   finalizedMatchViews := make([]*db.MatchView, 0)
@@ -75,6 +93,110 @@ func addMatchIDtoMatchTagCreate(matchTagCreates []*db.MatchTagCreate, matchID in
   return finishedMatchTagCreates
 }
 
+// isOpponentOwnedByUser checks that a match's opponent, if it has one, was recorded
+// by the match's user; users can't attach another user's opponents to their matches
+func isOpponentOwnedByUser(services *Services, opponentID db.NullInt64JSON, userID int64) (bool, error) {
+  if !opponentID.Valid {
+    return true, nil
+  }
+
+  opponent, err := services.Database.GetOpponentByOpponentID(opponentID.Int64)
+  if err == sql.ErrNoRows {
+    return false, nil
+  } else if err != nil {
+    return false, err
+  }
+
+  return opponent.UserID == userID, nil
+}
+
+// parseMatchViewFilter reads the optional filters for match/getall
+// from the query string (i.e. ?archetype=3&series=12)
+func parseMatchViewFilter(req *http.Request) (*db.MatchViewFilter, error) {
+  matchViewFilter := new(db.MatchViewFilter)
+  query := req.URL.Query()
+
+  archetypeID, err := parseOptionalID(query.Get("archetype"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid archetype %s", query.Get("archetype"))
+  }
+  matchViewFilter.ArchetypeID = archetypeID
+
+  seriesID, err := parseOptionalID(query.Get("series"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid series %s", query.Get("series"))
+  }
+  matchViewFilter.SeriesID = seriesID
+
+  tagID, err := parseOptionalID(query.Get("tag"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid tag %s", query.Get("tag"))
+  }
+  matchViewFilter.TagID = tagID
+
+  return matchViewFilter, nil
+}
+
+
+// parseOptionalID parses an ID from a query param, treating an empty param as null
+func parseOptionalID(param string) (db.NullInt64JSON, error) {
+  nullID := db.NullInt64JSON{}
+  if param == "" {
+    return nullID, nil
+  }
+
+  id, err := strconv.ParseInt(param, 10, 64)
+  if err != nil {
+    return nullID, err
+  }
+  nullID.Int64 = id
+  nullID.Valid = true
+
+  return nullID, nil
+}
+
+
+// resolveMatchTags fills in the tag ID for any match tags given by name (including the old
+// names of merged tags), drops repeated tags, and checks that every tag is either global or
+// one of the match user's own private tags. Returns nil if any tag can't be used
+func resolveMatchTags(services *Services, matchTagCreates []*db.MatchTagCreate, userID int64) ([]*db.MatchTagCreate, error) {
+  resolvedMatchTagCreates := make([]*db.MatchTagCreate, 0)
+  seenTagIDs := make(map[int64]bool)
+
+  for _, matchTagCreate := range matchTagCreates {
+    var tag *db.Tag
+    var err error
+    if matchTagCreate.TagID == 0 && matchTagCreate.TagName.Valid {
+      tag, err = services.Database.ResolveTagName(matchTagCreate.TagName.String, userID)
+    } else {
+      tag, err = services.Database.GetTagByTagID(int(matchTagCreate.TagID))
+    }
+    if err == sql.ErrNoRows {
+      return nil, nil
+    } else if err != nil {
+      return nil, err
+    }
+
+    if tag.UserID.Valid && tag.UserID.Int64 != userID {
+      return nil, nil
+    }
+
+    tagID := int64(tag.TagID)
+    if seenTagIDs[tagID] {
+      continue
+    }
+    seenTagIDs[tagID] = true
+
+    resolvedMatchTagCreate := new(db.MatchTagCreate)
+    resolvedMatchTagCreate.MatchID = matchTagCreate.MatchID
+    resolvedMatchTagCreate.TagID = tagID
+    resolvedMatchTagCreates = append(resolvedMatchTagCreates, resolvedMatchTagCreate)
+  }
+
+  return resolvedMatchTagCreates, nil
+}
+
+
 /*---------------------------------
              Router
 ----------------------------------*/
@@ -97,6 +219,10 @@ func (r *MatchRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     switch head {
     case "getall":
       r.handleGetAll(res, req)
+    case "trash":
+      r.handleTrash(res, req)
+    case "stream":
+      r.handleStream(res, req)
     default:
       http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
       return
@@ -110,6 +236,8 @@ func (r *MatchRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
       r.handleUpdate(res, req)
     case "delete":
       r.handleDelete(res, req)
+    case "undelete":
+      r.handleUndelete(res, req)
     default:
       http.Error(res, fmt.Sprintf("Unsupport POST path %s", head), http.StatusBadRequest)
       return
@@ -136,13 +264,39 @@ func NewMatchRouter(routerServices *Services) *MatchRouter {
 ----------------------------------*/
 
 func (r *MatchRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
-  matchViews, err := r.Services.Database.GetAllMatchViews()
+  matchViewFilter, err := parseMatchViewFilter(req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid match filter: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  // Filtering by someone else's private tag would tell us which matches they tagged with it
+  matchViewFilter.ViewerUserID = userID
+  if matchViewFilter.TagID.Valid {
+    tag, err := r.Services.Database.GetTagByTagID(int(matchViewFilter.TagID.Int64))
+    if err != nil && err != sql.ErrNoRows {
+      http.Error(res, fmt.Sprintf("Error getting filter tag from DB: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    if err == sql.ErrNoRows || (tag.UserID.Valid && tag.UserID.Int64 != userID) {
+      http.Error(res, fmt.Sprintf("Tag %d does not exist", matchViewFilter.TagID.Int64), http.StatusNotFound)
+      return
+    }
+  }
+
+  matchViews, err := r.Services.Database.GetAllMatchViews(matchViewFilter)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error getting all matches from DB: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
-  matchTagViews, err := r.Services.Database.GetAllMatchTagViews()
+  matchTagViews, err := r.Services.Database.GetAllMatchTagViews(userID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error getting all matches tags from DB: %s", err.Error()), http.StatusInternalServerError)
     return
@@ -173,6 +327,36 @@ func (r *MatchRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  // Users can only record matches for themselves
+  matchCreate.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  isOwned, err := isOpponentOwnedByUser(r.Services, matchCreate.OpponentID, matchCreate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting match opponent: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !isOwned {
+    http.Error(res, fmt.Sprintf("Opponent %d does not belong to user %d", matchCreate.OpponentID.Int64, matchCreate.UserID), http.StatusBadRequest)
+    return
+  }
+
+  if matchCreate.MatchTags != nil {
+    resolvedMatchTags, err := resolveMatchTags(r.Services, *matchCreate.MatchTags, matchCreate.UserID)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error getting match tags: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    if resolvedMatchTags == nil {
+      http.Error(res, fmt.Sprintf("Match tags must exist and be global or belong to user %d", matchCreate.UserID), http.StatusBadRequest)
+      return
+    }
+    matchCreate.MatchTags = &resolvedMatchTags
+  }
+
   // Make the new match and fetch relevant match view data for it
   matchID, err := r.Services.Database.CreateMatch(matchCreate)
 
@@ -196,13 +380,15 @@ func (r *MatchRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
     http.Error(res, fmt.Sprintf("Error getting match view: %s", err.Error()), http.StatusInternalServerError)
     return
   }
-  matchTagViews, err := r.Services.Database.GetMatchTagViewsByMatchID(matchID)
+  matchTagViews, err := r.Services.Database.GetMatchTagViewsByMatchID(matchID, matchView.UserID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error getting match tag view: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
   matchView.MatchTags = matchTagViews
+  recordAudit(r.Services, req, auditActionCreate, auditEntityMatch, matchID, nil, matchView)
+  publishMatchEvent(r.Services, matchEventCreate, matchView)
 
   response := &Response{
     Success:  true,
@@ -227,6 +413,49 @@ func (r *MatchRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  // Users can only change their own matches
+  existingMatchView, err := r.Services.Database.GetMatchViewByMatchID(matchUpdate.MatchID)
+  if err != nil && err != sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Error getting match view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if err == sql.ErrNoRows || existingMatchView.UserID != userID {
+    http.Error(res, fmt.Sprintf("Match %d not found", matchUpdate.MatchID), http.StatusNotFound)
+    return
+  }
+  existingMatchView.MatchTags, err = r.Services.Database.GetMatchTagViewsByMatchID(existingMatchView.MatchID, existingMatchView.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting match tag view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  isOwned, err := isOpponentOwnedByUser(r.Services, matchUpdate.OpponentID, existingMatchView.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting match opponent: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !isOwned {
+    http.Error(res, fmt.Sprintf("Opponent %d does not belong to user %d", matchUpdate.OpponentID.Int64, existingMatchView.UserID), http.StatusBadRequest)
+    return
+  }
+  if matchUpdate.MatchTags != nil {
+    resolvedMatchTags, err := resolveMatchTags(r.Services, *matchUpdate.MatchTags, existingMatchView.UserID)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error getting match tags: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    if resolvedMatchTags == nil {
+      http.Error(res, fmt.Sprintf("Match tags must exist and be global or belong to user %d", existingMatchView.UserID), http.StatusBadRequest)
+      return
+    }
+    matchUpdate.MatchTags = &resolvedMatchTags
+  }
+
   matchID, err := r.Services.Database.UpdateMatch(matchUpdate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error updating match in database: %s", err.Error()), http.StatusInternalServerError)
@@ -257,13 +486,15 @@ func (r *MatchRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
     http.Error(res, fmt.Sprintf("Error getting match view: %s", err.Error()), http.StatusInternalServerError)
     return
   }
-  matchTagViews, err := r.Services.Database.GetMatchTagViewsByMatchID(matchID)
+  matchTagViews, err := r.Services.Database.GetMatchTagViewsByMatchID(matchID, matchView.UserID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error getting match tag view: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
   matchView.MatchTags = matchTagViews
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityMatch, matchID, existingMatchView, matchView)
+  publishMatchEvent(r.Services, matchEventUpdate, matchView)
 
   response := &Response{
     Success:   true,
@@ -288,17 +519,220 @@ func (r *MatchRouter) handleDelete(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  // Users can only delete their own matches
+  existingMatchView, err := r.Services.Database.GetMatchViewByMatchID(matchDelete.MatchID)
+  if err != nil && err != sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Error getting match view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if err == sql.ErrNoRows || existingMatchView.UserID != userID {
+    http.Error(res, fmt.Sprintf("Match %d not found", matchDelete.MatchID), http.StatusNotFound)
+    return
+  }
+  existingMatchView.MatchTags, err = r.Services.Database.GetMatchTagViewsByMatchID(existingMatchView.MatchID, existingMatchView.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting match tag view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
   _, err = r.Services.Database.DeleteMatchByMatchID(matchDelete.MatchID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error deleting user match in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityMatch, matchDelete.MatchID, existingMatchView, nil)
+  publishMatchEvent(r.Services, matchEventDelete, existingMatchView)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *MatchRouter) handleUndelete(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  matchUndelete := new(db.MatchUndelete)
+
+  err := decoder.Decode(matchUndelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  // Only the match's own user can see it in their trash, so only they can restore it
+  existingMatchView, err := r.Services.Database.GetDeletedMatchViewByMatchID(matchUndelete.MatchID)
+  if err != nil && err != sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Error getting match view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if err == sql.ErrNoRows || existingMatchView.UserID != userID {
+    http.Error(res, fmt.Sprintf("Match %d is not in the trash", matchUndelete.MatchID), http.StatusNotFound)
+    return
+  }
+
+  matchID, err := r.Services.Database.UndeleteMatchByMatchID(matchUndelete.MatchID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error restoring match in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  matchView, err := r.Services.Database.GetMatchViewByMatchID(matchID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting match view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  matchTagViews, err := r.Services.Database.GetMatchTagViewsByMatchID(matchID, matchView.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting match tag view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  matchView.MatchTags = matchTagViews
+  recordAudit(r.Services, req, auditActionRestore, auditEntityMatch, matchID, existingMatchView, matchView)
+  publishMatchEvent(r.Services, matchEventRestore, matchView)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     MatchUndeleteResponseData{
+      Match:  matchView,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *MatchRouter) handleTrash(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  matchViews, err := r.Services.Database.GetDeletedMatchViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting deleted matches from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
 
   response := &Response{
     Success:  true,
     Error:    nil,
+    Data:     MatchTrashResponseData{
+      Matches:        matchViews,
+      RetentionDays:  matchTrashRetentionDays(),
+    },
   }
 
   res.Header().Set("Content-Type", "application/json")
   json.NewEncoder(res).Encode(response)
-}
\ No newline at end of file
+}
+
+
+func (r *MatchRouter) handleStream(res http.ResponseWriter, req *http.Request) {
+  matchStreamFilter, err := parseMatchStreamFilter(req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid match stream filter: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  flusher, ok := res.(http.Flusher)
+  if !ok {
+    http.Error(res, "Streaming is not supported", http.StatusInternalServerError)
+    return
+  }
+
+  // Subscribe before replaying, so nothing published in between gets missed
+  subscription, replayEvents, complete := r.Services.Events.Subscribe(getLastEventID(req))
+  defer r.Services.Events.Unsubscribe(subscription)
+
+  // Browser streams end when their access token does; the browser reconnects with its refreshed one
+  var expired <-chan time.Time
+  accessCookie, err := req.Cookie(accessTokenCookieName)
+  if err == nil && getAPIToken(req) == nil {
+    accessExpiration, err := r.Services.Auth.GetJWTTokenExpiration(accessCookie.Value)
+    if err == nil {
+      expirationTimer := time.NewTimer(time.Until(accessExpiration))
+      defer expirationTimer.Stop()
+      expired = expirationTimer.C
+    }
+  }
+
+  res.Header().Set("Content-Type", "text/event-stream")
+  res.Header().Set("Cache-Control", "no-cache")
+  res.Header().Set("Connection", "keep-alive")
+  res.Header().Set("X-Accel-Buffering", "no")
+  fmt.Fprintf(res, "retry: %d\n\n", matchStreamRetryMilliseconds)
+
+  // A reconnecting stream that missed events we no longer have needs to reload match/getall
+  if !complete {
+    fmt.Fprint(res, "event: reset\ndata: {}\n\n")
+  }
+  for _, event := range replayEvents {
+    if !matchStreamFilter.matches(event) {
+      continue
+    }
+
+    err := writeMatchEvent(res, event, userID)
+    if err != nil {
+      return
+    }
+  }
+  flusher.Flush()
+
+  heartbeat := time.NewTicker(matchStreamHeartbeatInterval)
+  defer heartbeat.Stop()
+
+  for {
+    select {
+    case <-req.Context().Done():
+      return
+    case <-expired:
+      return
+    case event, ok := <-subscription.Events:
+      // We drop streams that fall too far behind; the browser reconnects and catches up
+      if !ok {
+        return
+      }
+      if !matchStreamFilter.matches(event) {
+        continue
+      }
+
+      err := writeMatchEvent(res, event, userID)
+      if err != nil {
+        return
+      }
+      flusher.Flush()
+    case <-heartbeat.C:
+      _, err := fmt.Fprint(res, ": heartbeat\n\n")
+      if err != nil {
+        return
+      }
+      flusher.Flush()
+    }
+  }
+}
@@ -0,0 +1,374 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strconv"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// OpponentGetAllResponseData is the data we send back
+// after successfully getting all of a user's opponents
+type OpponentGetAllResponseData struct {
+  Opponents  []*db.OpponentView  `json:"opponents"`
+}
+
+
+// OpponentGetResponseData is the data we send back
+// after successfully getting a single opponent
+type OpponentGetResponseData struct {
+  Opponent  *db.OpponentView  `json:"opponent"`
+}
+
+
+// OpponentHistoryResponseData is the data we send back after
+// successfully getting every match against a given opponent
+type OpponentHistoryResponseData struct {
+  Opponent  *db.OpponentView  `json:"opponent"`
+  Matches   []*db.MatchView   `json:"matches"`
+}
+
+
+// OpponentCreateResponseData is the data we send
+// back after successfully creating a new opponent
+type OpponentCreateResponseData struct {
+  Opponent  *db.OpponentView  `json:"opponent"`
+}
+
+
+// OpponentUpdateResponseData is the data we send
+// back after successfully updating an opponent
+type OpponentUpdateResponseData struct {
+  Opponent  *db.OpponentView  `json:"opponent"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// OpponentRouter is responsible for serving "/api/opponent"
+// Basically, connecting to our Postgres DB for all
+// of the CRUD operations for our "Opponent" models
+type OpponentRouter struct {
+  Services  *Services
+}
+
+
+func (r *OpponentRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "getall":
+      r.handleGetAll(res, req)
+    default:
+      // Otherwise we're expecting /api/opponent/{id} or /api/opponent/{id}/history
+      opponentID, err := strconv.ParseInt(head, 10, 64)
+      if err != nil {
+        http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+        return
+      }
+
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "":
+        r.handleGetByID(res, req, opponentID)
+      case "history":
+        r.handleGetHistory(res, req, opponentID)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported GET path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "create":
+      r.handleCreate(res, req)
+    case "update":
+      r.handleUpdate(res, req)
+    case "delete":
+      r.handleDelete(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewOpponentRouter makes a new api/opponent router and hooks up its services
+func NewOpponentRouter(routerServices *Services) *OpponentRouter {
+  router := new(OpponentRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// checkOpponentOwner makes sure the logged in user owns the given opponent; opponents are
+// private to the user who recorded them. Writes the error response and returns false otherwise
+func (r *OpponentRouter) checkOpponentOwner(res http.ResponseWriter, req *http.Request, opponentID int64) bool {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return false
+  }
+
+  opponent, err := r.Services.Database.GetOpponentByOpponentID(opponentID)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Opponent %d does not exist", opponentID), http.StatusNotFound)
+    return false
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting opponent from database: %s", err.Error()), http.StatusInternalServerError)
+    return false
+  }
+
+  if opponent.UserID != userID {
+    http.Error(res, fmt.Sprintf("User not authorized to access opponent %d", opponentID), http.StatusUnauthorized)
+    return false
+  }
+
+  return true
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *OpponentRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  opponentViews, err := r.Services.Database.GetOpponentViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting opponents for userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     OpponentGetAllResponseData{
+      Opponents:  opponentViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *OpponentRouter) handleGetByID(res http.ResponseWriter, req *http.Request, opponentID int64) {
+  if !r.checkOpponentOwner(res, req, opponentID) {
+    return
+  }
+
+  opponentView, err := r.Services.Database.GetOpponentViewByOpponentID(opponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting opponent view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     OpponentGetResponseData{
+      Opponent:  opponentView,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *OpponentRouter) handleGetHistory(res http.ResponseWriter, req *http.Request, opponentID int64) {
+  if !r.checkOpponentOwner(res, req, opponentID) {
+    return
+  }
+
+  opponentView, err := r.Services.Database.GetOpponentViewByOpponentID(opponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting opponent view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  matchViews, err := r.Services.Database.GetMatchViewsByOpponentID(opponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting matches against opponent from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  matchTagViews, err := r.Services.Database.GetAllMatchTagViews(opponentView.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all matches tags from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  finalizedMatchViews := addMatchTagViewsToMatchViews(matchViews, matchTagViews)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     OpponentHistoryResponseData{
+      Opponent:  opponentView,
+      Matches:   finalizedMatchViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *OpponentRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  opponentCreate := new(db.OpponentCreate)
+
+  err := decoder.Decode(opponentCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Opponents always belong to whoever is logged in
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+  opponentCreate.UserID = userID
+
+  opponentID, err := r.Services.Database.CreateOpponent(opponentCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new opponent in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  opponentView, err := r.Services.Database.GetOpponentViewByOpponentID(opponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting new opponent view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityOpponent, opponentID, nil, opponentView)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     OpponentCreateResponseData{
+      Opponent:  opponentView,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *OpponentRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  opponentUpdate := new(db.OpponentUpdate)
+
+  err := decoder.Decode(opponentUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  if !r.checkOpponentOwner(res, req, opponentUpdate.OpponentID) {
+    return
+  }
+
+  existingOpponentView, err := r.Services.Database.GetOpponentViewByOpponentID(opponentUpdate.OpponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting opponent view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  opponentID, err := r.Services.Database.UpdateOpponent(opponentUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating opponent in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  opponentView, err := r.Services.Database.GetOpponentViewByOpponentID(opponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting updated opponent view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityOpponent, opponentID, existingOpponentView, opponentView)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     OpponentUpdateResponseData{
+      Opponent:  opponentView,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *OpponentRouter) handleDelete(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  opponentDelete := new(db.OpponentDelete)
+
+  err := decoder.Decode(opponentDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  if !r.checkOpponentOwner(res, req, opponentDelete.OpponentID) {
+    return
+  }
+
+  existingOpponentView, err := r.Services.Database.GetOpponentViewByOpponentID(opponentDelete.OpponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting opponent view: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  _, err = r.Services.Database.DeleteOpponentByOpponentID(opponentDelete.OpponentID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting opponent in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityOpponent, opponentDelete.OpponentID, existingOpponentView, nil)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
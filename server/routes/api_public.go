@@ -0,0 +1,192 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// PublicProfileResponseData is the data we send back after successfully
+// getting a user's public profile, along with their aggregate stats
+type PublicProfileResponseData struct {
+  User            *db.PublicProfileView        `json:"user"`
+  UserCharacters  []*db.UserCharacterView      `json:"userCharacters"`
+  Stages          []*db.StageWinRateView       `json:"stages"`
+  Archetypes      []*db.ArchetypeWinRateView   `json:"archetypes"`
+}
+
+
+// PublicShareResponseData is the data we send back after
+// successfully getting the matches behind a share link
+type PublicShareResponseData struct {
+  UserName   string           `json:"userName"`
+  ShareLink  *db.ShareLink    `json:"shareLink"`
+  Matches    []*db.MatchView  `json:"matches"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// PublicRouter is responsible for serving "/api/public"; the
+// only routes besides "/api/auth" that don't need a login
+type PublicRouter struct {
+  Services  *Services
+}
+
+
+func (r *PublicRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "u":
+      r.handleProfile(res, req)
+    case "s":
+      r.handleShare(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewPublicRouter makes a new api/public router and hooks up its services
+func NewPublicRouter(routerServices *Services) *PublicRouter {
+  router := new(PublicRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *PublicRouter) handleProfile(res http.ResponseWriter, req *http.Request) {
+  var userName string
+  userName, req.URL.Path = ShiftPath(req.URL.Path)
+
+  // Users without a public profile look exactly like users that don't exist
+  publicProfileView, err := r.Services.Database.GetPublicProfileViewByUserName(userName)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %s does not exist", userName), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting public profile for %s: %s", userName, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  userID := publicProfileView.UserID
+
+  userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user's saved characters with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  stageWinRateViews, err := r.Services.Database.GetStageWinRateViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting stage win rates for userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  archetypeWinRateViews, err := r.Services.Database.GetArchetypeWinRateViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting archetype win rates for userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     PublicProfileResponseData{
+      User:            publicProfileView,
+      UserCharacters:  userCharViews,
+      Stages:          stageWinRateViews,
+      Archetypes:      archetypeWinRateViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *PublicRouter) handleShare(res http.ResponseWriter, req *http.Request) {
+  var token string
+  token, req.URL.Path = ShiftPath(req.URL.Path)
+
+  shareLink, err := r.Services.Database.GetShareLinkByHashedToken(r.Services.Auth.HashSecretToken(token))
+  if err == sql.ErrNoRows {
+    http.Error(res, "Share link does not exist or has been revoked", http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting share link: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(shareLink.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user with userID %d: %s", shareLink.UserID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // The link's own user did the filtering, so their private tags still count for it
+  matchViewFilter := new(db.MatchViewFilter)
+  matchViewFilter.UserID.Valid = true
+  matchViewFilter.UserID.Int64 = shareLink.UserID
+  matchViewFilter.ArchetypeID = shareLink.ArchetypeID
+  matchViewFilter.SeriesID = shareLink.SeriesID
+  matchViewFilter.TagID = shareLink.TagID
+  matchViewFilter.ViewerUserID = shareLink.UserID
+
+  matchViews, err := r.Services.Database.GetAllMatchViews(matchViewFilter)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting shared matches from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Anyone can see this, so only global tags are shown
+  matchTagViews, err := r.Services.Database.GetAllMatchTagViews(0)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all matches tags from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Opponents are a user's own notes on who they played, so they aren't shared either
+  for _, matchView := range matchViews {
+    matchView.OpponentID = db.NullInt64JSON{}
+    matchView.OpponentAlias = db.NullStringJSON{}
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     PublicShareResponseData{
+      UserName:   userProfileView.UserName,
+      ShareLink:  shareLink,
+      Matches:    addMatchTagViewsToMatchViews(matchViews, matchTagViews),
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
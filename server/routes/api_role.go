@@ -0,0 +1,192 @@
+package routes
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/auth"
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// RoleGetAllResponseData is the data we send back
+// after a successfully getting all roles and their permissions
+type RoleGetAllResponseData struct {
+  Roles  []*db.Role  `json:"roles"`
+}
+
+
+// UserRoleUpdateResponseData is the data we send back
+// after successfully giving a user a role or taking one away
+type UserRoleUpdateResponseData struct {
+  UserRoles  []*db.UserRoleView  `json:"userRoles"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// RoleRouter is responsible for serving "/api/role"
+type RoleRouter struct {
+  Services  *Services
+}
+
+
+func (r *RoleRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "getall":
+      r.handleGetAll(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    if !checkPermission(r.Services, res, req, auth.PermissionManageRoles) {
+      return
+    }
+
+    if head != "user" {
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+
+    head, req.URL.Path = ShiftPath(req.URL.Path)
+    switch head {
+    case "add":
+      r.handleUserAdd(res, req)
+    case "remove":
+      r.handleUserRemove(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path user/%s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewRoleRouter makes a new api/role router and hooks up its services
+func NewRoleRouter(routerServices *Services) *RoleRouter {
+  router := new(RoleRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *RoleRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
+  roles, err := r.Services.Database.GetAllRoles()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting roles from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     RoleGetAllResponseData{
+      Roles:  roles,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *RoleRouter) handleUserAdd(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  userRoleCreate := new(db.UserRoleCreate)
+
+  err := decoder.Decode(userRoleCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingUserRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userRoleCreate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user roles from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  _, err = r.Services.Database.CreateUserRole(userRoleCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error adding user role in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  r.respondWithUserRoles(res, req, userRoleCreate.UserID, existingUserRoleViews)
+}
+
+
+func (r *RoleRouter) handleUserRemove(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  userRoleDelete := new(db.UserRoleDelete)
+
+  err := decoder.Decode(userRoleDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingUserRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userRoleDelete.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user roles from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  _, err = r.Services.Database.DeleteUserRole(userRoleDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error removing user role in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  r.respondWithUserRoles(res, req, userRoleDelete.UserID, existingUserRoleViews)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// respondWithUserRoles records a change to a user's roles and sends back their roles afterwards
+func (r *RoleRouter) respondWithUserRoles(res http.ResponseWriter, req *http.Request, userID int64, existingUserRoleViews []*db.UserRoleView) {
+  userRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user roles from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionSetRoles, auditEntityUser, userID, existingUserRoleViews, userRoleViews)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     UserRoleUpdateResponseData{
+      UserRoles:  userRoleViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
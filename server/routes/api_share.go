@@ -0,0 +1,227 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// ShareGetAllResponseData is the data we send back
+// after successfully getting all of a user's share links
+type ShareGetAllResponseData struct {
+  ShareLinks  []*db.ShareLink  `json:"shareLinks"`
+}
+
+
+// ShareCreateResponseData is the data we send back after successfully creating a share link;
+// this is the only time the token is ever sent, since we only keep a hash of it
+type ShareCreateResponseData struct {
+  ShareLink  *db.ShareLink  `json:"shareLink"`
+  Token      string         `json:"token"`
+}
+
+
+// ShareRevokeResponseData is the data we send
+// back after successfully revoking a share link
+type ShareRevokeResponseData struct {
+  ShareLinks  []*db.ShareLink  `json:"shareLinks"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// ShareRouter is responsible for serving "/api/share"; the
+// logged in user managing share links to their own matches
+type ShareRouter struct {
+  Services  *Services
+}
+
+
+func (r *ShareRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "getall":
+      r.handleGetAll(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "create":
+      r.handleCreate(res, req)
+    case "revoke":
+      r.handleRevoke(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewShareRouter makes a new api/share router and hooks up its services
+func NewShareRouter(routerServices *Services) *ShareRouter {
+  router := new(ShareRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *ShareRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  shareLinks, err := r.Services.Database.GetShareLinksByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting share links from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     ShareGetAllResponseData{
+      ShareLinks:  shareLinks,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *ShareRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  shareLinkCreate := new(db.ShareLinkCreate)
+
+  err := decoder.Decode(shareLinkCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Users can only share their own matches
+  shareLinkCreate.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  if shareLinkCreate.TagID.Valid {
+    tag, err := r.Services.Database.GetTagByTagID(int(shareLinkCreate.TagID.Int64))
+    if err != nil && err != sql.ErrNoRows {
+      http.Error(res, fmt.Sprintf("Error getting filter tag from DB: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    if err == sql.ErrNoRows || (tag.UserID.Valid && tag.UserID.Int64 != shareLinkCreate.UserID) {
+      http.Error(res, fmt.Sprintf("Tag %d does not exist", shareLinkCreate.TagID.Int64), http.StatusNotFound)
+      return
+    }
+  }
+
+  token, hashedToken, err := r.Services.Auth.GetNewSecretToken()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error generating share link token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  shareLinkCreate.HashedToken = hashedToken
+
+  shareLinkID, err := r.Services.Database.CreateShareLink(shareLinkCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating share link in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  shareLink, err := r.Services.Database.GetShareLinkByHashedToken(hashedToken)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting share link from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityShareLink, shareLinkID, nil, shareLink)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     ShareCreateResponseData{
+      ShareLink:  shareLink,
+      Token:      token,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *ShareRouter) handleRevoke(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  shareLinkRevoke := new(db.ShareLinkRevoke)
+
+  err := decoder.Decode(shareLinkRevoke)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  shareLinkRevoke.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  shareLinkID, err := r.Services.Database.RevokeShareLink(shareLinkRevoke)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Share link %d does not exist", shareLinkRevoke.ShareLinkID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error revoking share link in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionRevoke, auditEntityShareLink, shareLinkID, nil, nil)
+
+  shareLinks, err := r.Services.Database.GetShareLinksByUserID(shareLinkRevoke.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting share links from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     ShareRevokeResponseData{
+      ShareLinks:  shareLinks,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
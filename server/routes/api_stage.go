@@ -0,0 +1,183 @@
+package routes
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/auth"
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// StageGetAllResponseData is the data we send back
+// after a successfully getting all stage data
+type StageGetAllResponseData struct {
+  Stages  []*db.Stage  `json:"stages"`
+}
+
+
+// StageCreateResponseData is the data we send
+// back after a successfully creating a new stage
+type StageCreateResponseData struct {
+  Stage  *db.Stage  `json:"stage"`
+}
+
+
+// StageUpdateResponseData is the data we send
+// back after a successfully updating a stage
+type StageUpdateResponseData struct {
+  Stage  *db.Stage  `json:"stage"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// StageRouter is responsible for serving "/api/stage"
+// Basically, connecting to our Postgres DB for all
+// of the CRUD operations for our "Stage" models
+type StageRouter struct {
+  Services  *Services
+}
+
+
+func (r *StageRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "getall":
+      r.handleGetAll(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    if !checkPermission(r.Services, res, req, auth.PermissionManageStages) {
+      return
+    }
+
+    switch head {
+    case "create":
+      r.handleCreate(res, req)
+    case "update":
+      r.handleUpdate(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewStageRouter makes a new api/stage router and hooks up its services
+func NewStageRouter(routerServices *Services) *StageRouter {
+  router := new(StageRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *StageRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
+  stages, err := r.Services.Database.GetAllStages()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all stages from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     StageGetAllResponseData{
+      Stages:  stages,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *StageRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  stageCreate := new(db.StageCreate)
+
+  err := decoder.Decode(stageCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  stage, err := r.Services.Database.CreateStage(stageCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new stage in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityStage, stage.StageID, nil, stage)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     StageCreateResponseData{
+      Stage:  stage,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *StageRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  stageUpdate := new(db.StageUpdate)
+
+  err := decoder.Decode(stageUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingStage, err := r.Services.Database.GetStageByStageID(stageUpdate.StageID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting stage from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  stage, err := r.Services.Database.UpdateStage(stageUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating stage in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityStage, stage.StageID, existingStage, stage)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     StageUpdateResponseData{
+      Stage:  stage,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
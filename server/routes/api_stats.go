@@ -0,0 +1,201 @@
+package routes
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strconv"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// StatsStagesResponseData is the data we send back
+// after successfully getting a user's win rates by stage
+type StatsStagesResponseData struct {
+  Stages    []*db.StageWinRateView         `json:"stages"`
+  Matchups  []*db.StageMatchupWinRateView  `json:"matchups"`
+}
+
+
+// StatsArchetypesResponseData is the data we send back after
+// successfully getting a user's win rates by opponent archetype
+type StatsArchetypesResponseData struct {
+  Archetypes  []*db.ArchetypeWinRateView  `json:"archetypes"`
+}
+
+
+// StatsTagsResponseData is the data we send back after
+// successfully getting tag usage for a user or for everyone
+type StatsTagsResponseData struct {
+  Tags      []*db.TagUsageView  `json:"tags"`
+  TagPairs  []*db.TagPairView   `json:"tagPairs"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// StatsRouter is responsible for serving "/api/stats"
+// Basically, all of the aggregated, read only reports on our "Match" models
+type StatsRouter struct {
+  Services  *Services
+}
+
+
+func (r *StatsRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "stages":
+      r.handleStages(res, req)
+    case "archetypes":
+      r.handleArchetypes(res, req)
+    case "tags":
+      r.handleTags(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewStatsRouter makes a new api/stats router and hooks up its services
+func NewStatsRouter(routerServices *Services) *StatsRouter {
+  router := new(StatsRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *StatsRouter) handleStages(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  userID, err := strconv.ParseInt(head, 10, 64)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid user id: %s", head), http.StatusBadRequest)
+    return
+  }
+
+  stageWinRateViews, err := r.Services.Database.GetStageWinRateViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting stage win rates for userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  stageMatchupWinRateViews, err := r.Services.Database.GetStageMatchupWinRateViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting stage matchup win rates for userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     StatsStagesResponseData{
+      Stages:    stageWinRateViews,
+      Matchups:  stageMatchupWinRateViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *StatsRouter) handleArchetypes(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  userID, err := strconv.ParseInt(head, 10, 64)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid user id: %s", head), http.StatusBadRequest)
+    return
+  }
+
+  archetypeWinRateViews, err := r.Services.Database.GetArchetypeWinRateViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting archetype win rates for userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     StatsArchetypesResponseData{
+      Archetypes:  archetypeWinRateViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *StatsRouter) handleTags(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  // We're expecting either /api/stats/tags for everyone, or /api/stats/tags/{userId}
+  tagStatsFilter := new(db.TagStatsFilter)
+  if head != "" {
+    userID, err := strconv.ParseInt(head, 10, 64)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Invalid user id: %s", head), http.StatusBadRequest)
+      return
+    }
+    tagStatsFilter.UserID.Int64 = userID
+    tagStatsFilter.UserID.Valid = true
+  }
+
+  viewerUserID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+  tagStatsFilter.ViewerUserID = viewerUserID
+
+  tagUsageViews, err := r.Services.Database.GetTagUsageViews(tagStatsFilter)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting tag usage: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  tagPairViews, err := r.Services.Database.GetTagPairViews(tagStatsFilter)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting tag pairs: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     StatsTagsResponseData{
+      Tags:      tagUsageViews,
+      TagPairs:  tagPairViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
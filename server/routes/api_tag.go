@@ -1,10 +1,12 @@
 package routes
 
 import (
+  "database/sql"
   "encoding/json"
   "fmt"
   "net/http"
 
+  "github.com/cakebin/smush/server/services/auth"
   "github.com/cakebin/smush/server/services/db"
 )
 
@@ -16,7 +18,8 @@ import (
 // TagGetAllResponseData is the data we send back
 // after a successfully getiing all tags in our db
 type TagGetAllResponseData struct {
-  Tags  []*db.Tag  `json:"tags"`
+  Tags     []*db.Tag          `json:"tags"`
+  TagTree  []*db.TagTreeNode  `json:"tagTree"`
 }
 
 
@@ -34,6 +37,36 @@ type TagUpdateResponseData struct {
 }
 
 
+// TagCategoryGetAllResponseData is the data we send
+// back after successfully getting all tag categories
+type TagCategoryGetAllResponseData struct {
+  TagCategories  []*db.TagCategory  `json:"tagCategories"`
+}
+
+
+// TagCategoryCreateResponseData is the data we send
+// back after successfully creating a new tag category
+type TagCategoryCreateResponseData struct {
+  TagCategory  *db.TagCategory  `json:"tagCategory"`
+}
+
+
+// TagCategoryUpdateResponseData is the data we send
+// back after successfully updating a tag category
+type TagCategoryUpdateResponseData struct {
+  TagCategory  *db.TagCategory  `json:"tagCategory"`
+}
+
+
+// TagMergeResponseData is the data we send back
+// after successfully merging tags into another tag
+type TagMergeResponseData struct {
+  Tag          *db.Tag             `json:"tag"`
+  TagAliases   []*db.TagAlias      `json:"tagAliases"`
+  MergeResult  *db.TagMergeResult  `json:"mergeResult"`
+}
+
+
 /*---------------------------------
              Router
 ----------------------------------*/
@@ -54,30 +87,22 @@ func (r *TagRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     switch head {
     case "getall":
       r.handleGetAll(res, req)
+    case "category":
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "getall":
+        r.handleGetAllCategories(res, req)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported GET path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
     default:
       http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
       return
     }
   // POST Request Handlers
   case http.MethodPost:
-    // Check for admin role
-    accessCookie, err := req.Cookie("smush-access-token")
-    if err != nil {
-      http.Error(res, fmt.Sprintf("Access token expired; can't get user ID from cookie"), http.StatusUnauthorized)
-      return
-    }
-    userID, err := r.Services.Auth.GetUserIDFromJWTToken(accessCookie.Value)
-    userRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userID)
-    if err != nil {
-      http.Error(res, fmt.Sprintf("Error fetching user role from db: %s", err.Error()), http.StatusInternalServerError)
-      return
-    }
-    hasRoleAdmin := r.Services.Auth.HasRoleAdmin(userRoleViews)
-    if !hasRoleAdmin {
-      http.Error(res, fmt.Sprintf("User not authorized to POST to api/tag"), http.StatusUnauthorized)
-      return
-    }
-
     switch head {
     case "create":
       r.handleCreate(res, req)
@@ -85,6 +110,27 @@ func (r *TagRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
       r.handleUpdate(res, req)
     case "delete":
       r.handleDelete(res, req)
+    case "merge":
+      r.handleMerge(res, req)
+    case "category":
+      // Tag categories are shared by everyone, just like global tags
+      if !checkPermission(r.Services, res, req, auth.PermissionManageTags) {
+        return
+      }
+
+      var subHead string
+      subHead, req.URL.Path = ShiftPath(req.URL.Path)
+      switch subHead {
+      case "create":
+        r.handleCreateCategory(res, req)
+      case "update":
+        r.handleUpdateCategory(res, req)
+      case "delete":
+        r.handleDeleteCategory(res, req)
+      default:
+        http.Error(res, fmt.Sprintf("Unsupported POST path %s/%s", head, subHead), http.StatusBadRequest)
+        return
+      }
     default:
       http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
       return
@@ -106,13 +152,114 @@ func NewTagRouter(routerServices *Services) *TagRouter {
 }
 
 
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// checkTagAccess makes sure the given user is allowed to change a tag owned by tagUserID;
+// users manage their own private tags, and global ones need the tags:manage permission.
+// Writes the error response and returns false otherwise
+func (r *TagRouter) checkTagAccess(res http.ResponseWriter, req *http.Request, userID int64, tagUserID db.NullInt64JSON) bool {
+  if tagUserID.Valid {
+    if tagUserID.Int64 != userID {
+      http.Error(res, fmt.Sprintf("User not authorized to change another user's tags"), http.StatusUnauthorized)
+      return false
+    }
+    return true
+  }
+
+  return checkPermission(r.Services, res, req, auth.PermissionManageTags)
+}
+
+
+// checkExistingTagAccess looks up an existing tag and makes sure the logged in user is
+// allowed to change it. Writes the error response and returns false otherwise
+func (r *TagRouter) checkExistingTagAccess(res http.ResponseWriter, req *http.Request, tagID int) (*db.Tag, bool) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return nil, false
+  }
+
+  tag, err := r.Services.Database.GetTagByTagID(tagID)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Tag %d does not exist", tagID), http.StatusNotFound)
+    return nil, false
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting tag from database: %s", err.Error()), http.StatusInternalServerError)
+    return nil, false
+  }
+
+  // Someone else's private tag may as well not exist
+  if tag.UserID.Valid && tag.UserID.Int64 != userID {
+    http.Error(res, fmt.Sprintf("Tag %d does not exist", tagID), http.StatusNotFound)
+    return nil, false
+  }
+
+  return tag, r.checkTagAccess(res, req, userID, tag.UserID)
+}
+
+
+// checkParentTag makes sure a tag (with ID tagID, or 0 for a new tag) can be nested under
+// parentTagID. Global tags can only be nested under other global tags, private tags can also
+// be nested under their owner's tags, and a tag can't be nested under one of its own children.
+// Writes the error response and returns false otherwise
+func (r *TagRouter) checkParentTag(res http.ResponseWriter, tagID int, tagUserID db.NullInt64JSON, parentTagID db.NullInt64JSON) bool {
+  if !parentTagID.Valid {
+    return true
+  }
+
+  parentTag, err := r.Services.Database.GetTagByTagID(int(parentTagID.Int64))
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Parent tag %d does not exist", parentTagID.Int64), http.StatusBadRequest)
+    return false
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting parent tag from database: %s", err.Error()), http.StatusInternalServerError)
+    return false
+  }
+
+  if parentTag.UserID.Valid && parentTag.UserID != tagUserID {
+    http.Error(res, fmt.Sprintf("Parent tag %d does not exist", parentTagID.Int64), http.StatusBadRequest)
+    return false
+  }
+
+  if tagID == 0 {
+    return true
+  }
+  if parentTag.TagID == tagID {
+    http.Error(res, fmt.Sprintf("Tag %d can't be its own parent", tagID), http.StatusBadRequest)
+    return false
+  }
+
+  descendantTagIDs, err := r.Services.Database.GetTagDescendantIDs(tagID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting nested tags from database: %s", err.Error()), http.StatusInternalServerError)
+    return false
+  }
+  for _, descendantTagID := range descendantTagIDs {
+    if descendantTagID == parentTag.TagID {
+      http.Error(res, fmt.Sprintf("Tag %d can't be nested under its own child tag %d", tagID, parentTag.TagID), http.StatusBadRequest)
+      return false
+    }
+  }
+
+  return true
+}
+
+
 /*---------------------------------
              Handlers
 ----------------------------------*/
 
 
 func (r *TagRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
-  tags, err := r.Services.Database.GetAllTags()
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  tags, err := r.Services.Database.GetAllTagsByUserID(userID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error getting all tags from DB: %s", err.Error()), http.StatusInternalServerError)
     return
@@ -122,7 +269,8 @@ func (r *TagRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
     Success:  true,
     Error:    nil,
     Data:     TagGetAllResponseData{
-      Tags: tags,
+      Tags:     tags,
+      TagTree:  db.MakeTagTree(tags),
     },
   }
 
@@ -141,6 +289,19 @@ func (r *TagRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+  // Leaving out the user makes a global tag
+  if !r.checkTagAccess(res, req, userID, tagCreate.UserID) {
+    return
+  }
+  if !r.checkParentTag(res, 0, tagCreate.UserID, tagCreate.ParentTagID) {
+    return
+  }
+
   tagID, err := r.Services.Database.CreateTag(tagCreate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error creating new tag in database: %s", err.Error()), http.StatusInternalServerError)
@@ -152,6 +313,7 @@ func (r *TagRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
     http.Error(res, fmt.Sprintf("Error getting new tag in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityTag, int64(tag.TagID), nil, tag)
 
   response := &Response{
     Success:  true,
@@ -176,6 +338,14 @@ func (r *TagRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  existingTag, hasAccess := r.checkExistingTagAccess(res, req, tagUpdate.TagID)
+  if !hasAccess {
+    return
+  }
+  if !r.checkParentTag(res, tagUpdate.TagID, existingTag.UserID, tagUpdate.ParentTagID) {
+    return
+  }
+
   tagID, err := r.Services.Database.UpdateTag(tagUpdate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error update tag in database: %s", err.Error()), http.StatusInternalServerError)
@@ -187,6 +357,7 @@ func (r *TagRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
     http.Error(res, fmt.Sprintf("Error getting updated tag in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityTag, int64(tag.TagID), existingTag, tag)
 
   response := &Response{
     Success:  true,
@@ -211,11 +382,238 @@ func (r *TagRouter) handleDelete(res http.ResponseWriter, req *http.Request) {
     return
   }
 
-  _, err = r.Services.Database.DeleteTagByTagID(tagDelete.TagID)
-  if err != nil {
+  existingTag, hasAccess := r.checkExistingTagAccess(res, req, int(tagDelete.TagID))
+  if !hasAccess {
+    return
+  }
+
+  _, err = r.Services.Database.DeleteTagByTagID(tagDelete.TagID, tagDelete.Cascade)
+  if err == db.ErrTagInUse {
+    http.Error(res, fmt.Sprintf("Tag %d is still on matches; merge it into another tag or delete with cascade", tagDelete.TagID), http.StatusConflict)
+    return
+  } else if err != nil {
     http.Error(res, fmt.Sprintf("Error deleting tag in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityTag, tagDelete.TagID, existingTag, nil)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TagRouter) handleMerge(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  tagMerge := new(db.TagMerge)
+
+  err := decoder.Decode(tagMerge)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  if len(tagMerge.SourceTagIDs) == 0 {
+    http.Error(res, fmt.Sprintf("Need at least one tag to merge"), http.StatusBadRequest)
+    return
+  }
+  seenTagIDs := make(map[int64]bool)
+  for _, sourceTagID := range tagMerge.SourceTagIDs {
+    if sourceTagID == tagMerge.TargetTagID || seenTagIDs[sourceTagID] {
+      http.Error(res, fmt.Sprintf("Tag %d can't be merged more than once", sourceTagID), http.StatusBadRequest)
+      return
+    }
+    seenTagIDs[sourceTagID] = true
+  }
+
+  // Merging is for cleaning up the global tags, so it never touches anyone's private tags
+  if !checkPermission(r.Services, res, req, auth.PermissionManageTags) {
+    return
+  }
+  sourceTags := make([]*db.Tag, 0)
+  for _, tagID := range append(tagMerge.SourceTagIDs, tagMerge.TargetTagID) {
+    tag, hasAccess := r.checkExistingTagAccess(res, req, int(tagID))
+    if !hasAccess {
+      return
+    }
+    if tag.UserID.Valid {
+      http.Error(res, fmt.Sprintf("Only global tags can be merged"), http.StatusBadRequest)
+      return
+    }
+    if tagID != tagMerge.TargetTagID {
+      sourceTags = append(sourceTags, tag)
+    }
+  }
+
+  // The source tags' children move under the target, so the target can't be one of them
+  // (or nested any deeper), or it would end up nested under itself
+  for _, sourceTagID := range tagMerge.SourceTagIDs {
+    descendantTagIDs, err := r.Services.Database.GetTagDescendantIDs(int(sourceTagID))
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error getting nested tags from database: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    for _, descendantTagID := range descendantTagIDs {
+      if int64(descendantTagID) == tagMerge.TargetTagID {
+        http.Error(res, fmt.Sprintf("Tag %d can't be merged into its own nested tag %d", sourceTagID, tagMerge.TargetTagID), http.StatusBadRequest)
+        return
+      }
+    }
+  }
+
+  tagMergeResult, err := r.Services.Database.MergeTags(tagMerge)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Tags to merge no longer exist"), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error merging tags in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  tag, err := r.Services.Database.GetTagByTagID(int(tagMerge.TargetTagID))
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting merged tag in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  tagAliases, err := r.Services.Database.GetTagAliasesByTagID(int(tagMerge.TargetTagID))
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting merged tag aliases in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Each merged tag is gone afterwards, so record what it was merged into
+  for _, sourceTag := range sourceTags {
+    recordAudit(r.Services, req, auditActionMerge, auditEntityTag, int64(sourceTag.TagID), sourceTag, tag)
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TagMergeResponseData{
+      Tag:          tag,
+      TagAliases:   tagAliases,
+      MergeResult:  tagMergeResult,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TagRouter) handleGetAllCategories(res http.ResponseWriter, req *http.Request) {
+  tagCategories, err := r.Services.Database.GetAllTagCategories()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all tag categories from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TagCategoryGetAllResponseData{
+      TagCategories:  tagCategories,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TagRouter) handleCreateCategory(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  tagCategoryCreate := new(db.TagCategoryCreate)
+
+  err := decoder.Decode(tagCategoryCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  tagCategory, err := r.Services.Database.CreateTagCategory(tagCategoryCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating new tag category in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityTagCategory, tagCategory.TagCategoryID, nil, tagCategory)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TagCategoryCreateResponseData{
+      TagCategory:  tagCategory,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TagRouter) handleUpdateCategory(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  tagCategoryUpdate := new(db.TagCategoryUpdate)
+
+  err := decoder.Decode(tagCategoryUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingTagCategory, err := r.Services.Database.GetTagCategoryByTagCategoryID(tagCategoryUpdate.TagCategoryID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting tag category from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  tagCategory, err := r.Services.Database.UpdateTagCategory(tagCategoryUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating tag category in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityTagCategory, tagCategory.TagCategoryID, existingTagCategory, tagCategory)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TagCategoryUpdateResponseData{
+      TagCategory:  tagCategory,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TagRouter) handleDeleteCategory(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  tagCategoryDelete := new(db.TagCategoryDelete)
+
+  err := decoder.Decode(tagCategoryDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  existingTagCategory, err := r.Services.Database.GetTagCategoryByTagCategoryID(tagCategoryDelete.TagCategoryID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting tag category from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  _, err = r.Services.Database.DeleteTagCategoryByTagCategoryID(tagCategoryDelete.TagCategoryID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting tag category in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityTagCategory, tagCategoryDelete.TagCategoryID, existingTagCategory, nil)
 
   response := &Response{
     Success:  true,
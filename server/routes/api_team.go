@@ -0,0 +1,800 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "log"
+  "net/http"
+  "net/mail"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/cakebin/smush/server/services/db"
+  "github.com/cakebin/smush/server/services/email"
+)
+
+
+// How long a team invite can be accepted for, and how many matches the team activity shows
+const (
+  teamInviteExpiration  = 7 * 24 * time.Hour
+  teamActivityMatches   = 50
+)
+
+
+// teamRoleRanks orders the team roles; a member can only manage members ranked below them
+var teamRoleRanks = map[string]int{
+  db.TeamRoleOwner:   3,
+  db.TeamRoleAdmin:   2,
+  db.TeamRoleMember:  1,
+}
+
+
+/*---------------------------------
+          Request Data
+----------------------------------*/
+
+// TeamDeleteRequestData is the data we
+// need to delete a team and everything on it
+type TeamDeleteRequestData struct {
+  TeamID  int64  `json:"teamId"`
+}
+
+
+// TeamAcceptInviteRequestData is the data we need
+// to accept a team invite from its emailed link
+type TeamAcceptInviteRequestData struct {
+  Token  string  `json:"token"`
+}
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// TeamGetAllResponseData is the data we send back after
+// successfully getting every team the logged in user is on
+type TeamGetAllResponseData struct {
+  Teams  []*db.UserTeamView  `json:"teams"`
+}
+
+
+// TeamGetResponseData is the data we send back after successfully getting a team's members;
+// pending invites are only sent to the members who can manage them
+type TeamGetResponseData struct {
+  Team            *db.Team          `json:"team"`
+  TeamRole        string            `json:"teamRole"`
+  TeamMembers     []*db.TeamMember  `json:"teamMembers"`
+  PendingInvites  []*db.TeamInvite  `json:"pendingInvites"`
+}
+
+
+// TeamStatsResponseData is the data we send back after successfully getting a team's matchup
+// chart; the team-wide win rates, and every member's own win rates against each character
+type TeamStatsResponseData struct {
+  Matchups        []*db.TeamMatchupWinRateView        `json:"matchups"`
+  MemberMatchups  []*db.TeamMemberMatchupWinRateView  `json:"memberMatchups"`
+}
+
+
+// TeamActivityResponseData is the data we send back after successfully
+// getting the latest matches recorded by anyone on a team
+type TeamActivityResponseData struct {
+  Matches  []*db.MatchView  `json:"matches"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// TeamRouter is responsible for serving "/api/team"; teams of users who share a dashboard of
+// each other's matches. Everything about a team is only visible to the users on it
+type TeamRouter struct {
+  Services  *Services
+}
+
+
+func (r *TeamRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "getall":
+      r.handleGetAll(res, req)
+    case "get":
+      r.handleGet(res, req)
+    case "stats":
+      r.handleStats(res, req)
+    case "activity":
+      r.handleActivity(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "create":
+      r.handleCreate(res, req)
+    case "update":
+      r.handleUpdate(res, req)
+    case "delete":
+      r.handleDelete(res, req)
+    case "invite":
+      r.handleInvite(res, req)
+    case "revoke_invite":
+      r.handleRevokeInvite(res, req)
+    case "accept_invite":
+      r.handleAcceptInvite(res, req)
+    case "set_role":
+      r.handleSetRole(res, req)
+    case "remove_member":
+      r.handleRemoveMember(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewTeamRouter makes a new api/team router and hooks up its services
+func NewTeamRouter(routerServices *Services) *TeamRouter {
+  router := new(TeamRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *TeamRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  userTeamViews, err := r.Services.Database.GetUserTeamViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting teams from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TeamGetAllResponseData{
+      Teams:  userTeamViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TeamRouter) handleGet(res http.ResponseWriter, req *http.Request) {
+  teamMember, ok := r.getTeamMemberFromPath(res, req)
+  if !ok {
+    return
+  }
+
+  r.sendTeam(res, teamMember)
+}
+
+
+func (r *TeamRouter) handleStats(res http.ResponseWriter, req *http.Request) {
+  teamMember, ok := r.getTeamMemberFromPath(res, req)
+  if !ok {
+    return
+  }
+
+  teamMatchupWinRateViews, err := r.Services.Database.GetTeamMatchupWinRateViewsByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting matchup win rates for teamID %d: %s", teamMember.TeamID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  teamMemberMatchupWinRateViews, err := r.Services.Database.GetTeamMemberMatchupWinRateViewsByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting member matchup win rates for teamID %d: %s", teamMember.TeamID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TeamStatsResponseData{
+      Matchups:        teamMatchupWinRateViews,
+      MemberMatchups:  teamMemberMatchupWinRateViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TeamRouter) handleActivity(res http.ResponseWriter, req *http.Request) {
+  teamMember, ok := r.getTeamMemberFromPath(res, req)
+  if !ok {
+    return
+  }
+
+  matchViews, err := r.Services.Database.GetRecentMatchViewsByTeamID(teamMember.TeamID, teamActivityMatches)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team matches from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Only global tags are shown; the rest are each member's own
+  matchTagViews, err := r.Services.Database.GetAllMatchTagViews(0)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting all matches tags from DB: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Opponents are a user's own notes on who they played, so they aren't shared with the team
+  for _, matchView := range matchViews {
+    if matchView.UserID != teamMember.UserID {
+      matchView.OpponentID = db.NullInt64JSON{}
+      matchView.OpponentAlias = db.NullStringJSON{}
+    }
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TeamActivityResponseData{
+      Matches:  addMatchTagViewsToMatchViews(matchViews, matchTagViews),
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TeamRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamCreate := new(db.TeamCreate)
+
+  err := decoder.Decode(teamCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  teamCreate.TeamName = strings.TrimSpace(teamCreate.TeamName)
+  if teamCreate.TeamName == "" || len(teamCreate.TeamName) > 100 {
+    http.Error(res, "Team names must be between 1 and 100 characters", http.StatusBadRequest)
+    return
+  }
+
+  // Whoever makes the team owns it
+  teamCreate.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  teamID, err := r.Services.Database.CreateTeam(teamCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating team in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  team, err := r.Services.Database.GetTeamByTeamID(teamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team from database after creating it: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityTeam, teamID, nil, team)
+
+  teamMember, err := r.Services.Database.GetTeamMember(teamID, teamCreate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team member from database after creating team: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  r.sendTeam(res, teamMember)
+}
+
+
+func (r *TeamRouter) handleUpdate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamUpdate := new(db.TeamUpdate)
+
+  err := decoder.Decode(teamUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  teamUpdate.TeamName = strings.TrimSpace(teamUpdate.TeamName)
+  if teamUpdate.TeamName == "" || len(teamUpdate.TeamName) > 100 {
+    http.Error(res, "Team names must be between 1 and 100 characters", http.StatusBadRequest)
+    return
+  }
+
+  teamMember, ok := r.getTeamMember(res, req, teamUpdate.TeamID)
+  if !ok || !checkTeamRole(res, teamMember, db.TeamRoleAdmin) {
+    return
+  }
+
+  existingTeam, err := r.Services.Database.GetTeamByTeamID(teamUpdate.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  teamID, err := r.Services.Database.UpdateTeam(teamUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating team in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  team, err := r.Services.Database.GetTeamByTeamID(teamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team from database after updating it: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityTeam, teamID, existingTeam, team)
+
+  r.sendTeam(res, teamMember)
+}
+
+
+func (r *TeamRouter) handleDelete(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamDeleteRequestData := new(TeamDeleteRequestData)
+
+  err := decoder.Decode(teamDeleteRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  teamMember, ok := r.getTeamMember(res, req, teamDeleteRequestData.TeamID)
+  if !ok || !checkTeamRole(res, teamMember, db.TeamRoleOwner) {
+    return
+  }
+
+  existingTeam, err := r.Services.Database.GetTeamByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  teamID, err := r.Services.Database.DeleteTeamByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting team from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityTeam, teamID, existingTeam, nil)
+
+  r.handleGetAll(res, req)
+}
+
+
+// handleInvite emails someone a link to join a team; the token in the link is only ever sent in that email
+func (r *TeamRouter) handleInvite(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamInviteCreate := new(db.TeamInviteCreate)
+
+  err := decoder.Decode(teamInviteCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  emailAddress, err := mail.ParseAddress(strings.TrimSpace(teamInviteCreate.EmailAddress))
+  if err != nil || len(emailAddress.Address) > 100 {
+    http.Error(res, fmt.Sprintf("Invalid email address %s", teamInviteCreate.EmailAddress), http.StatusBadRequest)
+    return
+  }
+  teamInviteCreate.EmailAddress = emailAddress.Address
+
+  if teamInviteCreate.TeamRole == "" {
+    teamInviteCreate.TeamRole = db.TeamRoleMember
+  }
+  if teamInviteCreate.TeamRole != db.TeamRoleAdmin && teamInviteCreate.TeamRole != db.TeamRoleMember {
+    http.Error(res, fmt.Sprintf("Invalid team role %s; invites can only be for %s or %s", teamInviteCreate.TeamRole, db.TeamRoleAdmin, db.TeamRoleMember), http.StatusBadRequest)
+    return
+  }
+
+  teamMember, ok := r.getTeamMember(res, req, teamInviteCreate.TeamID)
+  if !ok || !checkTeamRole(res, teamMember, db.TeamRoleAdmin) {
+    return
+  }
+  teamInviteCreate.InvitedByUserID = teamMember.UserID
+
+  token, hashedToken, err := r.Services.Auth.GetNewSecretToken()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error generating team invite token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  teamInviteCreate.HashedToken = hashedToken
+  teamInviteCreate.ExpiresAt = time.Now().Add(teamInviteExpiration)
+
+  teamInviteID, err := r.Services.Database.CreateTeamInvite(teamInviteCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating team invite in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityTeamInvite, teamInviteID, nil, teamInviteCreate)
+
+  team, err := r.Services.Database.GetTeamByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  success, err := sendTeamInviteEmail(r.Services, team, teamMember, teamInviteCreate, token)
+  if !success || err != nil {
+    // The invite was made, but nobody got the link; revoke it so it isn't left pending
+    teamInviteRevoke := &db.TeamInviteRevoke{TeamInviteID: teamInviteID, TeamID: teamMember.TeamID}
+    _, revokeErr := r.Services.Database.RevokeTeamInvite(teamInviteRevoke)
+    if revokeErr != nil {
+      log.Printf("Error revoking team invite %d after failing to email it: %s", teamInviteID, revokeErr.Error())
+    }
+
+    http.Error(res, fmt.Sprintf("Error sending team invite email: %v", err), http.StatusInternalServerError)
+    return
+  }
+
+  r.sendTeam(res, teamMember)
+}
+
+
+func (r *TeamRouter) handleRevokeInvite(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamInviteRevoke := new(db.TeamInviteRevoke)
+
+  err := decoder.Decode(teamInviteRevoke)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  teamMember, ok := r.getTeamMember(res, req, teamInviteRevoke.TeamID)
+  if !ok || !checkTeamRole(res, teamMember, db.TeamRoleAdmin) {
+    return
+  }
+
+  teamInviteID, err := r.Services.Database.RevokeTeamInvite(teamInviteRevoke)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("No pending team invite %d", teamInviteRevoke.TeamInviteID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error revoking team invite in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionRevoke, auditEntityTeamInvite, teamInviteID, nil, nil)
+
+  r.sendTeam(res, teamMember)
+}
+
+
+// handleAcceptInvite adds the logged in user to a team from an invite's token;
+// the invite has to have been sent to the email address they log in with
+func (r *TeamRouter) handleAcceptInvite(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  acceptInviteRequestData := new(TeamAcceptInviteRequestData)
+
+  err := decoder.Decode(acceptInviteRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  teamInvite, err := r.Services.Database.GetTeamInviteByHashedToken(r.Services.Auth.HashSecretToken(acceptInviteRequestData.Token))
+  if err == sql.ErrNoRows {
+    http.Error(res, "Team invite is invalid, expired, or already used", http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team invite from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !strings.EqualFold(userProfileView.EmailAddress, teamInvite.EmailAddress) {
+    http.Error(res, fmt.Sprintf("This invite was sent to %s; log in with that account to accept it", teamInvite.EmailAddress), http.StatusForbidden)
+    return
+  }
+
+  teamInviteAccept := new(db.TeamInviteAccept)
+  teamInviteAccept.TeamInviteID = teamInvite.TeamInviteID
+  teamInviteAccept.UserID = userID
+  teamID, err := r.Services.Database.AcceptTeamInvite(teamInviteAccept)
+  if err == sql.ErrNoRows {
+    http.Error(res, "Team invite is invalid, expired, or already used", http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error accepting team invite in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  teamMember, err := r.Services.Database.GetTeamMember(teamID, userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team member from database after accepting invite: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionAcceptInvite, auditEntityTeamMember, teamMember.TeamMemberID, teamInvite, teamMember)
+
+  r.sendTeam(res, teamMember)
+}
+
+
+func (r *TeamRouter) handleSetRole(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamMemberUpdate := new(db.TeamMemberUpdate)
+
+  err := decoder.Decode(teamMemberUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+  if _, ok := teamRoleRanks[teamMemberUpdate.TeamRole]; !ok {
+    http.Error(res, fmt.Sprintf("Invalid team role %s", teamMemberUpdate.TeamRole), http.StatusBadRequest)
+    return
+  }
+
+  teamMember, ok := r.getTeamMember(res, req, teamMemberUpdate.TeamID)
+  if !ok || !checkTeamRole(res, teamMember, db.TeamRoleAdmin) {
+    return
+  }
+
+  // Owners hand the team off by making someone else an owner, then leaving or being demoted by them
+  if teamMemberUpdate.UserID == teamMember.UserID {
+    http.Error(res, "You can't change your own team role", http.StatusBadRequest)
+    return
+  }
+
+  existingTeamMember, err := r.Services.Database.GetTeamMember(teamMember.TeamID, teamMemberUpdate.UserID)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d is not on this team", teamMemberUpdate.UserID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team member from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !canManageTeamMember(teamMember, existingTeamMember) || teamRoleRanks[teamMemberUpdate.TeamRole] > teamRoleRanks[teamMember.TeamRole] {
+    http.Error(res, fmt.Sprintf("A team %s can't make a team %s a team %s", teamMember.TeamRole, existingTeamMember.TeamRole, teamMemberUpdate.TeamRole), http.StatusForbidden)
+    return
+  }
+
+  teamMemberID, err := r.Services.Database.UpdateTeamMemberRole(teamMemberUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating team member role in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  updatedTeamMember, err := r.Services.Database.GetTeamMember(teamMember.TeamID, teamMemberUpdate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team member from database after updating role: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityTeamMember, teamMemberID, existingTeamMember, updatedTeamMember)
+
+  r.sendTeam(res, teamMember)
+}
+
+
+// handleRemoveMember takes someone off a team; any member can remove themselves (leave the
+// team), as long as the team would still have an owner. Teams are deleted, not abandoned
+func (r *TeamRouter) handleRemoveMember(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  teamMemberDelete := new(db.TeamMemberDelete)
+
+  err := decoder.Decode(teamMemberDelete)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  teamMember, ok := r.getTeamMember(res, req, teamMemberDelete.TeamID)
+  if !ok {
+    return
+  }
+
+  existingTeamMember := teamMember
+  if teamMemberDelete.UserID != teamMember.UserID {
+    existingTeamMember, err = r.Services.Database.GetTeamMember(teamMember.TeamID, teamMemberDelete.UserID)
+    if err == sql.ErrNoRows {
+      http.Error(res, fmt.Sprintf("User %d is not on this team", teamMemberDelete.UserID), http.StatusNotFound)
+      return
+    } else if err != nil {
+      http.Error(res, fmt.Sprintf("Error getting team member from database: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    if !canManageTeamMember(teamMember, existingTeamMember) {
+      http.Error(res, fmt.Sprintf("A team %s can't remove a team %s", teamMember.TeamRole, existingTeamMember.TeamRole), http.StatusForbidden)
+      return
+    }
+  } else if teamMember.TeamRole == db.TeamRoleOwner {
+    teamMembers, err := r.Services.Database.GetTeamMembersByTeamID(teamMember.TeamID)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error getting team members from database: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+    numOwners := 0
+    for _, otherTeamMember := range teamMembers {
+      if otherTeamMember.TeamRole == db.TeamRoleOwner {
+        numOwners++
+      }
+    }
+    if numOwners <= 1 {
+      http.Error(res, "You're the team's only owner; make someone else an owner or delete the team instead", http.StatusBadRequest)
+      return
+    }
+  }
+
+  teamMemberID, err := r.Services.Database.DeleteTeamMember(teamMemberDelete)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d is not on this team", teamMemberDelete.UserID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error removing team member from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityTeamMember, teamMemberID, existingTeamMember, nil)
+
+  // Someone who just left can't see the team anymore
+  if teamMemberDelete.UserID == teamMember.UserID {
+    r.handleGetAll(res, req)
+    return
+  }
+
+  r.sendTeam(res, teamMember)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// getTeamMemberFromPath gets the logged in user's membership on the team in the
+// rest of the path (i.e. /api/team/get/12); see getTeamMember
+func (r *TeamRouter) getTeamMemberFromPath(res http.ResponseWriter, req *http.Request) (*db.TeamMember, bool) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  teamID, err := strconv.ParseInt(head, 10, 64)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid team id: %s", head), http.StatusBadRequest)
+    return nil, false
+  }
+
+  return r.getTeamMember(res, req, teamID)
+}
+
+
+// getTeamMember gets the logged in user's membership on a team. Writes the error response and
+// returns false if they aren't on it; teams they aren't on are "not found" to them, so nobody
+// can tell which teams exist
+func (r *TeamRouter) getTeamMember(res http.ResponseWriter, req *http.Request, teamID int64) (*db.TeamMember, bool) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return nil, false
+  }
+
+  teamMember, err := r.Services.Database.GetTeamMember(teamID, userID)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Team %d not found", teamID), http.StatusNotFound)
+    return nil, false
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team member from database: %s", err.Error()), http.StatusInternalServerError)
+    return nil, false
+  }
+
+  return teamMember, true
+}
+
+
+// checkTeamRole makes sure a team member has at least a given role on their team.
+// Writes the error response and returns false otherwise
+func checkTeamRole(res http.ResponseWriter, teamMember *db.TeamMember, teamRole string) bool {
+  if teamRoleRanks[teamMember.TeamRole] < teamRoleRanks[teamRole] {
+    http.Error(res, fmt.Sprintf("Only a team %s or above can do that", teamRole), http.StatusForbidden)
+    return false
+  }
+
+  return true
+}
+
+
+// canManageTeamMember checks that a team member can change or remove another member;
+// owners can manage anyone, everyone else only members ranked below them
+func canManageTeamMember(teamMember *db.TeamMember, otherTeamMember *db.TeamMember) bool {
+  if teamMember.TeamRole == db.TeamRoleOwner {
+    return true
+  }
+
+  return teamRoleRanks[teamMember.TeamRole] > teamRoleRanks[otherTeamMember.TeamRole]
+}
+
+
+// sendTeam sends back a team's members, and its pending invites if the member can manage them
+func (r *TeamRouter) sendTeam(res http.ResponseWriter, teamMember *db.TeamMember) {
+  team, err := r.Services.Database.GetTeamByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  teamMembers, err := r.Services.Database.GetTeamMembersByTeamID(teamMember.TeamID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting team members from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  pendingInvites := make([]*db.TeamInvite, 0)
+  if teamRoleRanks[teamMember.TeamRole] >= teamRoleRanks[db.TeamRoleAdmin] {
+    pendingInvites, err = r.Services.Database.GetPendingTeamInvitesByTeamID(teamMember.TeamID)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error getting team invites from database: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TeamGetResponseData{
+      Team:            team,
+      TeamRole:        teamMember.TeamRole,
+      TeamMembers:     teamMembers,
+      PendingInvites:  pendingInvites,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+// sendTeamInviteEmail emails someone the link to accept a team invite
+func sendTeamInviteEmail(services *Services, team *db.Team, inviter *db.TeamMember, teamInviteCreate *db.TeamInviteCreate, token string) (bool, error) {
+  teamInviteRequest, err := http.NewRequest("GET", "https://smush-tracker.herokuapp.com/team/invite", nil)
+  if err != nil {
+    return false, err
+  }
+
+  queryParam := teamInviteRequest.URL.Query()
+  queryParam.Add("t", token)
+  teamInviteRequest.URL.RawQuery = queryParam.Encode()
+
+  teamInviteInfo := new(email.TeamInviteInfo)
+  teamInviteInfo.UserEmail = teamInviteCreate.EmailAddress
+  teamInviteInfo.TeamName = team.TeamName
+  teamInviteInfo.InviterName = inviter.UserName
+  teamInviteInfo.InviteURL = teamInviteRequest.URL.String()
+  teamInviteInfo.ExpiresAt = teamInviteCreate.ExpiresAt
+
+  return services.Email.SendTeamInviteEmail(teamInviteInfo)
+}
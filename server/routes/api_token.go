@@ -0,0 +1,289 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+// The scopes an api token can be given
+const (
+  apiTokenScopeReadMatches   = "matches:read"
+  apiTokenScopeWriteMatches  = "matches:write"
+)
+
+
+// apiTokenScopes is every scope an api token can be given
+var apiTokenScopes = []string{
+  apiTokenScopeReadMatches,
+  apiTokenScopeWriteMatches,
+}
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// APITokenGetAllResponseData is the data we send back
+// after successfully getting all of a user's api tokens
+type APITokenGetAllResponseData struct {
+  APITokens  []*db.APIToken  `json:"apiTokens"`
+  Scopes     []string        `json:"scopes"`
+}
+
+
+// APITokenCreateResponseData is the data we send back after successfully creating an api token;
+// this is the only time the token is ever sent, since we only keep a hash of it
+type APITokenCreateResponseData struct {
+  APIToken  *db.APIToken  `json:"apiToken"`
+  Token     string        `json:"token"`
+}
+
+
+// APITokenRevokeResponseData is the data we send
+// back after successfully revoking an api token
+type APITokenRevokeResponseData struct {
+  APITokens  []*db.APIToken  `json:"apiTokens"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// APITokenRouter is responsible for serving "/api/token"; the logged
+// in user managing personal api tokens for their own scripts and bots
+type APITokenRouter struct {
+  Services  *Services
+}
+
+
+func (r *APITokenRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "getall":
+      r.handleGetAll(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "create":
+      r.handleCreate(res, req)
+    case "revoke":
+      r.handleRevoke(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewAPITokenRouter makes a new api/token router and hooks up its services
+func NewAPITokenRouter(routerServices *Services) *APITokenRouter {
+  router := new(APITokenRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *APITokenRouter) handleGetAll(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  apiTokens, err := r.Services.Database.GetAPITokensByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting API tokens from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     APITokenGetAllResponseData{
+      APITokens:  apiTokens,
+      Scopes:     apiTokenScopes,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *APITokenRouter) handleCreate(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  apiTokenCreate := new(db.APITokenCreate)
+
+  err := decoder.Decode(apiTokenCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  apiTokenCreate.TokenName = strings.TrimSpace(apiTokenCreate.TokenName)
+  if apiTokenCreate.TokenName == "" || len(apiTokenCreate.TokenName) > 100 {
+    http.Error(res, "API token names must be between 1 and 100 characters", http.StatusBadRequest)
+    return
+  }
+  if len(apiTokenCreate.Scopes) == 0 {
+    http.Error(res, "API tokens need at least one scope", http.StatusBadRequest)
+    return
+  }
+  for _, scope := range apiTokenCreate.Scopes {
+    if !isAPITokenScope(scope) {
+      http.Error(res, fmt.Sprintf("Unknown API token scope %s", scope), http.StatusBadRequest)
+      return
+    }
+  }
+  if apiTokenCreate.ExpiresAt.Valid && !apiTokenCreate.ExpiresAt.Time.After(time.Now()) {
+    http.Error(res, "API token expiration must be in the future", http.StatusBadRequest)
+    return
+  }
+
+  // Users can only make tokens for themselves
+  apiTokenCreate.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  token, hashedToken, err := r.Services.Auth.GetNewSecretToken()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error generating API token: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  apiTokenCreate.HashedToken = hashedToken
+
+  apiTokenID, err := r.Services.Database.CreateAPIToken(apiTokenCreate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating API token in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  apiToken, err := r.Services.Database.GetAPITokenByHashedToken(hashedToken)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting API token from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityAPIToken, apiTokenID, nil, apiToken)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     APITokenCreateResponseData{
+      APIToken:  apiToken,
+      Token:     token,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *APITokenRouter) handleRevoke(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  apiTokenRevoke := new(db.APITokenRevoke)
+
+  err := decoder.Decode(apiTokenRevoke)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  apiTokenRevoke.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  apiTokenID, err := r.Services.Database.RevokeAPIToken(apiTokenRevoke)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("API token %d does not exist", apiTokenRevoke.APITokenID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error revoking API token in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionRevoke, auditEntityAPIToken, apiTokenID, nil, nil)
+
+  apiTokens, err := r.Services.Database.GetAPITokensByUserID(apiTokenRevoke.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting API tokens from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     APITokenRevokeResponseData{
+      APITokens:  apiTokens,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// isAPITokenScope checks if a scope is one an api token can be given
+func isAPITokenScope(scope string) bool {
+  for _, apiTokenScope := range apiTokenScopes {
+    if apiTokenScope == scope {
+      return true
+    }
+  }
+
+  return false
+}
+
+
+// getAPITokenScope gets the scope an api token needs for a request to a given "/api" path. Tokens
+// only get to the match routes and the lookups needed to make sense of them; everything
+// else (i.e. managing tokens or the account itself) still needs a logged in browser
+func getAPITokenScope(head string, method string) (string, bool) {
+  switch head {
+  case "match":
+    if method == http.MethodGet {
+      return apiTokenScopeReadMatches, true
+    }
+    return apiTokenScopeWriteMatches, true
+  case "character", "stage", "tag", "stats":
+    if method == http.MethodGet {
+      return apiTokenScopeReadMatches, true
+    }
+  }
+
+  return "", false
+}
@@ -0,0 +1,388 @@
+package routes
+
+import (
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Request Data
+----------------------------------*/
+
+// TwoFactorCodeRequestData describes the data we're expecting when
+// a user proves they have their authenticator app set up
+type TwoFactorCodeRequestData struct {
+  Code  string  `json:"code"`
+}
+
+
+// TwoFactorDisableRequestData describes the data we're
+// expecting when a user turns off their own two-factor auth
+type TwoFactorDisableRequestData struct {
+  Password  string  `json:"password"`
+}
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// TwoFactorStatusResponseData is the data we send back after successfully getting a
+// user's two-factor auth status, or after any change to it
+type TwoFactorStatusResponseData struct {
+  TwoFactorEnabled  bool   `json:"twoFactorEnabled"`
+  NumRecoveryCodes  int64  `json:"numRecoveryCodes"`
+}
+
+
+// TwoFactorEnrollResponseData is the data we send back after successfully starting
+// two-factor enrollment; the user adds the secret to their authenticator app
+type TwoFactorEnrollResponseData struct {
+  Secret      string  `json:"secret"`
+  OTPAuthURI  string  `json:"otpAuthUri"`
+}
+
+
+// TwoFactorRecoveryCodesResponseData is the data we send back after successfully making a user new
+// recovery codes; this is the only time the codes are ever sent, since we only keep hashes of them
+type TwoFactorRecoveryCodesResponseData struct {
+  TwoFactorEnabled  bool      `json:"twoFactorEnabled"`
+  RecoveryCodes     []string  `json:"recoveryCodes"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// TwoFactorRouter handles all of /api/user/me/two-factor;
+// the logged in user managing their own two-factor auth
+type TwoFactorRouter struct {
+  Services  *Services
+}
+
+
+func (r *TwoFactorRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "status":
+      r.handleStatus(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // POST Request Handlers
+  case http.MethodPost:
+    switch head {
+    case "enroll":
+      r.handleEnroll(res, req)
+    case "confirm":
+      r.handleConfirm(res, req)
+    case "recovery-codes":
+      r.handleRecoveryCodes(res, req)
+    case "disable":
+      r.handleDisable(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported POST path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewTwoFactorRouter makes a new api/user/me/two-factor router and hooks up its services
+func NewTwoFactorRouter(routerServices *Services) *TwoFactorRouter {
+  router := new(TwoFactorRouter)
+
+  router.Services = routerServices
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *TwoFactorRouter) handleStatus(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  r.sendStatus(res, userID)
+}
+
+
+func (r *TwoFactorRouter) handleEnroll(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  // Swapping out the secret of an enabled user would let anyone at their logged in computer take over their second factor
+  if userProfileView.TwoFactorEnabled {
+    http.Error(res, "Two-factor auth is already on; turn it off before enrolling again", http.StatusBadRequest)
+    return
+  }
+
+  secret, err := r.Services.Auth.GetNewTOTPSecret()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error generating TOTP secret: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // The secret isn't required at log in until it's been confirmed with a code
+  twoFactorUpdate := new(db.UserTwoFactorUpdate)
+  twoFactorUpdate.UserID = userID
+  twoFactorUpdate.TOTPSecret.Valid = true
+  twoFactorUpdate.TOTPSecret.String = secret
+  twoFactorUpdate.TOTPEnabled = false
+  _, err = r.Services.Database.UpdateUserTwoFactor(twoFactorUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error saving TOTP secret in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TwoFactorEnrollResponseData{
+      Secret:      secret,
+      OTPAuthURI:  r.Services.Auth.GetTOTPURI(secret, userProfileView.EmailAddress),
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *TwoFactorRouter) handleConfirm(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  var twoFactorCodeRequestData TwoFactorCodeRequestData
+
+  err := decoder.Decode(&twoFactorCodeRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  userTwoFactor, err := r.Services.Database.GetUserTwoFactorByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting two-factor settings from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if userTwoFactor.TOTPEnabled {
+    http.Error(res, "Two-factor auth is already on", http.StatusBadRequest)
+    return
+  }
+  if !userTwoFactor.TOTPSecret.Valid {
+    http.Error(res, "Two-factor enrollment hasn't been started", http.StatusBadRequest)
+    return
+  }
+
+  if !r.checkCode(res, userTwoFactor, twoFactorCodeRequestData.Code) {
+    return
+  }
+
+  twoFactorUpdate := new(db.UserTwoFactorUpdate)
+  twoFactorUpdate.UserID = userID
+  twoFactorUpdate.TOTPSecret = userTwoFactor.TOTPSecret
+  twoFactorUpdate.TOTPEnabled = true
+  _, err = r.Services.Database.UpdateUserTwoFactor(twoFactorUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error turning on two-factor auth in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionEnableTwoFactor, auditEntityUser, userID, nil, nil)
+
+  r.sendNewRecoveryCodes(res, userID)
+}
+
+
+func (r *TwoFactorRouter) handleRecoveryCodes(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  var twoFactorCodeRequestData TwoFactorCodeRequestData
+
+  err := decoder.Decode(&twoFactorCodeRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  userTwoFactor, err := r.Services.Database.GetUserTwoFactorByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting two-factor settings from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !userTwoFactor.TOTPEnabled {
+    http.Error(res, "Two-factor auth is off", http.StatusBadRequest)
+    return
+  }
+
+  if !r.checkCode(res, userTwoFactor, twoFactorCodeRequestData.Code) {
+    return
+  }
+
+  r.sendNewRecoveryCodes(res, userID)
+}
+
+
+func (r *TwoFactorRouter) handleDisable(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  var twoFactorDisableRequestData TwoFactorDisableRequestData
+
+  err := decoder.Decode(&twoFactorDisableRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  // Make sure it's really the user and not just someone at their logged in computer
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  userCredentialsView, err := r.Services.Database.GetUserCredentialsViewByEmail(userProfileView.EmailAddress)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user credentials with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  _, err = r.Services.Auth.CheckPassword(userCredentialsView.HashedPassword, twoFactorDisableRequestData.Password)
+  if err != nil {
+    http.Error(res, "Invalid password", http.StatusUnauthorized)
+    return
+  }
+
+  _, err = r.Services.Database.ResetUserTwoFactor(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error turning off two-factor auth in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionResetTwoFactor, auditEntityUser, userID, nil, nil)
+
+  r.sendStatus(res, userID)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// checkCode checks a code from the user's authenticator app,
+// writing the error response and returning false if it's wrong
+func (r *TwoFactorRouter) checkCode(res http.ResponseWriter, userTwoFactor *db.UserTwoFactor, code string) bool {
+  ok, err := useTOTPCode(r.Services, userTwoFactor, code)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error checking two-factor code: %s", err.Error()), http.StatusInternalServerError)
+    return false
+  }
+  if !ok {
+    http.Error(res, "Invalid two-factor code", http.StatusUnauthorized)
+    return false
+  }
+
+  return true
+}
+
+
+// sendNewRecoveryCodes replaces all of a user's recovery codes with new ones and sends them back
+func (r *TwoFactorRouter) sendNewRecoveryCodes(res http.ResponseWriter, userID int64) {
+  recoveryCodes, hashedRecoveryCodes, err := r.Services.Auth.GetNewRecoveryCodes()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error generating recovery codes: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  recoveryCodesReplace := new(db.RecoveryCodesReplace)
+  recoveryCodesReplace.UserID = userID
+  recoveryCodesReplace.HashedCodes = hashedRecoveryCodes
+  err = r.Services.Database.ReplaceRecoveryCodes(recoveryCodesReplace)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error saving recovery codes in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TwoFactorRecoveryCodesResponseData{
+      TwoFactorEnabled:  true,
+      RecoveryCodes:     recoveryCodes,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+// sendStatus sends back whether a user has two-factor auth on and how many recovery codes they have left
+func (r *TwoFactorRouter) sendStatus(res http.ResponseWriter, userID int64) {
+  userTwoFactor, err := r.Services.Database.GetUserTwoFactorByUserID(userID)
+  if err == sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("User %d does not exist", userID), http.StatusNotFound)
+    return
+  } else if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting two-factor settings from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  numRecoveryCodes, err := r.Services.Database.GetNumUnusedRecoveryCodesByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting recovery codes from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     TwoFactorStatusResponseData{
+      TwoFactorEnabled:  userTwoFactor.TOTPEnabled,
+      NumRecoveryCodes:  numRecoveryCodes,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
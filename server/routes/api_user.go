@@ -1,6 +1,7 @@
 package routes
 
 import (
+  "database/sql"
   "encoding/json"
   "fmt"
   "net/http"
@@ -42,6 +43,22 @@ type UserUpdateDefaultUserCharacterResponseData struct {
 }
 
 
+// UserUpdatePublicProfileResponseData is the data we send back after
+// successfully opting a user into or out of a public profile
+type UserUpdatePublicProfileResponseData struct {
+  User            *db.UserProfileView      `json:"user"`
+  UserCharacters  []*db.UserCharacterView  `json:"userCharacters"`
+}
+
+
+// UserUpdateFeedOptOutResponseData is the data we send back after successfully
+// opting a user into or out of showing up in their followers' feeds
+type UserUpdateFeedOptOutResponseData struct {
+  User            *db.UserProfileView      `json:"user"`
+  UserCharacters  []*db.UserCharacterView  `json:"userCharacters"`
+}
+
+
 /*---------------------------------
              Router
 ----------------------------------*/
@@ -52,6 +69,7 @@ type UserUpdateDefaultUserCharacterResponseData struct {
 type UserRouter struct {
   Services             *Services
   UserCharacterRouter  *UserCharacterRouter
+  UserMeRouter         *UserMeRouter
 }
 
 
@@ -63,6 +81,8 @@ func (r *UserRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
   switch head {
   case "character":
     r.UserCharacterRouter.ServeHTTP(res, req)
+  case "me":
+    r.UserMeRouter.ServeHTTP(res, req)
 
   // Otherwise, handle the user specific requests
   default:
@@ -86,6 +106,10 @@ func (r *UserRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
           r.handleUpdateProfile(res, req)
         case "update_default_user_character":
           r.handleUpdateDefaultUserCharacter(res, req)
+        case "update_public_profile":
+          r.handleUpdatePublicProfile(res, req)
+        case "update_feed_opt_out":
+          r.handleUpdateFeedOptOut(res, req)
         default:
           http.Error(res, fmt.Sprintf("Unsupport POST path %s", head), http.StatusBadRequest)
           return
@@ -105,6 +129,7 @@ func NewUserRouter(routerServices *Services) *UserRouter {
 
   router.Services = routerServices
   router.UserCharacterRouter = NewUserCharacterRouter(routerServices)
+  router.UserMeRouter = NewUserMeRouter(routerServices)
 
   return router
 }
@@ -131,6 +156,17 @@ func (r *UserRouter) handleGetByID(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  // Users getting their own profile get their current roles too, so they see role changes
+  // without logging in again. Nobody else needs to know what another user can do.
+  loggedInUserID, err := getUserIDFromAccessToken(r.Services, req)
+  if err == nil && loggedInUserID == userID {
+    err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+    if err != nil {
+      http.Error(res, err.Error(), http.StatusInternalServerError)
+      return
+    }
+  }
+
   // Also get the user's saved characters
   userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
   if err != nil {
@@ -182,12 +218,39 @@ func (r *UserRouter) handleUpdateProfile(res http.ResponseWriter, req *http.Requ
     return
   }
 
+  existingUserProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userProfileUpdate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Changing the case of your own user name is fine, but not taking someone else's
+  userNameUserID, err := r.Services.Database.GetUserIDByUserName(userProfileUpdate.UserName)
+  if err == nil && userNameUserID != userProfileUpdate.UserID {
+    http.Error(res, fmt.Sprintf("User already exists with user name %s", userProfileUpdate.UserName), http.StatusBadRequest)
+    return
+  } else if err != nil && err != sql.ErrNoRows {
+    http.Error(res, fmt.Sprintf("Error checking user name in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
   userID, err := r.Services.Database.UpdateUserProfile(userProfileUpdate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error updating user in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
   userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database after updating profile: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityUser, userID, existingUserProfileView, userProfileView)
+
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
 
   userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
   if err != nil {
@@ -219,6 +282,12 @@ func (r *UserRouter) handleUpdateDefaultUserCharacter(res http.ResponseWriter, r
     return
   }
 
+  existingUserProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userDefaultUserCharUpdate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
   userID, err := r.Services.Database.UpdateUserDefaultUserCharacter(userDefaultUserCharUpdate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error updating user default character in database: %s", err.Error()), http.StatusInternalServerError)
@@ -230,6 +299,13 @@ func (r *UserRouter) handleUpdateDefaultUserCharacter(res http.ResponseWriter, r
     http.Error(res, fmt.Sprintf("Error getting user in database after updating default user character: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityUser, userID, existingUserProfileView, userProfileView)
+
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
 
   userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
   if err != nil {
@@ -249,3 +325,127 @@ func (r *UserRouter) handleUpdateDefaultUserCharacter(res http.ResponseWriter, r
   res.Header().Set("Content-Type", "application/json")
   json.NewEncoder(res).Encode(response)
 }
+
+
+func (r *UserRouter) handleUpdatePublicProfile(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  publicProfileUpdate := new(db.UserPublicProfileUpdate)
+
+  err := decoder.Decode(publicProfileUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Users can only make their own profile public
+  publicProfileUpdate.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  existingUserProfileView, err := r.Services.Database.GetUserProfileViewByUserID(publicProfileUpdate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userID, err := r.Services.Database.UpdateUserPublicProfile(publicProfileUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating user public profile in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database after updating public profile: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityUser, userID, existingUserProfileView, userProfileView)
+
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
+
+  userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user character views in database after updating public profile: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     UserUpdatePublicProfileResponseData{
+      User:            userProfileView,
+      UserCharacters:  userCharViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+func (r *UserRouter) handleUpdateFeedOptOut(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  feedOptOutUpdate := new(db.UserFeedOptOutUpdate)
+
+  err := decoder.Decode(feedOptOutUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  // Users can only opt themselves out of feeds
+  feedOptOutUpdate.UserID, err = getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  existingUserProfileView, err := r.Services.Database.GetUserProfileViewByUserID(feedOptOutUpdate.UserID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userID, err := r.Services.Database.UpdateUserFeedOptOut(feedOptOutUpdate)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error updating user feed opt out in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user in database after updating feed opt out: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityUser, userID, existingUserProfileView, userProfileView)
+
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
+
+  userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user character views in database after updating feed opt out: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     UserUpdateFeedOptOutResponseData{
+      User:            userProfileView,
+      UserCharacters:  userCharViews,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+  "database/sql"
   "encoding/json"
   "fmt"
   "net/http"
@@ -37,6 +38,24 @@ type UserCharacterDeleteResponseData struct {
 }
 
 
+// isValidAltCostume checks that a given alt costume exists for a given character;
+// not picking an alt costume at all is always valid
+func isValidAltCostume(services *Services, characterID int64, altCostume db.NullInt64JSON) (bool, error) {
+  if !altCostume.Valid {
+    return true, nil
+  }
+
+  _, err := services.Database.GetCharacterCostumeByCostumeIndex(characterID, altCostume.Int64)
+  if err == sql.ErrNoRows {
+    return false, nil
+  } else if err != nil {
+    return false, err
+  }
+
+  return true, nil
+}
+
+
 /*---------------------------------
              Router
 ----------------------------------*/
@@ -96,12 +115,29 @@ func (r *UserCharacterRouter) handleCreate(res http.ResponseWriter, req *http.Re
     return
   }
 
-  _, err = r.Services.Database.CreateUserCharacter(userCharCreate)
+  isValid, err := isValidAltCostume(r.Services, userCharCreate.CharacterID, userCharCreate.AltCostume)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting character costume from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !isValid {
+    http.Error(res, fmt.Sprintf("Alt costume %d does not exist for characterID %d", userCharCreate.AltCostume.Int64, userCharCreate.CharacterID), http.StatusBadRequest)
+    return
+  }
+
+  userCharID, err := r.Services.Database.CreateUserCharacter(userCharCreate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error creating new user character in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
+  userCharView, err := r.Services.Database.GetUserCharacterViewByUserCharacterID(userCharID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching new user character view in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionCreate, auditEntityUserCharacter, userCharID, nil, userCharView)
+
   userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userCharCreate.UserID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error fetching user character views in database after creating new user_character: %s", err.Error()), http.StatusInternalServerError)
@@ -114,6 +150,12 @@ func (r *UserCharacterRouter) handleCreate(res http.ResponseWriter, req *http.Re
     return
   }
 
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
+
   response := Response{
     Success:  true,
     Error:    nil,
@@ -138,12 +180,35 @@ func (r *UserCharacterRouter) handleUpdate(res http.ResponseWriter, req *http.Re
     return
   }
 
-  _, err = r.Services.Database.UpdateUserCharacter(userCharUpdate)
+  isValid, err := isValidAltCostume(r.Services, userCharUpdate.CharacterID.Int64, userCharUpdate.AltCostume)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting character costume from database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  if !isValid {
+    http.Error(res, fmt.Sprintf("Alt costume %d does not exist for characterID %d", userCharUpdate.AltCostume.Int64, userCharUpdate.CharacterID.Int64), http.StatusBadRequest)
+    return
+  }
+
+  existingUserCharView, err := r.Services.Database.GetUserCharacterViewByUserCharacterID(userCharUpdate.UserCharacterID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user character view in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  userCharID, err := r.Services.Database.UpdateUserCharacter(userCharUpdate)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error updating user character in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
 
+  userCharView, err := r.Services.Database.GetUserCharacterViewByUserCharacterID(userCharID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching updated user character view in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+  recordAudit(r.Services, req, auditActionUpdate, auditEntityUserCharacter, userCharID, existingUserCharView, userCharView)
+
   userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userCharUpdate.UserID)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error fetching user character views in database after updating user_character: %s", err.Error()), http.StatusInternalServerError)
@@ -156,12 +221,11 @@ func (r *UserCharacterRouter) handleUpdate(res http.ResponseWriter, req *http.Re
     return
   }
 
-  userRoleViews, err := r.Services.Database.GetUserRoleViewsByUserID(userCharUpdate.UserID)
+  err = setUserRolesAndPermissions(r.Services, req, userProfileView)
   if err != nil {
-    http.Error(res, fmt.Sprintf("Error fetching user roles from database: %s", err.Error()), http.StatusInternalServerError)
+    http.Error(res, err.Error(), http.StatusInternalServerError)
     return
   }
-  userProfileView.UserRoles = userRoleViews
 
   response := &Response{
     Success:  true,
@@ -207,11 +271,18 @@ func (r *UserCharacterRouter) handleDelete(res http.ResponseWriter, req *http.Re
     }
   }
 
+  existingUserCharView, err := r.Services.Database.GetUserCharacterViewByUserCharacterID(userCharDelete.UserCharacterID.Int64)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error fetching user character view in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
   _, err = r.Services.Database.DeleteUserCharacterByID(userCharDelete.UserCharacterID.Int64)
   if err != nil {
     http.Error(res, fmt.Sprintf("Error deleting user character in database: %s", err.Error()), http.StatusInternalServerError)
     return
   }
+  recordAudit(r.Services, req, auditActionDelete, auditEntityUserCharacter, userCharDelete.UserCharacterID.Int64, existingUserCharView, nil)
 
   userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userCharDelete.UserID)
   if err != nil {
@@ -225,6 +296,12 @@ func (r *UserCharacterRouter) handleDelete(res http.ResponseWriter, req *http.Re
     return
   }
 
+  err = setUserRolesAndPermissions(r.Services, req, updatedUserProfileView)
+  if err != nil {
+    http.Error(res, err.Error(), http.StatusInternalServerError)
+    return
+  }
+
   response := &Response{
     Success:  true,
     Error:    nil,
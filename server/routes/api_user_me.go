@@ -0,0 +1,325 @@
+package routes
+
+import (
+  "archive/zip"
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "time"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+/*---------------------------------
+          Request Data
+----------------------------------*/
+
+// UserDeleteRequestData describes the data we're
+// expecting when a user deletes their own account
+type UserDeleteRequestData struct {
+  Password  string  `json:"password"`
+}
+
+
+/*---------------------------------
+          Response Data
+----------------------------------*/
+
+// UserDeleteResponseData is the data we send back
+// after a user successfully deletes their own account
+type UserDeleteResponseData struct {
+  UserID  int64  `json:"userId"`
+}
+
+
+// UserExportSession describes one of a user's logged in sessions in their data export
+type UserExportSession struct {
+  Expires  time.Time  `json:"expires"`
+}
+
+
+/*---------------------------------
+             Router
+----------------------------------*/
+
+// UserMeRouter handles all of /api/user/me; the logged
+// in user getting a copy of or deleting their own data
+type UserMeRouter struct {
+  Services         *Services
+  TwoFactorRouter  *TwoFactorRouter
+}
+
+
+func (r *UserMeRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  var head string
+  head, req.URL.Path = ShiftPath(req.URL.Path)
+
+  // Delegate to sub routers first
+  if head == "two-factor" {
+    r.TwoFactorRouter.ServeHTTP(res, req)
+    return
+  }
+
+  switch req.Method {
+  // GET Request Handlers
+  case http.MethodGet:
+    switch head {
+    case "export":
+      r.handleExport(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported GET path %s", head), http.StatusBadRequest)
+      return
+    }
+  // DELETE Request Handlers
+  case http.MethodDelete:
+    switch head {
+    case "":
+      r.handleDelete(res, req)
+    default:
+      http.Error(res, fmt.Sprintf("Unsupported DELETE path %s", head), http.StatusBadRequest)
+      return
+    }
+  // Unsupported Method Response
+  default:
+    http.Error(res, fmt.Sprintf("Unsupported Method type %s", req.Method), http.StatusBadRequest)
+  }
+}
+
+
+// NewUserMeRouter makes a new api/user/me router and hooks up its services
+func NewUserMeRouter(routerServices *Services) *UserMeRouter {
+  router := new(UserMeRouter)
+
+  router.Services = routerServices
+  router.TwoFactorRouter = NewTwoFactorRouter(routerServices)
+
+  return router
+}
+
+
+/*---------------------------------
+             Handlers
+----------------------------------*/
+
+func (r *UserMeRouter) handleExport(res http.ResponseWriter, req *http.Request) {
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  exportFiles, err := r.getExportFiles(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user data for export: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // Build the whole archive before sending anything, so we can still send an error
+  var archive bytes.Buffer
+  zipWriter := zip.NewWriter(&archive)
+  for _, exportFile := range exportFiles {
+    fileWriter, err := zipWriter.Create(exportFile.name)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error creating export archive: %s", err.Error()), http.StatusInternalServerError)
+      return
+    }
+
+    encoder := json.NewEncoder(fileWriter)
+    encoder.SetIndent("", "  ")
+    err = encoder.Encode(exportFile.data)
+    if err != nil {
+      http.Error(res, fmt.Sprintf("Error writing %s to export archive: %s", exportFile.name, err.Error()), http.StatusInternalServerError)
+      return
+    }
+  }
+  err = zipWriter.Close()
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error creating export archive: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  res.Header().Set("Content-Type", "application/zip")
+  res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"smush-export-%d.zip\"", userID))
+  res.Write(archive.Bytes())
+}
+
+
+func (r *UserMeRouter) handleDelete(res http.ResponseWriter, req *http.Request) {
+  decoder := json.NewDecoder(req.Body)
+  var userDeleteRequestData UserDeleteRequestData
+
+  err := decoder.Decode(&userDeleteRequestData)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Invalid JSON request: %s", err.Error()), http.StatusBadRequest)
+    return
+  }
+
+  userID, err := getUserIDFromAccessToken(r.Services, req)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user ID from access token: %s", err.Error()), http.StatusUnauthorized)
+    return
+  }
+
+  // Make sure it's really the user and not just someone at their logged in computer
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  userCredentialsView, err := r.Services.Database.GetUserCredentialsViewByEmail(userProfileView.EmailAddress)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error getting user credentials with userID %d: %s", userID, err.Error()), http.StatusInternalServerError)
+    return
+  }
+  _, err = r.Services.Auth.CheckPassword(userCredentialsView.HashedPassword, userDeleteRequestData.Password)
+  if err != nil {
+    http.Error(res, "Invalid password", http.StatusUnauthorized)
+    return
+  }
+
+  deletedUserID, err := r.Services.Database.DeleteUserByUserID(userID)
+  if err != nil {
+    http.Error(res, fmt.Sprintf("Error deleting user in database: %s", err.Error()), http.StatusInternalServerError)
+    return
+  }
+
+  // The user is gone, so they can't be the actor anymore. Nothing about
+  // them is kept in the log, since the whole point is to get rid of their data
+  writeAuditLog(r.Services, req, 0, auditActionDelete, auditEntityUser, deletedUserID, nil, nil)
+
+  clearAuthCookies(res)
+
+  response := &Response{
+    Success:  true,
+    Error:    nil,
+    Data:     UserDeleteResponseData{
+      UserID:  deletedUserID,
+    },
+  }
+
+  res.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(res).Encode(response)
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// exportFile is a single JSON file in a user's data export
+type exportFile struct {
+  name  string
+  data  interface{}
+}
+
+
+// getExportFiles gathers everything we have stored about a user for their data export
+func (r *UserMeRouter) getExportFiles(userID int64) ([]*exportFile, error) {
+  userProfileView, err := r.Services.Database.GetUserProfileViewByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  userCharViews, err := r.Services.Database.GetUserCharacterViewsByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  matchViewFilter := new(db.MatchViewFilter)
+  matchViewFilter.UserID.Valid = true
+  matchViewFilter.UserID.Int64 = userID
+  matchViewFilter.ViewerUserID = userID
+  matchViews, err := r.Services.Database.GetAllMatchViews(matchViewFilter)
+  if err != nil {
+    return nil, err
+  }
+  matchTagViews, err := r.Services.Database.GetAllMatchTagViews(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  deletedMatchViews, err := r.Services.Database.GetDeletedMatchViewsByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  // Global tags aren't the user's data; only their private ones are
+  allTags, err := r.Services.Database.GetAllTagsByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+  tags := make([]*db.Tag, 0)
+  for _, tag := range allTags {
+    if tag.UserID.Valid {
+      tags = append(tags, tag)
+    }
+  }
+
+  opponentViews, err := r.Services.Database.GetOpponentViewsByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  shareLinks, err := r.Services.Database.GetShareLinksByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  apiTokens, err := r.Services.Database.GetAPITokensByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  userIdentities, err := r.Services.Database.GetUserIdentitiesByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  follows, err := r.Services.Database.GetFollowsByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  gspHistory, err := r.Services.Database.GetGspHistoryByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  userTeamViews, err := r.Services.Database.GetUserTeamViewsByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+
+  // A user has at most one logged in session, tied to their refresh token
+  sessions := make([]*UserExportSession, 0)
+  refreshToken, err := r.Services.Database.GetUserRefreshTokenByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+  if refreshToken != "" {
+    expires, err := r.Services.Auth.GetJWTTokenExpiration(refreshToken)
+    if err == nil {
+      sessions = append(sessions, &UserExportSession{Expires: expires})
+    }
+  }
+
+  exportFiles := []*exportFile{
+    {name: "profile.json", data: userProfileView},
+    {name: "user_characters.json", data: userCharViews},
+    {name: "matches.json", data: addMatchTagViewsToMatchViews(matchViews, matchTagViews)},
+    {name: "deleted_matches.json", data: deletedMatchViews},
+    {name: "tags.json", data: tags},
+    {name: "opponents.json", data: opponentViews},
+    {name: "share_links.json", data: shareLinks},
+    {name: "api_tokens.json", data: apiTokens},
+    {name: "user_identities.json", data: userIdentities},
+    {name: "follows.json", data: follows},
+    {name: "gsp_history.json", data: gspHistory},
+    {name: "teams.json", data: userTeamViews},
+    {name: "sessions.json", data: sessions},
+  }
+
+  return exportFiles, nil
+}
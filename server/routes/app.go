@@ -23,6 +23,9 @@ func (r *AppRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
   case "api":
     r.APIRouter.ServeHTTP(res, req)
   default:
+    // The front end needs its CSRF cookie before its first api request (i.e. logging in)
+    ensureCSRFCookie(res, req)
+
     // Angular requires returning index.html if you are using routing in your app:
     // https://angular.io/guide/deployment#routed-apps-must-fallback-to-indexhtml
     http.ServeFile(res, req, "dist/static/index.html")
@@ -41,5 +44,7 @@ func NewRouter() *AppRouter {
   router.APIRouter = NewAPIRouter(routerServices)
   router.StaticRouter = NewStaticRouter()
 
+  startMatchTrashPurge(routerServices)
+
   return router
 }
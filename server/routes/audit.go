@@ -0,0 +1,143 @@
+package routes
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "log"
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
+
+// The kinds of entities we record changes to in the audit log
+const (
+  auditEntityMatch          = "match"
+  auditEntityCharacter      = "character"
+  auditEntityCostume        = "character_costume"
+  auditEntityArchetype      = "archetype"
+  auditEntitySeries         = "series"
+  auditEntityStage          = "stage"
+  auditEntityTag            = "tag"
+  auditEntityTagCategory    = "tag_category"
+  auditEntityOpponent       = "opponent"
+  auditEntityUser           = "user"
+  auditEntityUserCharacter  = "user_character"
+  auditEntityShareLink      = "share_link"
+  auditEntityAPIToken       = "api_token"
+  auditEntityUserIdentity   = "user_identity"
+  auditEntityFollow         = "follow"
+  auditEntityTeam           = "team"
+  auditEntityTeamMember     = "team_member"
+  auditEntityTeamInvite     = "team_invite"
+)
+
+
+// The actions we record in the audit log
+const (
+  auditActionCreate           = "create"
+  auditActionUpdate           = "update"
+  auditActionDelete           = "delete"
+  auditActionRestore          = "restore"
+  auditActionMerge            = "merge"
+  auditActionRegister         = "register"
+  auditActionResetPassword    = "reset_password"
+  auditActionChangePassword   = "change_password"
+  auditActionSetRoles         = "set_roles"
+  auditActionDisable          = "disable"
+  auditActionEnable           = "enable"
+  auditActionLogout           = "logout"
+  auditActionRevoke           = "revoke"
+  auditActionEnableTwoFactor  = "enable_two_factor"
+  auditActionResetTwoFactor   = "reset_two_factor"
+  auditActionLinkIdentity     = "link_identity"
+  auditActionAcceptInvite     = "accept_invite"
+)
+
+
+// requestIDKey is the context key for a request's ID
+type requestIDKey struct{}
+
+
+// withRequestID gives a request an ID that ties together everything it
+// wrote to the audit log, and sends it back in the X-Request-ID header.
+// Heroku's router already sets one, so we reuse it when we're given one
+func withRequestID(res http.ResponseWriter, req *http.Request) *http.Request {
+  requestID := req.Header.Get("X-Request-ID")
+  if requestID == "" || len(requestID) > 100 {
+    randomBytes := make([]byte, 16)
+    _, err := rand.Read(randomBytes)
+    if err != nil {
+      log.Printf("Error generating request ID: %s", err.Error())
+    }
+    requestID = hex.EncodeToString(randomBytes)
+  }
+
+  res.Header().Set("X-Request-ID", requestID)
+  return req.WithContext(context.WithValue(req.Context(), requestIDKey{}, requestID))
+}
+
+
+// getRequestID gets the ID withRequestID gave a request
+func getRequestID(req *http.Request) string {
+  requestID, _ := req.Context().Value(requestIDKey{}).(string)
+  return requestID
+}
+
+
+// recordAudit writes a data-changing action to the audit log, along with the state of the entity
+// before and after the change (nil when there isn't one, i.e. before a create). The logged in
+// user is recorded as the actor. The change has already been made by the time this is called,
+// so failing to write the log is only logged instead of failing the whole request
+func recordAudit(services *Services, req *http.Request, action string, entityType string, entityID int64, before interface{}, after interface{}) {
+  // Some actions (i.e. registering) happen before anyone is logged in
+  actorUserID, err := getUserIDFromAccessToken(services, req)
+  if err != nil {
+    actorUserID = 0
+  }
+
+  writeAuditLog(services, req, actorUserID, action, entityType, entityID, before, after)
+}
+
+
+// writeAuditLog writes an entry to the audit log with the given actor, or none if it's 0;
+// i.e. a user deleting themselves can't be the actor once they're gone
+func writeAuditLog(services *Services, req *http.Request, actorUserID int64, action string, entityType string, entityID int64, before interface{}, after interface{}) {
+  auditLogCreate := new(db.AuditLogCreate)
+  auditLogCreate.Action = action
+  auditLogCreate.EntityType = entityType
+  auditLogCreate.EntityID.Valid = entityID != 0
+  auditLogCreate.EntityID.Int64 = entityID
+  auditLogCreate.RequestID = getRequestID(req)
+  auditLogCreate.ActorUserID.Valid = actorUserID != 0
+  auditLogCreate.ActorUserID.Int64 = actorUserID
+
+  var err error
+  auditLogCreate.BeforeData, err = marshalAuditData(before)
+  if err != nil {
+    log.Printf("Error recording %s %s %d in audit log: %s", action, entityType, entityID, err.Error())
+    return
+  }
+  auditLogCreate.AfterData, err = marshalAuditData(after)
+  if err != nil {
+    log.Printf("Error recording %s %s %d in audit log: %s", action, entityType, entityID, err.Error())
+    return
+  }
+
+  _, err = services.Database.CreateAuditLog(auditLogCreate)
+  if err != nil {
+    log.Printf("Error recording %s %s %d in audit log: %s", action, entityType, entityID, err.Error())
+  }
+}
+
+
+// marshalAuditData turns an entity's state into JSON for the audit log
+func marshalAuditData(data interface{}) (json.RawMessage, error) {
+  if data == nil {
+    return nil, nil
+  }
+
+  return json.Marshal(data)
+}
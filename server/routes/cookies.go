@@ -0,0 +1,174 @@
+package routes
+
+import (
+  "crypto/rand"
+  "crypto/subtle"
+  "encoding/hex"
+  "log"
+  "net/http"
+  "os"
+  "strings"
+  "time"
+)
+
+
+// The names of the cookies we hand out
+const (
+  accessTokenCookieName   = "smush-access-token"
+  refreshTokenCookieName  = "smush-refresh-token"
+  csrfTokenCookieName     = "XSRF-TOKEN"
+  oidcStateCookieName     = "smush-oidc-state"
+)
+
+
+// csrfTokenHeaderName is the header the front end echoes the CSRF cookie back in;
+// Angular's HttpClient does this for us on every state-changing request
+const csrfTokenHeaderName = "X-XSRF-TOKEN"
+
+
+/*---------------------------------
+          Cookie Policy
+----------------------------------*/
+
+// cookiePolicy describes the attributes every one of our cookies gets, so
+// setting and clearing a cookie always agree with each other
+type cookiePolicy struct {
+  Secure    bool
+  SameSite  http.SameSite
+  Domain    string
+}
+
+
+// authCookiePolicy is read once from the environment:
+// COOKIE_SECURE ("false" to allow plain http, i.e. local development),
+// COOKIE_SAMESITE ("lax", "strict", or "none"), and COOKIE_DOMAIN (optional)
+var authCookiePolicy = getCookiePolicy()
+
+
+// getCookiePolicy reads our cookie policy from the environment,
+// falling back to secure defaults for anything unset or unknown
+func getCookiePolicy() *cookiePolicy {
+  policy := &cookiePolicy{
+    Secure:    os.Getenv("COOKIE_SECURE") != "false",
+    SameSite:  http.SameSiteLaxMode,
+    Domain:    os.Getenv("COOKIE_DOMAIN"),
+  }
+
+  switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+  case "", "lax":
+    policy.SameSite = http.SameSiteLaxMode
+  case "strict":
+    policy.SameSite = http.SameSiteStrictMode
+  case "none":
+    // Browsers drop SameSite=None cookies that aren't also Secure
+    policy.SameSite = http.SameSiteNoneMode
+    policy.Secure = true
+  default:
+    log.Printf("Unknown COOKIE_SAMESITE %s; using lax", os.Getenv("COOKIE_SAMESITE"))
+  }
+
+  return policy
+}
+
+
+// newCookie makes a cookie following our cookie policy; an empty value with
+// a zero expiration makes a cookie that deletes any existing one
+func (policy *cookiePolicy) newCookie(name string, value string, path string, expires time.Time, httpOnly bool) *http.Cookie {
+  cookie := &http.Cookie{
+    Name:      name,
+    Value:     value,
+    Path:      path,
+    Domain:    policy.Domain,
+    Secure:    policy.Secure,
+    HttpOnly:  httpOnly,
+    SameSite:  policy.SameSite,
+  }
+
+  if value == "" && expires.IsZero() {
+    cookie.MaxAge = -1
+  } else {
+    cookie.Expires = expires
+  }
+
+  return cookie
+}
+
+
+/*---------------------------------
+          Auth Cookies
+----------------------------------*/
+
+// setAuthCookie sets one of our access or refresh token cookies; the front end never
+// needs to read them, so they're HttpOnly and only ever sent to the api
+func setAuthCookie(res http.ResponseWriter, name string, token string, expires time.Time) {
+  http.SetCookie(res, authCookiePolicy.newCookie(name, token, "/api/", expires, true))
+}
+
+
+// clearAuthCookies deletes the access and refresh token cookies; used whenever a user is logged out.
+// The attributes have to match the ones the cookies were set with, or the browser keeps them
+func clearAuthCookies(res http.ResponseWriter) {
+  http.SetCookie(res, authCookiePolicy.newCookie(accessTokenCookieName, "", "/api/", time.Time{}, true))
+  http.SetCookie(res, authCookiePolicy.newCookie(refreshTokenCookieName, "", "/api/", time.Time{}, true))
+}
+
+
+// setOIDCStateCookie remembers what we sent an OpenID Connect provider when a user started logging in with it,
+// so we can check the provider's response belongs to that log in. It's only ever sent back to the oidc routes
+func setOIDCStateCookie(res http.ResponseWriter, value string, expires time.Time) {
+  http.SetCookie(res, authCookiePolicy.newCookie(oidcStateCookieName, value, "/api/auth/oidc/", expires, true))
+}
+
+
+// clearOIDCStateCookie deletes the OpenID Connect state cookie once it's been used
+func clearOIDCStateCookie(res http.ResponseWriter) {
+  http.SetCookie(res, authCookiePolicy.newCookie(oidcStateCookieName, "", "/api/auth/oidc/", time.Time{}, true))
+}
+
+
+/*---------------------------------
+          CSRF Protection
+----------------------------------*/
+
+// ensureCSRFCookie gives a browser a random CSRF token cookie if it doesn't have one yet.
+// It isn't HttpOnly, since the front end has to read it to echo it back as a header
+func ensureCSRFCookie(res http.ResponseWriter, req *http.Request) {
+  csrfCookie, err := req.Cookie(csrfTokenCookieName)
+  if err == nil && csrfCookie.Value != "" {
+    return
+  }
+
+  randomBytes := make([]byte, 32)
+  _, err = rand.Read(randomBytes)
+  if err != nil {
+    log.Printf("Error generating CSRF token: %s", err.Error())
+    return
+  }
+
+  http.SetCookie(res, authCookiePolicy.newCookie(csrfTokenCookieName, hex.EncodeToString(randomBytes), "/", time.Now().AddDate(1, 0, 0), false))
+}
+
+
+// checkCSRFToken makes sure a state-changing request echoed its CSRF cookie back in a header
+// (double-submit); another site can make a browser send our cookies, but can't read them.
+// Safe methods are always allowed. Writes the error response and returns false otherwise
+func checkCSRFToken(res http.ResponseWriter, req *http.Request) bool {
+  switch req.Method {
+  case http.MethodGet, http.MethodHead, http.MethodOptions:
+    return true
+  }
+
+  csrfCookie, err := req.Cookie(csrfTokenCookieName)
+  if err != nil || csrfCookie.Value == "" {
+    http.Error(res, "Missing CSRF token cookie. Please reload the page", http.StatusForbidden)
+    return false
+  }
+
+  csrfHeader := req.Header.Get(csrfTokenHeaderName)
+  if subtle.ConstantTimeCompare([]byte(csrfHeader), []byte(csrfCookie.Value)) != 1 {
+    http.Error(res, "Invalid CSRF token. Please reload the page", http.StatusForbidden)
+    return false
+  }
+
+  return true
+}
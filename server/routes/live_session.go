@@ -0,0 +1,230 @@
+package routes
+
+import (
+  "sort"
+  "time"
+
+  "github.com/cakebin/smush/server/services/db"
+  "github.com/cakebin/smush/server/services/events"
+)
+
+
+// Without a set start time, a live session is every match a user has logged without a break longer
+// than the session gap; we only look back so far when picking up a session that's already going
+const (
+  liveSessionGap       = time.Hour
+  liveSessionLookback  = 24 * time.Hour
+)
+
+
+// How many recent results a live session shows when the overlay doesn't ask for a number, and the most it can ask for
+const (
+  defaultLiveSessionResults  = 10
+  maxLiveSessionResults      = 50
+)
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// LiveSession describes a user's current session for stream overlays;
+// it's sent again every time one of the user's matches changes
+type LiveSession struct {
+  SessionStart          db.NullTimeJSON         `json:"sessionStart"`
+  NumMatches            int64                   `json:"numMatches"`
+  Wins                  int64                   `json:"wins"`
+  Losses                int64                   `json:"losses"`
+  // The character the user played in their latest match
+  CurrentCharacterID    db.NullInt64JSON        `json:"currentCharacterId"`
+  CurrentCharacterName  db.NullStringJSON       `json:"currentCharacterName"`
+  CurrentCharacterImg   db.NullStringJSON       `json:"currentCharacterImage"`
+  // GSP change on the current character, from their first match with it this session to their latest
+  CurrentGsp            db.NullInt64JSON        `json:"currentGsp"`
+  GspDelta              db.NullInt64JSON        `json:"gspDelta"`
+  // Latest first
+  RecentResults         []*LiveSessionResult    `json:"recentResults"`
+}
+
+
+// LiveSessionResult describes a single match in a live session
+type LiveSessionResult struct {
+  MatchID                int64              `json:"matchId"`
+  Created                time.Time          `json:"created"`
+  UserWin                db.NullBoolJSON    `json:"userWin"`
+  UserCharacterID        db.NullInt64JSON   `json:"userCharacterId"`
+  UserCharacterGsp       db.NullInt64JSON   `json:"userCharacterGsp"`
+  OpponentCharacterID    int64              `json:"opponentCharacterId"`
+  OpponentCharacterName  string             `json:"opponentCharacterName"`
+  OpponentCharacterImg   string             `json:"opponentCharacterImage"`
+}
+
+
+// liveSessionTracker keeps track of the matches in a user's live session as their match events come in
+type liveSessionTracker struct {
+  // When the session was set to start; zero means sessions are split by liveSessionGap
+  since       time.Time
+  numResults  int
+  // Oldest first
+  matchViews  []*db.MatchView
+}
+
+
+/*---------------------------------
+             Helpers
+----------------------------------*/
+
+// newLiveSessionTracker picks up a user's live session from the matches they've already logged
+func newLiveSessionTracker(services *Services, userID int64, since time.Time, numResults int) (*liveSessionTracker, error) {
+  tracker := &liveSessionTracker{
+    since:       since,
+    numResults:  numResults,
+  }
+
+  lookback := since
+  if lookback.IsZero() {
+    lookback = time.Now().Add(-liveSessionLookback)
+  }
+  matchViews, err := services.Database.GetMatchViewsByUserIDSince(userID, lookback)
+  if err != nil {
+    return nil, err
+  }
+
+  if !since.IsZero() {
+    tracker.matchViews = matchViews
+    return tracker, nil
+  }
+
+  // Walk back from the latest match until there's a break; a session that's been
+  // on a break since then is already over, so the next match starts a new one
+  if len(matchViews) == 0 || time.Since(matchViews[len(matchViews)-1].Created) > liveSessionGap {
+    tracker.matchViews = make([]*db.MatchView, 0)
+    return tracker, nil
+  }
+  sessionStart := len(matchViews) - 1
+  for sessionStart > 0 && matchViews[sessionStart].Created.Sub(matchViews[sessionStart-1].Created) <= liveSessionGap {
+    sessionStart--
+  }
+  tracker.matchViews = matchViews[sessionStart:]
+
+  return tracker, nil
+}
+
+
+// apply updates the session with a match event; returns false if the event didn't change it
+func (tracker *liveSessionTracker) apply(event *events.Event) bool {
+  matchView, ok := event.Data.(*db.MatchView)
+  if !ok {
+    return false
+  }
+
+  index := -1
+  for i, sessionMatchView := range tracker.matchViews {
+    if sessionMatchView.MatchID == matchView.MatchID {
+      index = i
+    }
+  }
+
+  switch event.EventType {
+  case matchEventCreate, matchEventRestore:
+    if index >= 0 {
+      tracker.matchViews[index] = matchView
+      return true
+    }
+    if !tracker.since.IsZero() && matchView.Created.Before(tracker.since) {
+      return false
+    }
+
+    if tracker.since.IsZero() && len(tracker.matchViews) > 0 {
+      first := tracker.matchViews[0]
+      last := tracker.matchViews[len(tracker.matchViews)-1]
+
+      // A match logged after a break starts a new session; a restored one from before this session isn't part of it
+      if matchView.Created.Sub(last.Created) > liveSessionGap {
+        tracker.matchViews = make([]*db.MatchView, 0)
+      } else if first.Created.Sub(matchView.Created) > liveSessionGap {
+        return false
+      }
+    }
+
+    tracker.matchViews = append(tracker.matchViews, matchView)
+    sort.SliceStable(tracker.matchViews, func(i, j int) bool {
+      return tracker.matchViews[i].Created.Before(tracker.matchViews[j].Created)
+    })
+    return true
+  case matchEventUpdate:
+    if index < 0 {
+      return false
+    }
+    tracker.matchViews[index] = matchView
+    return true
+  case matchEventDelete:
+    if index < 0 {
+      return false
+    }
+    tracker.matchViews = append(tracker.matchViews[:index], tracker.matchViews[index+1:]...)
+    return true
+  }
+
+  return false
+}
+
+
+// session sums up the matches in the session for overlays
+func (tracker *liveSessionTracker) session() *LiveSession {
+  liveSession := new(LiveSession)
+  liveSession.RecentResults = make([]*LiveSessionResult, 0)
+  if len(tracker.matchViews) == 0 {
+    return liveSession
+  }
+
+  liveSession.SessionStart.Valid = true
+  liveSession.SessionStart.Time = tracker.matchViews[0].Created
+  if !tracker.since.IsZero() {
+    liveSession.SessionStart.Time = tracker.since
+  }
+
+  latest := tracker.matchViews[len(tracker.matchViews)-1]
+  liveSession.CurrentCharacterID = latest.UserCharacterID
+  liveSession.CurrentCharacterName = latest.UserCharacterName
+  liveSession.CurrentCharacterImg = latest.UserCharacterImg
+
+  var firstGsp db.NullInt64JSON
+  for i := len(tracker.matchViews) - 1; i >= 0; i-- {
+    matchView := tracker.matchViews[i]
+
+    liveSession.NumMatches++
+    if matchView.UserWin.Valid && matchView.UserWin.Bool {
+      liveSession.Wins++
+    } else if matchView.UserWin.Valid {
+      liveSession.Losses++
+    }
+
+    if latest.UserCharacterID.Valid && matchView.UserCharacterID == latest.UserCharacterID && matchView.UserCharacterGsp.Valid {
+      if !liveSession.CurrentGsp.Valid {
+        liveSession.CurrentGsp = matchView.UserCharacterGsp
+      }
+      firstGsp = matchView.UserCharacterGsp
+    }
+
+    if len(liveSession.RecentResults) < tracker.numResults {
+      liveSession.RecentResults = append(liveSession.RecentResults, &LiveSessionResult{
+        MatchID:                matchView.MatchID,
+        Created:                matchView.Created,
+        UserWin:                matchView.UserWin,
+        UserCharacterID:        matchView.UserCharacterID,
+        UserCharacterGsp:       matchView.UserCharacterGsp,
+        OpponentCharacterID:    matchView.OpponentCharacterID,
+        OpponentCharacterName:  matchView.OpponentCharacterName,
+        OpponentCharacterImg:   matchView.OpponentCharacterImg,
+      })
+    }
+  }
+
+  if liveSession.CurrentGsp.Valid {
+    liveSession.GspDelta.Valid = true
+    liveSession.GspDelta.Int64 = liveSession.CurrentGsp.Int64 - firstGsp.Int64
+  }
+
+  return liveSession
+}
@@ -0,0 +1,125 @@
+package routes
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strconv"
+  "time"
+
+  "github.com/cakebin/smush/server/services/db"
+  "github.com/cakebin/smush/server/services/events"
+)
+
+
+// The kinds of match events we publish
+const (
+  matchEventCreate   = "match_create"
+  matchEventUpdate   = "match_update"
+  matchEventDelete   = "match_delete"
+  matchEventRestore  = "match_restore"
+)
+
+
+// How often we send a comment down an idle match stream, so proxies don't close it
+// and the browser notices a dead connection; and how long browsers wait to reconnect
+const (
+  matchStreamHeartbeatInterval  = 15 * time.Second
+  matchStreamRetryMilliseconds  = 3000
+)
+
+
+// matchStreamFilter describes which match events a stream wants; zero means any
+type matchStreamFilter struct {
+  UserID       int64
+  CharacterID  int64
+}
+
+
+// publishMatchEvent tells every match stream about a change to a match; the match view
+// is the match after the change (or before it, for deletes), tags included
+func publishMatchEvent(services *Services, eventType string, matchView *db.MatchView) {
+  characterIDs := []int64{matchView.OpponentCharacterID}
+  if matchView.UserCharacterID.Valid {
+    characterIDs = append(characterIDs, matchView.UserCharacterID.Int64)
+  }
+
+  services.Events.Publish(eventType, matchView.UserID, characterIDs, matchView)
+}
+
+
+// parseMatchStreamFilter reads the optional filters for match/stream
+// from the query string (i.e. ?user=3&character=12)
+func parseMatchStreamFilter(req *http.Request) (*matchStreamFilter, error) {
+  filter := new(matchStreamFilter)
+  query := req.URL.Query()
+
+  userID, err := parseOptionalID(query.Get("user"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid user %s", query.Get("user"))
+  }
+  filter.UserID = userID.Int64
+
+  characterID, err := parseOptionalID(query.Get("character"))
+  if err != nil {
+    return nil, fmt.Errorf("invalid character %s", query.Get("character"))
+  }
+  filter.CharacterID = characterID.Int64
+
+  return filter, nil
+}
+
+
+// getLastEventID gets the ID of the last event a reconnecting stream saw; browsers send it as
+// the Last-Event-ID header, but it can also be given as ?lastEventId= when opening a new stream
+func getLastEventID(req *http.Request) int64 {
+  lastEventID := req.Header.Get("Last-Event-ID")
+  if lastEventID == "" {
+    lastEventID = req.URL.Query().Get("lastEventId")
+  }
+
+  id, err := strconv.ParseInt(lastEventID, 10, 64)
+  if err != nil {
+    return 0
+  }
+
+  return id
+}
+
+
+// matches checks if a stream with this filter wants a given event
+func (filter *matchStreamFilter) matches(event *events.Event) bool {
+  if filter.UserID != 0 && event.UserID != filter.UserID {
+    return false
+  }
+  if filter.CharacterID != 0 && !event.HasCharacter(filter.CharacterID) {
+    return false
+  }
+
+  return true
+}
+
+
+// writeMatchEvent writes a single match event to a stream, in the format EventSource expects.
+// Other users' private tags are left off, the same as they are in match/getall
+func writeMatchEvent(res http.ResponseWriter, event *events.Event, viewerUserID int64) error {
+  data := event.Data
+  if matchView, ok := event.Data.(*db.MatchView); ok && matchView.UserID != viewerUserID {
+    visibleMatchView := *matchView
+    visibleMatchView.MatchTags = make([]*db.MatchTagView, 0)
+    for _, matchTagView := range matchView.MatchTags {
+      if !matchTagView.TagUserID.Valid {
+        visibleMatchView.MatchTags = append(visibleMatchView.MatchTags, matchTagView)
+      }
+    }
+    data = &visibleMatchView
+  }
+
+  eventData, err := json.Marshal(data)
+  if err != nil {
+    return err
+  }
+
+  _, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.EventID, event.EventType, eventData)
+  return err
+}
@@ -0,0 +1,157 @@
+package routes
+
+import (
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/cakebin/smush/server/services/auth"
+  "github.com/cakebin/smush/server/services/events"
+)
+
+
+/*---------------------------------
+            Test Stubs
+----------------------------------*/
+
+// stubStreamAuth uses our real auth for everything but access tokens,
+// which always belong to user 7 and expire whenever the test says
+type stubStreamAuth struct {
+  *auth.Auth
+  accessExpiration  time.Time
+}
+
+
+func (a *stubStreamAuth) GetUserIDFromJWTToken(token string) (int64, error) {
+  return 7, nil
+}
+
+
+func (a *stubStreamAuth) GetJWTTokenExpiration(token string) (time.Time, error) {
+  return a.accessExpiration, nil
+}
+
+
+// newStubStreamRouter makes a match router on the given hub whose access tokens expire at accessExpiration
+func newStubStreamRouter(hub *events.Events, accessExpiration time.Time) *MatchRouter {
+  stubAuth := &stubStreamAuth{Auth: auth.New(nil), accessExpiration: accessExpiration}
+  services := &Services{Auth: stubAuth, Events: hub}
+
+  return NewMatchRouter(services)
+}
+
+
+// getMatchStream opens match/stream as a reconnecting browser that last saw lastEventID
+// (none when empty), and waits up to five seconds for the stream to close
+func getMatchStream(t *testing.T, router *MatchRouter, lastEventID string) *httptest.ResponseRecorder {
+  req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+  req.AddCookie(&http.Cookie{Name: accessTokenCookieName, Value: "test-access-token"})
+  if lastEventID != "" {
+    req.Header.Set("Last-Event-ID", lastEventID)
+  }
+
+  res := httptest.NewRecorder()
+  done := make(chan bool)
+  go func() {
+    router.ServeHTTP(res, req)
+    close(done)
+  }()
+
+  select {
+  case <-done:
+  case <-time.After(5 * time.Second):
+    t.Fatal("Match stream did not close when its access token expired")
+  }
+
+  return res
+}
+
+
+// streamEventIDs gets the IDs of the events written to a match stream, in order
+func streamEventIDs(body string) []string {
+  ids := make([]string, 0)
+  for _, line := range strings.Split(body, "\n") {
+    if strings.HasPrefix(line, "id: ") {
+      ids = append(ids, strings.TrimPrefix(line, "id: "))
+    }
+  }
+  return ids
+}
+
+
+/*---------------------------------
+              Tests
+----------------------------------*/
+
+func TestMatchStreamReplay(t *testing.T) {
+  tests := []struct {
+    name         string
+    lastEventID  string
+    expectedIDs  []string
+    reset        bool
+  }{
+    {"new stream", "", []string{}, false},
+    {"caught up stream", "5", []string{}, false},
+    {"stream within the buffer", "3", []string{"4", "5"}, false},
+    {"stream at the oldest buffered event", "2", []string{"3", "4", "5"}, false},
+    {"stream past the buffer", "1", []string{"3", "4", "5"}, true},
+    {"stream from before a restart", "9", []string{}, true},
+  }
+  for _, test := range tests {
+    // Three events are kept for replays, so the first two of five are gone
+    hub := events.New(3)
+    for i := 0; i < 5; i++ {
+      hub.Publish(matchEventCreate, 7, []int64{12}, nil)
+    }
+    router := newStubStreamRouter(hub, time.Now().Add(50 * time.Millisecond))
+
+    res := getMatchStream(t, router, test.lastEventID)
+    if res.Code != http.StatusOK {
+      t.Fatalf("Match stream for %s returned %d: %s", test.name, res.Code, res.Body.String())
+    }
+
+    body := res.Body.String()
+    if ids := streamEventIDs(body); fmt.Sprint(ids) != fmt.Sprint(test.expectedIDs) {
+      t.Errorf("Match stream for %s replayed %v, expected %v", test.name, ids, test.expectedIDs)
+    }
+    reset := strings.Contains(body, "event: reset\n")
+    if reset != test.reset {
+      t.Errorf("Match stream for %s sent a reset event %t, expected %t", test.name, reset, test.reset)
+    }
+    if reset && len(test.expectedIDs) > 0 && strings.Index(body, "event: reset\n") > strings.Index(body, "id: ") {
+      t.Errorf("Match stream for %s should send the reset event before any replayed ones", test.name)
+    }
+  }
+}
+
+
+func TestMatchStreamClosesAtTokenExpiry(t *testing.T) {
+  started := time.Now()
+  hub := events.New(0)
+  router := newStubStreamRouter(hub, started.Add(100 * time.Millisecond))
+
+  res := getMatchStream(t, router, "")
+  if time.Since(started) < 100 * time.Millisecond {
+    t.Errorf("Match stream closed after %s, before its access token expired", time.Since(started))
+  }
+  if res.Code != http.StatusOK {
+    t.Fatalf("Match stream returned %d: %s", res.Code, res.Body.String())
+  }
+}
+
+
+func TestMatchStreamAlreadyExpired(t *testing.T) {
+  hub := events.New(0)
+  router := newStubStreamRouter(hub, time.Now().Add(-time.Minute))
+
+  res := getMatchStream(t, router, "")
+  if res.Code != http.StatusOK {
+    t.Fatalf("Match stream returned %d: %s", res.Code, res.Body.String())
+  }
+  if !strings.HasPrefix(res.Body.String(), fmt.Sprintf("retry: %d\n\n", matchStreamRetryMilliseconds)) {
+    t.Errorf("Match stream should tell the browser how long to wait before reconnecting, got %q", res.Body.String())
+  }
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+  "log"
+  "os"
+  "strconv"
+  "time"
+)
+
+
+// How long deleted matches stay in the trash when MATCH_TRASH_RETENTION_DAYS isn't set,
+// and how often we check for matches that have been in there longer than that
+const (
+  defaultMatchTrashRetentionDays  = 30
+  matchTrashPurgeInterval         = time.Hour
+)
+
+
+// matchTrashRetentionDays reads how many days deleted matches are kept
+// around from MATCH_TRASH_RETENTION_DAYS, falling back to the default
+func matchTrashRetentionDays() int64 {
+  retentionDays, err := strconv.ParseInt(os.Getenv("MATCH_TRASH_RETENTION_DAYS"), 10, 64)
+  if err != nil || retentionDays < 0 {
+    return defaultMatchTrashRetentionDays
+  }
+
+  return retentionDays
+}
+
+
+// startMatchTrashPurge permanently removes matches that have been in the trash
+// longer than the retention period, once now and then every purge interval
+func startMatchTrashPurge(services *Services) {
+  go func() {
+    for {
+      purgeMatchTrash(services)
+      time.Sleep(matchTrashPurgeInterval)
+    }
+  }()
+}
+
+
+// purgeMatchTrash runs a single purge of the match trash
+func purgeMatchTrash(services *Services) {
+  retention := time.Duration(matchTrashRetentionDays()) * 24 * time.Hour
+  numPurged, err := services.Database.PurgeDeletedMatches(time.Now().Add(-retention))
+  if err != nil {
+    log.Printf("Error purging match trash: %s", err.Error())
+    return
+  }
+
+  if numPurged > 0 {
+    log.Printf("Purged %d matches from the trash", numPurged)
+  }
+}
@@ -2,10 +2,13 @@ package routes
 
 import (
   "log"
+  "os"
+  "strconv"
 
   "github.com/cakebin/smush/server/services/auth"
   "github.com/cakebin/smush/server/services/db"
   "github.com/cakebin/smush/server/services/email"
+  "github.com/cakebin/smush/server/services/events"
 )
 
 
@@ -15,6 +18,7 @@ type Services struct {
   Database  db.DatabaseManager
   Auth      auth.Authenticator
   Email     email.Emailer
+  Events    events.EventManager
 }
 
 
@@ -27,8 +31,12 @@ func NewRouterServices() *Services {
     log.Fatalf("Error opening database: %s", err.Error())
   }
   services.Database = database
-  services.Auth = auth.New()
+  services.Auth = auth.New(database)
   services.Email = email.New()
 
+  // EVENT_REPLAY_SIZE is how many events reconnecting streams can catch up on; unset uses the default
+  replaySize, _ := strconv.Atoi(os.Getenv("EVENT_REPLAY_SIZE"))
+  services.Events = events.New(replaySize)
+
   return services
 }
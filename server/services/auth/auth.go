@@ -1,9 +1,18 @@
 package auth
 
+import (
+  "net/http"
+
+  "github.com/cakebin/smush/server/services/db"
+)
+
 
 // Auth is the struct that we're going to use 
 // to implement all of out Authenticator interfaces
-type Auth struct {}
+type Auth struct {
+  Database  db.PermissionManager
+  oidc      *oidcProvider
+}
 
 
 // Authenticator combines all of the various
@@ -12,11 +21,17 @@ type Authenticator interface {
   JWTManager
   EncryptionManager
   RoleManager
+  SecretTokenManager
+  TOTPManager
+  OIDCManager
 }
 
 
-// New makes a new Auth struct which implements
-// all of the "Authenticator" methods
-func New() *Auth {
-  return &Auth{}
+// New makes a new Auth struct which implements all of the "Authenticator"
+// methods, with the OpenID Connect provider set up from the environment
+func New(database db.PermissionManager) *Auth {
+  return &Auth{
+    Database:  database,
+    oidc:      newOIDCProvider(getOIDCSettings(), &http.Client{Timeout: oidcRequestTimeout}),
+  }
 }
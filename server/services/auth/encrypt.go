@@ -2,10 +2,30 @@ package auth
 
 
 import (
-  "golang.org/x/crypto/bcrypt"
+  "errors"
+  "log"
+  "os"
 )
 
 
+// ErrUnknownHash is returned when checking a password against
+// a hash that none of our password hashers made
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+
+// passwordHashers are all of the algorithms we can check passwords against
+var passwordHashers = []PasswordHasher{
+  newBcryptHasher(),
+  newArgon2idHasher(),
+}
+
+
+// preferredHasher is the algorithm new passwords are hashed with, read once from
+// PASSWORD_HASH_ALGORITHM; hashes made with anything else (or with weaker settings)
+// are redone with it the next time their user logs in
+var preferredHasher = getPreferredHasher()
+
+
 /*---------------------------------
             Interface
 ----------------------------------*/
@@ -15,6 +35,7 @@ import (
 type EncryptionManager interface {
   HashPassword(password string) (string, error)
   CheckPassword(hashed string, password string) (bool, error) 
+  PasswordNeedsRehash(hashed string) bool
 }
 
 
@@ -23,29 +44,66 @@ type EncryptionManager interface {
 ----------------------------------*/
 
 
-// HashPassword takes a given password and hashes it for storage in the user table
+// HashPassword takes a given password and hashes it for storage in the user table;
+// the hash records which algorithm and settings made it, so we can check it later
 func (a *Auth) HashPassword(password string) (string, error) {
-  bytePassword := []byte(password)
+  return preferredHasher.Hash(password)
+}
+
 
-  hash, err := bcrypt.GenerateFromPassword(bytePassword, bcrypt.MinCost)
-  if err != nil {
-    return "", err
+// CheckPassword checks a given plain password against a hashed
+// password made by any of our password hashers to see if they're compatible
+func (a *Auth) CheckPassword(hashed string, password string) (bool, error) {
+  hasher := getHasherForHash(hashed)
+  if hasher == nil {
+    return false, ErrUnknownHash
   }
 
-  return string(hash), nil
+  return hasher.Verify(hashed, password)
 }
 
 
-// CheckPassword checks a given plain password against
-// a hashed password to see if they're compatible
-func (a *Auth) CheckPassword(hashed string, password string) (bool, error) {
-  byteHash := []byte(hashed)
-  bytePassword := []byte(password)
+// PasswordNeedsRehash checks if a hashed password was made with something other than our preferred
+// algorithm and settings, meaning it should be hashed again while we have the plain password (i.e. on log in)
+func (a *Auth) PasswordNeedsRehash(hashed string) bool {
+  if !preferredHasher.Identifies(hashed) {
+    return true
+  }
+
+  return preferredHasher.NeedsRehash(hashed)
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// getHasherForHash finds the password hasher that made a given hash, or nil if none of them did
+func getHasherForHash(hashed string) PasswordHasher {
+  for _, hasher := range passwordHashers {
+    if hasher.Identifies(hashed) {
+      return hasher
+    }
+  }
+
+  return nil
+}
+
+
+// getPreferredHasher reads the preferred password hashing algorithm from
+// PASSWORD_HASH_ALGORITHM, falling back to argon2id when it's missing or unknown
+func getPreferredHasher() PasswordHasher {
+  algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM")
+  if algorithm == "" {
+    algorithm = argon2idAlgorithm
+  }
 
-  err := bcrypt.CompareHashAndPassword(byteHash, bytePassword)
-  if err != nil {
-    return false, err
+  for _, hasher := range passwordHashers {
+    if hasher.Algorithm() == algorithm {
+      return hasher
+    }
   }
 
-  return  true, nil
+  log.Printf("Unknown PASSWORD_HASH_ALGORITHM %s; using %s instead", algorithm, argon2idAlgorithm)
+  return newArgon2idHasher()
 }
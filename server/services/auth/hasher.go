@@ -0,0 +1,261 @@
+package auth
+
+
+import (
+  "crypto/rand"
+  "crypto/subtle"
+  "encoding/base64"
+  "errors"
+  "fmt"
+  "log"
+  "os"
+  "strconv"
+  "strings"
+
+  "golang.org/x/crypto/argon2"
+  "golang.org/x/crypto/bcrypt"
+)
+
+
+// The names of the password hashing algorithms we support, as used in PASSWORD_HASH_ALGORITHM
+const (
+  bcryptAlgorithm    = "bcrypt"
+  argon2idAlgorithm  = "argon2id"
+)
+
+
+// The argon2id settings we hash new passwords with; these follow the
+// "low memory" recommendation from RFC 9106 so a small dyno can keep up
+const (
+  argon2idMemory       = 64 * 1024
+  argon2idIterations   = 3
+  argon2idParallelism  = 4
+  argon2idSaltLength   = 16
+  argon2idKeyLength    = 32
+)
+
+
+// ErrInvalidHash is returned when a hash claims to be from one
+// of our algorithms, but its settings or data can't be read
+var ErrInvalidHash = errors.New("invalid password hash")
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// PasswordHasher describes a single password hashing algorithm. Each hash it makes is a
+// self-describing string (PHC format, i.e. "$argon2id$v=19$m=65536,t=3,p=4$salt$hash")
+// recording the algorithm and settings used, so older hashes can still be checked
+type PasswordHasher interface {
+  Algorithm() string
+  Hash(password string) (string, error)
+  Verify(hashed string, password string) (bool, error)
+  // Identifies checks if a hash was made by this algorithm
+  Identifies(hashed string) bool
+  // NeedsRehash checks if a hash made by this algorithm used weaker settings than we use now
+  NeedsRehash(hashed string) bool
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// bcryptHasher hashes passwords with bcrypt; bcrypt's own "$2a$10$..." format is already PHC-like
+type bcryptHasher struct {
+  cost  int
+}
+
+
+// argon2idHasher hashes passwords with argon2id
+type argon2idHasher struct {
+  memory       uint32
+  iterations   uint32
+  parallelism  uint8
+  saltLength   uint32
+  keyLength    uint32
+}
+
+
+// argon2idParams are the settings and data read back out of an argon2id hash
+type argon2idParams struct {
+  memory       uint32
+  iterations   uint32
+  parallelism  uint8
+  salt         []byte
+  key          []byte
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// newBcryptHasher makes a bcrypt hasher with the cost from BCRYPT_COST
+func newBcryptHasher() *bcryptHasher {
+  return &bcryptHasher{cost: getBcryptCost()}
+}
+
+
+func (h *bcryptHasher) Algorithm() string {
+  return bcryptAlgorithm
+}
+
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+  hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+  if err != nil {
+    return "", err
+  }
+
+  return string(hash), nil
+}
+
+
+func (h *bcryptHasher) Verify(hashed string, password string) (bool, error) {
+  err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+  if err != nil {
+    return false, err
+  }
+
+  return true, nil
+}
+
+
+func (h *bcryptHasher) Identifies(hashed string) bool {
+  return strings.HasPrefix(hashed, "$2a$") || strings.HasPrefix(hashed, "$2b$") || strings.HasPrefix(hashed, "$2y$")
+}
+
+
+func (h *bcryptHasher) NeedsRehash(hashed string) bool {
+  cost, err := bcrypt.Cost([]byte(hashed))
+  if err != nil {
+    return false
+  }
+
+  return cost < h.cost
+}
+
+
+// newArgon2idHasher makes an argon2id hasher with our current settings
+func newArgon2idHasher() *argon2idHasher {
+  return &argon2idHasher{
+    memory:       argon2idMemory,
+    iterations:   argon2idIterations,
+    parallelism:  argon2idParallelism,
+    saltLength:   argon2idSaltLength,
+    keyLength:    argon2idKeyLength,
+  }
+}
+
+
+func (h *argon2idHasher) Algorithm() string {
+  return argon2idAlgorithm
+}
+
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+  salt := make([]byte, h.saltLength)
+  _, err := rand.Read(salt)
+  if err != nil {
+    return "", err
+  }
+
+  key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, h.keyLength)
+
+  return fmt.Sprintf(
+    "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+    argon2.Version,
+    h.memory,
+    h.iterations,
+    h.parallelism,
+    base64.RawStdEncoding.EncodeToString(salt),
+    base64.RawStdEncoding.EncodeToString(key),
+  ), nil
+}
+
+
+func (h *argon2idHasher) Verify(hashed string, password string) (bool, error) {
+  params, err := parseArgon2idHash(hashed)
+  if err != nil {
+    return false, err
+  }
+
+  key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+  if subtle.ConstantTimeCompare(key, params.key) != 1 {
+    return false, errors.New("password does not match hash")
+  }
+
+  return true, nil
+}
+
+
+func (h *argon2idHasher) Identifies(hashed string) bool {
+  return strings.HasPrefix(hashed, "$argon2id$")
+}
+
+
+func (h *argon2idHasher) NeedsRehash(hashed string) bool {
+  params, err := parseArgon2idHash(hashed)
+  if err != nil {
+    return false
+  }
+
+  return params.memory < h.memory || params.iterations < h.iterations || params.parallelism < h.parallelism || uint32(len(params.key)) < h.keyLength
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// parseArgon2idHash reads the settings, salt and key back out of a hash made by argon2idHasher
+func parseArgon2idHash(hashed string) (*argon2idParams, error) {
+  // The leading "$" leaves an empty first part: "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+  parts := strings.Split(hashed, "$")
+  if len(parts) != 6 || parts[1] != argon2idAlgorithm {
+    return nil, ErrInvalidHash
+  }
+
+  var version int
+  _, err := fmt.Sscanf(parts[2], "v=%d", &version)
+  if err != nil || version != argon2.Version {
+    return nil, ErrInvalidHash
+  }
+
+  params := new(argon2idParams)
+  _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+  if err != nil {
+    return nil, ErrInvalidHash
+  }
+
+  params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+  if err != nil {
+    return nil, ErrInvalidHash
+  }
+  params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+  if err != nil || len(params.key) == 0 {
+    return nil, ErrInvalidHash
+  }
+
+  return params, nil
+}
+
+
+// getBcryptCost reads the bcrypt cost from BCRYPT_COST, falling back
+// to bcrypt's default when it's missing or out of bcrypt's range
+func getBcryptCost() int {
+  costEnv := os.Getenv("BCRYPT_COST")
+  if costEnv == "" {
+    return bcrypt.DefaultCost
+  }
+
+  cost, err := strconv.Atoi(costEnv)
+  if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+    log.Printf("Invalid BCRYPT_COST %s; using %d instead", costEnv, bcrypt.DefaultCost)
+    return bcrypt.DefaultCost
+  }
+
+  return cost
+}
@@ -0,0 +1,411 @@
+package auth
+
+
+import (
+  "crypto/rsa"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "math/big"
+  "net/http"
+  "net/url"
+  "os"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/dgrijalva/jwt-go"
+)
+
+
+// How long we wait on the OpenID Connect provider; it shouldn't hang a log in forever
+const oidcRequestTimeout = 10 * time.Second
+
+
+// How long we wait before fetching the provider's signing keys again when we see one we don't know
+const oidcKeyRefreshInterval = time.Minute
+
+
+// ErrOIDCDisabled is returned when OpenID Connect log in is used without being set up
+var ErrOIDCDisabled = errors.New("OpenID Connect log in is not set up")
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// OIDCIdentity describes who a user is according to
+// the OpenID Connect provider they logged in with
+type OIDCIdentity struct {
+  Issuer         string
+  Subject        string
+  EmailAddress   string
+  EmailVerified  bool
+  Name           string
+}
+
+
+// oidcSettings describes the OpenID Connect provider we let users log in with. New reads
+// it from OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET (optional; PKCE covers public
+// clients), OIDC_REDIRECT_URL, and OIDC_SCOPES (defaults to "openid email profile")
+type oidcSettings struct {
+  Issuer        string
+  ClientID      string
+  ClientSecret  string
+  RedirectURL   string
+  Scopes        string
+}
+
+
+// oidcDiscovery is the part of the provider's discovery document
+// (/.well-known/openid-configuration) that we use
+type oidcDiscovery struct {
+  Issuer                 string  `json:"issuer"`
+  AuthorizationEndpoint  string  `json:"authorization_endpoint"`
+  TokenEndpoint          string  `json:"token_endpoint"`
+  JWKSURI                string  `json:"jwks_uri"`
+}
+
+
+// oidcProvider talks to the provider with its own HTTP client, and caches the provider's discovery document
+// and signing keys, since neither changes often; keys are fetched again when a token is signed with a new one
+type oidcProvider struct {
+  settings      *oidcSettings
+  client        *http.Client
+  mutex         sync.Mutex
+  discovery     *oidcDiscovery
+  keys          map[string]*rsa.PublicKey
+  keysFetched   time.Time
+}
+
+
+// oidcTokenResponse is the part of the provider's token endpoint response that we use
+type oidcTokenResponse struct {
+  IDToken           string  `json:"id_token"`
+  Error             string  `json:"error"`
+  ErrorDescription  string  `json:"error_description"`
+}
+
+
+// oidcJWKS is the provider's set of signing keys; we only use its RSA keys
+type oidcJWKS struct {
+  Keys  []struct {
+    KeyType  string  `json:"kty"`
+    KeyID    string  `json:"kid"`
+    Use      string  `json:"use"`
+    N        string  `json:"n"`
+    E        string  `json:"e"`
+  }  `json:"keys"`
+}
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// OIDCManager describes all of the methods used for logging
+// in with an OpenID Connect provider (authorization code with PKCE)
+type OIDCManager interface {
+  OIDCEnabled() bool
+  GetOIDCAuthorizationURL(state string, nonce string, codeVerifier string) (string, error)
+  ExchangeOIDCCode(code string, codeVerifier string, nonce string) (*OIDCIdentity, error)
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// OIDCEnabled checks if an OpenID Connect provider has been set up
+func (a *Auth) OIDCEnabled() bool {
+  return a.oidc != nil && a.oidc.settings.Issuer != "" && a.oidc.settings.ClientID != "" && a.oidc.settings.RedirectURL != ""
+}
+
+
+// GetOIDCAuthorizationURL gets the provider's URL to send a user to for logging in. The state and nonce tie
+// the provider's response to this log in, and only the hash of the code verifier is sent along (PKCE)
+func (a *Auth) GetOIDCAuthorizationURL(state string, nonce string, codeVerifier string) (string, error) {
+  if !a.OIDCEnabled() {
+    return "", ErrOIDCDisabled
+  }
+
+  discovery, err := a.oidc.getDiscovery()
+  if err != nil {
+    return "", err
+  }
+
+  codeChallenge := sha256.Sum256([]byte(codeVerifier))
+  query := url.Values{}
+  query.Set("response_type", "code")
+  query.Set("client_id", a.oidc.settings.ClientID)
+  query.Set("redirect_uri", a.oidc.settings.RedirectURL)
+  query.Set("scope", a.oidc.settings.Scopes)
+  query.Set("state", state)
+  query.Set("nonce", nonce)
+  query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(codeChallenge[:]))
+  query.Set("code_challenge_method", "S256")
+
+  separator := "?"
+  if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+    separator = "&"
+  }
+
+  return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+
+// ExchangeOIDCCode trades the code the provider gave back for an ID token, and verifies it
+// (signature, issuer, audience, expiration, and nonce) before trusting who it says the user is
+func (a *Auth) ExchangeOIDCCode(code string, codeVerifier string, nonce string) (*OIDCIdentity, error) {
+  if !a.OIDCEnabled() {
+    return nil, ErrOIDCDisabled
+  }
+
+  discovery, err := a.oidc.getDiscovery()
+  if err != nil {
+    return nil, err
+  }
+
+  form := url.Values{}
+  form.Set("grant_type", "authorization_code")
+  form.Set("code", code)
+  form.Set("redirect_uri", a.oidc.settings.RedirectURL)
+  form.Set("client_id", a.oidc.settings.ClientID)
+  form.Set("code_verifier", codeVerifier)
+  if a.oidc.settings.ClientSecret != "" {
+    form.Set("client_secret", a.oidc.settings.ClientSecret)
+  }
+
+  tokenRes, err := a.oidc.client.PostForm(discovery.TokenEndpoint, form)
+  if err != nil {
+    return nil, err
+  }
+  defer tokenRes.Body.Close()
+
+  tokenResponse := new(oidcTokenResponse)
+  err = json.NewDecoder(tokenRes.Body).Decode(tokenResponse)
+  if err != nil {
+    return nil, fmt.Errorf("invalid token response from OpenID Connect provider: %s", err.Error())
+  }
+  if tokenRes.StatusCode != http.StatusOK || tokenResponse.IDToken == "" {
+    return nil, fmt.Errorf("OpenID Connect provider rejected the code: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+  }
+
+  return a.oidc.verifyIDToken(tokenResponse.IDToken, nonce)
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// getOIDCSettings reads our OpenID Connect provider's settings from the environment
+func getOIDCSettings() *oidcSettings {
+  settings := &oidcSettings{
+    Issuer:        strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/"),
+    ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+    ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+    RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+    Scopes:        os.Getenv("OIDC_SCOPES"),
+  }
+  if settings.Scopes == "" {
+    settings.Scopes = "openid email profile"
+  }
+
+  return settings
+}
+
+
+// newOIDCProvider makes a provider with the given settings, that talks to it with the given client
+func newOIDCProvider(settings *oidcSettings, client *http.Client) *oidcProvider {
+  return &oidcProvider{settings: settings, client: client}
+}
+
+
+// getDiscovery gets the provider's discovery document, fetching it the first time it's needed
+func (p *oidcProvider) getDiscovery() (*oidcDiscovery, error) {
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+
+  if p.discovery != nil {
+    return p.discovery, nil
+  }
+
+  discovery := new(oidcDiscovery)
+  err := p.getJSON(p.settings.Issuer+"/.well-known/openid-configuration", discovery)
+  if err != nil {
+    return nil, err
+  }
+
+  // The issuer has to be exactly the one we were set up with, or its tokens won't verify anyways
+  if strings.TrimSuffix(discovery.Issuer, "/") != p.settings.Issuer {
+    return nil, fmt.Errorf("OpenID Connect discovery issuer %s does not match %s", discovery.Issuer, p.settings.Issuer)
+  }
+  if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+    return nil, errors.New("OpenID Connect discovery document is missing endpoints")
+  }
+
+  p.discovery = discovery
+  return p.discovery, nil
+}
+
+
+// getKey gets one of the provider's RSA signing keys by its key ID, fetching
+// the provider's keys again if we don't know it (i.e. they rotated their keys)
+func (p *oidcProvider) getKey(keyID string) (*rsa.PublicKey, error) {
+  discovery, err := p.getDiscovery()
+  if err != nil {
+    return nil, err
+  }
+
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+
+  key, ok := p.keys[keyID]
+  if ok {
+    return key, nil
+  }
+  if time.Since(p.keysFetched) < oidcKeyRefreshInterval {
+    return nil, fmt.Errorf("unknown OpenID Connect signing key %s", keyID)
+  }
+
+  jwks := new(oidcJWKS)
+  err = p.getJSON(discovery.JWKSURI, jwks)
+  if err != nil {
+    return nil, err
+  }
+
+  keys := make(map[string]*rsa.PublicKey)
+  for _, jwk := range jwks.Keys {
+    if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+      continue
+    }
+
+    n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+    if err != nil {
+      continue
+    }
+    e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+    if err != nil {
+      continue
+    }
+
+    keys[jwk.KeyID] = &rsa.PublicKey{
+      N: new(big.Int).SetBytes(n),
+      E: int(new(big.Int).SetBytes(e).Int64()),
+    }
+  }
+  p.keys = keys
+  p.keysFetched = time.Now()
+
+  key, ok = p.keys[keyID]
+  if !ok {
+    return nil, fmt.Errorf("unknown OpenID Connect signing key %s", keyID)
+  }
+
+  return key, nil
+}
+
+
+// verifyIDToken checks an ID token from the provider and gets the identity out of it
+func (p *oidcProvider) verifyIDToken(idToken string, nonce string) (*OIDCIdentity, error) {
+  claims := jwt.MapClaims{}
+  parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}}
+  parsedToken, err := parser.ParseWithClaims(
+    idToken,
+    claims,
+    func(token *jwt.Token) (interface{}, error) {
+      keyID, _ := token.Header["kid"].(string)
+      return p.getKey(keyID)
+    },
+  )
+  if err != nil {
+    return nil, err
+  }
+  if !parsedToken.Valid {
+    return nil, errors.New("Token Expired")
+  }
+
+  discovery, err := p.getDiscovery()
+  if err != nil {
+    return nil, err
+  }
+
+  issuer, _ := claims["iss"].(string)
+  if issuer != discovery.Issuer {
+    return nil, fmt.Errorf("ID token issuer %s does not match %s", issuer, discovery.Issuer)
+  }
+  if _, ok := claims["exp"]; !ok {
+    return nil, errors.New("ID token has no expiration")
+  }
+  if !hasOIDCAudience(claims, p.settings.ClientID) {
+    return nil, errors.New("ID token was not issued to us")
+  }
+  tokenNonce, _ := claims["nonce"].(string)
+  if nonce == "" || tokenNonce != nonce {
+    return nil, errors.New("ID token nonce does not match this log in")
+  }
+
+  identity := new(OIDCIdentity)
+  identity.Issuer = issuer
+  identity.Subject, _ = claims["sub"].(string)
+  identity.EmailAddress, _ = claims["email"].(string)
+  identity.Name, _ = claims["name"].(string)
+
+  // Some providers send email_verified as a string
+  switch emailVerified := claims["email_verified"].(type) {
+  case bool:
+    identity.EmailVerified = emailVerified
+  case string:
+    identity.EmailVerified = emailVerified == "true"
+  }
+
+  if identity.Subject == "" {
+    return nil, errors.New("ID token has no subject")
+  }
+
+  return identity, nil
+}
+
+
+// hasOIDCAudience checks if an ID token was issued to a given client; aud can be a single
+// client or a list of them, and azp names the one it's for when there's more than one
+func hasOIDCAudience(claims jwt.MapClaims, clientID string) bool {
+  switch audience := claims["aud"].(type) {
+  case string:
+    return audience == clientID
+  case []interface{}:
+    found := false
+    for _, client := range audience {
+      if client == clientID {
+        found = true
+      }
+    }
+    if !found {
+      return false
+    }
+
+    authorizedParty, ok := claims["azp"].(string)
+    return len(audience) == 1 || (ok && authorizedParty == clientID)
+  }
+
+  return false
+}
+
+
+// getJSON gets a JSON document from the provider
+func (p *oidcProvider) getJSON(documentURL string, v interface{}) error {
+  res, err := p.client.Get(documentURL)
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+
+  if res.StatusCode != http.StatusOK {
+    return fmt.Errorf("OpenID Connect provider returned %d for %s", res.StatusCode, documentURL)
+  }
+
+  return json.NewDecoder(res.Body).Decode(v)
+}
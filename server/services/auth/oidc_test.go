@@ -0,0 +1,404 @@
+package auth
+
+import (
+  "crypto/rand"
+  "crypto/rsa"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/json"
+  "math/big"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/dgrijalva/jwt-go"
+)
+
+
+/*---------------------------------
+          Test Provider
+----------------------------------*/
+
+// testOIDCProvider is a stand-in OpenID Connect provider; it serves a discovery document,
+// a token endpoint that hands back whatever ID token a test gives it, and its signing keys
+type testOIDCProvider struct {
+  t            *testing.T
+  server       *httptest.Server
+  key          *rsa.PrivateKey
+  keyID        string
+  issuer       string
+  idToken      string
+  tokenStatus  int
+  tokenForm    url.Values
+}
+
+
+const (
+  testOIDCClientID     = "smush-client"
+  testOIDCRedirectURL  = "https://smush.example/oidc/callback"
+  testOIDCNonce        = "test-nonce"
+)
+
+
+// newTestOIDCProvider starts a test provider; close its server when the test is done
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+  key, err := rsa.GenerateKey(rand.Reader, 2048)
+  if err != nil {
+    t.Fatalf("Error generating signing key: %s", err.Error())
+  }
+
+  provider := &testOIDCProvider{t: t, key: key, keyID: "test-key", tokenStatus: http.StatusOK}
+
+  mux := http.NewServeMux()
+  mux.HandleFunc("/.well-known/openid-configuration", func(res http.ResponseWriter, req *http.Request) {
+    json.NewEncoder(res).Encode(map[string]string{
+      "issuer":                  provider.issuer,
+      "authorization_endpoint":  provider.server.URL + "/authorize",
+      "token_endpoint":          provider.server.URL + "/token",
+      "jwks_uri":                provider.server.URL + "/jwks",
+    })
+  })
+  mux.HandleFunc("/token", func(res http.ResponseWriter, req *http.Request) {
+    req.ParseForm()
+    provider.tokenForm = req.PostForm
+
+    res.WriteHeader(provider.tokenStatus)
+    if provider.tokenStatus != http.StatusOK {
+      json.NewEncoder(res).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+      return
+    }
+    json.NewEncoder(res).Encode(map[string]string{"id_token": provider.idToken})
+  })
+  mux.HandleFunc("/jwks", func(res http.ResponseWriter, req *http.Request) {
+    json.NewEncoder(res).Encode(map[string]interface{}{
+      "keys": []map[string]string{{
+        "kty":  "RSA",
+        "kid":  provider.keyID,
+        "use":  "sig",
+        "n":    base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+        "e":    base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+      }},
+    })
+  })
+
+  provider.server = httptest.NewServer(mux)
+  provider.issuer = provider.server.URL
+
+  return provider
+}
+
+
+// newAuth makes an Auth that logs in with the test provider
+func (p *testOIDCProvider) newAuth() *Auth {
+  settings := &oidcSettings{
+    Issuer:       p.issuer,
+    ClientID:     testOIDCClientID,
+    RedirectURL:  testOIDCRedirectURL,
+    Scopes:       "openid email profile",
+  }
+
+  return &Auth{oidc: newOIDCProvider(settings, p.server.Client())}
+}
+
+
+// validClaims are the claims of an ID token that should be accepted
+func (p *testOIDCProvider) validClaims() jwt.MapClaims {
+  return jwt.MapClaims{
+    "iss":             p.issuer,
+    "sub":             "user-123",
+    "aud":             testOIDCClientID,
+    "exp":             time.Now().Add(5 * time.Minute).Unix(),
+    "iat":             time.Now().Unix(),
+    "nonce":           testOIDCNonce,
+    "email":           "player@smush.example",
+    "email_verified":  true,
+    "name":            "Player",
+  }
+}
+
+
+// sign makes the ID token the token endpoint hands back next
+func (p *testOIDCProvider) sign(claims jwt.MapClaims) {
+  token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+  token.Header["kid"] = p.keyID
+
+  idToken, err := token.SignedString(p.key)
+  if err != nil {
+    p.t.Fatalf("Error signing ID token: %s", err.Error())
+  }
+  p.idToken = idToken
+}
+
+
+/*---------------------------------
+              Tests
+----------------------------------*/
+
+func TestOIDCEnabled(t *testing.T) {
+  if (&Auth{}).OIDCEnabled() {
+    t.Error("OIDCEnabled with no provider should be false")
+  }
+  if (&Auth{oidc: newOIDCProvider(&oidcSettings{Issuer: "https://id.example"}, http.DefaultClient)}).OIDCEnabled() {
+    t.Error("OIDCEnabled without a client ID and redirect URL should be false")
+  }
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  if !provider.newAuth().OIDCEnabled() {
+    t.Error("OIDCEnabled with a provider set up should be true")
+  }
+}
+
+
+func TestGetOIDCAuthorizationURL(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+
+  authorizationURL, err := a.GetOIDCAuthorizationURL("test-state", testOIDCNonce, "test-verifier")
+  if err != nil {
+    t.Fatalf("GetOIDCAuthorizationURL failed: %s", err.Error())
+  }
+
+  parsedURL, err := url.Parse(authorizationURL)
+  if err != nil {
+    t.Fatalf("Invalid authorization URL %s: %s", authorizationURL, err.Error())
+  }
+  if !strings.HasPrefix(authorizationURL, provider.server.URL+"/authorize?") {
+    t.Errorf("Authorization URL %s should use the discovered authorization endpoint", authorizationURL)
+  }
+
+  codeChallenge := sha256.Sum256([]byte("test-verifier"))
+  expected := map[string]string{
+    "response_type":          "code",
+    "client_id":              testOIDCClientID,
+    "redirect_uri":           testOIDCRedirectURL,
+    "state":                  "test-state",
+    "nonce":                  testOIDCNonce,
+    "code_challenge":         base64.RawURLEncoding.EncodeToString(codeChallenge[:]),
+    "code_challenge_method":  "S256",
+  }
+  query := parsedURL.Query()
+  for name, value := range expected {
+    if query.Get(name) != value {
+      t.Errorf("Authorization URL %s = %q, expected %q", name, query.Get(name), value)
+    }
+  }
+  if query.Get("code_verifier") != "" {
+    t.Error("Authorization URL should never include the code verifier")
+  }
+}
+
+
+func TestGetOIDCAuthorizationURLIssuerMismatch(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+  provider.issuer = "https://someone-else.example"
+
+  _, err := a.GetOIDCAuthorizationURL("test-state", testOIDCNonce, "test-verifier")
+  if err == nil {
+    t.Error("A discovery document for another issuer should be rejected")
+  }
+}
+
+
+func TestExchangeOIDCCode(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+  provider.sign(provider.validClaims())
+
+  identity, err := a.ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+  if err != nil {
+    t.Fatalf("ExchangeOIDCCode failed: %s", err.Error())
+  }
+
+  if identity.Issuer != provider.issuer || identity.Subject != "user-123" {
+    t.Errorf("Identity is %s %s, expected %s user-123", identity.Issuer, identity.Subject, provider.issuer)
+  }
+  if identity.EmailAddress != "player@smush.example" || !identity.EmailVerified || identity.Name != "Player" {
+    t.Errorf("Identity email, verification, and name are wrong: %+v", identity)
+  }
+
+  expectedForm := map[string]string{
+    "grant_type":     "authorization_code",
+    "code":           "test-code",
+    "code_verifier":  "test-verifier",
+    "client_id":      testOIDCClientID,
+    "redirect_uri":   testOIDCRedirectURL,
+  }
+  for name, value := range expectedForm {
+    if provider.tokenForm.Get(name) != value {
+      t.Errorf("Token request %s = %q, expected %q", name, provider.tokenForm.Get(name), value)
+    }
+  }
+}
+
+
+func TestExchangeOIDCCodeEmailVerified(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+
+  // Some providers send email_verified as a string
+  tests := []struct {
+    emailVerified  interface{}
+    expected       bool
+  }{
+    {false, false},
+    {"false", false},
+    {"true", true},
+    {nil, false},
+  }
+  for _, test := range tests {
+    claims := provider.validClaims()
+    if test.emailVerified == nil {
+      delete(claims, "email_verified")
+    } else {
+      claims["email_verified"] = test.emailVerified
+    }
+    provider.sign(claims)
+
+    identity, err := a.ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+    if err != nil {
+      t.Fatalf("ExchangeOIDCCode with email_verified %v failed: %s", test.emailVerified, err.Error())
+    }
+    if identity.EmailVerified != test.expected {
+      t.Errorf("EmailVerified with email_verified %v = %t, expected %t", test.emailVerified, identity.EmailVerified, test.expected)
+    }
+  }
+}
+
+
+func TestExchangeOIDCCodeRejectsBadTokens(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+
+  otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+  if err != nil {
+    t.Fatalf("Error generating signing key: %s", err.Error())
+  }
+
+  tests := []struct {
+    name    string
+    modify  func(claims jwt.MapClaims)
+    sign    func(claims jwt.MapClaims) string
+  }{
+    {name: "nonce missing from token", modify: func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+    {name: "wrong issuer", modify: func(claims jwt.MapClaims) { claims["iss"] = "https://someone-else.example" }},
+    {name: "wrong audience", modify: func(claims jwt.MapClaims) { claims["aud"] = "someone-else" }},
+    {name: "audience list without us", modify: func(claims jwt.MapClaims) { claims["aud"] = []string{"someone-else", "another"} }},
+    {
+      name: "audience list for another authorized party",
+      modify: func(claims jwt.MapClaims) {
+        claims["aud"] = []string{testOIDCClientID, "someone-else"}
+        claims["azp"] = "someone-else"
+      },
+    },
+    {name: "expired", modify: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+    {name: "no expiration", modify: func(claims jwt.MapClaims) { delete(claims, "exp") }},
+    {name: "no subject", modify: func(claims jwt.MapClaims) { delete(claims, "sub") }},
+    {
+      name: "signed with an unknown key",
+      sign: func(claims jwt.MapClaims) string {
+        token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+        token.Header["kid"] = provider.keyID
+        idToken, _ := token.SignedString(otherKey)
+        return idToken
+      },
+    },
+    {
+      name: "signed with HS256",
+      sign: func(claims jwt.MapClaims) string {
+        token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+        token.Header["kid"] = provider.keyID
+        idToken, _ := token.SignedString([]byte("not-a-real-key"))
+        return idToken
+      },
+    },
+  }
+  for _, test := range tests {
+    claims := provider.validClaims()
+    if test.modify != nil {
+      test.modify(claims)
+    }
+    if test.sign != nil {
+      provider.idToken = test.sign(claims)
+    } else {
+      provider.sign(claims)
+    }
+
+    _, err := a.ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+    if err == nil {
+      t.Errorf("ExchangeOIDCCode with %s should have failed", test.name)
+    }
+  }
+}
+
+
+func TestExchangeOIDCCodeRejectsBadNonce(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+  provider.sign(provider.validClaims())
+
+  // The nonce from this log in's state cookie has to be the one the provider put in the token
+  for _, nonce := range []string{"some-other-nonce", ""} {
+    _, err := a.ExchangeOIDCCode("test-code", "test-verifier", nonce)
+    if err == nil {
+      t.Errorf("ExchangeOIDCCode with nonce %q should have failed", nonce)
+    }
+  }
+}
+
+
+func TestExchangeOIDCCodeTokenEndpointError(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+  provider.tokenStatus = http.StatusBadRequest
+
+  _, err := a.ExchangeOIDCCode("bad-code", "test-verifier", testOIDCNonce)
+  if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+    t.Errorf("ExchangeOIDCCode with a rejected code should fail with the provider's error, got %v", err)
+  }
+}
+
+
+func TestExchangeOIDCCodeRotatedKeys(t *testing.T) {
+  provider := newTestOIDCProvider(t)
+  defer provider.server.Close()
+  a := provider.newAuth()
+  provider.sign(provider.validClaims())
+
+  _, err := a.ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+  if err != nil {
+    t.Fatalf("ExchangeOIDCCode failed: %s", err.Error())
+  }
+
+  // A key we've never seen is fetched again, but not more than once a minute
+  provider.keyID = "rotated-key"
+  provider.sign(provider.validClaims())
+  _, err = a.ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+  if err == nil {
+    t.Error("A new key right after fetching the keys should not be fetched again yet")
+  }
+
+  a.oidc.keysFetched = time.Now().Add(-oidcKeyRefreshInterval)
+  _, err = a.ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+  if err != nil {
+    t.Errorf("A rotated key should be fetched once the refresh interval has passed: %s", err.Error())
+  }
+}
+
+
+func TestExchangeOIDCCodeDisabled(t *testing.T) {
+  _, err := (&Auth{}).ExchangeOIDCCode("test-code", "test-verifier", testOIDCNonce)
+  if err != ErrOIDCDisabled {
+    t.Errorf("ExchangeOIDCCode without a provider should return ErrOIDCDisabled, got %v", err)
+  }
+}
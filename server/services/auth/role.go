@@ -1,11 +1,20 @@
 package auth
 
 import (
-  "github.com/cakebin/smush/server/services/db"
+  "context"
+  "sync"
 )
 
 
-const adminRoleID int64 = 1
+// The permissions we check for in code; these must match the permissions table
+const (
+  PermissionManageCharacters = "characters:manage"
+  PermissionManageStages     = "stages:manage"
+  PermissionManageTags       = "tags:manage"
+  PermissionManageRoles      = "roles:manage"
+  PermissionManageUsers      = "users:manage"
+  PermissionViewAudit        = "audit:view"
+)
 
 
 /*---------------------------------
@@ -15,7 +24,25 @@ const adminRoleID int64 = 1
 // RoleManager describes all of the methods used
 // for handling the permissions/roles auth layer
 type RoleManager interface {
-  HasRoleAdmin(userRoleViews []*db.UserRoleView) bool
+  WithPermissionCache(ctx context.Context) context.Context
+  HasPermission(ctx context.Context, userID int64, permissionName string) (bool, error)
+  GetPermissionNames(ctx context.Context, userID int64) ([]string, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// permissionCacheKey is the context key for a request's permissionCache
+type permissionCacheKey struct{}
+
+
+// permissionCache holds the permissions we've already looked up while handling
+// a single request, so checking several permissions only hits the database once
+type permissionCache struct {
+  mutex                   sync.Mutex
+  permissionNamesByUserID map[int64][]string
 }
 
 
@@ -23,14 +50,53 @@ type RoleManager interface {
        Method Implementations
 ----------------------------------*/
 
-// HasRoleAdmin checks to see whether or not user's
-// fetched user roles has the "admin" role
-func (a *Auth) HasRoleAdmin(userRoleViews []*db.UserRoleView) bool {
-  for _, userRoleView := range userRoleViews {
-    if userRoleView.RoleID == adminRoleID {
-      return true
+// WithPermissionCache gives a request's context its own permission cache; permissions are
+// only cached for the life of the request, so role changes take effect on the next one
+func (a *Auth) WithPermissionCache(ctx context.Context) context.Context {
+  cache := &permissionCache{permissionNamesByUserID: make(map[int64][]string)}
+  return context.WithValue(ctx, permissionCacheKey{}, cache)
+}
+
+
+// HasPermission checks to see whether or not any
+// of a user's roles grant a given permission
+func (a *Auth) HasPermission(ctx context.Context, userID int64, permissionName string) (bool, error) {
+  permissionNames, err := a.GetPermissionNames(ctx, userID)
+  if err != nil {
+    return false, err
+  }
+
+  for _, userPermissionName := range permissionNames {
+    if userPermissionName == permissionName {
+      return true, nil
     }
   }
 
-  return false
+  return false, nil
+}
+
+
+// GetPermissionNames gets the names of every permission granted by a user's roles,
+// using the context's permission cache if it has one
+func (a *Auth) GetPermissionNames(ctx context.Context, userID int64) ([]string, error) {
+  cache, hasCache := ctx.Value(permissionCacheKey{}).(*permissionCache)
+  if !hasCache {
+    return a.Database.GetPermissionNamesByUserID(userID)
+  }
+
+  cache.mutex.Lock()
+  defer cache.mutex.Unlock()
+
+  permissionNames, isCached := cache.permissionNamesByUserID[userID]
+  if isCached {
+    return permissionNames, nil
+  }
+
+  permissionNames, err := a.Database.GetPermissionNamesByUserID(userID)
+  if err != nil {
+    return nil, err
+  }
+  cache.permissionNamesByUserID[userID] = permissionNames
+
+  return permissionNames, nil
 }
@@ -0,0 +1,48 @@
+package auth
+
+
+import (
+  "crypto/rand"
+  "crypto/sha256"
+  "encoding/hex"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// SecretTokenManager describes all of the methods used for the random tokens we
+// hand out in links (i.e. share links); we only ever store a hash of the token
+type SecretTokenManager interface {
+  GetNewSecretToken() (string, string, error)
+  HashSecretToken(token string) string
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetNewSecretToken generates a new random token, returning both
+// the token to give out and the hash of it to store in the database
+func (a *Auth) GetNewSecretToken() (string, string, error) {
+  randomBytes := make([]byte, 32)
+  _, err := rand.Read(randomBytes)
+  if err != nil {
+    return "", "", err
+  }
+
+  token := hex.EncodeToString(randomBytes)
+
+  return token, a.HashSecretToken(token), nil
+}
+
+
+// HashSecretToken hashes a given secret token for storage or lookup; the tokens are
+// already random enough that a plain SHA-256 is safe, unlike with passwords
+func (a *Auth) HashSecretToken(token string) string {
+  hash := sha256.Sum256([]byte(token))
+
+  return hex.EncodeToString(hash[:])
+}
@@ -18,13 +18,25 @@ var jwtKey = []byte(os.Getenv("JWT_TOKEN_SECRET"))
 
 
 // Claims is a custom extended jwt.StandardClaims to include
-// a user's email address as part of the claims
+// a user's email address as part of the claims. Scoped tokens
+// are only good for one thing (i.e. finishing a two-factor log in),
+// and are never accepted as access or refresh tokens
 type Claims struct {
   UserID               int
+  Scope                string  `json:",omitempty"`
   jwt.StandardClaims
 }
 
 
+// ScopeTwoFactor is the scope of the token we give out after a user's password checks out,
+// but before they've entered their two-factor code
+const ScopeTwoFactor = "two_factor"
+
+
+// errWrongScope is returned when a token is used for something outside of its scope
+var errWrongScope = errors.New("Token has the wrong scope")
+
+
 /*---------------------------------
             Interface
 ----------------------------------*/
@@ -36,6 +48,9 @@ type JWTManager interface {
   RefreshJWTAccessToken(token string, expiration time.Time) (string, error)
   CheckJWTToken(token string) (bool, error)
   GetUserIDFromJWTToken(token string) (int64, error)
+  GetJWTTokenExpiration(token string) (time.Time, error)
+  GetNewScopedJWTToken(id int64, scope string, expiration time.Time) (string, error)
+  GetUserIDFromScopedJWTToken(token string, scope string) (int64, error)
 }
 
 
@@ -80,6 +95,9 @@ func (a *Auth) CheckJWTToken(token string) (bool, error) {
   if !parsedToken.Valid {
     return false, errors.New("Token Expired")
   }
+  if claims.Scope != "" {
+    return false, errWrongScope
+  }
 
   return true, nil
 }
@@ -123,6 +141,74 @@ func (a *Auth) GetUserIDFromJWTToken(token string) (int64, error) {
   if !parsedToken.Valid {
     return 0, errors.New("Token Expired")
   }
+  if claims.Scope != "" {
+    return 0, errWrongScope
+  }
+
+  return int64(claims.UserID), nil
+}
+
+
+// GetJWTTokenExpiration gets when a valid JWT token expires
+func (a *Auth) GetJWTTokenExpiration(token string) (time.Time, error) {
+  claims := new(Claims)
+  parsedToken, err := jwt.ParseWithClaims(
+    token,
+    claims,
+    func(token *jwt.Token) (interface{}, error) { return jwtKey, nil},
+  )
+  if err != nil {
+    return time.Time{}, err
+  }
+
+  if !parsedToken.Valid {
+    return time.Time{}, errors.New("Token Expired")
+  }
+
+  return time.Unix(claims.ExpiresAt, 0), nil
+}
+
+
+// GetNewScopedJWTToken generates a new jwt token for a given user that's only good for a
+// given scope; these are checked with GetUserIDFromScopedJWTToken instead of CheckJWTToken
+func (a *Auth) GetNewScopedJWTToken(id int64, scope string, expirationTime time.Time) (string, error) {
+  claims := &Claims{
+    UserID: int(id),
+    Scope: scope,
+    StandardClaims: jwt.StandardClaims{
+      ExpiresAt: expirationTime.Unix(),
+    },
+  }
+
+  token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+  tokenStr, err := token.SignedString(jwtKey)
+  if err != nil {
+    return "", err
+  }
+
+  return tokenStr, nil
+}
+
+
+// GetUserIDFromScopedJWTToken checks that a token is valid and has the given scope,
+// then extracts the stored userID from its claims
+func (a *Auth) GetUserIDFromScopedJWTToken(token string, scope string) (int64, error) {
+  claims := new(Claims)
+  parsedToken, err := jwt.ParseWithClaims(
+    token,
+    claims,
+    func(token *jwt.Token) (interface{}, error) { return jwtKey, nil},
+  )
+  if err != nil {
+    return 0, err
+  }
+
+  if !parsedToken.Valid {
+    return 0, errors.New("Token Expired")
+  }
+  if claims.Scope != scope {
+    return 0, errWrongScope
+  }
 
   return int64(claims.UserID), nil
 }
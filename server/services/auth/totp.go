@@ -0,0 +1,172 @@
+package auth
+
+
+import (
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/sha1"
+  "crypto/subtle"
+  "encoding/base32"
+  "encoding/binary"
+  "encoding/hex"
+  "fmt"
+  "net/url"
+  "strings"
+  "time"
+)
+
+
+// The TOTP settings we use; these are the defaults (RFC 6238) that every authenticator app supports,
+// and we accept codes from one step before or after the current one to allow for clock drift
+const (
+  totpIssuer        = "Smush Tracker"
+  totpSecretLength  = 20
+  totpDigits        = 6
+  totpPeriod        = 30
+  totpSkew          = 1
+)
+
+
+// How many recovery codes a user gets at a time, and how many random bytes are in each
+const (
+  numRecoveryCodes    = 10
+  recoveryCodeLength  = 8
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TOTPManager describes all of the methods used for
+// time-based one time passwords and their recovery codes
+type TOTPManager interface {
+  GetNewTOTPSecret() (string, error)
+  GetTOTPURI(secret string, accountName string) string
+  CheckTOTPCode(secret string, code string) (int64, bool)
+  GetNewRecoveryCodes() ([]string, []string, error)
+  HashRecoveryCode(code string) string
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetNewTOTPSecret generates a new random TOTP secret, base32 encoded the way authenticator apps expect
+func (a *Auth) GetNewTOTPSecret() (string, error) {
+  randomBytes := make([]byte, totpSecretLength)
+  _, err := rand.Read(randomBytes)
+  if err != nil {
+    return "", err
+  }
+
+  return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+
+// GetTOTPURI makes the otpauth:// URI for a TOTP secret; authenticator apps
+// can add the secret by scanning it as a QR code
+func (a *Auth) GetTOTPURI(secret string, accountName string) string {
+  query := url.Values{}
+  query.Set("secret", secret)
+  query.Set("issuer", totpIssuer)
+  query.Set("algorithm", "SHA1")
+  query.Set("digits", fmt.Sprintf("%d", totpDigits))
+  query.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+  label := url.PathEscape(totpIssuer + ":" + accountName)
+
+  return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+
+// CheckTOTPCode checks a code from a user's authenticator app against their secret, returning
+// the time step the code was for. Callers should make sure each step is only used once
+func (a *Auth) CheckTOTPCode(secret string, code string) (int64, bool) {
+  key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+  if err != nil {
+    return 0, false
+  }
+
+  code = strings.TrimSpace(code)
+  if len(code) != totpDigits {
+    return 0, false
+  }
+
+  currentStep := time.Now().Unix() / totpPeriod
+  for step := currentStep - totpSkew; step <= currentStep + totpSkew; step++ {
+    if subtle.ConstantTimeCompare([]byte(getHOTPCode(key, step)), []byte(code)) == 1 {
+      return step, true
+    }
+  }
+
+  return 0, false
+}
+
+
+// GetNewRecoveryCodes generates a new set of recovery codes, returning both the
+// codes to show the user (once) and the hashes of them to store in the database
+func (a *Auth) GetNewRecoveryCodes() ([]string, []string, error) {
+  codes := make([]string, 0)
+  hashedCodes := make([]string, 0)
+
+  for i := 0; i < numRecoveryCodes; i++ {
+    randomBytes := make([]byte, recoveryCodeLength)
+    _, err := rand.Read(randomBytes)
+    if err != nil {
+      return nil, nil, err
+    }
+
+    // Split up into groups of four so it's easier to copy down, i.e. 1a2b-3c4d-5e6f-7a8b
+    hexCode := hex.EncodeToString(randomBytes)
+    groups := make([]string, 0)
+    for start := 0; start < len(hexCode); start += 4 {
+      groups = append(groups, hexCode[start:start+4])
+    }
+    code := strings.Join(groups, "-")
+
+    codes = append(codes, code)
+    hashedCodes = append(hashedCodes, a.HashRecoveryCode(code))
+  }
+
+  return codes, hashedCodes, nil
+}
+
+
+// HashRecoveryCode hashes a recovery code for storage or lookup; dashes,
+// spaces and capitalization are ignored since users will be typing these in
+func (a *Auth) HashRecoveryCode(code string) string {
+  normalizedCode := strings.ToLower(code)
+  normalizedCode = strings.Replace(normalizedCode, "-", "", -1)
+  normalizedCode = strings.Replace(normalizedCode, " ", "", -1)
+
+  return a.HashSecretToken(normalizedCode)
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// getHOTPCode makes the HOTP code (RFC 4226) for a given key and counter;
+// TOTP is just HOTP with the current time step as the counter
+func getHOTPCode(key []byte, counter int64) string {
+  counterBytes := make([]byte, 8)
+  binary.BigEndian.PutUint64(counterBytes, uint64(counter))
+
+  mac := hmac.New(sha1.New, key)
+  mac.Write(counterBytes)
+  sum := mac.Sum(nil)
+
+  // Dynamic truncation: the last nibble picks which 4 bytes of the hash become the code
+  offset := sum[len(sum)-1] & 0x0f
+  value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+  modulus := uint32(1)
+  for i := 0; i < totpDigits; i++ {
+    modulus *= 10
+  }
+
+  return fmt.Sprintf("%0*d", totpDigits, value % modulus)
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+  "fmt"
+  "strings"
+  "time"
+
+  "github.com/lib/pq"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// AdminUserViewManager describes all of the methods used to interact with
+// the user views only admins get to see (emails, roles, account status, etc)
+type AdminUserViewManager interface {
+  GetAdminUserViews(adminUserFilter *AdminUserFilter) ([]*AdminUserView, int64, error)
+  GetAdminUserViewByUserID(userID int64) (*AdminUserView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// AdminUserView describes everything an admin needs to see when managing a user
+type AdminUserView struct {
+  // Data from users
+  UserID            int64           `json:"userId"`
+  UserName          string          `json:"userName"`
+  EmailAddress      string          `json:"emailAddress"`
+  Created           time.Time       `json:"created"`
+  Disabled          bool            `json:"disabled"`
+  DeletedAt         NullTimeJSON    `json:"deletedAt"`
+  TwoFactorEnabled  bool            `json:"twoFactorEnabled"`
+
+  // Data from matches
+  NumMatches        int64           `json:"numMatches"`
+
+  // Data from user_roles; added seperately from the SQL
+  UserRoles         []*UserRoleView  `json:"userRoles"`
+}
+
+
+// AdminUserFilter describes how to search and page through users
+type AdminUserFilter struct {
+  // Matched against the start of user names and email addresses; empty matches everyone
+  Search          string  `json:"search"`
+  IncludeDeleted  bool    `json:"includeDeleted"`
+  // Pages start at 1
+  Page            int64   `json:"page"`
+  PageSize        int64   `json:"pageSize"`
+}
+
+
+/*---------------------------------
+        Shared SQL Statements
+----------------------------------*/
+
+// adminUserViewSelectStatement is the SELECT shared by all of our admin user view queries
+const adminUserViewSelectStatement = `
+    SELECT
+      users.user_id        AS  user_id,
+      users.user_name      AS  user_name,
+      users.email_address  AS  email_address,
+      users.created        AS  created,
+      users.disabled       AS  disabled,
+      users.deleted_at     AS  deleted_at,
+      users.totp_enabled   AS  two_factor_enabled,
+      (
+        SELECT COUNT(*) FROM matches WHERE matches.user_id = users.user_id AND matches.deleted_at IS NULL
+      )                    AS  num_matches
+    FROM
+      users
+`
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAdminUserViews gets one page of the users that pass the given filter,
+// along with the total number of users that pass it across every page
+func (db *DB) GetAdminUserViews(adminUserFilter *AdminUserFilter) ([]*AdminUserView, int64, error) {
+  whereClause, args := adminUserFilter.makeWhereClause()
+
+  var totalUsers int64
+  err := db.QueryRow("SELECT COUNT(*) FROM users"+whereClause, args...).Scan(&totalUsers)
+  if err != nil {
+    return nil, 0, err
+  }
+
+  args = append(args, adminUserFilter.PageSize, (adminUserFilter.Page-1)*adminUserFilter.PageSize)
+  sqlStatement := adminUserViewSelectStatement + whereClause + fmt.Sprintf(`
+    ORDER BY
+      users.user_id
+    LIMIT $%d OFFSET $%d
+  `, len(args)-1, len(args))
+  rows, err := db.Query(sqlStatement, args...)
+  if err != nil {
+    return nil, 0, err
+  }
+  defer rows.Close()
+
+  adminUserViews := make([]*AdminUserView, 0)
+  for rows.Next() {
+    adminUserView, err := scanAdminUserView(rows)
+    if err != nil {
+      return nil, 0, err
+    }
+
+    adminUserViews = append(adminUserViews, adminUserView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, 0, err
+  }
+
+  err = db.addAdminUserRoles(adminUserViews)
+  if err != nil {
+    return nil, 0, err
+  }
+
+  return adminUserViews, totalUsers, nil
+}
+
+
+// GetAdminUserViewByUserID gets everything an admin needs to see for a single user
+func (db *DB) GetAdminUserViewByUserID(userID int64) (*AdminUserView, error) {
+  sqlStatement := adminUserViewSelectStatement + `
+    WHERE
+      users.user_id = $1
+  `
+  row := db.QueryRow(sqlStatement, userID)
+  adminUserView, err := scanAdminUserView(row)
+  if err != nil {
+    return nil, err
+  }
+
+  err = db.addAdminUserRoles([]*AdminUserView{adminUserView})
+  if err != nil {
+    return nil, err
+  }
+
+  return adminUserView, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// makeWhereClause turns an AdminUserFilter into a WHERE clause to add
+// after "FROM users", along with the arguments for its placeholders
+func (adminUserFilter *AdminUserFilter) makeWhereClause() (string, []interface{}) {
+  conditions := make([]string, 0)
+  args := make([]interface{}, 0)
+
+  if adminUserFilter.Search != "" {
+    args = append(args, strings.ToLower(adminUserFilter.Search)+"%")
+    conditions = append(conditions, fmt.Sprintf(
+      "(LOWER(users.user_name) LIKE $%d OR LOWER(users.email_address) LIKE $%d)",
+      len(args),
+      len(args),
+    ))
+  }
+  if !adminUserFilter.IncludeDeleted {
+    conditions = append(conditions, "users.deleted_at IS NULL")
+  }
+
+  if len(conditions) == 0 {
+    return "", args
+  }
+
+  return "\n    WHERE\n      " + strings.Join(conditions, "\n      AND ") + "\n", args
+}
+
+
+// scanAdminUserView scans a single row selected with adminUserViewSelectStatement into an AdminUserView
+func scanAdminUserView(row rowScanner) (*AdminUserView, error) {
+  adminUserView := new(AdminUserView)
+  err := row.Scan(
+    &adminUserView.UserID,
+    &adminUserView.UserName,
+    &adminUserView.EmailAddress,
+    &adminUserView.Created,
+    &adminUserView.Disabled,
+    &adminUserView.DeletedAt,
+    &adminUserView.TwoFactorEnabled,
+    &adminUserView.NumMatches,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return adminUserView, nil
+}
+
+
+// addAdminUserRoles fills in the roles for each of the given admin user views
+func (db *DB) addAdminUserRoles(adminUserViews []*AdminUserView) error {
+  adminUserViewsByID := make(map[int64]*AdminUserView)
+  userIDs := make([]int64, 0)
+  for _, adminUserView := range adminUserViews {
+    adminUserView.UserRoles = make([]*UserRoleView, 0)
+    adminUserViewsByID[adminUserView.UserID] = adminUserView
+    userIDs = append(userIDs, adminUserView.UserID)
+  }
+
+  rows, err := db.Query(`
+    SELECT
+      user_roles.user_role_id  AS  user_role_id,
+      user_roles.user_id       AS  user_id,
+      user_roles.role_id       AS  role_id,
+      roles.role_name          AS  role_name
+    FROM
+      user_roles
+    INNER JOIN roles ON roles.role_id = user_roles.role_id
+    WHERE
+      user_roles.user_id = ANY($1)
+    ORDER BY
+      roles.role_id
+  `, pq.Array(userIDs))
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    userRoleView := new(UserRoleView)
+    err := rows.Scan(
+      &userRoleView.UserRoleID,
+      &userRoleView.UserID,
+      &userRoleView.RoleID,
+      &userRoleView.RoleName,
+    )
+    if err != nil {
+      return err
+    }
+
+    adminUserView := adminUserViewsByID[userRoleView.UserID]
+    adminUserView.UserRoles = append(adminUserView.UserRoles, userRoleView)
+  }
+
+  return rows.Err()
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+  "time"
+
+  "github.com/lib/pq"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// APITokenManager describes all of the methods used
+// to interact with the api_tokens table in our database
+type APITokenManager interface {
+  GetAPITokensByUserID(userID int64) ([]*APIToken, error)
+  GetAPITokenByHashedToken(hashedToken string) (*APIToken, error)
+
+  CreateAPIToken(apiTokenCreate *APITokenCreate) (int64, error)
+  RevokeAPIToken(apiTokenRevoke *APITokenRevoke) (int64, error)
+  UpdateAPITokenLastUsed(apiTokenID int64) error
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// APIToken describes a personal access token a user made for their own scripts;
+// the scopes limit what the token can be used for. The token itself is never stored
+type APIToken struct {
+  APITokenID  int64         `json:"apiTokenId"`
+  UserID      int64         `json:"userId"`
+  TokenName   string        `json:"tokenName"`
+  Scopes      []string      `json:"scopes"`
+  Created     time.Time     `json:"created"`
+  ExpiresAt   NullTimeJSON  `json:"expiresAt"`
+  LastUsed    NullTimeJSON  `json:"lastUsed"`
+  RevokedAt   NullTimeJSON  `json:"revokedAt"`
+}
+
+
+// APITokenCreate describes the data needed
+// to create a new api token in our db
+type APITokenCreate struct {
+  UserID       int64         `json:"-"`
+  HashedToken  string        `json:"-"`
+  TokenName    string        `json:"tokenName"`
+  Scopes       []string      `json:"scopes"`
+  ExpiresAt    NullTimeJSON  `json:"expiresAt"`
+}
+
+
+// APITokenRevoke describes the data needed to revoke
+// an api token; users can only revoke their own tokens
+type APITokenRevoke struct {
+  APITokenID  int64  `json:"apiTokenId"`
+  UserID      int64  `json:"-"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAPITokensByUserID gets every api token a user has made, including revoked and expired ones
+func (db *DB) GetAPITokensByUserID(userID int64) ([]*APIToken, error) {
+  sqlStatement := `
+    SELECT
+      api_token_id,
+      user_id,
+      token_name,
+      scopes,
+      created,
+      expires_at,
+      last_used,
+      revoked_at
+    FROM
+      api_tokens
+    WHERE
+      user_id = $1
+    ORDER BY
+      created DESC
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  apiTokens := make([]*APIToken, 0)
+  for rows.Next() {
+    apiToken, err := scanAPIToken(rows)
+    if err != nil {
+      return nil, err
+    }
+
+    apiTokens = append(apiTokens, apiToken)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return apiTokens, nil
+}
+
+
+// GetAPITokenByHashedToken gets the api token with the given token hash, but only if it hasn't been
+// revoked or expired and its user is still active. Returns sql.ErrNoRows otherwise
+func (db *DB) GetAPITokenByHashedToken(hashedToken string) (*APIToken, error) {
+  sqlStatement := `
+    SELECT
+      api_tokens.api_token_id,
+      api_tokens.user_id,
+      api_tokens.token_name,
+      api_tokens.scopes,
+      api_tokens.created,
+      api_tokens.expires_at,
+      api_tokens.last_used,
+      api_tokens.revoked_at
+    FROM
+      api_tokens
+    INNER JOIN users ON users.user_id = api_tokens.user_id
+    WHERE
+      api_tokens.hashed_token = $1
+      AND api_tokens.revoked_at IS NULL
+      AND (api_tokens.expires_at IS NULL OR api_tokens.expires_at > CURRENT_TIMESTAMP)
+      AND users.disabled = false
+      AND users.deleted_at IS NULL
+  `
+  row := db.QueryRow(sqlStatement, hashedToken)
+
+  return scanAPIToken(row)
+}
+
+
+// CreateAPIToken adds a new entry to the api_tokens table in our database
+func (db *DB) CreateAPIToken(apiTokenCreate *APITokenCreate) (int64, error) {
+  var apiTokenID int64
+  sqlStatement := `
+    INSERT INTO api_tokens
+      (user_id, token_name, hashed_token, scopes, expires_at)
+    VALUES
+      ($1, $2, $3, $4, $5)
+    RETURNING
+      api_token_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    apiTokenCreate.UserID,
+    apiTokenCreate.TokenName,
+    apiTokenCreate.HashedToken,
+    pq.Array(apiTokenCreate.Scopes),
+    apiTokenCreate.ExpiresAt,
+  )
+
+  err := row.Scan(&apiTokenID)
+  if err != nil {
+    return 0, err
+  }
+
+  return apiTokenID, nil
+}
+
+
+// RevokeAPIToken stops an api token from working; revoked tokens are kept so their
+// user can still see them. Returns sql.ErrNoRows if the token isn't the user's
+func (db *DB) RevokeAPIToken(apiTokenRevoke *APITokenRevoke) (int64, error) {
+  var apiTokenID int64
+  sqlStatement := `
+    UPDATE
+      api_tokens
+    SET
+      revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+    WHERE
+      api_token_id = $1
+      AND user_id = $2
+    RETURNING
+      api_token_id
+  `
+  row := db.QueryRow(sqlStatement, apiTokenRevoke.APITokenID, apiTokenRevoke.UserID)
+
+  err := row.Scan(&apiTokenID)
+  if err != nil {
+    return 0, err
+  }
+
+  return apiTokenID, nil
+}
+
+
+// UpdateAPITokenLastUsed records that an api token was just used, so its user can tell stale tokens apart
+func (db *DB) UpdateAPITokenLastUsed(apiTokenID int64) error {
+  sqlStatement := `
+    UPDATE
+      api_tokens
+    SET
+      last_used = CURRENT_TIMESTAMP
+    WHERE
+      api_token_id = $1
+  `
+  _, err := db.Exec(sqlStatement, apiTokenID)
+
+  return err
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// HasScope checks if an api token was given a scope when it was made
+func (apiToken *APIToken) HasScope(scope string) bool {
+  for _, tokenScope := range apiToken.Scopes {
+    if tokenScope == scope {
+      return true
+    }
+  }
+
+  return false
+}
+
+
+// scanAPIToken scans a single row from the api_tokens table into an APIToken
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+  apiToken := new(APIToken)
+  err := row.Scan(
+    &apiToken.APITokenID,
+    &apiToken.UserID,
+    &apiToken.TokenName,
+    pq.Array(&apiToken.Scopes),
+    &apiToken.Created,
+    &apiToken.ExpiresAt,
+    &apiToken.LastUsed,
+    &apiToken.RevokedAt,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return apiToken, nil
+}
@@ -0,0 +1,201 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// ArchetypeManager describes all of the methods used
+// to interact with the archetypes table in our database
+type ArchetypeManager interface {
+  GetAllArchetypes() ([]*Archetype, error)
+  GetArchetypeByArchetypeID(archetypeID int64) (*Archetype, error)
+
+  CreateArchetype(archetypeCreate *ArchetypeCreate) (*Archetype, error)
+  UpdateArchetype(archetypeUpdate *ArchetypeUpdate) (*Archetype, error)
+  DeleteArchetypeByArchetypeID(archetypeID int64) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Archetype describes a character archetype (i.e. "Zoner", "Grappler")
+type Archetype struct {
+  ArchetypeID    int64   `json:"archetypeId"`
+  ArchetypeName  string  `json:"archetypeName"`
+}
+
+
+// ArchetypeCreate describes the data needed
+// to create a given archetype in our db
+type ArchetypeCreate struct {
+  ArchetypeName  string  `json:"archetypeName"`
+}
+
+
+// ArchetypeUpdate describes the data needed
+// to update a given archetype in our db
+type ArchetypeUpdate struct {
+  ArchetypeID    int64   `json:"archetypeId"`
+  ArchetypeName  string  `json:"archetypeName"`
+}
+
+
+// ArchetypeDelete describes the data needed
+// to delete a given archetype in our db
+type ArchetypeDelete struct {
+  ArchetypeID  int64  `json:"archetypeId"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAllArchetypes gets all of the archetypes we have in our database
+func (db *DB) GetAllArchetypes() ([]*Archetype, error) {
+  sqlStatement := `
+    SELECT
+      archetype_id,
+      archetype_name
+    FROM
+      archetypes
+    ORDER BY
+      archetype_name
+  `
+  rows, err := db.Query(sqlStatement)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  archetypes := make([]*Archetype, 0)
+  for rows.Next() {
+    archetype := new(Archetype)
+    err := rows.Scan(
+      &archetype.ArchetypeID,
+      &archetype.ArchetypeName,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    archetypes = append(archetypes, archetype)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return archetypes, nil
+}
+
+
+// GetArchetypeByArchetypeID gets a specific archetype given its ID
+func (db *DB) GetArchetypeByArchetypeID(archetypeID int64) (*Archetype, error) {
+  sqlStatement := `
+    SELECT
+      archetype_id,
+      archetype_name
+    FROM
+      archetypes
+    WHERE
+      archetype_id = $1
+  `
+  row := db.QueryRow(sqlStatement, archetypeID)
+
+  archetype := new(Archetype)
+  err := row.Scan(
+    &archetype.ArchetypeID,
+    &archetype.ArchetypeName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return archetype, nil
+}
+
+
+// CreateArchetype adds a new entry to the archetypes table
+func (db *DB) CreateArchetype(archetypeCreate *ArchetypeCreate) (*Archetype, error) {
+  sqlStatement := `
+    INSERT INTO archetypes
+      (archetype_name)
+    VALUES
+      ($1)
+    RETURNING
+      archetype_id,
+      archetype_name
+  `
+  row := db.QueryRow(sqlStatement, archetypeCreate.ArchetypeName)
+
+  archetype := new(Archetype)
+  err := row.Scan(
+    &archetype.ArchetypeID,
+    &archetype.ArchetypeName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return archetype, nil
+}
+
+
+// UpdateArchetype updates an existing entry in the archetypes table
+func (db *DB) UpdateArchetype(archetypeUpdate *ArchetypeUpdate) (*Archetype, error) {
+  sqlStatement := `
+    UPDATE
+      archetypes
+    SET
+      archetype_name = $1
+    WHERE
+      archetype_id = $2
+    RETURNING
+      archetype_id,
+      archetype_name
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    archetypeUpdate.ArchetypeName,
+    archetypeUpdate.ArchetypeID,
+  )
+
+  archetype := new(Archetype)
+  err := row.Scan(
+    &archetype.ArchetypeID,
+    &archetype.ArchetypeName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return archetype, nil
+}
+
+
+// DeleteArchetypeByArchetypeID deletes an existing entry in the archetypes
+// table; any links to characters are removed along with it
+func (db *DB) DeleteArchetypeByArchetypeID(archetypeID int64) (int64, error) {
+  var deletedArchetypeID int64
+  sqlStatement := `
+    DELETE FROM
+      archetypes
+    WHERE
+      archetype_id = $1
+    RETURNING
+      archetype_id
+  `
+  row := db.QueryRow(sqlStatement, archetypeID)
+
+  err := row.Scan(&deletedArchetypeID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedArchetypeID, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// ArchetypeStatsViewManager describes all of the methods used to get aggregated
+// match results by opponent archetype (data joined between matches, characters, and archetypes)
+type ArchetypeStatsViewManager interface {
+  GetArchetypeWinRateViewsByUserID(userID int64) ([]*ArchetypeWinRateView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// ArchetypeWinRateView describes a user's win rate against
+// every opponent character with a given archetype
+type ArchetypeWinRateView struct {
+  ArchetypeID    int64   `json:"archetypeId"`
+  ArchetypeName  string  `json:"archetypeName"`
+  WinRecord
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetArchetypeWinRateViewsByUserID gets a user's win rate against each archetype they've recorded
+// a match against. A character can have more than one archetype, so a match can count towards several
+func (db *DB) GetArchetypeWinRateViewsByUserID(userID int64) ([]*ArchetypeWinRateView, error) {
+  sqlStatement := `
+    SELECT
+      archetypes.archetype_id                              AS archetype_id,
+      archetypes.archetype_name                            AS archetype_name,
+      COUNT(*) FILTER (WHERE matches.user_win = true)      AS wins,
+      COUNT(*) FILTER (WHERE matches.user_win = false)     AS losses
+    FROM
+      matches
+    INNER JOIN character_archetypes ON character_archetypes.character_id = matches.opponent_character_id
+    INNER JOIN archetypes ON archetypes.archetype_id = character_archetypes.archetype_id
+    WHERE
+      matches.user_id = $1
+      AND matches.deleted_at IS NULL
+    GROUP BY
+      archetypes.archetype_id,
+      archetypes.archetype_name
+    ORDER BY
+      archetypes.archetype_name
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  archetypeWinRateViews := make([]*ArchetypeWinRateView, 0)
+  for rows.Next() {
+    archetypeWinRateView := new(ArchetypeWinRateView)
+    err := rows.Scan(
+      &archetypeWinRateView.ArchetypeID,
+      &archetypeWinRateView.ArchetypeName,
+      &archetypeWinRateView.Wins,
+      &archetypeWinRateView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    archetypeWinRateView.calculateWinRate()
+    archetypeWinRateViews = append(archetypeWinRateViews, archetypeWinRateView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return archetypeWinRateViews, nil
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+  "encoding/json"
+  "fmt"
+  "strings"
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// AuditManager describes all of the methods used
+// to interact with the audit_log table in our database
+type AuditManager interface {
+  GetAuditLogs(auditLogFilter *AuditLogFilter) ([]*AuditLog, int64, error)
+
+  CreateAuditLog(auditLogCreate *AuditLogCreate) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// AuditLog describes a single data-changing action in our audit_log table
+type AuditLog struct {
+  AuditLogID   int64            `json:"auditLogId"`
+  Created      time.Time        `json:"created"`
+  ActorUserID  NullInt64JSON    `json:"actorUserId"`
+  Action       string           `json:"action"`
+  EntityType   string           `json:"entityType"`
+  EntityID     NullInt64JSON    `json:"entityId"`
+  BeforeData   json.RawMessage  `json:"beforeData"`
+  AfterData    json.RawMessage  `json:"afterData"`
+  RequestID    string           `json:"requestId"`
+
+  // Data from users
+  ActorUserName  NullStringJSON  `json:"actorUserName"`
+}
+
+
+// AuditLogCreate describes the data needed to add an entry to our
+// audit_log; BeforeData/AfterData are left null when there's nothing to save
+type AuditLogCreate struct {
+  ActorUserID  NullInt64JSON    `json:"actorUserId"`
+  Action       string           `json:"action"`
+  EntityType   string           `json:"entityType"`
+  EntityID     NullInt64JSON    `json:"entityId"`
+  BeforeData   json.RawMessage  `json:"beforeData"`
+  AfterData    json.RawMessage  `json:"afterData"`
+  RequestID    string           `json:"requestId"`
+}
+
+
+// AuditLogFilter describes the optional filters we can apply when searching the
+// audit log; any field left null/empty is ignored. Newest entries come first
+type AuditLogFilter struct {
+  ActorUserID  NullInt64JSON  `json:"actorUserId"`
+  EntityType   string         `json:"entityType"`
+  EntityID     NullInt64JSON  `json:"entityId"`
+  From         NullTimeJSON   `json:"from"`
+  To           NullTimeJSON   `json:"to"`
+  // Pages start at 1
+  Page         int64          `json:"page"`
+  PageSize     int64          `json:"pageSize"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAuditLogs gets one page of the audit log entries that pass the given filter,
+// along with the total number of entries that pass it across every page
+func (db *DB) GetAuditLogs(auditLogFilter *AuditLogFilter) ([]*AuditLog, int64, error) {
+  whereClause, args := auditLogFilter.makeWhereClause()
+
+  var totalAuditLogs int64
+  err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+whereClause, args...).Scan(&totalAuditLogs)
+  if err != nil {
+    return nil, 0, err
+  }
+
+  args = append(args, auditLogFilter.PageSize, (auditLogFilter.Page-1)*auditLogFilter.PageSize)
+  sqlStatement := `
+    SELECT
+      audit_log.audit_log_id   AS  audit_log_id,
+      audit_log.created        AS  created,
+      audit_log.actor_user_id  AS  actor_user_id,
+      audit_log.action         AS  action,
+      audit_log.entity_type    AS  entity_type,
+      audit_log.entity_id      AS  entity_id,
+      audit_log.before_data    AS  before_data,
+      audit_log.after_data     AS  after_data,
+      audit_log.request_id     AS  request_id,
+      users.user_name          AS  actor_user_name
+    FROM
+      audit_log
+    LEFT JOIN users ON users.user_id = audit_log.actor_user_id
+  ` + whereClause + fmt.Sprintf(`
+    ORDER BY
+      audit_log.created DESC,
+      audit_log.audit_log_id DESC
+    LIMIT $%d OFFSET $%d
+  `, len(args)-1, len(args))
+  rows, err := db.Query(sqlStatement, args...)
+  if err != nil {
+    return nil, 0, err
+  }
+  defer rows.Close()
+
+  auditLogs := make([]*AuditLog, 0)
+  for rows.Next() {
+    auditLog := new(AuditLog)
+    var beforeData, afterData []byte
+    err := rows.Scan(
+      &auditLog.AuditLogID,
+      &auditLog.Created,
+      &auditLog.ActorUserID,
+      &auditLog.Action,
+      &auditLog.EntityType,
+      &auditLog.EntityID,
+      &beforeData,
+      &afterData,
+      &auditLog.RequestID,
+      &auditLog.ActorUserName,
+    )
+    if err != nil {
+      return nil, 0, err
+    }
+
+    auditLog.BeforeData = nullableJSON(beforeData)
+    auditLog.AfterData = nullableJSON(afterData)
+    auditLogs = append(auditLogs, auditLog)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, 0, err
+  }
+
+  return auditLogs, totalAuditLogs, nil
+}
+
+
+// CreateAuditLog adds a new entry to the audit_log table in our database
+func (db *DB) CreateAuditLog(auditLogCreate *AuditLogCreate) (int64, error) {
+  sqlStatement := `
+    INSERT INTO audit_log
+      (actor_user_id, action, entity_type, entity_id, before_data, after_data, request_id)
+    VALUES
+      ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING
+      audit_log_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    auditLogCreate.ActorUserID,
+    auditLogCreate.Action,
+    auditLogCreate.EntityType,
+    auditLogCreate.EntityID,
+    nullableJSONArg(auditLogCreate.BeforeData),
+    nullableJSONArg(auditLogCreate.AfterData),
+    auditLogCreate.RequestID,
+  )
+
+  var auditLogID int64
+  err := row.Scan(&auditLogID)
+  if err != nil {
+    return 0, err
+  }
+
+  return auditLogID, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// makeWhereClause turns an AuditLogFilter into a WHERE clause to add
+// after "FROM audit_log", along with the arguments for its placeholders
+func (auditLogFilter *AuditLogFilter) makeWhereClause() (string, []interface{}) {
+  conditions := make([]string, 0)
+  args := make([]interface{}, 0)
+
+  if auditLogFilter.ActorUserID.Valid {
+    args = append(args, auditLogFilter.ActorUserID.Int64)
+    conditions = append(conditions, fmt.Sprintf("audit_log.actor_user_id = $%d", len(args)))
+  }
+  if auditLogFilter.EntityType != "" {
+    args = append(args, auditLogFilter.EntityType)
+    conditions = append(conditions, fmt.Sprintf("audit_log.entity_type = $%d", len(args)))
+  }
+  if auditLogFilter.EntityID.Valid {
+    args = append(args, auditLogFilter.EntityID.Int64)
+    conditions = append(conditions, fmt.Sprintf("audit_log.entity_id = $%d", len(args)))
+  }
+  if auditLogFilter.From.Valid {
+    args = append(args, auditLogFilter.From.Time)
+    conditions = append(conditions, fmt.Sprintf("audit_log.created >= $%d", len(args)))
+  }
+  if auditLogFilter.To.Valid {
+    args = append(args, auditLogFilter.To.Time)
+    conditions = append(conditions, fmt.Sprintf("audit_log.created < $%d", len(args)))
+  }
+
+  if len(conditions) == 0 {
+    return "", args
+  }
+
+  return "\n    WHERE\n      " + strings.Join(conditions, "\n      AND ") + "\n", args
+}
+
+
+// nullableJSON turns a scanned JSONB column into a json.RawMessage,
+// keeping SQL NULLs as JSON nulls
+func nullableJSON(data []byte) json.RawMessage {
+  if data == nil {
+    return json.RawMessage("null")
+  }
+
+  return json.RawMessage(data)
+}
+
+
+// nullableJSONArg turns a json.RawMessage into an argument for a JSONB column,
+// storing empty or null JSON as SQL NULL
+func nullableJSONArg(data json.RawMessage) interface{} {
+  if len(data) == 0 || string(data) == "null" {
+    return nil
+  }
+
+  return string(data)
+}
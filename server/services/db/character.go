@@ -1,5 +1,11 @@
 package db
 
+import (
+  "database/sql"
+
+  "github.com/lib/pq"
+)
+
 
 /*---------------------------------
             Interface
@@ -9,9 +15,12 @@ package db
 // to interact with the characters table in our database
 type CharacterManager interface {
   GetAllCharacters() ([]*Character, error)
+  GetCharacterByCharacterID(characterID int64) (*Character, error)
 
   CreateCharacter(characterCreate *CharacterCreate) (*Character, error)
   UpdateCharacter(characterUpdate *CharacterUpdate) (*Character, error)
+  SetCharacterArchetypes(characterID int64, archetypeIDs []int64) error
+  SetCharacterSeries(characterID int64, seriesIDs []int64) error
 }
 
 
@@ -22,32 +31,45 @@ type CharacterManager interface {
 // Character describes the required and optional data
 // needed to create a new character in our characters table
 type Character struct {
-  CharacterID         int64           `json:"characterId"`
-  CharacterName       string          `json:"characterName"`
-  CharacterStockImg   NullStringJSON  `json:"characterStockImg,omitempty"`
-  CharacterImg        NullStringJSON  `json:"characterImg,omitempty"`
-  CharacterArchetype  NullStringJSON  `json:"characterArchetype,omitempty"`
+  CharacterID              int64           `json:"characterId"`
+  CharacterName            string          `json:"characterName"`
+  CharacterStockImg        NullStringJSON  `json:"characterStockImg,omitempty"`
+  CharacterImg             NullStringJSON  `json:"characterImg,omitempty"`
+  CharacterDlc             bool            `json:"characterDlc"`
+  CharacterReleaseVersion  NullStringJSON  `json:"characterReleaseVersion,omitempty"`
+
+  // Data from character_archetypes and character_series; added seperately from the SQL
+  CharacterArchetypes      []*Archetype    `json:"characterArchetypes"`
+  CharacterSeries          []*Series       `json:"characterSeries"`
 }
 
 
-// CharacterUpdate describes the data needed 
+// CharacterUpdate describes the data needed
 // to update a given character in our db
 type CharacterUpdate struct {
-  CharacterID         int64           `json:"characterId"`
-  CharacterName       NullStringJSON  `json:"characterName,omitempty"`
-  CharacterStockImg   NullStringJSON  `json:"characterStockImg,omitempty"`
-  CharacterImg        NullStringJSON  `json:"characterImg,omitempty"`
-  CharacterArchetype  NullStringJSON  `json:"characterArchetype,omitempty"`
+  CharacterID              int64           `json:"characterId"`
+  CharacterName            NullStringJSON  `json:"characterName,omitempty"`
+  CharacterStockImg        NullStringJSON  `json:"characterStockImg,omitempty"`
+  CharacterImg             NullStringJSON  `json:"characterImg,omitempty"`
+  // Leaving this out keeps whether the character is DLC as is
+  CharacterDlc             NullBoolJSON    `json:"characterDlc"`
+  CharacterReleaseVersion  NullStringJSON  `json:"characterReleaseVersion,omitempty"`
+  // Leaving these out keeps the character's current archetypes/series
+  ArchetypeIDs             *[]int64        `json:"archetypeIds"`
+  SeriesIDs                *[]int64        `json:"seriesIds"`
 }
 
 
-// CharacterCreate describes the data needed 
+// CharacterCreate describes the data needed
 // to create a given character in our db
 type CharacterCreate struct {
-  CharacterName       string          `json:"characterName"`
-  CharacterStockImg   NullStringJSON  `json:"characterStockImg"`
-  CharacterImg        NullStringJSON  `json:"characterImg"`
-  CharacterArchetype  NullStringJSON  `json:"characterArchetype"`
+  CharacterName            string          `json:"characterName"`
+  CharacterStockImg        NullStringJSON  `json:"characterStockImg"`
+  CharacterImg             NullStringJSON  `json:"characterImg"`
+  CharacterDlc             bool            `json:"characterDlc"`
+  CharacterReleaseVersion  NullStringJSON  `json:"characterReleaseVersion"`
+  ArchetypeIDs             []int64         `json:"archetypeIds"`
+  SeriesIDs                []int64         `json:"seriesIds"`
 }
 
 
@@ -63,9 +85,12 @@ func (db *DB) GetAllCharacters() ([]*Character, error) {
       character_name,
       character_stock_img,
       character_img,
-      character_archetype
+      character_dlc,
+      character_release_version
     FROM
       characters
+    ORDER BY
+      character_id
   `
   rows, err := db.Query(sqlStatement)
   if err != nil {
@@ -81,7 +106,8 @@ func (db *DB) GetAllCharacters() ([]*Character, error) {
       &character.CharacterName,
       &character.CharacterStockImg,
       &character.CharacterImg,
-      &character.CharacterArchetype,
+      &character.CharacterDlc,
+      &character.CharacterReleaseVersion,
     )
 
     if err != nil {
@@ -96,31 +122,31 @@ func (db *DB) GetAllCharacters() ([]*Character, error) {
     return nil, err
   }
 
+  err = db.addCharacterLinks(characters)
+  if err != nil {
+    return nil, err
+  }
+
   return characters, nil
 }
 
 
-// CreateCharacter adds a new entry to the characters table in our database
-func (db *DB) CreateCharacter(characterCreate *CharacterCreate) (*Character, error) {
+// GetCharacterByCharacterID gets a specific character given a characterID
+func (db *DB) GetCharacterByCharacterID(characterID int64) (*Character, error) {
   sqlStatement := `
-    INSERT INTO characters
-      (character_name, character_stock_img, character_img, character_archetype)
-    VALUES
-      ($1, $2, $3, $4)
-    RETURNING
+    SELECT
       character_id,
       character_name,
       character_stock_img,
       character_img,
-      character_archetype
+      character_dlc,
+      character_release_version
+    FROM
+      characters
+    WHERE
+      character_id = $1
   `
-  row := db.QueryRow(
-    sqlStatement,
-    characterCreate.CharacterName,
-    characterCreate.CharacterStockImg,
-    characterCreate.CharacterImg,
-    characterCreate.CharacterArchetype,
-  )
+  row := db.QueryRow(sqlStatement, characterID)
 
   character := new(Character)
   err := row.Scan(
@@ -128,18 +154,81 @@ func (db *DB) CreateCharacter(characterCreate *CharacterCreate) (*Character, err
     &character.CharacterName,
     &character.CharacterStockImg,
     &character.CharacterImg,
-    &character.CharacterArchetype,
+    &character.CharacterDlc,
+    &character.CharacterReleaseVersion,
   )
   if err != nil {
     return nil, err
   }
 
+  err = db.addCharacterLinks([]*Character{character})
+  if err != nil {
+    return nil, err
+  }
+
   return character, nil
 }
 
 
-// UpdateCharacter updates an existing entry in the characters table in our database
+// CreateCharacter adds a new entry to the characters table in our database,
+// along with its archetypes and series; all in one transaction
+func (db *DB) CreateCharacter(characterCreate *CharacterCreate) (*Character, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return nil, err
+  }
+  defer tx.Rollback()
+
+  sqlStatement := `
+    INSERT INTO characters
+      (character_name, character_stock_img, character_img, character_dlc, character_release_version)
+    VALUES
+      ($1, $2, $3, $4, $5)
+    RETURNING
+      character_id
+  `
+  row := tx.QueryRow(
+    sqlStatement,
+    characterCreate.CharacterName,
+    characterCreate.CharacterStockImg,
+    characterCreate.CharacterImg,
+    characterCreate.CharacterDlc,
+    characterCreate.CharacterReleaseVersion,
+  )
+
+  var characterID int64
+  err = row.Scan(&characterID)
+  if err != nil {
+    return nil, err
+  }
+
+  err = setCharacterLinks(tx, "character_archetypes", "archetype_id", characterID, characterCreate.ArchetypeIDs)
+  if err != nil {
+    return nil, err
+  }
+  err = setCharacterLinks(tx, "character_series", "series_id", characterID, characterCreate.SeriesIDs)
+  if err != nil {
+    return nil, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return nil, err
+  }
+
+  return db.GetCharacterByCharacterID(characterID)
+}
+
+
+// UpdateCharacter updates an existing entry in the characters table in our
+// database, along with its archetypes and series; all in one transaction
 func (db *DB) UpdateCharacter(characterUpdate *CharacterUpdate) (*Character, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return nil, err
+  }
+  defer tx.Rollback()
+
   sqlStatement := `
     UPDATE
       characters
@@ -147,36 +236,185 @@ func (db *DB) UpdateCharacter(characterUpdate *CharacterUpdate) (*Character, err
       character_name = $1,
       character_stock_img = $2,
       character_img = $3,
-      character_archetype = $4
+      character_dlc = COALESCE($4, character_dlc),
+      character_release_version = $5
     WHERE
-      character_id = $5
+      character_id = $6
     RETURNING
-      character_id,
-      character_name,
-      character_stock_img,
-      character_img,
-      character_archetype
+      character_id
   `
-  row := db.QueryRow(
+  row := tx.QueryRow(
     sqlStatement,
     characterUpdate.CharacterName,
     characterUpdate.CharacterStockImg,
     characterUpdate.CharacterImg,
-    characterUpdate.CharacterArchetype,
+    characterUpdate.CharacterDlc,
+    characterUpdate.CharacterReleaseVersion,
     characterUpdate.CharacterID,
   )
 
-  character := new(Character)
-  err := row.Scan(
-    &character.CharacterID,
-    &character.CharacterName,
-    &character.CharacterStockImg,
-    &character.CharacterImg,
-    &character.CharacterArchetype,
-  )
+  var characterID int64
+  err = row.Scan(&characterID)
   if err != nil {
     return nil, err
   }
 
-  return character, nil
+  if characterUpdate.ArchetypeIDs != nil {
+    err = setCharacterLinks(tx, "character_archetypes", "archetype_id", characterID, *characterUpdate.ArchetypeIDs)
+    if err != nil {
+      return nil, err
+    }
+  }
+  if characterUpdate.SeriesIDs != nil {
+    err = setCharacterLinks(tx, "character_series", "series_id", characterID, *characterUpdate.SeriesIDs)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return nil, err
+  }
+
+  return db.GetCharacterByCharacterID(characterID)
+}
+
+
+// SetCharacterArchetypes replaces all of a character's archetypes with the given ones
+func (db *DB) SetCharacterArchetypes(characterID int64, archetypeIDs []int64) error {
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  err = setCharacterLinks(tx, "character_archetypes", "archetype_id", characterID, archetypeIDs)
+  if err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+
+// SetCharacterSeries replaces all of a character's series with the given ones
+func (db *DB) SetCharacterSeries(characterID int64, seriesIDs []int64) error {
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  err = setCharacterLinks(tx, "character_series", "series_id", characterID, seriesIDs)
+  if err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// setCharacterLinks replaces every row in a character link table (i.e. character_archetypes)
+// for a given character with links to the given IDs
+func setCharacterLinks(tx *sql.Tx, table string, column string, characterID int64, linkedIDs []int64) error {
+  _, err := tx.Exec("DELETE FROM "+table+" WHERE character_id = $1", characterID)
+  if err != nil {
+    return err
+  }
+
+  if len(linkedIDs) == 0 {
+    return nil
+  }
+
+  _, err = tx.Exec(
+    "INSERT INTO "+table+" (character_id, "+column+") SELECT $1, UNNEST($2::INTEGER[]) ON CONFLICT DO NOTHING",
+    characterID,
+    pq.Array(linkedIDs),
+  )
+
+  return err
+}
+
+
+// addCharacterLinks fills in the archetypes and series for each of the given characters
+func (db *DB) addCharacterLinks(characters []*Character) error {
+  charactersByID := make(map[int64]*Character)
+  characterIDs := make([]int64, 0)
+  for _, character := range characters {
+    character.CharacterArchetypes = make([]*Archetype, 0)
+    character.CharacterSeries = make([]*Series, 0)
+    charactersByID[character.CharacterID] = character
+    characterIDs = append(characterIDs, character.CharacterID)
+  }
+
+  archetypeRows, err := db.Query(`
+    SELECT
+      character_archetypes.character_id  AS  character_id,
+      archetypes.archetype_id            AS  archetype_id,
+      archetypes.archetype_name          AS  archetype_name
+    FROM
+      character_archetypes
+    INNER JOIN archetypes ON archetypes.archetype_id = character_archetypes.archetype_id
+    WHERE
+      character_archetypes.character_id = ANY($1)
+    ORDER BY
+      archetypes.archetype_name
+  `, pq.Array(characterIDs))
+  if err != nil {
+    return err
+  }
+  defer archetypeRows.Close()
+
+  for archetypeRows.Next() {
+    var characterID int64
+    archetype := new(Archetype)
+    err := archetypeRows.Scan(&characterID, &archetype.ArchetypeID, &archetype.ArchetypeName)
+    if err != nil {
+      return err
+    }
+
+    character := charactersByID[characterID]
+    character.CharacterArchetypes = append(character.CharacterArchetypes, archetype)
+  }
+  err = archetypeRows.Err()
+  if err != nil {
+    return err
+  }
+
+  seriesRows, err := db.Query(`
+    SELECT
+      character_series.character_id  AS  character_id,
+      series.series_id               AS  series_id,
+      series.series_name             AS  series_name
+    FROM
+      character_series
+    INNER JOIN series ON series.series_id = character_series.series_id
+    WHERE
+      character_series.character_id = ANY($1)
+    ORDER BY
+      series.series_name
+  `, pq.Array(characterIDs))
+  if err != nil {
+    return err
+  }
+  defer seriesRows.Close()
+
+  for seriesRows.Next() {
+    var characterID int64
+    series := new(Series)
+    err := seriesRows.Scan(&characterID, &series.SeriesID, &series.SeriesName)
+    if err != nil {
+      return err
+    }
+
+    character := charactersByID[characterID]
+    character.CharacterSeries = append(character.CharacterSeries, series)
+  }
+
+  return seriesRows.Err()
 }
@@ -0,0 +1,298 @@
+package db
+
+import (
+  "fmt"
+  "strings"
+)
+
+
+// NumCharacterCostumes is the number of alt costumes every character has
+const NumCharacterCostumes = 8
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// CharacterCostumeManager describes all of the methods used
+// to interact with the character_costumes table in our database
+type CharacterCostumeManager interface {
+  GetCharacterCostumesByCharacterID(characterID int64) ([]*CharacterCostume, error)
+  GetCharacterCostumeByCostumeIndex(characterID int64, costumeIndex int64) (*CharacterCostume, error)
+  GetCharacterCostumeByCharacterCostumeID(characterCostumeID int64) (*CharacterCostume, error)
+
+  CreateCharacterCostumes(characterCostumesCreate []*CharacterCostumeCreate) ([]int64, error)
+  UpdateCharacterCostume(characterCostumeUpdate *CharacterCostumeUpdate) (*CharacterCostume, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// CharacterCostume describes one of a character's alt costumes; the costume index
+// is what we store in user_characters.alt_costume, and the image path is
+// relative to our static assets directory
+type CharacterCostume struct {
+  CharacterCostumeID  int64   `json:"characterCostumeId"`
+  CharacterID         int64   `json:"characterId"`
+  CostumeIndex        int64   `json:"costumeIndex"`
+  CostumeName         string  `json:"costumeName"`
+  CostumeImg          string  `json:"costumeImg"`
+}
+
+
+// CharacterCostumeCreate describes the data needed
+// to create a given character costume in our db
+type CharacterCostumeCreate struct {
+  CharacterID   int64   `json:"characterId"`
+  CostumeIndex  int64   `json:"costumeIndex"`
+  CostumeName   string  `json:"costumeName"`
+  CostumeImg    string  `json:"costumeImg"`
+}
+
+
+// CharacterCostumeUpdate describes the data needed
+// to update a given character costume in our db
+type CharacterCostumeUpdate struct {
+  CharacterCostumeID  int64   `json:"characterCostumeId"`
+  CostumeName         string  `json:"costumeName"`
+  CostumeImg          string  `json:"costumeImg"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetCharacterCostumesByCharacterID gets all of the costumes for a given character
+func (db *DB) GetCharacterCostumesByCharacterID(characterID int64) ([]*CharacterCostume, error) {
+  sqlStatement := `
+    SELECT
+      character_costume_id,
+      character_id,
+      costume_index,
+      costume_name,
+      costume_img
+    FROM
+      character_costumes
+    WHERE
+      character_id = $1
+    ORDER BY
+      costume_index
+  `
+  rows, err := db.Query(sqlStatement, characterID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  characterCostumes := make([]*CharacterCostume, 0)
+  for rows.Next() {
+    characterCostume := new(CharacterCostume)
+    err := rows.Scan(
+      &characterCostume.CharacterCostumeID,
+      &characterCostume.CharacterID,
+      &characterCostume.CostumeIndex,
+      &characterCostume.CostumeName,
+      &characterCostume.CostumeImg,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    characterCostumes = append(characterCostumes, characterCostume)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return characterCostumes, nil
+}
+
+
+// GetCharacterCostumeByCostumeIndex gets a specific costume for a given
+// character; returns sql.ErrNoRows if the character has no such costume
+func (db *DB) GetCharacterCostumeByCostumeIndex(characterID int64, costumeIndex int64) (*CharacterCostume, error) {
+  sqlStatement := `
+    SELECT
+      character_costume_id,
+      character_id,
+      costume_index,
+      costume_name,
+      costume_img
+    FROM
+      character_costumes
+    WHERE
+      character_id = $1 AND costume_index = $2
+  `
+  row := db.QueryRow(sqlStatement, characterID, costumeIndex)
+
+  characterCostume := new(CharacterCostume)
+  err := row.Scan(
+    &characterCostume.CharacterCostumeID,
+    &characterCostume.CharacterID,
+    &characterCostume.CostumeIndex,
+    &characterCostume.CostumeName,
+    &characterCostume.CostumeImg,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return characterCostume, nil
+}
+
+
+// GetCharacterCostumeByCharacterCostumeID gets a specific character costume given its ID
+func (db *DB) GetCharacterCostumeByCharacterCostumeID(characterCostumeID int64) (*CharacterCostume, error) {
+  sqlStatement := `
+    SELECT
+      character_costume_id,
+      character_id,
+      costume_index,
+      costume_name,
+      costume_img
+    FROM
+      character_costumes
+    WHERE
+      character_costume_id = $1
+  `
+  row := db.QueryRow(sqlStatement, characterCostumeID)
+
+  characterCostume := new(CharacterCostume)
+  err := row.Scan(
+    &characterCostume.CharacterCostumeID,
+    &characterCostume.CharacterID,
+    &characterCostume.CostumeIndex,
+    &characterCostume.CostumeName,
+    &characterCostume.CostumeImg,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return characterCostume, nil
+}
+
+
+// CreateCharacterCostumes adds multiple new entries to the character_costumes table
+func (db *DB) CreateCharacterCostumes(characterCostumesCreate []*CharacterCostumeCreate) ([]int64, error) {
+  table := "character_costumes"
+  columns := []string{"character_id", "costume_index", "costume_name", "costume_img"}
+  numInserts := len(characterCostumesCreate)
+  returningCol := "character_costume_id"
+  sqlStatement := MakeMultiInsertStatement(table, columns, numInserts, returningCol)
+  expandedCharacterCostumes := expandCharacterCostumesCreate(characterCostumesCreate)
+  rows, err := db.Query(sqlStatement, expandedCharacterCostumes...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  characterCostumeIDs := make([]int64, 0)
+  for rows.Next() {
+    var characterCostumeID int64
+    err := rows.Scan(&characterCostumeID)
+    if err != nil {
+      return nil, err
+    }
+
+    characterCostumeIDs = append(characterCostumeIDs, characterCostumeID)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return characterCostumeIDs, nil
+}
+
+
+// UpdateCharacterCostume updates an existing entry in the character_costumes table
+func (db *DB) UpdateCharacterCostume(characterCostumeUpdate *CharacterCostumeUpdate) (*CharacterCostume, error) {
+  sqlStatement := `
+    UPDATE
+      character_costumes
+    SET
+      costume_name = $1,
+      costume_img = $2
+    WHERE
+      character_costume_id = $3
+    RETURNING
+      character_costume_id,
+      character_id,
+      costume_index,
+      costume_name,
+      costume_img
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    characterCostumeUpdate.CostumeName,
+    characterCostumeUpdate.CostumeImg,
+    characterCostumeUpdate.CharacterCostumeID,
+  )
+
+  characterCostume := new(CharacterCostume)
+  err := row.Scan(
+    &characterCostume.CharacterCostumeID,
+    &characterCostume.CharacterID,
+    &characterCostume.CostumeIndex,
+    &characterCostume.CostumeName,
+    &characterCostume.CostumeImg,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return characterCostume, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// MakeDefaultCharacterCostumes builds the default set of costumes for a character from its
+// stock image, following the same naming scheme as our static assets (i.e. mario.png is
+// full/mario.png for the default costume and alt/mario_2.png through alt/mario_8.png after)
+func MakeDefaultCharacterCostumes(characterID int64, characterStockImg string) []*CharacterCostumeCreate {
+  characterCostumesCreate := make([]*CharacterCostumeCreate, 0)
+  imgName := strings.TrimSuffix(characterStockImg, ".png")
+
+  for costumeIndex := int64(1); costumeIndex <= NumCharacterCostumes; costumeIndex++ {
+    characterCostumeCreate := new(CharacterCostumeCreate)
+    characterCostumeCreate.CharacterID = characterID
+    characterCostumeCreate.CostumeIndex = costumeIndex
+    if costumeIndex == 1 {
+      characterCostumeCreate.CostumeName = "Default"
+      characterCostumeCreate.CostumeImg = fmt.Sprintf("full/%s", characterStockImg)
+    } else {
+      characterCostumeCreate.CostumeName = fmt.Sprintf("Alt %d", costumeIndex)
+      characterCostumeCreate.CostumeImg = fmt.Sprintf("alt/%s_%d.png", imgName, costumeIndex)
+    }
+    characterCostumesCreate = append(characterCostumesCreate, characterCostumeCreate)
+  }
+
+  return characterCostumesCreate
+}
+
+
+// expandCharacterCostumesCreate expands a slice of CharacterCostumeCreate into a
+// slice of sequential values, intended to be used in conjunction with a multi-insert
+// statement (i.e. for use in CreateCharacterCostumes)
+func expandCharacterCostumesCreate(characterCostumesCreate []*CharacterCostumeCreate) []interface{} {
+  expandedCharacterCostumes := make([]interface{}, 0)
+
+  for _, characterCostumeCreate := range characterCostumesCreate {
+    expandedCharacterCostumes = append(expandedCharacterCostumes, characterCostumeCreate.CharacterID)
+    expandedCharacterCostumes = append(expandedCharacterCostumes, characterCostumeCreate.CostumeIndex)
+    expandedCharacterCostumes = append(expandedCharacterCostumes, characterCostumeCreate.CostumeName)
+    expandedCharacterCostumes = append(expandedCharacterCostumes, characterCostumeCreate.CostumeImg)
+  }
+
+  return expandedCharacterCostumes
+}
@@ -29,6 +29,32 @@ type DatabaseManager interface {
   MatchTagManager
   MatchTagViewManager
   TagManager
+  StageManager
+  StageStatsViewManager
+  OpponentManager
+  OpponentViewManager
+  CharacterCostumeManager
+  RosterManager
+  ArchetypeManager
+  SeriesManager
+  ArchetypeStatsViewManager
+  TagCategoryManager
+  TagAliasManager
+  TagStatsViewManager
+  PermissionManager
+  RoleManager
+  AdminUserViewManager
+  AuditManager
+  PublicProfileViewManager
+  ShareLinkManager
+  TwoFactorManager
+  APITokenManager
+  UserIdentityManager
+  FollowManager
+  FeedViewManager
+  TeamManager
+  TeamInviteManager
+  TeamStatsViewManager
 }
 
 
@@ -0,0 +1,192 @@
+package db
+
+import (
+  "time"
+)
+
+
+// The kinds of items that show up in a user's activity feed
+const (
+  FeedItemTypeMatch      = "match"
+  FeedItemTypeGspChange  = "gsp_change"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// FeedViewManager describes all of the methods used to interact with activity
+// feed views in our database (matches and GSP changes from followed users)
+type FeedViewManager interface {
+  GetFeedItems(feedFilter *FeedFilter) ([]*FeedItem, int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// FeedItem describes a single thing a followed user did; which fields
+// are set depends on its type (a logged match or a GSP change)
+type FeedItem struct {
+  FeedItemType           string          `json:"feedItemType"`
+  Created                time.Time       `json:"created"`
+  UserID                 int64           `json:"userId"`
+  UserName               string          `json:"userName"`
+  CharacterID            NullInt64JSON   `json:"characterId"`
+  CharacterName          NullStringJSON  `json:"characterName"`
+  CharacterImg           NullStringJSON  `json:"characterImage"`
+
+  // Data from matches
+  MatchID                NullInt64JSON   `json:"matchId"`
+  UserWin                NullBoolJSON    `json:"userWin"`
+  OpponentCharacterID    NullInt64JSON   `json:"opponentCharacterId"`
+  OpponentCharacterName  NullStringJSON  `json:"opponentCharacterName"`
+  OpponentCharacterImg   NullStringJSON  `json:"opponentCharacterImage"`
+
+  // Data from gsp_history; matches use NewGsp for the GSP they were logged with
+  OldGsp                 NullInt64JSON   `json:"oldGsp"`
+  NewGsp                 NullInt64JSON   `json:"newGsp"`
+}
+
+
+// FeedFilter describes whose feed to get and which page of it
+type FeedFilter struct {
+  UserID    int64  `json:"userId"`
+  // Pages start at 1
+  Page      int64  `json:"page"`
+  PageSize  int64  `json:"pageSize"`
+}
+
+
+/*---------------------------------
+        Shared SQL Statements
+----------------------------------*/
+
+// feedViewSelectStatement is every match and GSP change from the users someone ($1) follows,
+// leaving out anyone who opted out of feeds, or has been disabled or deleted
+const feedViewSelectStatement = `
+    WITH feed_users AS (
+      SELECT
+        users.user_id,
+        users.user_name
+      FROM
+        follows
+      INNER JOIN users ON users.user_id = follows.followed_user_id
+      WHERE
+        follows.follower_user_id = $1
+        AND users.feed_opt_out = false
+        AND users.disabled = false
+        AND users.deleted_at IS NULL
+    ),
+    feed_items AS (
+      SELECT
+        'match'                                 AS feed_item_type,
+        matches.created                         AS created,
+        feed_users.user_id                      AS user_id,
+        feed_users.user_name                    AS user_name,
+        player_character.character_id           AS character_id,
+        player_character.character_name         AS character_name,
+        player_character.character_stock_img    AS character_img,
+        matches.match_id                        AS match_id,
+        matches.user_win                        AS user_win,
+        opponent_character.character_id         AS opponent_character_id,
+        opponent_character.character_name       AS opponent_character_name,
+        opponent_character.character_stock_img  AS opponent_character_img,
+        NULL::INTEGER                           AS old_gsp,
+        matches.user_character_gsp              AS new_gsp
+      FROM
+        matches
+      INNER JOIN feed_users ON feed_users.user_id = matches.user_id
+      LEFT JOIN characters player_character ON player_character.character_id = matches.user_character_id
+      LEFT JOIN characters opponent_character ON opponent_character.character_id = matches.opponent_character_id
+      WHERE
+        matches.deleted_at IS NULL
+      UNION ALL
+      SELECT
+        'gsp_change'                            AS feed_item_type,
+        gsp_history.created                     AS created,
+        feed_users.user_id                      AS user_id,
+        feed_users.user_name                    AS user_name,
+        characters.character_id                 AS character_id,
+        characters.character_name               AS character_name,
+        characters.character_stock_img          AS character_img,
+        NULL::INTEGER                           AS match_id,
+        NULL::BOOLEAN                           AS user_win,
+        NULL::INTEGER                           AS opponent_character_id,
+        NULL::TEXT                              AS opponent_character_name,
+        NULL::TEXT                              AS opponent_character_img,
+        gsp_history.old_gsp                     AS old_gsp,
+        gsp_history.new_gsp                     AS new_gsp
+      FROM
+        gsp_history
+      INNER JOIN feed_users ON feed_users.user_id = gsp_history.user_id
+      LEFT JOIN characters ON characters.character_id = gsp_history.character_id
+    )
+`
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetFeedItems gets one page of a user's activity feed, newest first,
+// along with the total number of items in it across every page
+func (db *DB) GetFeedItems(feedFilter *FeedFilter) ([]*FeedItem, int64, error) {
+  var totalItems int64
+  err := db.QueryRow(feedViewSelectStatement+"SELECT COUNT(*) FROM feed_items", feedFilter.UserID).Scan(&totalItems)
+  if err != nil {
+    return nil, 0, err
+  }
+
+  sqlStatement := feedViewSelectStatement + `
+    SELECT
+      *
+    FROM
+      feed_items
+    ORDER BY
+      created DESC,
+      feed_item_type,
+      match_id DESC
+    LIMIT $2 OFFSET $3
+  `
+  rows, err := db.Query(sqlStatement, feedFilter.UserID, feedFilter.PageSize, (feedFilter.Page-1)*feedFilter.PageSize)
+  if err != nil {
+    return nil, 0, err
+  }
+  defer rows.Close()
+
+  feedItems := make([]*FeedItem, 0)
+  for rows.Next() {
+    feedItem := new(FeedItem)
+    err := rows.Scan(
+      &feedItem.FeedItemType,
+      &feedItem.Created,
+      &feedItem.UserID,
+      &feedItem.UserName,
+      &feedItem.CharacterID,
+      &feedItem.CharacterName,
+      &feedItem.CharacterImg,
+      &feedItem.MatchID,
+      &feedItem.UserWin,
+      &feedItem.OpponentCharacterID,
+      &feedItem.OpponentCharacterName,
+      &feedItem.OpponentCharacterImg,
+      &feedItem.OldGsp,
+      &feedItem.NewGsp,
+    )
+    if err != nil {
+      return nil, 0, err
+    }
+
+    feedItems = append(feedItems, feedItem)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, 0, err
+  }
+
+  return feedItems, totalItems, nil
+}
@@ -0,0 +1,256 @@
+package db
+
+import (
+  "database/sql"
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// FollowManager describes all of the methods used
+// to interact with the follows table in our database
+type FollowManager interface {
+  GetFollowedUsersByUserID(userID int64) ([]*FollowUser, error)
+  GetFollowersByUserID(userID int64) ([]*FollowUser, error)
+  GetFollowsByUserID(userID int64) ([]*Follow, error)
+
+  CreateFollow(followCreate *FollowCreate) (int64, error)
+  DeleteFollow(followDelete *FollowDelete) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Follow describes the data in the follows table
+type Follow struct {
+  FollowerUserID  int64      `json:"followerUserId"`
+  FollowedUserID  int64      `json:"followedUserId"`
+  Created         time.Time  `json:"created"`
+}
+
+
+// FollowUser describes a user on either end of a follow,
+// and when they started following (or being followed)
+type FollowUser struct {
+  UserID    int64      `json:"userId"`
+  UserName  string     `json:"userName"`
+  Created   time.Time  `json:"created"`
+}
+
+
+// FollowCreate describes the data needed for
+// a user to start following another user
+type FollowCreate struct {
+  FollowerUserID  int64  `json:"-"`
+  FollowedUserID  int64  `json:"userId"`
+}
+
+
+// FollowDelete describes the data needed for
+// a user to stop following another user
+type FollowDelete struct {
+  FollowerUserID  int64  `json:"-"`
+  FollowedUserID  int64  `json:"userId"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetFollowedUsersByUserID gets every user a user follows, newest follow first;
+// deleted users are left out, but they're still followed if they come back
+func (db *DB) GetFollowedUsersByUserID(userID int64) ([]*FollowUser, error) {
+  sqlStatement := `
+    SELECT
+      users.user_id    AS  user_id,
+      users.user_name  AS  user_name,
+      follows.created  AS  created
+    FROM
+      follows
+    INNER JOIN users ON users.user_id = follows.followed_user_id
+    WHERE
+      follows.follower_user_id = $1
+      AND users.deleted_at IS NULL
+    ORDER BY
+      follows.created DESC
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanFollowUsers(rows)
+}
+
+
+// GetFollowersByUserID gets every user following a user, newest follow first
+func (db *DB) GetFollowersByUserID(userID int64) ([]*FollowUser, error) {
+  sqlStatement := `
+    SELECT
+      users.user_id    AS  user_id,
+      users.user_name  AS  user_name,
+      follows.created  AS  created
+    FROM
+      follows
+    INNER JOIN users ON users.user_id = follows.follower_user_id
+    WHERE
+      follows.followed_user_id = $1
+      AND users.deleted_at IS NULL
+    ORDER BY
+      follows.created DESC
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanFollowUsers(rows)
+}
+
+
+// GetFollowsByUserID gets every follow a user is on either end of, for their data export
+func (db *DB) GetFollowsByUserID(userID int64) ([]*Follow, error) {
+  sqlStatement := `
+    SELECT
+      follower_user_id,
+      followed_user_id,
+      created
+    FROM
+      follows
+    WHERE
+      follower_user_id = $1
+      OR followed_user_id = $1
+    ORDER BY
+      created
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  follows := make([]*Follow, 0)
+  for rows.Next() {
+    follow := new(Follow)
+    err := rows.Scan(
+      &follow.FollowerUserID,
+      &follow.FollowedUserID,
+      &follow.Created,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    follows = append(follows, follow)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return follows, nil
+}
+
+
+// CreateFollow adds a new entry to the follows table in our database; following someone you
+// already follow does nothing. Returns sql.ErrNoRows if the followed user doesn't exist (or was deleted)
+func (db *DB) CreateFollow(followCreate *FollowCreate) (int64, error) {
+  var followedUserID int64
+  err := db.QueryRow(`
+    SELECT
+      user_id
+    FROM
+      users
+    WHERE
+      user_id = $1
+      AND deleted_at IS NULL
+  `, followCreate.FollowedUserID).Scan(&followedUserID)
+  if err != nil {
+    return 0, err
+  }
+
+  sqlStatement := `
+    INSERT INTO follows
+      (follower_user_id, followed_user_id)
+    VALUES
+      ($1, $2)
+    ON CONFLICT DO NOTHING
+  `
+  _, err = db.Exec(
+    sqlStatement,
+    followCreate.FollowerUserID,
+    followedUserID,
+  )
+  if err != nil {
+    return 0, err
+  }
+
+  return followedUserID, nil
+}
+
+
+// DeleteFollow removes an entry from the follows table in our database;
+// returns sql.ErrNoRows if the user wasn't following them
+func (db *DB) DeleteFollow(followDelete *FollowDelete) (int64, error) {
+  var followedUserID int64
+  sqlStatement := `
+    DELETE FROM
+      follows
+    WHERE
+      follower_user_id = $1
+      AND followed_user_id = $2
+    RETURNING
+      followed_user_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    followDelete.FollowerUserID,
+    followDelete.FollowedUserID,
+  )
+
+  err := row.Scan(&followedUserID)
+  if err != nil {
+    return 0, err
+  }
+
+  return followedUserID, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// scanFollowUsers scans every row from a follows query into FollowUsers
+func scanFollowUsers(rows *sql.Rows) ([]*FollowUser, error) {
+  followUsers := make([]*FollowUser, 0)
+  for rows.Next() {
+    followUser := new(FollowUser)
+    err := rows.Scan(
+      &followUser.UserID,
+      &followUser.UserName,
+      &followUser.Created,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    followUsers = append(followUsers, followUser)
+  }
+
+  err := rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return followUsers, nil
+}
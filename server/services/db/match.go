@@ -1,5 +1,9 @@
 package db
 
+import (
+  "time"
+)
+
 
 /*---------------------------------
             Interface
@@ -11,6 +15,8 @@ type MatchManager interface {
   CreateMatch(matchCreate *MatchCreate) (int64, error)
   UpdateMatch(matchUpdate *MatchUpdate) (int64, error)
   DeleteMatchByMatchID(matchID int64) (int64, error)
+  UndeleteMatchByMatchID(matchID int64) (int64, error)
+  PurgeDeletedMatches(deletedBefore time.Time) (int64, error)
 }
 
 
@@ -28,6 +34,8 @@ type Match struct {
   UserCharacterID       NullInt64JSON  `json:"userCharacterId"`
   UserCharacterGsp      NullInt64JSON  `json:"userCharacterGsp"`
   UserWin               NullBoolJSON   `json:"userWin"`
+  StageID               NullInt64JSON  `json:"stageId"`
+  OpponentID            NullInt64JSON  `json:"opponentId"`
 }
 
 
@@ -41,6 +49,8 @@ type MatchUpdate struct {
   UserCharacterGsp      NullInt64JSON       `json:"userCharacterGsp"`
   UserWin               NullBoolJSON        `json:"userWin"`
   Created               NullTimeJSON        `json:"created"`
+  StageID               NullInt64JSON       `json:"stageId"`
+  OpponentID            NullInt64JSON       `json:"opponentId"`
   MatchTags             *[]*MatchTagCreate  `json:"matchTags"`
 }
 
@@ -54,6 +64,8 @@ type MatchCreate struct {
   UserCharacterID       NullInt64JSON       `json:"userCharacterId"`
   UserCharacterGsp      NullInt64JSON       `json:"userCharacterGsp"`
   UserWin               NullBoolJSON        `json:"userWin"`
+  StageID               NullInt64JSON       `json:"stageId"`
+  OpponentID            NullInt64JSON       `json:"opponentId"`
   MatchTags             *[]*MatchTagCreate  `json:"matchTags"`
 }
 
@@ -65,6 +77,13 @@ type MatchDelete struct {
 }
 
 
+// MatchUndelete describes the data needed
+// to restore a given match from the trash
+type MatchUndelete struct {
+  MatchID  int64  `json:"matchId"`
+}
+
+
 /*---------------------------------
        Method Implementations
 ----------------------------------*/
@@ -79,9 +98,11 @@ func (db *DB) CreateMatch(matchCreate *MatchCreate) (int64, error) {
       opponent_character_gsp,
       user_character_id,
       user_character_gsp,
-      user_win
+      user_win,
+      stage_id,
+      opponent_id
     )
-    VALUES ($1, $2, $3, $4, $5, $6)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
     RETURNING
       match_id
   `
@@ -93,6 +114,8 @@ func (db *DB) CreateMatch(matchCreate *MatchCreate) (int64, error) {
     matchCreate.UserCharacterID,
     matchCreate.UserCharacterGsp,
     matchCreate.UserWin,
+    matchCreate.StageID,
+    matchCreate.OpponentID,
   )
 
   err := row.Scan(&matchID)
@@ -117,9 +140,11 @@ func (db *DB) UpdateMatch(matchUpdate *MatchUpdate) (int64, error) {
       user_character_id = $3,
       user_character_gsp = $4,
       user_win = $5,
-      created = $6
+      created = $6,
+      stage_id = $7,
+      opponent_id = $8
     WHERE
-      match_id = $7
+      match_id = $9
     RETURNING
       match_id
   `
@@ -131,6 +156,8 @@ func (db *DB) UpdateMatch(matchUpdate *MatchUpdate) (int64, error) {
     matchUpdate.UserCharacterGsp,
     matchUpdate.UserWin,
     matchUpdate.Created,
+    matchUpdate.StageID,
+    matchUpdate.OpponentID,
     matchUpdate.MatchID,
   )
   err := row.Scan(&matchID)
@@ -143,14 +170,18 @@ func (db *DB) UpdateMatch(matchUpdate *MatchUpdate) (int64, error) {
 }
 
 
-// DeleteMatchByMatchID removes an existing entry in the matches table
+// DeleteMatchByMatchID moves an existing entry in the matches table to the trash; it's
+// hidden from every match view until it's restored or purged for good
 func (db *DB) DeleteMatchByMatchID(matchID int64) (int64, error) {
   var deletedMatchID int64
   sqlStatement := `
-    DELETE FROM
+    UPDATE
       matches
+    SET
+      deleted_at = CURRENT_TIMESTAMP
     WHERE
       match_id = $1
+      AND deleted_at IS NULL
     RETURNING
       match_id
   `
@@ -158,8 +189,70 @@ func (db *DB) DeleteMatchByMatchID(matchID int64) (int64, error) {
 
   err := row.Scan(&deletedMatchID)
   if err != nil {
-    return 0, nil
+    return 0, err
   }
 
   return deletedMatchID, nil
-}
\ No newline at end of file
+}
+
+
+// UndeleteMatchByMatchID restores a match from the trash
+func (db *DB) UndeleteMatchByMatchID(matchID int64) (int64, error) {
+  var undeletedMatchID int64
+  sqlStatement := `
+    UPDATE
+      matches
+    SET
+      deleted_at = NULL
+    WHERE
+      match_id = $1
+      AND deleted_at IS NOT NULL
+    RETURNING
+      match_id
+  `
+  row := db.QueryRow(sqlStatement, matchID)
+
+  err := row.Scan(&undeletedMatchID)
+  if err != nil {
+    return 0, err
+  }
+
+  return undeletedMatchID, nil
+}
+
+
+// PurgeDeletedMatches permanently removes every match (and its match tags)
+// that was moved to the trash before the given time, returning how many were removed
+func (db *DB) PurgeDeletedMatches(deletedBefore time.Time) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  _, err = tx.Exec(`
+    DELETE FROM
+      match_tags
+    WHERE
+      match_id IN (SELECT match_id FROM matches WHERE deleted_at < $1)
+  `, deletedBefore)
+  if err != nil {
+    return 0, err
+  }
+
+  result, err := tx.Exec(`DELETE FROM matches WHERE deleted_at < $1`, deletedBefore)
+  if err != nil {
+    return 0, err
+  }
+  numPurged, err := result.RowsAffected()
+  if err != nil {
+    return 0, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return 0, err
+  }
+
+  return numPurged, nil
+}
@@ -15,8 +15,10 @@ type MatchTag struct {
 // MatchTagCreate describes the data needed
 // to create a "match tag" relationship
 type MatchTagCreate struct {
-  MatchID  int64  `json:"matchId"`
-  TagID    int64  `json:"tagId"`
+  MatchID  int64           `json:"matchId"`
+  TagID    int64           `json:"tagId"`
+  // Imports can send a tag name (or an old, merged name) instead of a tag ID
+  TagName  NullStringJSON  `json:"tagName"`
 }
 
 /*---------------------------------
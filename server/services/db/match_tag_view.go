@@ -7,10 +7,15 @@ package db
 
 // MatchTagView describes a JOIN between match_tags and tags tables
 type MatchTagView struct {
-  MatchTagID  int64   `json:"matchTagId"`
-  MatchID     int64   `json:"matchId"`
-  TagID       int64   `json:"tagId"`
-  TagName     string  `json:"tagName"`
+  MatchTagID       int64           `json:"matchTagId"`
+  MatchID          int64           `json:"matchId"`
+  TagID            int64           `json:"tagId"`
+  TagName          string          `json:"tagName"`
+  TagUserID        NullInt64JSON   `json:"tagUserId"`
+
+  // Data from tag_categories
+  TagCategoryID    NullInt64JSON   `json:"tagCategoryId"`
+  TagCategoryName  NullStringJSON  `json:"tagCategoryName"`
 }
 
 
@@ -21,8 +26,8 @@ type MatchTagView struct {
 // MatchTagViewManager describes all of the methods
 // used to interact with "match tag" views in our database
 type MatchTagViewManager interface {
-  GetAllMatchTagViews() ([]*MatchTagView, error)
-  GetMatchTagViewsByMatchID(matchID int64) ([]*MatchTagView, error)
+  GetAllMatchTagViews(viewerUserID int64) ([]*MatchTagView, error)
+  GetMatchTagViewsByMatchID(matchID int64, viewerUserID int64) ([]*MatchTagView, error)
 }
 
 
@@ -30,19 +35,29 @@ type MatchTagViewManager interface {
        Method Implementations
 ----------------------------------*/
 
-// GetAllMatchTagViews gets all of the match tags
-func (db *DB) GetAllMatchTagViews() ([]*MatchTagView, error) {
+// GetAllMatchTagViews gets all of the match tags that a given viewer can see; other
+// users' private tags are left out, even on matches the viewer can otherwise see,
+// and so are the tags on matches in the trash
+func (db *DB) GetAllMatchTagViews(viewerUserID int64) ([]*MatchTagView, error) {
   sqlStatement := `
     SELECT
-      match_tags.match_tag_id  AS  match_tag_id,
-      match_tags.match_id      AS  match_id,
-      tags.tag_id              AS  tag_id,
-      tags.tag_name            AS  tag_name
+      match_tags.match_tag_id           AS  match_tag_id,
+      match_tags.match_id               AS  match_id,
+      tags.tag_id                       AS  tag_id,
+      tags.tag_name                     AS  tag_name,
+      tags.user_id                      AS  tag_user_id,
+      tag_categories.tag_category_id    AS  tag_category_id,
+      tag_categories.tag_category_name  AS  tag_category_name
     FROM
       match_tags
+    INNER JOIN matches ON matches.match_id = match_tags.match_id
     LEFT JOIN tags ON tags.tag_id = match_tags.tag_id
+    LEFT JOIN tag_categories ON tag_categories.tag_category_id = tags.tag_category_id
+    WHERE
+      matches.deleted_at IS NULL
+      AND (tags.user_id IS NULL OR tags.user_id = $1)
   `
-  rows, err := db.Query(sqlStatement)
+  rows, err := db.Query(sqlStatement, viewerUserID)
   if err != nil {
     return nil, err
   }
@@ -56,6 +71,9 @@ func (db *DB) GetAllMatchTagViews() ([]*MatchTagView, error) {
       &matchTagView.MatchID,
       &matchTagView.TagID,
       &matchTagView.TagName,
+      &matchTagView.TagUserID,
+      &matchTagView.TagCategoryID,
+      &matchTagView.TagCategoryName,
     )
     if err != nil {
       return nil, err
@@ -74,21 +92,28 @@ func (db *DB) GetAllMatchTagViews() ([]*MatchTagView, error) {
 
 
 
-// GetMatchTagViewsByMatchID gets all of the match tags for a given matchID
-func (db *DB) GetMatchTagViewsByMatchID(matchID int64) ([]*MatchTagView, error) {
+// GetMatchTagViewsByMatchID gets all of the match tags for a given matchID that a given viewer can see
+func (db *DB) GetMatchTagViewsByMatchID(matchID int64, viewerUserID int64) ([]*MatchTagView, error) {
   sqlStatement := `
     SELECT
-      match_tags.match_tag_id  AS  match_tag_id,
-      match_tags.match_id      AS  match_id,
-      tags.tag_id              AS  tag_id,
-      tags.tag_name            AS  tag_name
+      match_tags.match_tag_id           AS  match_tag_id,
+      match_tags.match_id               AS  match_id,
+      tags.tag_id                       AS  tag_id,
+      tags.tag_name                     AS  tag_name,
+      tags.user_id                      AS  tag_user_id,
+      tag_categories.tag_category_id    AS  tag_category_id,
+      tag_categories.tag_category_name  AS  tag_category_name
     FROM
       match_tags
+    INNER JOIN matches ON matches.match_id = match_tags.match_id
     LEFT JOIN tags ON tags.tag_id = match_tags.tag_id
+    LEFT JOIN tag_categories ON tag_categories.tag_category_id = tags.tag_category_id
     WHERE
       match_tags.match_id = $1
+      AND matches.deleted_at IS NULL
+      AND (tags.user_id IS NULL OR tags.user_id = $2)
   `
-  rows, err := db.Query(sqlStatement, matchID)
+  rows, err := db.Query(sqlStatement, matchID, viewerUserID)
   if err != nil {
     return nil, err
   }
@@ -102,6 +127,9 @@ func (db *DB) GetMatchTagViewsByMatchID(matchID int64) ([]*MatchTagView, error)
       &matchTagView.MatchID,
       &matchTagView.TagID,
       &matchTagView.TagName,
+      &matchTagView.TagUserID,
+      &matchTagView.TagCategoryID,
+      &matchTagView.TagCategoryName,
     )
     if err != nil {
       return nil, err
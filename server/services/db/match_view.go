@@ -1,6 +1,9 @@
 package db
 
 import (
+  "database/sql"
+  "fmt"
+  "strings"
   "time"
 )
 
@@ -13,7 +16,12 @@ import (
 // match views in our database (data joined between match, character, user, etc)
 type MatchViewManager interface {
   GetMatchViewByMatchID(matchID int64) (*MatchView, error)
-  GetAllMatchViews() ([]*MatchView, error)
+  GetAllMatchViews(matchViewFilter *MatchViewFilter) ([]*MatchView, error)
+  GetMatchViewsByOpponentID(opponentID int64) ([]*MatchView, error)
+  GetMatchViewsByUserIDSince(userID int64, since time.Time) ([]*MatchView, error)
+  GetRecentMatchViewsByTeamID(teamID int64, limit int64) ([]*MatchView, error)
+  GetDeletedMatchViewByMatchID(matchID int64) (*MatchView, error)
+  GetDeletedMatchViewsByUserID(userID int64) ([]*MatchView, error)
 }
 
 
@@ -34,6 +42,10 @@ type MatchView struct {
   OpponentCharacterGsp   NullInt64JSON    `json:"opponentCharacterGsp,omitempty"`
   UserCharacterGsp       NullInt64JSON    `json:"userCharacterGsp,omitempty"`
   UserWin                NullBoolJSON     `json:"userWin,omitempty"`
+  StageID                NullInt64JSON    `json:"stageId"`
+  OpponentID             NullInt64JSON    `json:"opponentId"`
+  // Only set for matches in the trash
+  DeletedAt              NullTimeJSON     `json:"deletedAt"`
 
   // Data from users
   UserName               string            `json:"userName"`
@@ -44,22 +56,46 @@ type MatchView struct {
   OpponentCharacterImg   string           `json:"opponentCharacterImage"`
   UserCharacterImg       NullStringJSON   `json:"userCharacterImage"`
 
+  // Data from stages
+  StageName              NullStringJSON   `json:"stageName"`
+
+  // Data from opponents
+  OpponentAlias          NullStringJSON   `json:"opponentAlias"`
+
   // Data from user characters
   AltCostume             NullInt64JSON    `json:"altCostume,omitempty"`
 
+  // Data from character_costumes; resolved from the user character's alt costume
+  UserCharacterCostumeImg  NullStringJSON  `json:"userCharacterCostumeImage"`
+
   // Data from match_tags; added seperately from the SQL Joins
   MatchTags              []*MatchTagView  `json:"matchTags"`
 }
 
 
+// MatchViewFilter describes the optional filters we can apply when getting all match views;
+// any field left null is ignored
+type MatchViewFilter struct {
+  // Only matches recorded by this user
+  UserID        NullInt64JSON  `json:"userId"`
+  // Only matches against characters with this archetype
+  ArchetypeID   NullInt64JSON  `json:"archetypeId"`
+  // Only matches against characters from this series
+  SeriesID      NullInt64JSON  `json:"seriesId"`
+  // Only matches tagged with this tag or any tag nested under it
+  TagID         NullInt64JSON  `json:"tagId"`
+  // The user doing the filtering; nested tags private to anyone else are skipped
+  ViewerUserID  int64          `json:"-"`
+}
+
+
 /*---------------------------------
-       Method Implementations
+        Shared SQL Statements
 ----------------------------------*/
 
-// GetMatchViewByMatchID gets all of the data needed to display
-// an individual match, which includes joined data from the users and characters table
-func (db *DB) GetMatchViewByMatchID(matchID int64) (*MatchView, error) {
-  sqlStatement := `
+// matchViewSelectStatement is the SELECT and JOINs shared by all of our match view
+// queries; each query only needs to add its own WHERE/ORDER BY clauses after it
+const matchViewSelectStatement = `
     SELECT
       matches.created                         AS created,
       matches.match_id                        AS match_id,
@@ -74,17 +110,223 @@ func (db *DB) GetMatchViewByMatchID(matchID int64) (*MatchView, error) {
       player_character.character_name         AS player_character_name,
       opponent_character.character_stock_img  AS opponent_character_img,
       player_character.character_stock_img    AS player_character_img,
-      user_characters.alt_costume             AS alt_costume
+      user_characters.alt_costume             AS alt_costume,
+      matches.stage_id                        AS stage_id,
+      stages.stage_name                       AS stage_name,
+      matches.opponent_id                     AS opponent_id,
+      opponents.opponent_alias                AS opponent_alias,
+      user_costume.costume_img                AS user_character_costume_img,
+      matches.deleted_at                      AS deleted_at
     FROM
       matches
     LEFT JOIN users ON users.user_id = matches.user_id
     LEFT JOIN characters opponent_character ON opponent_character.character_id = matches.opponent_character_id
     LEFT JOIN characters player_character ON player_character.character_id = matches.user_character_id
     LEFT JOIN user_characters ON user_characters.character_id = matches.user_character_id AND user_characters.user_id = matches.user_id
+    LEFT JOIN stages ON stages.stage_id = matches.stage_id
+    LEFT JOIN opponents ON opponents.opponent_id = matches.opponent_id
+    LEFT JOIN character_costumes user_costume ON user_costume.character_id = matches.user_character_id AND user_costume.costume_index = COALESCE(user_characters.alt_costume, 1)
+`
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetMatchViewByMatchID gets all of the data needed to display
+// an individual match, which includes joined data from the users and characters table
+func (db *DB) GetMatchViewByMatchID(matchID int64) (*MatchView, error) {
+  sqlStatement := matchViewSelectStatement + `
     WHERE
-     match_id = $1
+      matches.match_id = $1
+      AND matches.deleted_at IS NULL
   `
   row := db.QueryRow(sqlStatement, matchID)
+  matchView, err := scanMatchView(row)
+  if err != nil {
+    return nil, err
+  }
+
+  return matchView, nil
+}
+
+// GetAllMatchViews gets all of the data needed to display all recorded matches that pass
+// the given filter, which includes joined data from the matches, users, and characters tables
+func (db *DB) GetAllMatchViews(matchViewFilter *MatchViewFilter) ([]*MatchView, error) {
+  whereClause, args := matchViewFilter.makeWhereClause()
+  rows, err := db.Query(matchViewSelectStatement+whereClause, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanMatchViews(rows)
+}
+
+
+// GetMatchViewsByOpponentID gets all of the data needed to display
+// every match a user has recorded against a given opponent
+func (db *DB) GetMatchViewsByOpponentID(opponentID int64) ([]*MatchView, error) {
+  sqlStatement := matchViewSelectStatement + `
+    WHERE
+      matches.opponent_id = $1
+      AND matches.deleted_at IS NULL
+    ORDER BY
+      matches.created DESC
+  `
+  rows, err := db.Query(sqlStatement, opponentID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanMatchViews(rows)
+}
+
+
+// GetMatchViewsByUserIDSince gets all of the data needed to display every match
+// a user has recorded since a given time, oldest first; used for live sessions
+func (db *DB) GetMatchViewsByUserIDSince(userID int64, since time.Time) ([]*MatchView, error) {
+  sqlStatement := matchViewSelectStatement + `
+    WHERE
+      matches.user_id = $1
+      AND matches.created >= $2
+      AND matches.deleted_at IS NULL
+    ORDER BY
+      matches.created
+  `
+  rows, err := db.Query(sqlStatement, userID, since)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanMatchViews(rows)
+}
+
+
+// GetRecentMatchViewsByTeamID gets all of the data needed to display the latest
+// matches recorded by anyone on a team, newest first; used for team dashboards
+func (db *DB) GetRecentMatchViewsByTeamID(teamID int64, limit int64) ([]*MatchView, error) {
+  sqlStatement := matchViewSelectStatement + `
+    INNER JOIN team_members ON team_members.user_id = matches.user_id
+    WHERE
+      team_members.team_id = $1
+      AND users.deleted_at IS NULL
+      AND matches.deleted_at IS NULL
+    ORDER BY
+      matches.created DESC
+    LIMIT $2
+  `
+  rows, err := db.Query(sqlStatement, teamID, limit)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanMatchViews(rows)
+}
+
+
+// GetDeletedMatchViewByMatchID gets all of the data needed to
+// display an individual match, but only if it's in the trash
+func (db *DB) GetDeletedMatchViewByMatchID(matchID int64) (*MatchView, error) {
+  sqlStatement := matchViewSelectStatement + `
+    WHERE
+      matches.match_id = $1
+      AND matches.deleted_at IS NOT NULL
+  `
+  row := db.QueryRow(sqlStatement, matchID)
+  matchView, err := scanMatchView(row)
+  if err != nil {
+    return nil, err
+  }
+
+  return matchView, nil
+}
+
+
+// GetDeletedMatchViewsByUserID gets all of the data needed to display
+// every match a user has in the trash, most recently deleted first
+func (db *DB) GetDeletedMatchViewsByUserID(userID int64) ([]*MatchView, error) {
+  sqlStatement := matchViewSelectStatement + `
+    WHERE
+      matches.user_id = $1
+      AND matches.deleted_at IS NOT NULL
+    ORDER BY
+      matches.deleted_at DESC
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  return scanMatchViews(rows)
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// makeWhereClause turns a MatchViewFilter into a WHERE clause to add after
+// matchViewSelectStatement, along with the arguments for its placeholders;
+// matches in the trash are always left out
+func (matchViewFilter *MatchViewFilter) makeWhereClause() (string, []interface{}) {
+  conditions := []string{"matches.deleted_at IS NULL"}
+  args := make([]interface{}, 0)
+  if matchViewFilter == nil {
+    matchViewFilter = new(MatchViewFilter)
+  }
+
+  if matchViewFilter.UserID.Valid {
+    args = append(args, matchViewFilter.UserID.Int64)
+    conditions = append(conditions, fmt.Sprintf("matches.user_id = $%d", len(args)))
+  }
+  if matchViewFilter.ArchetypeID.Valid {
+    args = append(args, matchViewFilter.ArchetypeID.Int64)
+    conditions = append(conditions, fmt.Sprintf(`EXISTS (
+      SELECT 1 FROM character_archetypes
+      WHERE character_archetypes.character_id = matches.opponent_character_id AND character_archetypes.archetype_id = $%d
+    )`, len(args)))
+  }
+  if matchViewFilter.SeriesID.Valid {
+    args = append(args, matchViewFilter.SeriesID.Int64)
+    conditions = append(conditions, fmt.Sprintf(`EXISTS (
+      SELECT 1 FROM character_series
+      WHERE character_series.character_id = matches.opponent_character_id AND character_series.series_id = $%d
+    )`, len(args)))
+  }
+
+  if matchViewFilter.TagID.Valid {
+    args = append(args, matchViewFilter.TagID.Int64, matchViewFilter.ViewerUserID)
+    conditions = append(conditions, fmt.Sprintf(`EXISTS (
+      SELECT 1 FROM match_tags
+      WHERE match_tags.match_id = matches.match_id AND match_tags.tag_id IN (
+        WITH RECURSIVE filter_tags AS (
+          SELECT tag_id FROM tags WHERE tag_id = $%d
+          UNION
+          SELECT tags.tag_id FROM tags INNER JOIN filter_tags ON tags.parent_tag_id = filter_tags.tag_id
+          WHERE tags.user_id IS NULL OR tags.user_id = $%d
+        )
+        SELECT tag_id FROM filter_tags
+      )
+    )`, len(args)-1, len(args)))
+  }
+
+  return "\n    WHERE\n      " + strings.Join(conditions, "\n      AND ") + "\n", args
+}
+
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+  Scan(dest ...interface{}) error
+}
+
+
+// scanMatchView scans a single row selected with matchViewSelectStatement into a MatchView
+func scanMatchView(row rowScanner) (*MatchView, error) {
   matchView := new(MatchView)
   err := row.Scan(
     &matchView.Created,
@@ -101,6 +343,12 @@ func (db *DB) GetMatchViewByMatchID(matchID int64) (*MatchView, error) {
     &matchView.OpponentCharacterImg,
     &matchView.UserCharacterImg,
     &matchView.AltCostume,
+    &matchView.StageID,
+    &matchView.StageName,
+    &matchView.OpponentID,
+    &matchView.OpponentAlias,
+    &matchView.UserCharacterCostumeImg,
+    &matchView.DeletedAt,
   )
 
   if err != nil {
@@ -110,59 +358,12 @@ func (db *DB) GetMatchViewByMatchID(matchID int64) (*MatchView, error) {
   return matchView, nil
 }
 
-// GetAllMatchViews gets all of the data needed to display all recorded matches,
-// which includes joined data from the matches, users, and characters tables
-func (db *DB) GetAllMatchViews() ([]*MatchView, error) {
-  sqlStatement := `
-    SELECT
-      matches.created                         AS created,
-      matches.match_id                        AS match_id,
-      users.user_id                           AS user_id,
-      player_character.character_id           AS player_character_id,
-      opponent_character.character_id         AS opponent_character_id,
-      matches.opponent_character_gsp          AS opponent_character_gsp,
-      matches.user_character_gsp              AS player_character_gsp,
-      matches.user_win                        AS user_win,
-      users.user_name                         AS user_name,
-      opponent_character.character_name       AS opponent_character_name,
-      player_character.character_name         AS player_character_name,
-      opponent_character.character_stock_img  AS opponent_character_img,
-      player_character.character_stock_img    AS player_character_img,
-      user_characters.alt_costume             AS alt_costume
-    FROM
-      matches
-    LEFT JOIN users ON users.user_id = matches.user_id
-    LEFT JOIN characters opponent_character ON opponent_character.character_id = matches.opponent_character_id
-    LEFT JOIN characters player_character ON player_character.character_id = matches.user_character_id
-    LEFT JOIN user_characters ON user_characters.character_id = matches.user_character_id AND user_characters.user_id = matches.user_id
-  `
-
-  rows, err := db.Query(sqlStatement)
-  if err != nil {
-    return nil, err
-  }
-  defer rows.Close()
 
+// scanMatchViews scans all of the rows selected with matchViewSelectStatement into MatchViews
+func scanMatchViews(rows *sql.Rows) ([]*MatchView, error) {
   matchViews := make([]*MatchView, 0)
   for rows.Next() {
-    matchView := new(MatchView)
-    err := rows.Scan(
-      &matchView.Created,
-      &matchView.MatchID,
-      &matchView.UserID,
-      &matchView.UserCharacterID,
-      &matchView.OpponentCharacterID,
-      &matchView.OpponentCharacterGsp,
-      &matchView.UserCharacterGsp,
-      &matchView.UserWin,
-      &matchView.UserName,
-      &matchView.OpponentCharacterName,
-      &matchView.UserCharacterName,
-      &matchView.OpponentCharacterImg,
-      &matchView.UserCharacterImg,
-      &matchView.AltCostume,
-    )
-
+    matchView, err := scanMatchView(rows)
     if err != nil {
       return nil, err
     }
@@ -170,7 +371,7 @@ func (db *DB) GetAllMatchViews() ([]*MatchView, error) {
     matchViews = append(matchViews, matchView)
   }
 
-  err = rows.Err()
+  err := rows.Err()
   if err != nil {
     return nil, err
   }
@@ -0,0 +1,184 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// OpponentManager describes all of the methods used
+// to interact with the opponents table in our database
+type OpponentManager interface {
+  GetOpponentByOpponentID(opponentID int64) (*Opponent, error)
+
+  CreateOpponent(opponentCreate *OpponentCreate) (int64, error)
+  UpdateOpponent(opponentUpdate *OpponentUpdate) (int64, error)
+  DeleteOpponentByOpponentID(opponentID int64) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Opponent describes a person a user has played against;
+// opponents are owned by the user who recorded them
+type Opponent struct {
+  OpponentID      int64           `json:"opponentId"`
+  UserID          int64           `json:"userId"`
+  OpponentUserID  NullInt64JSON   `json:"opponentUserId"`
+  OpponentAlias   string          `json:"opponentAlias"`
+  OpponentNotes   NullStringJSON  `json:"opponentNotes"`
+  Created         time.Time       `json:"created"`
+}
+
+
+// OpponentCreate describes the data needed
+// to create a given opponent in our db
+type OpponentCreate struct {
+  UserID          int64           `json:"userId"`
+  OpponentUserID  NullInt64JSON   `json:"opponentUserId"`
+  OpponentAlias   string          `json:"opponentAlias"`
+  OpponentNotes   NullStringJSON  `json:"opponentNotes"`
+}
+
+
+// OpponentUpdate describes the data needed
+// to update a given opponent in our db
+type OpponentUpdate struct {
+  OpponentID      int64           `json:"opponentId"`
+  OpponentUserID  NullInt64JSON   `json:"opponentUserId"`
+  OpponentAlias   string          `json:"opponentAlias"`
+  OpponentNotes   NullStringJSON  `json:"opponentNotes"`
+}
+
+
+// OpponentDelete describes the data needed
+// to delete a given opponent in our db
+type OpponentDelete struct {
+  OpponentID  int64  `json:"opponentId"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetOpponentByOpponentID gets a specific opponent given an opponentID
+func (db *DB) GetOpponentByOpponentID(opponentID int64) (*Opponent, error) {
+  sqlStatement := `
+    SELECT
+      opponent_id,
+      user_id,
+      opponent_user_id,
+      opponent_alias,
+      opponent_notes,
+      created
+    FROM
+      opponents
+    WHERE
+      opponent_id = $1
+  `
+  row := db.QueryRow(sqlStatement, opponentID)
+
+  opponent := new(Opponent)
+  err := row.Scan(
+    &opponent.OpponentID,
+    &opponent.UserID,
+    &opponent.OpponentUserID,
+    &opponent.OpponentAlias,
+    &opponent.OpponentNotes,
+    &opponent.Created,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return opponent, nil
+}
+
+
+// CreateOpponent adds a new entry to the opponents table
+func (db *DB) CreateOpponent(opponentCreate *OpponentCreate) (int64, error) {
+  var opponentID int64
+  sqlStatement := `
+    INSERT INTO opponents
+      (user_id, opponent_user_id, opponent_alias, opponent_notes)
+    VALUES
+      ($1, $2, $3, $4)
+    RETURNING
+      opponent_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    opponentCreate.UserID,
+    opponentCreate.OpponentUserID,
+    opponentCreate.OpponentAlias,
+    opponentCreate.OpponentNotes,
+  )
+
+  err := row.Scan(&opponentID)
+  if err != nil {
+    return 0, err
+  }
+
+  return opponentID, nil
+}
+
+
+// UpdateOpponent updates an existing entry in the opponents table
+func (db *DB) UpdateOpponent(opponentUpdate *OpponentUpdate) (int64, error) {
+  var opponentID int64
+  sqlStatement := `
+    UPDATE
+      opponents
+    SET
+      opponent_user_id = $1,
+      opponent_alias = $2,
+      opponent_notes = $3
+    WHERE
+      opponent_id = $4
+    RETURNING
+      opponent_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    opponentUpdate.OpponentUserID,
+    opponentUpdate.OpponentAlias,
+    opponentUpdate.OpponentNotes,
+    opponentUpdate.OpponentID,
+  )
+
+  err := row.Scan(&opponentID)
+  if err != nil {
+    return 0, err
+  }
+
+  return opponentID, nil
+}
+
+
+// DeleteOpponentByOpponentID removes an existing entry in the opponents table;
+// any matches against the opponent are kept, just without the opponent attached
+func (db *DB) DeleteOpponentByOpponentID(opponentID int64) (int64, error) {
+  var deletedOpponentID int64
+  sqlStatement := `
+    DELETE FROM
+      opponents
+    WHERE
+      opponent_id = $1
+    RETURNING
+      opponent_id
+  `
+  row := db.QueryRow(sqlStatement, opponentID)
+
+  err := row.Scan(&deletedOpponentID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedOpponentID, nil
+}
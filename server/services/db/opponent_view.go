@@ -0,0 +1,158 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// OpponentViewManager describes all of the methods used to interact with
+// opponent views in our database (data joined between opponents, users, and matches)
+type OpponentViewManager interface {
+  GetOpponentViewsByUserID(userID int64) ([]*OpponentView, error)
+  GetOpponentViewByOpponentID(opponentID int64) (*OpponentView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// OpponentView desribes a JOIN between the opponents, users, and matches tables,
+// containing an opponent along with the user's head-to-head record against them
+type OpponentView struct {
+  // Data from opponents
+  OpponentID        int64           `json:"opponentId"`
+  UserID            int64           `json:"userId"`
+  OpponentUserID    NullInt64JSON   `json:"opponentUserId"`
+  OpponentAlias     string          `json:"opponentAlias"`
+  OpponentNotes     NullStringJSON  `json:"opponentNotes"`
+  Created           time.Time       `json:"created"`
+
+  // Data from users (the opponent's linked account, if any)
+  OpponentUserName  NullStringJSON  `json:"opponentUserName"`
+
+  // Data from matches
+  LastPlayed        NullTimeJSON    `json:"lastPlayed"`
+  WinRecord
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetOpponentViewsByUserID gets all of a user's opponents along with their head-to-head records
+func (db *DB) GetOpponentViewsByUserID(userID int64) ([]*OpponentView, error) {
+  sqlStatement := `
+    SELECT
+      opponents.opponent_id                                AS opponent_id,
+      opponents.user_id                                    AS user_id,
+      opponents.opponent_user_id                           AS opponent_user_id,
+      opponents.opponent_alias                             AS opponent_alias,
+      opponents.opponent_notes                             AS opponent_notes,
+      opponents.created                                    AS created,
+      opponent_user.user_name                              AS opponent_user_name,
+      MAX(matches.created)                                 AS last_played,
+      COUNT(matches.match_id) FILTER (WHERE matches.user_win = true)   AS wins,
+      COUNT(matches.match_id) FILTER (WHERE matches.user_win = false)  AS losses
+    FROM
+      opponents
+    LEFT JOIN users opponent_user ON opponent_user.user_id = opponents.opponent_user_id
+    LEFT JOIN matches ON matches.opponent_id = opponents.opponent_id AND matches.deleted_at IS NULL
+    WHERE
+      opponents.user_id = $1
+    GROUP BY
+      opponents.opponent_id,
+      opponent_user.user_name
+    ORDER BY
+      opponents.opponent_alias
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  opponentViews := make([]*OpponentView, 0)
+  for rows.Next() {
+    opponentView := new(OpponentView)
+    err := rows.Scan(
+      &opponentView.OpponentID,
+      &opponentView.UserID,
+      &opponentView.OpponentUserID,
+      &opponentView.OpponentAlias,
+      &opponentView.OpponentNotes,
+      &opponentView.Created,
+      &opponentView.OpponentUserName,
+      &opponentView.LastPlayed,
+      &opponentView.Wins,
+      &opponentView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    opponentView.calculateWinRate()
+    opponentViews = append(opponentViews, opponentView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return opponentViews, nil
+}
+
+
+// GetOpponentViewByOpponentID gets a given opponent along with the head-to-head record against them
+func (db *DB) GetOpponentViewByOpponentID(opponentID int64) (*OpponentView, error) {
+  sqlStatement := `
+    SELECT
+      opponents.opponent_id                                AS opponent_id,
+      opponents.user_id                                    AS user_id,
+      opponents.opponent_user_id                           AS opponent_user_id,
+      opponents.opponent_alias                             AS opponent_alias,
+      opponents.opponent_notes                             AS opponent_notes,
+      opponents.created                                    AS created,
+      opponent_user.user_name                              AS opponent_user_name,
+      MAX(matches.created)                                 AS last_played,
+      COUNT(matches.match_id) FILTER (WHERE matches.user_win = true)   AS wins,
+      COUNT(matches.match_id) FILTER (WHERE matches.user_win = false)  AS losses
+    FROM
+      opponents
+    LEFT JOIN users opponent_user ON opponent_user.user_id = opponents.opponent_user_id
+    LEFT JOIN matches ON matches.opponent_id = opponents.opponent_id AND matches.deleted_at IS NULL
+    WHERE
+      opponents.opponent_id = $1
+    GROUP BY
+      opponents.opponent_id,
+      opponent_user.user_name
+  `
+  row := db.QueryRow(sqlStatement, opponentID)
+
+  opponentView := new(OpponentView)
+  err := row.Scan(
+    &opponentView.OpponentID,
+    &opponentView.UserID,
+    &opponentView.OpponentUserID,
+    &opponentView.OpponentAlias,
+    &opponentView.OpponentNotes,
+    &opponentView.Created,
+    &opponentView.OpponentUserName,
+    &opponentView.LastPlayed,
+    &opponentView.Wins,
+    &opponentView.Losses,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  opponentView.calculateWinRate()
+
+  return opponentView, nil
+}
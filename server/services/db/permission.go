@@ -0,0 +1,112 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// PermissionManager describes all of the methods used to interact
+// with the permissions and role_permissions tables in our database
+type PermissionManager interface {
+  GetAllPermissions() ([]*Permission, error)
+  GetPermissionNamesByUserID(userID int64) ([]string, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Permission describes a named right that roles can grant (i.e. "tags:manage")
+type Permission struct {
+  PermissionID           int64           `json:"permissionId"`
+  PermissionName         string          `json:"permissionName"`
+  PermissionDescription  NullStringJSON  `json:"permissionDescription"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAllPermissions gets all of the permissions we have in our database
+func (db *DB) GetAllPermissions() ([]*Permission, error) {
+  sqlStatement := `
+    SELECT
+      permission_id,
+      permission_name,
+      permission_description
+    FROM
+      permissions
+    ORDER BY
+      permission_name
+  `
+  rows, err := db.Query(sqlStatement)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  permissions := make([]*Permission, 0)
+  for rows.Next() {
+    permission := new(Permission)
+    err := rows.Scan(
+      &permission.PermissionID,
+      &permission.PermissionName,
+      &permission.PermissionDescription,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    permissions = append(permissions, permission)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return permissions, nil
+}
+
+
+// GetPermissionNamesByUserID gets the names of every permission
+// granted to a given user through any of their roles
+func (db *DB) GetPermissionNamesByUserID(userID int64) ([]string, error) {
+  sqlStatement := `
+    SELECT DISTINCT
+      permissions.permission_name  AS  permission_name
+    FROM
+      user_roles
+    INNER JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+    INNER JOIN permissions ON permissions.permission_id = role_permissions.permission_id
+    WHERE
+      user_roles.user_id = $1
+    ORDER BY
+      permissions.permission_name
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  permissionNames := make([]string, 0)
+  for rows.Next() {
+    var permissionName string
+    err := rows.Scan(&permissionName)
+    if err != nil {
+      return nil, err
+    }
+
+    permissionNames = append(permissionNames, permissionName)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return permissionNames, nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// PublicProfileViewManager describes all of the methods used to interact with
+// public profile views in our database (data joined between users, characters, and matches)
+type PublicProfileViewManager interface {
+  GetPublicProfileViewByUserName(userName string) (*PublicProfileView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// PublicProfileView describes everything we're willing to show about a user
+// to anyone who isn't logged in; notably, it never includes their email address
+type PublicProfileView struct {
+  // Data from users
+  UserID                   int64           `json:"userId"`
+  UserName                 string          `json:"userName"`
+  Created                  time.Time       `json:"created"`
+
+  // Data from characters
+  DefaultCharacterID       NullInt64JSON   `json:"defaultCharacterId"`
+  DefaultCharacterName     NullStringJSON  `json:"defaultCharacterName"`
+
+  // Data from user_characters
+  DefaultUserCharacterGsp  NullInt64JSON   `json:"defaultUserCharacterGsp"`
+
+  // Data from matches
+  NumMatches               int64           `json:"numMatches"`
+  WinRecord
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetPublicProfileViewByUserName gets a user's public profile along with their overall record; user names are
+// unique regardless of case. Users who haven't opted into a public profile (or are disabled or deleted) are
+// treated as if they don't exist
+func (db *DB) GetPublicProfileViewByUserName(userName string) (*PublicProfileView, error) {
+  sqlStatement := `
+    SELECT
+      users.user_id                  AS  user_id,
+      users.user_name                AS  user_name,
+      users.created                  AS  created,
+      characters.character_id        AS  default_character_id,
+      characters.character_name      AS  default_character_name,
+      user_characters.character_gsp  AS  default_character_gsp,
+      (
+        SELECT COUNT(*) FROM matches WHERE matches.user_id = users.user_id AND matches.deleted_at IS NULL
+      )                              AS  num_matches,
+      (
+        SELECT COUNT(*) FROM matches WHERE matches.user_id = users.user_id AND matches.deleted_at IS NULL AND matches.user_win = true
+      )                              AS  wins,
+      (
+        SELECT COUNT(*) FROM matches WHERE matches.user_id = users.user_id AND matches.deleted_at IS NULL AND matches.user_win = false
+      )                              AS  losses
+    FROM
+      users
+    LEFT JOIN user_characters ON user_characters.user_character_id = users.default_user_character_id
+    LEFT JOIN characters ON characters.character_id = user_characters.character_id
+    WHERE
+      LOWER(users.user_name) = LOWER($1)
+      AND users.public_profile = true
+      AND users.disabled = false
+      AND users.deleted_at IS NULL
+  `
+  row := db.QueryRow(sqlStatement, userName)
+  publicProfileView := new(PublicProfileView)
+  err := row.Scan(
+    &publicProfileView.UserID,
+    &publicProfileView.UserName,
+    &publicProfileView.Created,
+    &publicProfileView.DefaultCharacterID,
+    &publicProfileView.DefaultCharacterName,
+    &publicProfileView.DefaultUserCharacterGsp,
+    &publicProfileView.NumMatches,
+    &publicProfileView.Wins,
+    &publicProfileView.Losses,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  publicProfileView.calculateWinRate()
+
+  return publicProfileView, nil
+}
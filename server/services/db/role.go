@@ -0,0 +1,183 @@
+package db
+
+import (
+  "github.com/lib/pq"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// RoleManager describes all of the methods used to interact
+// with the roles and user_roles tables in our database
+type RoleManager interface {
+  GetAllRoles() ([]*Role, error)
+
+  CreateUserRole(userRoleCreate *UserRoleCreate) (int64, error)
+  DeleteUserRole(userRoleDelete *UserRoleDelete) (int64, error)
+  SetUserRoles(userRoleSet *UserRoleSet) error
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Role describes a role along with the names of the permissions it grants
+type Role struct {
+  RoleID           int64     `json:"roleId"`
+  RoleName         string    `json:"roleName"`
+  PermissionNames  []string  `json:"permissionNames"`
+}
+
+
+// UserRoleCreate describes the data needed
+// to give a user a role in our database
+type UserRoleCreate struct {
+  UserID  int64  `json:"userId"`
+  RoleID  int64  `json:"roleId"`
+}
+
+
+// UserRoleDelete describes the data needed
+// to take a role away from a user in our database
+type UserRoleDelete struct {
+  UserID  int64  `json:"userId"`
+  RoleID  int64  `json:"roleId"`
+}
+
+
+// UserRoleSet describes the data needed to replace
+// all of a user's roles with the given ones
+type UserRoleSet struct {
+  UserID   int64    `json:"userId"`
+  RoleIDs  []int64  `json:"roleIds"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAllRoles gets all of the roles we have in our database, along with their permissions
+func (db *DB) GetAllRoles() ([]*Role, error) {
+  sqlStatement := `
+    SELECT
+      roles.role_id                                                                                    AS  role_id,
+      roles.role_name                                                                                  AS  role_name,
+      ARRAY_REMOVE(ARRAY_AGG(permissions.permission_name ORDER BY permissions.permission_name), NULL)  AS  permission_names
+    FROM
+      roles
+    LEFT JOIN role_permissions ON role_permissions.role_id = roles.role_id
+    LEFT JOIN permissions ON permissions.permission_id = role_permissions.permission_id
+    GROUP BY
+      roles.role_id,
+      roles.role_name
+    ORDER BY
+      roles.role_id
+  `
+  rows, err := db.Query(sqlStatement)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  roles := make([]*Role, 0)
+  for rows.Next() {
+    role := new(Role)
+    permissionNames := make(pq.StringArray, 0)
+    err := rows.Scan(
+      &role.RoleID,
+      &role.RoleName,
+      &permissionNames,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    role.PermissionNames = []string(permissionNames)
+    roles = append(roles, role)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return roles, nil
+}
+
+
+// CreateUserRole gives a user a role; giving a user a role they already have does nothing
+func (db *DB) CreateUserRole(userRoleCreate *UserRoleCreate) (int64, error) {
+  sqlStatement := `
+    INSERT INTO user_roles
+      (user_id, role_id)
+    VALUES
+      ($1, $2)
+    ON CONFLICT (user_id, role_id) DO UPDATE SET
+      role_id = EXCLUDED.role_id
+    RETURNING
+      user_role_id
+  `
+  row := db.QueryRow(sqlStatement, userRoleCreate.UserID, userRoleCreate.RoleID)
+
+  var userRoleID int64
+  err := row.Scan(&userRoleID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userRoleID, nil
+}
+
+
+// DeleteUserRole takes a role away from a user
+func (db *DB) DeleteUserRole(userRoleDelete *UserRoleDelete) (int64, error) {
+  sqlStatement := `
+    DELETE FROM
+      user_roles
+    WHERE
+      user_id = $1 AND role_id = $2
+    RETURNING
+      user_role_id
+  `
+  row := db.QueryRow(sqlStatement, userRoleDelete.UserID, userRoleDelete.RoleID)
+
+  var deletedUserRoleID int64
+  err := row.Scan(&deletedUserRoleID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedUserRoleID, nil
+}
+
+
+// SetUserRoles replaces all of a user's roles with the given ones
+func (db *DB) SetUserRoles(userRoleSet *UserRoleSet) error {
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  _, err = tx.Exec("DELETE FROM user_roles WHERE user_id = $1", userRoleSet.UserID)
+  if err != nil {
+    return err
+  }
+
+  if len(userRoleSet.RoleIDs) > 0 {
+    _, err = tx.Exec(
+      "INSERT INTO user_roles (user_id, role_id) SELECT $1, UNNEST($2::INTEGER[]) ON CONFLICT DO NOTHING",
+      userRoleSet.UserID,
+      pq.Array(userRoleSet.RoleIDs),
+    )
+    if err != nil {
+      return err
+    }
+  }
+
+  return tx.Commit()
+}
@@ -0,0 +1,576 @@
+package db
+
+import (
+  "database/sql"
+  "encoding/json"
+  "os"
+  "sort"
+
+  "github.com/lib/pq"
+)
+
+
+// DefaultRosterManifestPath is where our bundled roster manifest lives, relative to the repo root
+const DefaultRosterManifestPath = "server/services/db/roster/roster.json"
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// RosterManager describes all of the methods used to keep the
+// characters table in sync with our bundled roster manifest
+type RosterManager interface {
+  SyncRoster(rosterManifest *RosterManifest, dryRun bool) (*RosterDiff, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// RosterManifest describes a versioned list of every character in the game
+type RosterManifest struct {
+  RosterVersion  string                      `json:"rosterVersion"`
+  Characters     []*RosterManifestCharacter  `json:"characters"`
+}
+
+
+// RosterManifestCharacter describes a single character entry in the roster manifest;
+// character IDs are fixed in the manifest so that they match across every database
+type RosterManifestCharacter struct {
+  CharacterID              int64     `json:"characterId"`
+  CharacterName            string    `json:"characterName"`
+  CharacterSeries          []string  `json:"characterSeries"`
+  CharacterArchetypes      []string  `json:"characterArchetypes"`
+  CharacterDlc             bool      `json:"characterDlc"`
+  CharacterReleaseVersion  string    `json:"characterReleaseVersion"`
+  CharacterStockImg        string    `json:"characterStockImg"`
+  CharacterImg             string    `json:"characterImg"`
+}
+
+
+// RosterCharacterChange describes how an existing character was changed by a roster sync
+type RosterCharacterChange struct {
+  Before         *Character  `json:"before"`
+  After          *Character  `json:"after"`
+  ChangedFields  []string    `json:"changedFields"`
+}
+
+
+// RosterDiff describes everything a roster sync changed (or would change, for a dry run)
+type RosterDiff struct {
+  RosterVersion     string                    `json:"rosterVersion"`
+  PreviousVersion   NullStringJSON            `json:"previousVersion"`
+  DryRun            bool                      `json:"dryRun"`
+  Added             []*Character              `json:"added"`
+  Updated           []*RosterCharacterChange  `json:"updated"`
+  NumUnchanged      int                       `json:"numUnchanged"`
+  // Characters in the database that the manifest doesn't know about; we never delete these
+  Unmanaged         []*Character              `json:"unmanaged"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// LoadRosterManifest reads and parses a roster manifest from a given file path
+func LoadRosterManifest(manifestPath string) (*RosterManifest, error) {
+  manifestFile, err := os.Open(manifestPath)
+  if err != nil {
+    return nil, err
+  }
+  defer manifestFile.Close()
+
+  rosterManifest := new(RosterManifest)
+  err = json.NewDecoder(manifestFile).Decode(rosterManifest)
+  if err != nil {
+    return nil, err
+  }
+
+  return rosterManifest, nil
+}
+
+
+// SyncRoster upserts every character in the roster manifest into the characters table in a
+// single transaction. Characters that already match the manifest are left alone, so running
+// the same manifest twice is a no-op; a dry run reports the diff and rolls everything back
+func (db *DB) SyncRoster(rosterManifest *RosterManifest, dryRun bool) (*RosterDiff, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return nil, err
+  }
+  defer tx.Rollback()
+
+  rosterDiff := new(RosterDiff)
+  rosterDiff.RosterVersion = rosterManifest.RosterVersion
+  rosterDiff.DryRun = dryRun
+  rosterDiff.Added = make([]*Character, 0)
+  rosterDiff.Updated = make([]*RosterCharacterChange, 0)
+  rosterDiff.Unmanaged = make([]*Character, 0)
+
+  err = tx.QueryRow(`
+    SELECT
+      roster_version
+    FROM
+      roster_syncs
+    ORDER BY
+      roster_sync_id DESC
+    LIMIT 1
+  `).Scan(&rosterDiff.PreviousVersion)
+  if err != nil && err != sql.ErrNoRows {
+    return nil, err
+  }
+
+  existingCharacters, err := getAllCharactersForUpdate(tx)
+  if err != nil {
+    return nil, err
+  }
+
+  manifestCharacterIDs := make(map[int64]bool)
+  for _, manifestCharacter := range rosterManifest.Characters {
+    manifestCharacterIDs[manifestCharacter.CharacterID] = true
+    character := manifestCharacter.toCharacter()
+
+    existingCharacter, exists := existingCharacters[character.CharacterID]
+    if !exists {
+      err = insertRosterCharacter(tx, character)
+      if err != nil {
+        return nil, err
+      }
+      err = setRosterCharacterLinks(tx, character)
+      if err != nil {
+        return nil, err
+      }
+      rosterDiff.Added = append(rosterDiff.Added, character)
+      continue
+    }
+
+    changedFields := diffCharacters(existingCharacter, character)
+    if len(changedFields) == 0 {
+      rosterDiff.NumUnchanged++
+      continue
+    }
+
+    err = updateRosterCharacter(tx, character)
+    if err != nil {
+      return nil, err
+    }
+    err = setRosterCharacterLinks(tx, character)
+    if err != nil {
+      return nil, err
+    }
+    rosterDiff.Updated = append(rosterDiff.Updated, &RosterCharacterChange{
+      Before:         existingCharacter,
+      After:          character,
+      ChangedFields:  changedFields,
+    })
+  }
+
+  for characterID, existingCharacter := range existingCharacters {
+    if !manifestCharacterIDs[characterID] {
+      rosterDiff.Unmanaged = append(rosterDiff.Unmanaged, existingCharacter)
+    }
+  }
+  sort.Slice(rosterDiff.Unmanaged, func(i, j int) bool {
+    return rosterDiff.Unmanaged[i].CharacterID < rosterDiff.Unmanaged[j].CharacterID
+  })
+
+  // We insert with explicit IDs, so make sure the serial picks up after the roster
+  _, err = tx.Exec(`SELECT setval('characters_character_id_seq', (SELECT MAX(character_id) FROM characters))`)
+  if err != nil {
+    return nil, err
+  }
+
+  // Only record the sync if it actually did something, so re-running a manifest leaves no trace
+  hasChanges := len(rosterDiff.Added) > 0 || len(rosterDiff.Updated) > 0
+  isNewVersion := !rosterDiff.PreviousVersion.Valid || rosterDiff.PreviousVersion.String != rosterDiff.RosterVersion
+  if hasChanges || isNewVersion {
+    _, err = tx.Exec(
+      `INSERT INTO roster_syncs (roster_version, num_added, num_updated) VALUES ($1, $2, $3)`,
+      rosterDiff.RosterVersion,
+      len(rosterDiff.Added),
+      len(rosterDiff.Updated),
+    )
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  if dryRun {
+    return rosterDiff, nil
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return nil, err
+  }
+
+  return rosterDiff, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// toCharacter converts a manifest entry into the Character we expect to have in the database
+func (rc *RosterManifestCharacter) toCharacter() *Character {
+  character := new(Character)
+  character.CharacterID = rc.CharacterID
+  character.CharacterName = rc.CharacterName
+  character.CharacterStockImg = makeNullStringJSON(rc.CharacterStockImg)
+  character.CharacterImg = makeNullStringJSON(rc.CharacterImg)
+  character.CharacterDlc = rc.CharacterDlc
+  character.CharacterReleaseVersion = makeNullStringJSON(rc.CharacterReleaseVersion)
+
+  // IDs get filled in once the names are looked up in setRosterCharacterLinks
+  character.CharacterArchetypes = make([]*Archetype, 0)
+  for _, archetypeName := range sortedUniqueNames(rc.CharacterArchetypes) {
+    character.CharacterArchetypes = append(character.CharacterArchetypes, &Archetype{ArchetypeName: archetypeName})
+  }
+  character.CharacterSeries = make([]*Series, 0)
+  for _, seriesName := range sortedUniqueNames(rc.CharacterSeries) {
+    character.CharacterSeries = append(character.CharacterSeries, &Series{SeriesName: seriesName})
+  }
+
+  return character
+}
+
+
+// makeNullStringJSON treats empty strings from the manifest as NULL
+func makeNullStringJSON(str string) NullStringJSON {
+  nullStr := NullStringJSON{}
+  nullStr.String = str
+  nullStr.Valid = str != ""
+
+  return nullStr
+}
+
+
+// sortedUniqueNames sorts a list of names and drops any empty or repeated ones
+func sortedUniqueNames(names []string) []string {
+  uniqueNames := make([]string, 0)
+  seenNames := make(map[string]bool)
+  for _, name := range names {
+    if name == "" || seenNames[name] {
+      continue
+    }
+    seenNames[name] = true
+    uniqueNames = append(uniqueNames, name)
+  }
+  sort.Strings(uniqueNames)
+
+  return uniqueNames
+}
+
+
+// diffCharacters lists the names of the fields that differ between two characters
+func diffCharacters(before *Character, after *Character) []string {
+  changedFields := make([]string, 0)
+
+  if before.CharacterName != after.CharacterName {
+    changedFields = append(changedFields, "characterName")
+  }
+  if before.CharacterStockImg.NullString != after.CharacterStockImg.NullString {
+    changedFields = append(changedFields, "characterStockImg")
+  }
+  if before.CharacterImg.NullString != after.CharacterImg.NullString {
+    changedFields = append(changedFields, "characterImg")
+  }
+  if !equalNames(archetypeNames(before.CharacterArchetypes), archetypeNames(after.CharacterArchetypes)) {
+    changedFields = append(changedFields, "characterArchetypes")
+  }
+  if !equalNames(seriesNames(before.CharacterSeries), seriesNames(after.CharacterSeries)) {
+    changedFields = append(changedFields, "characterSeries")
+  }
+  if before.CharacterDlc != after.CharacterDlc {
+    changedFields = append(changedFields, "characterDlc")
+  }
+  if before.CharacterReleaseVersion.NullString != after.CharacterReleaseVersion.NullString {
+    changedFields = append(changedFields, "characterReleaseVersion")
+  }
+
+  return changedFields
+}
+
+
+// archetypeNames lists the names of the given archetypes
+func archetypeNames(archetypes []*Archetype) []string {
+  names := make([]string, 0)
+  for _, archetype := range archetypes {
+    names = append(names, archetype.ArchetypeName)
+  }
+
+  return names
+}
+
+
+// seriesNames lists the names of the given series
+func seriesNames(allSeries []*Series) []string {
+  names := make([]string, 0)
+  for _, series := range allSeries {
+    names = append(names, series.SeriesName)
+  }
+
+  return names
+}
+
+
+// equalNames checks if two sorted lists of names are the same
+func equalNames(a []string, b []string) bool {
+  if len(a) != len(b) {
+    return false
+  }
+  for i := range a {
+    if a[i] != b[i] {
+      return false
+    }
+  }
+
+  return true
+}
+
+
+// getAllCharactersForUpdate gets every character keyed by ID, locking the rows for the rest of the sync
+func getAllCharactersForUpdate(tx *sql.Tx) (map[int64]*Character, error) {
+  rows, err := tx.Query(`
+    SELECT
+      character_id,
+      character_name,
+      character_stock_img,
+      character_img,
+      character_dlc,
+      character_release_version
+    FROM
+      characters
+    FOR UPDATE
+  `)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  characters := make(map[int64]*Character)
+  for rows.Next() {
+    character := new(Character)
+    err := rows.Scan(
+      &character.CharacterID,
+      &character.CharacterName,
+      &character.CharacterStockImg,
+      &character.CharacterImg,
+      &character.CharacterDlc,
+      &character.CharacterReleaseVersion,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    character.CharacterArchetypes = make([]*Archetype, 0)
+    character.CharacterSeries = make([]*Series, 0)
+    characters[character.CharacterID] = character
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  archetypeRows, err := tx.Query(`
+    SELECT
+      character_archetypes.character_id  AS  character_id,
+      archetypes.archetype_id            AS  archetype_id,
+      archetypes.archetype_name          AS  archetype_name
+    FROM
+      character_archetypes
+    INNER JOIN archetypes ON archetypes.archetype_id = character_archetypes.archetype_id
+    ORDER BY
+      archetypes.archetype_name
+  `)
+  if err != nil {
+    return nil, err
+  }
+  defer archetypeRows.Close()
+
+  for archetypeRows.Next() {
+    var characterID int64
+    archetype := new(Archetype)
+    err := archetypeRows.Scan(&characterID, &archetype.ArchetypeID, &archetype.ArchetypeName)
+    if err != nil {
+      return nil, err
+    }
+
+    character := characters[characterID]
+    character.CharacterArchetypes = append(character.CharacterArchetypes, archetype)
+  }
+  err = archetypeRows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  seriesRows, err := tx.Query(`
+    SELECT
+      character_series.character_id  AS  character_id,
+      series.series_id               AS  series_id,
+      series.series_name             AS  series_name
+    FROM
+      character_series
+    INNER JOIN series ON series.series_id = character_series.series_id
+    ORDER BY
+      series.series_name
+  `)
+  if err != nil {
+    return nil, err
+  }
+  defer seriesRows.Close()
+
+  for seriesRows.Next() {
+    var characterID int64
+    series := new(Series)
+    err := seriesRows.Scan(&characterID, &series.SeriesID, &series.SeriesName)
+    if err != nil {
+      return nil, err
+    }
+
+    character := characters[characterID]
+    character.CharacterSeries = append(character.CharacterSeries, series)
+  }
+  err = seriesRows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return characters, nil
+}
+
+
+// insertRosterCharacter adds a new character from the manifest along with its default costumes
+func insertRosterCharacter(tx *sql.Tx, character *Character) error {
+  _, err := tx.Exec(`
+    INSERT INTO characters (
+      character_id,
+      character_name,
+      character_stock_img,
+      character_img,
+      character_dlc,
+      character_release_version
+    )
+    VALUES ($1, $2, $3, $4, $5, $6)
+  `,
+    character.CharacterID,
+    character.CharacterName,
+    character.CharacterStockImg,
+    character.CharacterImg,
+    character.CharacterDlc,
+    character.CharacterReleaseVersion,
+  )
+  if err != nil {
+    return err
+  }
+
+  if !character.CharacterStockImg.Valid {
+    return nil
+  }
+
+  characterCostumesCreate := MakeDefaultCharacterCostumes(character.CharacterID, character.CharacterStockImg.String)
+  columns := []string{"character_id", "costume_index", "costume_name", "costume_img"}
+  sqlStatement := MakeMultiInsertStatement("character_costumes", columns, len(characterCostumesCreate), "character_costume_id")
+  _, err = tx.Exec(sqlStatement, expandCharacterCostumesCreate(characterCostumesCreate)...)
+
+  return err
+}
+
+
+// updateRosterCharacter overwrites an existing character with its manifest entry
+func updateRosterCharacter(tx *sql.Tx, character *Character) error {
+  _, err := tx.Exec(`
+    UPDATE
+      characters
+    SET
+      character_name = $1,
+      character_stock_img = $2,
+      character_img = $3,
+      character_dlc = $4,
+      character_release_version = $5
+    WHERE
+      character_id = $6
+  `,
+    character.CharacterName,
+    character.CharacterStockImg,
+    character.CharacterImg,
+    character.CharacterDlc,
+    character.CharacterReleaseVersion,
+    character.CharacterID,
+  )
+
+  return err
+}
+
+
+// setRosterCharacterLinks replaces a character's archetypes and series with the ones named in the
+// manifest, creating any archetypes or series we haven't seen before. Fills in their IDs as well
+func setRosterCharacterLinks(tx *sql.Tx, character *Character) error {
+  archetypeIDsByName, err := upsertNames(tx, "archetypes", "archetype_id", "archetype_name", archetypeNames(character.CharacterArchetypes))
+  if err != nil {
+    return err
+  }
+  archetypeIDs := make([]int64, 0)
+  for _, archetype := range character.CharacterArchetypes {
+    archetype.ArchetypeID = archetypeIDsByName[archetype.ArchetypeName]
+    archetypeIDs = append(archetypeIDs, archetype.ArchetypeID)
+  }
+  err = setCharacterLinks(tx, "character_archetypes", "archetype_id", character.CharacterID, archetypeIDs)
+  if err != nil {
+    return err
+  }
+
+  seriesIDsByName, err := upsertNames(tx, "series", "series_id", "series_name", seriesNames(character.CharacterSeries))
+  if err != nil {
+    return err
+  }
+  seriesIDs := make([]int64, 0)
+  for _, series := range character.CharacterSeries {
+    series.SeriesID = seriesIDsByName[series.SeriesName]
+    seriesIDs = append(seriesIDs, series.SeriesID)
+  }
+
+  return setCharacterLinks(tx, "character_series", "series_id", character.CharacterID, seriesIDs)
+}
+
+
+// upsertNames makes sure every given name exists in a lookup table (i.e. archetypes)
+// and returns the IDs of all of them keyed by name
+func upsertNames(tx *sql.Tx, table string, idColumn string, nameColumn string, names []string) (map[string]int64, error) {
+  idsByName := make(map[string]int64)
+  if len(names) == 0 {
+    return idsByName, nil
+  }
+
+  _, err := tx.Exec(
+    "INSERT INTO "+table+" ("+nameColumn+") SELECT UNNEST($1::VARCHAR[]) ON CONFLICT ("+nameColumn+") DO NOTHING",
+    pq.Array(names),
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  rows, err := tx.Query("SELECT "+idColumn+", "+nameColumn+" FROM "+table+" WHERE "+nameColumn+" = ANY($1)", pq.Array(names))
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    var id int64
+    var name string
+    err := rows.Scan(&id, &name)
+    if err != nil {
+      return nil, err
+    }
+
+    idsByName[name] = id
+  }
+
+  return idsByName, rows.Err()
+}
@@ -0,0 +1,201 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// SeriesManager describes all of the methods used
+// to interact with the series table in our database
+type SeriesManager interface {
+  GetAllSeries() ([]*Series, error)
+  GetSeriesBySeriesID(seriesID int64) (*Series, error)
+
+  CreateSeries(seriesCreate *SeriesCreate) (*Series, error)
+  UpdateSeries(seriesUpdate *SeriesUpdate) (*Series, error)
+  DeleteSeriesBySeriesID(seriesID int64) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Series describes a game franchise a character comes from (i.e. "Fire Emblem")
+type Series struct {
+  SeriesID    int64   `json:"seriesId"`
+  SeriesName  string  `json:"seriesName"`
+}
+
+
+// SeriesCreate describes the data needed
+// to create a given series in our db
+type SeriesCreate struct {
+  SeriesName  string  `json:"seriesName"`
+}
+
+
+// SeriesUpdate describes the data needed
+// to update a given series in our db
+type SeriesUpdate struct {
+  SeriesID    int64   `json:"seriesId"`
+  SeriesName  string  `json:"seriesName"`
+}
+
+
+// SeriesDelete describes the data needed
+// to delete a given series in our db
+type SeriesDelete struct {
+  SeriesID  int64  `json:"seriesId"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAllSeries gets all of the series we have in our database
+func (db *DB) GetAllSeries() ([]*Series, error) {
+  sqlStatement := `
+    SELECT
+      series_id,
+      series_name
+    FROM
+      series
+    ORDER BY
+      series_name
+  `
+  rows, err := db.Query(sqlStatement)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  allSeries := make([]*Series, 0)
+  for rows.Next() {
+    series := new(Series)
+    err := rows.Scan(
+      &series.SeriesID,
+      &series.SeriesName,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    allSeries = append(allSeries, series)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return allSeries, nil
+}
+
+
+// GetSeriesBySeriesID gets a specific series given its ID
+func (db *DB) GetSeriesBySeriesID(seriesID int64) (*Series, error) {
+  sqlStatement := `
+    SELECT
+      series_id,
+      series_name
+    FROM
+      series
+    WHERE
+      series_id = $1
+  `
+  row := db.QueryRow(sqlStatement, seriesID)
+
+  series := new(Series)
+  err := row.Scan(
+    &series.SeriesID,
+    &series.SeriesName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return series, nil
+}
+
+
+// CreateSeries adds a new entry to the series table
+func (db *DB) CreateSeries(seriesCreate *SeriesCreate) (*Series, error) {
+  sqlStatement := `
+    INSERT INTO series
+      (series_name)
+    VALUES
+      ($1)
+    RETURNING
+      series_id,
+      series_name
+  `
+  row := db.QueryRow(sqlStatement, seriesCreate.SeriesName)
+
+  series := new(Series)
+  err := row.Scan(
+    &series.SeriesID,
+    &series.SeriesName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return series, nil
+}
+
+
+// UpdateSeries updates an existing entry in the series table
+func (db *DB) UpdateSeries(seriesUpdate *SeriesUpdate) (*Series, error) {
+  sqlStatement := `
+    UPDATE
+      series
+    SET
+      series_name = $1
+    WHERE
+      series_id = $2
+    RETURNING
+      series_id,
+      series_name
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    seriesUpdate.SeriesName,
+    seriesUpdate.SeriesID,
+  )
+
+  series := new(Series)
+  err := row.Scan(
+    &series.SeriesID,
+    &series.SeriesName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return series, nil
+}
+
+
+// DeleteSeriesBySeriesID deletes an existing entry in the series
+// table; any links to characters are removed along with it
+func (db *DB) DeleteSeriesBySeriesID(seriesID int64) (int64, error) {
+  var deletedSeriesID int64
+  sqlStatement := `
+    DELETE FROM
+      series
+    WHERE
+      series_id = $1
+    RETURNING
+      series_id
+  `
+  row := db.QueryRow(sqlStatement, seriesID)
+
+  err := row.Scan(&deletedSeriesID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedSeriesID, nil
+}
@@ -0,0 +1,209 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// ShareLinkManager describes all of the methods used
+// to interact with the share_links table in our database
+type ShareLinkManager interface {
+  GetShareLinksByUserID(userID int64) ([]*ShareLink, error)
+  GetShareLinkByHashedToken(hashedToken string) (*ShareLink, error)
+
+  CreateShareLink(shareLinkCreate *ShareLinkCreate) (int64, error)
+  RevokeShareLink(shareLinkRevoke *ShareLinkRevoke) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// ShareLink describes an unlisted link to one of a user's filtered match lists; the
+// filters mean the same thing they do for match/getall. The token itself is never stored
+type ShareLink struct {
+  ShareLinkID  int64          `json:"shareLinkId"`
+  UserID       int64          `json:"userId"`
+  ArchetypeID  NullInt64JSON  `json:"archetypeId"`
+  SeriesID     NullInt64JSON  `json:"seriesId"`
+  TagID        NullInt64JSON  `json:"tagId"`
+  Created      time.Time      `json:"created"`
+  RevokedAt    NullTimeJSON   `json:"revokedAt"`
+}
+
+
+// ShareLinkCreate describes the data needed
+// to create a new share link in our db
+type ShareLinkCreate struct {
+  UserID       int64          `json:"userId"`
+  HashedToken  string         `json:"-"`
+  ArchetypeID  NullInt64JSON  `json:"archetypeId"`
+  SeriesID     NullInt64JSON  `json:"seriesId"`
+  TagID        NullInt64JSON  `json:"tagId"`
+}
+
+
+// ShareLinkRevoke describes the data needed to revoke
+// a share link; users can only revoke their own links
+type ShareLinkRevoke struct {
+  ShareLinkID  int64  `json:"shareLinkId"`
+  UserID       int64  `json:"-"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetShareLinksByUserID gets every share link a user has made, including revoked ones
+func (db *DB) GetShareLinksByUserID(userID int64) ([]*ShareLink, error) {
+  sqlStatement := `
+    SELECT
+      share_link_id,
+      user_id,
+      archetype_id,
+      series_id,
+      tag_id,
+      created,
+      revoked_at
+    FROM
+      share_links
+    WHERE
+      user_id = $1
+    ORDER BY
+      created DESC
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  shareLinks := make([]*ShareLink, 0)
+  for rows.Next() {
+    shareLink, err := scanShareLink(rows)
+    if err != nil {
+      return nil, err
+    }
+
+    shareLinks = append(shareLinks, shareLink)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return shareLinks, nil
+}
+
+
+// GetShareLinkByHashedToken gets the share link with the given token hash, but only if it
+// hasn't been revoked and its user is still active. Returns sql.ErrNoRows otherwise
+func (db *DB) GetShareLinkByHashedToken(hashedToken string) (*ShareLink, error) {
+  sqlStatement := `
+    SELECT
+      share_links.share_link_id,
+      share_links.user_id,
+      share_links.archetype_id,
+      share_links.series_id,
+      share_links.tag_id,
+      share_links.created,
+      share_links.revoked_at
+    FROM
+      share_links
+    INNER JOIN users ON users.user_id = share_links.user_id
+    WHERE
+      share_links.hashed_token = $1
+      AND share_links.revoked_at IS NULL
+      AND users.disabled = false
+      AND users.deleted_at IS NULL
+  `
+  row := db.QueryRow(sqlStatement, hashedToken)
+
+  return scanShareLink(row)
+}
+
+
+// CreateShareLink adds a new entry to the share_links table in our database
+func (db *DB) CreateShareLink(shareLinkCreate *ShareLinkCreate) (int64, error) {
+  var shareLinkID int64
+  sqlStatement := `
+    INSERT INTO share_links
+      (user_id, hashed_token, archetype_id, series_id, tag_id)
+    VALUES
+      ($1, $2, $3, $4, $5)
+    RETURNING
+      share_link_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    shareLinkCreate.UserID,
+    shareLinkCreate.HashedToken,
+    shareLinkCreate.ArchetypeID,
+    shareLinkCreate.SeriesID,
+    shareLinkCreate.TagID,
+  )
+
+  err := row.Scan(&shareLinkID)
+  if err != nil {
+    return 0, err
+  }
+
+  return shareLinkID, nil
+}
+
+
+// RevokeShareLink stops a share link from working; revoked links are kept so their
+// user can still see them. Returns sql.ErrNoRows if the link isn't the user's
+func (db *DB) RevokeShareLink(shareLinkRevoke *ShareLinkRevoke) (int64, error) {
+  var shareLinkID int64
+  sqlStatement := `
+    UPDATE
+      share_links
+    SET
+      revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+    WHERE
+      share_link_id = $1
+      AND user_id = $2
+    RETURNING
+      share_link_id
+  `
+  row := db.QueryRow(sqlStatement, shareLinkRevoke.ShareLinkID, shareLinkRevoke.UserID)
+
+  err := row.Scan(&shareLinkID)
+  if err != nil {
+    return 0, err
+  }
+
+  return shareLinkID, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// scanShareLink scans a single row from the share_links table into a ShareLink
+func scanShareLink(row rowScanner) (*ShareLink, error) {
+  shareLink := new(ShareLink)
+  err := row.Scan(
+    &shareLink.ShareLinkID,
+    &shareLink.UserID,
+    &shareLink.ArchetypeID,
+    &shareLink.SeriesID,
+    &shareLink.TagID,
+    &shareLink.Created,
+    &shareLink.RevokedAt,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return shareLink, nil
+}
@@ -0,0 +1,23 @@
+-- Create the api_tokens table; each token is a personal access token a user makes for their
+-- own scripts and bots, sent as an "Authorization: Bearer" header instead of the auth cookies.
+-- Only a hash of the token is stored. Tokens without an expires_at never expire
+DROP TABLE IF EXISTS "api_tokens";
+
+CREATE TABLE "api_tokens" (
+  "api_token_id" SERIAL NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "token_name" VARCHAR(100) NOT NULL,
+  "hashed_token" VARCHAR(64) NOT NULL,
+  "scopes" TEXT[] NOT NULL DEFAULT '{}',
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "expires_at" TIMESTAMP,
+  "last_used" TIMESTAMP,
+  "revoked_at" TIMESTAMP,
+  PRIMARY KEY ("api_token_id"),
+  UNIQUE ("hashed_token")
+);
+
+
+ALTER TABLE "api_tokens" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+
+CREATE INDEX "api_tokens_user_id_idx" ON "api_tokens" ("user_id");
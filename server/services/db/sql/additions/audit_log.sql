@@ -0,0 +1,35 @@
+-- First create the audit_log table; every data-changing request writes a row
+-- here with the state of what it changed before and after
+DROP TABLE IF EXISTS "audit_log";
+
+CREATE TABLE "audit_log" (
+  "audit_log_id" SERIAL NOT NULL,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "actor_user_id" INTEGER,
+  "action" VARCHAR(50) NOT NULL,
+  "entity_type" VARCHAR(50) NOT NULL,
+  "entity_id" INTEGER,
+  "before_data" JSONB,
+  "after_data" JSONB,
+  "request_id" VARCHAR(100) NOT NULL,
+  PRIMARY KEY ("audit_log_id")
+);
+
+
+-- Keep the log around even after the user who made the change is deleted
+ALTER TABLE "audit_log" ADD FOREIGN KEY ("actor_user_id") REFERENCES "users" ("user_id") ON DELETE SET NULL;
+
+
+-- Indexes for the filters admins search the log by
+CREATE INDEX ON "audit_log" ("actor_user_id", "created");
+CREATE INDEX ON "audit_log" ("entity_type", "entity_id", "created");
+CREATE INDEX ON "audit_log" ("created");
+
+
+-- Reading the audit log gets its own permission, which only admins have
+INSERT INTO "permissions" ("permission_name", "permission_description") VALUES
+('audit:view', 'Search the audit log of data-changing actions');
+
+INSERT INTO "role_permissions" ("role_id", "permission_id")
+SELECT "roles"."role_id", "permissions"."permission_id" FROM "roles" CROSS JOIN "permissions"
+WHERE "roles"."role_name" = 'Admin' AND "permissions"."permission_name" = 'audit:view';
@@ -0,0 +1,70 @@
+-- First create the archetypes and series lookup tables
+DROP TABLE IF EXISTS "archetypes";
+
+CREATE TABLE "archetypes" (
+  "archetype_id" SERIAL NOT NULL,
+  "archetype_name" VARCHAR(100) NOT NULL UNIQUE,
+  PRIMARY KEY ("archetype_id")
+);
+
+
+DROP TABLE IF EXISTS "series";
+
+CREATE TABLE "series" (
+  "series_id" SERIAL NOT NULL,
+  "series_name" VARCHAR(100) NOT NULL UNIQUE,
+  PRIMARY KEY ("series_id")
+);
+
+
+-- Then create the many-to-many tables linking them to characters
+DROP TABLE IF EXISTS "character_archetypes";
+
+CREATE TABLE "character_archetypes" (
+  "character_archetype_id" SERIAL NOT NULL,
+  "character_id" INTEGER NOT NULL,
+  "archetype_id" INTEGER NOT NULL,
+  PRIMARY KEY ("character_archetype_id"),
+  UNIQUE ("character_id", "archetype_id")
+);
+
+
+DROP TABLE IF EXISTS "character_series";
+
+CREATE TABLE "character_series" (
+  "character_series_id" SERIAL NOT NULL,
+  "character_id" INTEGER NOT NULL,
+  "series_id" INTEGER NOT NULL,
+  PRIMARY KEY ("character_series_id"),
+  UNIQUE ("character_id", "series_id")
+);
+
+
+-- Add the foreign keys to the link tables
+ALTER TABLE "character_archetypes" ADD FOREIGN KEY ("character_id") REFERENCES "characters" ("character_id") ON DELETE CASCADE;
+ALTER TABLE "character_archetypes" ADD FOREIGN KEY ("archetype_id") REFERENCES "archetypes" ("archetype_id") ON DELETE CASCADE;
+ALTER TABLE "character_series" ADD FOREIGN KEY ("character_id") REFERENCES "characters" ("character_id") ON DELETE CASCADE;
+ALTER TABLE "character_series" ADD FOREIGN KEY ("series_id") REFERENCES "series" ("series_id") ON DELETE CASCADE;
+
+
+-- Populate the lookup tables and links from the old free text columns
+INSERT INTO "archetypes" ("archetype_name")
+SELECT DISTINCT "character_archetype" FROM "characters" WHERE "character_archetype" IS NOT NULL;
+
+INSERT INTO "character_archetypes" ("character_id", "archetype_id")
+SELECT "characters"."character_id", "archetypes"."archetype_id"
+FROM "characters"
+INNER JOIN "archetypes" ON "archetypes"."archetype_name" = "characters"."character_archetype";
+
+INSERT INTO "series" ("series_name")
+SELECT DISTINCT "character_series" FROM "characters" WHERE "character_series" IS NOT NULL;
+
+INSERT INTO "character_series" ("character_id", "series_id")
+SELECT "characters"."character_id", "series"."series_id"
+FROM "characters"
+INNER JOIN "series" ON "series"."series_name" = "characters"."character_series";
+
+
+-- Finally, drop the old columns
+ALTER TABLE "characters" DROP COLUMN "character_archetype";
+ALTER TABLE "characters" DROP COLUMN "character_series";
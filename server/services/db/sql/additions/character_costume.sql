@@ -0,0 +1,33 @@
+-- First create the character_costumes table; every character has 8 alt costumes,
+-- numbered 1 through 8 the same way user_characters.alt_costume is
+DROP TABLE IF EXISTS "character_costumes";
+
+CREATE TABLE "character_costumes" (
+  "character_costume_id" SERIAL NOT NULL,
+  "character_id" INTEGER NOT NULL,
+  "costume_index" INTEGER NOT NULL,
+  "costume_name" VARCHAR(100) NOT NULL,
+  "costume_img" VARCHAR(100) NOT NULL,
+  PRIMARY KEY ("character_costume_id"),
+  UNIQUE ("character_id", "costume_index")
+);
+
+
+-- Add foreign key constraints to "character_costumes"
+ALTER TABLE "character_costumes" ADD FOREIGN KEY ("character_id") REFERENCES "characters" ("character_id") ON DELETE CASCADE;
+
+
+-- Populate the costumes for our existing characters. Image paths are relative to /static/assets;
+-- the default costume uses the full art, and the rest use the numbered alt art
+INSERT INTO "character_costumes" ("character_id", "costume_index", "costume_name", "costume_img")
+SELECT
+  "characters"."character_id",
+  "costume"."costume_index",
+  CASE WHEN "costume"."costume_index" = 1 THEN 'Default' ELSE 'Alt ' || "costume"."costume_index" END,
+  CASE WHEN "costume"."costume_index" = 1
+    THEN 'full/' || "characters"."character_stock_img"
+    ELSE 'alt/' || REPLACE("characters"."character_stock_img", '.png', '') || '_' || "costume"."costume_index" || '.png'
+  END
+FROM "characters"
+CROSS JOIN generate_series(1, 8) AS "costume"("costume_index")
+WHERE "characters"."character_stock_img" IS NOT NULL;
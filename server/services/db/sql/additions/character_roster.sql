@@ -0,0 +1,17 @@
+-- Add the roster metadata we sync from the bundled roster manifest
+ALTER TABLE "characters" ADD COLUMN "character_series" VARCHAR(100);
+ALTER TABLE "characters" ADD COLUMN "character_dlc" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "characters" ADD COLUMN "character_release_version" VARCHAR(20);
+
+
+-- Then create the roster_syncs table, so we know which manifest version was last applied
+DROP TABLE IF EXISTS "roster_syncs";
+
+CREATE TABLE "roster_syncs" (
+  "roster_sync_id" SERIAL NOT NULL,
+  "roster_version" VARCHAR(20) NOT NULL,
+  "num_added" INTEGER NOT NULL DEFAULT 0,
+  "num_updated" INTEGER NOT NULL DEFAULT 0,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("roster_sync_id")
+);
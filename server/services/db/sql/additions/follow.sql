@@ -0,0 +1,44 @@
+-- Users can opt out of showing up in anyone's activity feed
+ALTER TABLE "users" ADD COLUMN "feed_opt_out" BOOLEAN NOT NULL DEFAULT false;
+
+
+-- Then create the follows table; a user following another sees their activity in their feed
+DROP TABLE IF EXISTS "follows";
+
+CREATE TABLE "follows" (
+  "follower_user_id" INTEGER NOT NULL,
+  "followed_user_id" INTEGER NOT NULL,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("follower_user_id", "followed_user_id"),
+  CHECK ("follower_user_id" <> "followed_user_id")
+);
+
+
+ALTER TABLE "follows" ADD FOREIGN KEY ("follower_user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+ALTER TABLE "follows" ADD FOREIGN KEY ("followed_user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+
+CREATE INDEX "follows_followed_user_id_idx" ON "follows" ("followed_user_id");
+
+
+-- Then create the gsp_history table; every time a saved character's GSP changes, so feeds can show it.
+-- old_gsp is null for a character's first GSP
+DROP TABLE IF EXISTS "gsp_history";
+
+CREATE TABLE "gsp_history" (
+  "gsp_history_id" SERIAL NOT NULL,
+  "user_character_id" INTEGER NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "character_id" INTEGER NOT NULL,
+  "old_gsp" INTEGER,
+  "new_gsp" INTEGER NOT NULL,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("gsp_history_id")
+);
+
+
+ALTER TABLE "gsp_history" ADD FOREIGN KEY ("user_character_id") REFERENCES "user_characters" ("user_character_id") ON DELETE CASCADE;
+ALTER TABLE "gsp_history" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+ALTER TABLE "gsp_history" ADD FOREIGN KEY ("character_id") REFERENCES "characters" ("character_id") ON DELETE CASCADE;
+
+CREATE INDEX "gsp_history_user_id_created_idx" ON "gsp_history" ("user_id", "created");
+CREATE INDEX "matches_user_id_created_idx" ON "matches" ("user_id", "created");
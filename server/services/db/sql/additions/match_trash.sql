@@ -0,0 +1,4 @@
+-- Deleting a match moves it to the trash first, so it can be restored until it's purged
+ALTER TABLE "matches" ADD COLUMN "deleted_at" TIMESTAMP;
+
+CREATE INDEX "matches_deleted_at_idx" ON "matches" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
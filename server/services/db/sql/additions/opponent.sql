@@ -0,0 +1,23 @@
+-- First create the opponents table; each user keeps their own list of opponents,
+-- optionally linked to the opponent's own smush account
+DROP TABLE IF EXISTS "opponents";
+
+CREATE TABLE "opponents" (
+  "opponent_id" SERIAL NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "opponent_user_id" INTEGER,
+  "opponent_alias" VARCHAR(100) NOT NULL,
+  "opponent_notes" TEXT,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("opponent_id")
+);
+
+
+-- Add foreign key constraints to "opponents"
+ALTER TABLE "opponents" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+ALTER TABLE "opponents" ADD FOREIGN KEY ("opponent_user_id") REFERENCES "users" ("user_id") ON DELETE SET NULL;
+
+
+-- Then add the optional opponent to matches; removing an opponent keeps its matches
+ALTER TABLE "matches" ADD COLUMN "opponent_id" INTEGER;
+ALTER TABLE "matches" ADD FOREIGN KEY ("opponent_id") REFERENCES "opponents" ("opponent_id") ON DELETE SET NULL;
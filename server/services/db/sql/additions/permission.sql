@@ -0,0 +1,59 @@
+-- First create the permissions table; permission names are checked for in code, so only add
+-- new permissions here alongside the code that uses them
+DROP TABLE IF EXISTS "permissions";
+
+CREATE TABLE "permissions" (
+  "permission_id" SERIAL NOT NULL,
+  "permission_name" VARCHAR(100) NOT NULL UNIQUE,
+  "permission_description" VARCHAR(255),
+  PRIMARY KEY ("permission_id")
+);
+
+
+INSERT INTO "permissions" ("permission_name", "permission_description") VALUES
+('characters:manage', 'Create and edit characters, costumes, archetypes and series'),
+('stages:manage', 'Create and edit stages'),
+('tags:manage', 'Create, edit, merge and delete global tags and tag categories'),
+('roles:manage', 'Assign roles to and remove roles from users');
+
+
+-- Then create the role_permissions table
+DROP TABLE IF EXISTS "role_permissions";
+
+CREATE TABLE "role_permissions" (
+  "role_permission_id" SERIAL NOT NULL,
+  "role_id" INTEGER NOT NULL,
+  "permission_id" INTEGER NOT NULL,
+  PRIMARY KEY ("role_permission_id"),
+  UNIQUE ("role_id", "permission_id")
+);
+
+
+-- Add foreign key constraints to "role_permissions"
+ALTER TABLE "role_permissions" ADD FOREIGN KEY ("role_id") REFERENCES "roles" ("role_id") ON DELETE CASCADE;
+ALTER TABLE "role_permissions" ADD FOREIGN KEY ("permission_id") REFERENCES "permissions" ("permission_id") ON DELETE CASCADE;
+
+
+-- Create our narrower roles
+INSERT INTO "roles" ("role_name") VALUES ('Roster Editor'), ('Tag Moderator');
+
+
+-- Admins get every permission, and the narrower roles get just what they need
+INSERT INTO "role_permissions" ("role_id", "permission_id")
+SELECT "roles"."role_id", "permissions"."permission_id" FROM "roles" CROSS JOIN "permissions" WHERE "roles"."role_name" = 'Admin';
+
+INSERT INTO "role_permissions" ("role_id", "permission_id")
+SELECT "roles"."role_id", "permissions"."permission_id" FROM "roles" INNER JOIN "permissions"
+ON ("roles"."role_name" = 'Roster Editor' AND "permissions"."permission_name" IN ('characters:manage', 'stages:manage'))
+OR ("roles"."role_name" = 'Tag Moderator' AND "permissions"."permission_name" = 'tags:manage');
+
+
+-- Finally, make sure a user can only have each role once
+DELETE FROM "user_roles" duplicate_user_roles
+USING "user_roles" original_user_roles
+WHERE duplicate_user_roles."user_id" = original_user_roles."user_id"
+  AND duplicate_user_roles."role_id" = original_user_roles."role_id"
+  AND duplicate_user_roles."user_role_id" > original_user_roles."user_role_id";
+
+ALTER TABLE "user_roles" ADD UNIQUE ("user_id", "role_id");
+ALTER TABLE "roles" ADD UNIQUE ("role_name");
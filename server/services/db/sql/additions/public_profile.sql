@@ -0,0 +1,44 @@
+-- Users can opt into a public, read only profile page
+ALTER TABLE "users" ADD COLUMN "public_profile" BOOLEAN NOT NULL DEFAULT false;
+
+
+-- Public profiles are found by user name, so no two users can share one (ignoring case).
+-- Anyone who already shares a name with an older account gets their user ID tacked on
+UPDATE "users" SET "user_name" = LEFT("user_name", 80) || '-' || "user_id"
+WHERE "user_id" IN (
+  SELECT "user_id" FROM (
+    SELECT "user_id", ROW_NUMBER() OVER (PARTITION BY LOWER("user_name") ORDER BY "user_id") AS "name_rank" FROM "users"
+  ) "ranked_users"
+  WHERE "name_rank" > 1
+);
+
+CREATE UNIQUE INDEX "users_user_name_lower_idx" ON "users" (LOWER("user_name"));
+
+
+-- Then create the share_links table; each link is an unlisted, revocable view of one of a
+-- user's filtered match lists. Only a hash of the link's token is stored
+DROP TABLE IF EXISTS "share_links";
+
+CREATE TABLE "share_links" (
+  "share_link_id" SERIAL NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "hashed_token" VARCHAR(64) NOT NULL,
+  "archetype_id" INTEGER,
+  "series_id" INTEGER,
+  "tag_id" INTEGER,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "revoked_at" TIMESTAMP,
+  PRIMARY KEY ("share_link_id"),
+  UNIQUE ("hashed_token")
+);
+
+
+ALTER TABLE "share_links" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+ALTER TABLE "share_links" ADD FOREIGN KEY ("archetype_id") REFERENCES "archetypes" ("archetype_id") ON DELETE CASCADE;
+ALTER TABLE "share_links" ADD FOREIGN KEY ("series_id") REFERENCES "series" ("series_id") ON DELETE CASCADE;
+
+-- A link filtered on a tag must never quietly become unfiltered, so deleting a tag revokes its links first
+-- (and merging tags moves them to the merged tag); the tag is only cleared on links that are already revoked
+ALTER TABLE "share_links" ADD FOREIGN KEY ("tag_id") REFERENCES "tags" ("tag_id") ON DELETE SET NULL;
+
+CREATE INDEX "share_links_user_id_idx" ON "share_links" ("user_id");
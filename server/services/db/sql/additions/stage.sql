@@ -0,0 +1,22 @@
+-- First create the stages table
+DROP TABLE IF EXISTS "stages";
+
+CREATE TABLE "stages" (
+  "stage_id" SERIAL NOT NULL,
+  "stage_name" VARCHAR(100) NOT NULL,
+  "stage_img" VARCHAR(100),
+  PRIMARY KEY ("stage_id")
+);
+
+
+-- Populate the stages table with the commonly played stages
+INSERT INTO "stages" ("stage_name", "stage_img") VALUES
+('Battlefield', 'battlefield.png'), ('Small Battlefield', 'small_battlefield.png'), ('Final Destination', 'final_destination.png'),
+('Pokemon Stadium 2', 'pokemon_stadium_2.png'), ('Smashville', 'smashville.png'), ('Town and City', 'town_and_city.png'),
+('Kalos Pokemon League', 'kalos_pokemon_league.png'), ('Lylat Cruise', 'lylat_cruise.png'), ('Yoshi''s Story', 'yoshis_story.png'),
+('Unova Pokemon League', 'unova_pokemon_league.png');
+
+
+-- Then add the optional stage to matches; removing a stage keeps its matches
+ALTER TABLE "matches" ADD COLUMN "stage_id" INTEGER;
+ALTER TABLE "matches" ADD FOREIGN KEY ("stage_id") REFERENCES "stages" ("stage_id") ON DELETE SET NULL;
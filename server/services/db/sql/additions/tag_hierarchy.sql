@@ -0,0 +1,22 @@
+-- First create the tag_categories table
+DROP TABLE IF EXISTS "tag_categories";
+
+CREATE TABLE "tag_categories" (
+  "tag_category_id" SERIAL NOT NULL,
+  "tag_category_name" VARCHAR(100) NOT NULL UNIQUE,
+  PRIMARY KEY ("tag_category_id")
+);
+
+
+-- Populate the tag_categories table with our starting categories
+INSERT INTO "tag_categories" ("tag_category_name") VALUES
+('Connection'), ('Opponent style'), ('Mistake');
+
+
+-- Then add the optional category and parent tag to tags; removing either keeps the tag,
+-- so removing a parent tag turns its children into top level tags
+ALTER TABLE "tags" ADD COLUMN "tag_category_id" INTEGER;
+ALTER TABLE "tags" ADD COLUMN "parent_tag_id" INTEGER;
+ALTER TABLE "tags" ADD CHECK ("parent_tag_id" <> "tag_id");
+ALTER TABLE "tags" ADD FOREIGN KEY ("tag_category_id") REFERENCES "tag_categories" ("tag_category_id") ON DELETE SET NULL;
+ALTER TABLE "tags" ADD FOREIGN KEY ("parent_tag_id") REFERENCES "tags" ("tag_id") ON DELETE SET NULL;
@@ -0,0 +1,31 @@
+-- First clean up any duplicate match tags so we can make each match/tag pair unique
+DELETE FROM "match_tags" duplicate_match_tags
+USING "match_tags" original_match_tags
+WHERE duplicate_match_tags."match_id" = original_match_tags."match_id"
+  AND duplicate_match_tags."tag_id" = original_match_tags."tag_id"
+  AND duplicate_match_tags."match_tag_id" > original_match_tags."match_tag_id";
+
+ALTER TABLE "match_tags" ADD UNIQUE ("match_id", "tag_id");
+
+
+-- Tags that are still on matches can't be deleted unless their match tags are removed first
+ALTER TABLE "match_tags" DROP CONSTRAINT "match_tags_tag_id_fkey";
+ALTER TABLE "match_tags" ADD FOREIGN KEY ("tag_id") REFERENCES "tags" ("tag_id") ON DELETE RESTRICT;
+
+
+-- Then create the tag_aliases table; merged tags leave their old names
+-- behind as aliases of the tag they were merged into
+DROP TABLE IF EXISTS "tag_aliases";
+
+CREATE TABLE "tag_aliases" (
+  "tag_alias_id" SERIAL NOT NULL,
+  "tag_id" INTEGER NOT NULL,
+  "tag_alias_name" VARCHAR(100) NOT NULL,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("tag_alias_id"),
+  UNIQUE ("tag_id", "tag_alias_name")
+);
+
+
+-- Add foreign key constraints to "tag_aliases"
+ALTER TABLE "tag_aliases" ADD FOREIGN KEY ("tag_id") REFERENCES "tags" ("tag_id") ON DELETE CASCADE;
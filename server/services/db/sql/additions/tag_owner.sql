@@ -0,0 +1,6 @@
+-- Tags with a user are private to that user; tags without one are global and managed by admins
+ALTER TABLE "tags" ADD COLUMN "user_id" INTEGER;
+
+
+-- Add foreign key constraints to "tags"; a user's private tags go away with them
+ALTER TABLE "tags" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
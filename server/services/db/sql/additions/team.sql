@@ -0,0 +1,58 @@
+-- Create the teams table; a group of users who share a dashboard of everyone's matches
+DROP TABLE IF EXISTS "teams" CASCADE;
+
+CREATE TABLE "teams" (
+  "team_id" SERIAL NOT NULL,
+  "team_name" VARCHAR(100) NOT NULL,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("team_id")
+);
+
+
+-- Then create the team_members table; every team keeps at least one owner.
+-- Owners can do anything, admins can invite and manage members, members can only look
+DROP TABLE IF EXISTS "team_members";
+
+CREATE TABLE "team_members" (
+  "team_member_id" SERIAL NOT NULL,
+  "team_id" INTEGER NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "team_role" VARCHAR(20) NOT NULL DEFAULT 'member',
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("team_member_id"),
+  UNIQUE ("team_id", "user_id"),
+  CHECK ("team_role" IN ('owner', 'admin', 'member'))
+);
+
+
+ALTER TABLE "team_members" ADD FOREIGN KEY ("team_id") REFERENCES "teams" ("team_id") ON DELETE CASCADE;
+ALTER TABLE "team_members" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+
+CREATE INDEX "team_members_user_id_idx" ON "team_members" ("user_id");
+
+
+-- Then create the team_invites table; invites are emailed as a link with a random token,
+-- and only a hash of the token is stored. An invite works once, until it expires
+DROP TABLE IF EXISTS "team_invites";
+
+CREATE TABLE "team_invites" (
+  "team_invite_id" SERIAL NOT NULL,
+  "team_id" INTEGER NOT NULL,
+  "email_address" VARCHAR(100) NOT NULL,
+  "team_role" VARCHAR(20) NOT NULL DEFAULT 'member',
+  "hashed_token" VARCHAR(64) NOT NULL,
+  "invited_by_user_id" INTEGER,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "expires_at" TIMESTAMP NOT NULL,
+  "accepted_at" TIMESTAMP,
+  "revoked_at" TIMESTAMP,
+  PRIMARY KEY ("team_invite_id"),
+  UNIQUE ("hashed_token"),
+  CHECK ("team_role" IN ('admin', 'member'))
+);
+
+
+ALTER TABLE "team_invites" ADD FOREIGN KEY ("team_id") REFERENCES "teams" ("team_id") ON DELETE CASCADE;
+ALTER TABLE "team_invites" ADD FOREIGN KEY ("invited_by_user_id") REFERENCES "users" ("user_id") ON DELETE SET NULL;
+
+CREATE INDEX "team_invites_team_id_idx" ON "team_invites" ("team_id");
@@ -0,0 +1,38 @@
+-- Users can turn on TOTP two-factor auth; the secret is saved as soon as they start enrolling,
+-- but it isn't required at log in until they've confirmed it with a code from their app.
+-- totp_last_step is the last time step a code was used for, so a code can't be used twice
+ALTER TABLE "users" ADD COLUMN "totp_secret" VARCHAR(64);
+ALTER TABLE "users" ADD COLUMN "totp_enabled" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "users" ADD COLUMN "totp_last_step" BIGINT;
+
+
+-- Logging in with two-factor auth on hands out a short lived token to send back with a code; only a hash
+-- of the latest one is kept, and it's cleared once it's used. Too many wrong codes in a row locks the user
+-- out of the second step until two_factor_locked_until, and throws out the token they were using
+ALTER TABLE "users" ADD COLUMN "two_factor_login_token" VARCHAR(64);
+ALTER TABLE "users" ADD COLUMN "two_factor_failed_attempts" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN "two_factor_locked_until" TIMESTAMP;
+
+
+-- Then create the recovery_codes table; each code gets a user back in once if they lose their
+-- authenticator app. Only a hash of each code is stored
+DROP TABLE IF EXISTS "recovery_codes";
+
+CREATE TABLE "recovery_codes" (
+  "recovery_code_id" SERIAL NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "hashed_code" VARCHAR(64) NOT NULL,
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "used_at" TIMESTAMP,
+  PRIMARY KEY ("recovery_code_id")
+);
+
+
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+
+CREATE INDEX "recovery_codes_user_id_idx" ON "recovery_codes" ("user_id");
+
+
+-- Resetting another user's two-factor auth is part of managing users
+UPDATE "permissions" SET "permission_description" = 'Search, disable, log out, reset passwords and two-factor auth for and delete users'
+WHERE "permission_name" = 'users:manage';
@@ -0,0 +1,12 @@
+-- Let admins disable abusive accounts, and soft delete users while keeping their rows around
+ALTER TABLE "users" ADD COLUMN "disabled" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "users" ADD COLUMN "deleted_at" TIMESTAMP;
+
+
+-- Managing other users' accounts gets its own permission, which only admins have
+INSERT INTO "permissions" ("permission_name", "permission_description") VALUES
+('users:manage', 'Search, disable, log out, reset passwords for and delete users');
+
+INSERT INTO "role_permissions" ("role_id", "permission_id")
+SELECT "roles"."role_id", "permissions"."permission_id" FROM "roles" CROSS JOIN "permissions"
+WHERE "roles"."role_name" = 'Admin' AND "permissions"."permission_name" = 'users:manage';
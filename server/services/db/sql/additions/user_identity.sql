@@ -0,0 +1,20 @@
+-- Create the user_identities table; each identity links a user to an account with an OpenID Connect
+-- provider they can log in with. The issuer and subject together are what the provider knows them by
+DROP TABLE IF EXISTS "user_identities";
+
+CREATE TABLE "user_identities" (
+  "user_identity_id" SERIAL NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "issuer" VARCHAR(256) NOT NULL,
+  "subject" VARCHAR(256) NOT NULL,
+  "email_address" VARCHAR(256),
+  "created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "last_login" TIMESTAMP,
+  PRIMARY KEY ("user_identity_id"),
+  UNIQUE ("issuer", "subject")
+);
+
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("user_id") ON DELETE CASCADE;
+
+CREATE INDEX "user_identities_user_id_idx" ON "user_identities" ("user_id");
@@ -0,0 +1,189 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// StageManager describes all of the methods used
+// to interact with the stages table in our database
+type StageManager interface {
+  GetAllStages() ([]*Stage, error)
+  GetStageByStageID(stageID int64) (*Stage, error)
+
+  CreateStage(stageCreate *StageCreate) (*Stage, error)
+  UpdateStage(stageUpdate *StageUpdate) (*Stage, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Stage describes the required and optional data
+// needed to create a new stage in our stages table
+type Stage struct {
+  StageID    int64           `json:"stageId"`
+  StageName  string          `json:"stageName"`
+  StageImg   NullStringJSON  `json:"stageImg,omitempty"`
+}
+
+
+// StageUpdate describes the data needed
+// to update a given stage in our db
+type StageUpdate struct {
+  StageID    int64           `json:"stageId"`
+  StageName  string          `json:"stageName"`
+  StageImg   NullStringJSON  `json:"stageImg,omitempty"`
+}
+
+
+// StageCreate describes the data needed
+// to create a given stage in our db
+type StageCreate struct {
+  StageName  string          `json:"stageName"`
+  StageImg   NullStringJSON  `json:"stageImg"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAllStages gets all of the stages we have in our database
+func (db *DB) GetAllStages() ([]*Stage, error) {
+  sqlStatement := `
+    SELECT
+      stage_id,
+      stage_name,
+      stage_img
+    FROM
+      stages
+    ORDER BY
+      stage_id
+  `
+  rows, err := db.Query(sqlStatement)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  stages := make([]*Stage, 0)
+  for rows.Next() {
+    stage := new(Stage)
+    err := rows.Scan(
+      &stage.StageID,
+      &stage.StageName,
+      &stage.StageImg,
+    )
+
+    if err != nil {
+      return nil, err
+    }
+
+    stages = append(stages, stage)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return stages, nil
+}
+
+
+// GetStageByStageID gets a specific stage given its ID
+func (db *DB) GetStageByStageID(stageID int64) (*Stage, error) {
+  sqlStatement := `
+    SELECT
+      stage_id,
+      stage_name,
+      stage_img
+    FROM
+      stages
+    WHERE
+      stage_id = $1
+  `
+  row := db.QueryRow(sqlStatement, stageID)
+
+  stage := new(Stage)
+  err := row.Scan(
+    &stage.StageID,
+    &stage.StageName,
+    &stage.StageImg,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return stage, nil
+}
+
+
+// CreateStage adds a new entry to the stages table in our database
+func (db *DB) CreateStage(stageCreate *StageCreate) (*Stage, error) {
+  sqlStatement := `
+    INSERT INTO stages
+      (stage_name, stage_img)
+    VALUES
+      ($1, $2)
+    RETURNING
+      stage_id,
+      stage_name,
+      stage_img
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    stageCreate.StageName,
+    stageCreate.StageImg,
+  )
+
+  stage := new(Stage)
+  err := row.Scan(
+    &stage.StageID,
+    &stage.StageName,
+    &stage.StageImg,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return stage, nil
+}
+
+
+// UpdateStage updates an existing entry in the stages table in our database
+func (db *DB) UpdateStage(stageUpdate *StageUpdate) (*Stage, error) {
+  sqlStatement := `
+    UPDATE
+      stages
+    SET
+      stage_name = $1,
+      stage_img = $2
+    WHERE
+      stage_id = $3
+    RETURNING
+      stage_id,
+      stage_name,
+      stage_img
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    stageUpdate.StageName,
+    stageUpdate.StageImg,
+    stageUpdate.StageID,
+  )
+
+  stage := new(Stage)
+  err := row.Scan(
+    &stage.StageID,
+    &stage.StageName,
+    &stage.StageImg,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return stage, nil
+}
@@ -0,0 +1,153 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// StageStatsViewManager describes all of the methods used to get
+// aggregated match results by stage (data joined between matches, stages, and characters)
+type StageStatsViewManager interface {
+  GetStageWinRateViewsByUserID(userID int64) ([]*StageWinRateView, error)
+  GetStageMatchupWinRateViewsByUserID(userID int64) ([]*StageMatchupWinRateView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// StageWinRateView describes a user's win rate on a given stage
+type StageWinRateView struct {
+  StageID    int64   `json:"stageId"`
+  StageName  string  `json:"stageName"`
+  WinRecord
+}
+
+
+// StageMatchupWinRateView describes a user's win rate
+// on a given stage against a given opponent character
+type StageMatchupWinRateView struct {
+  StageID                int64   `json:"stageId"`
+  StageName              string  `json:"stageName"`
+  OpponentCharacterID    int64   `json:"opponentCharacterId"`
+  OpponentCharacterName  string  `json:"opponentCharacterName"`
+  WinRecord
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetStageWinRateViewsByUserID gets a user's win rate on every stage they've recorded a match on
+func (db *DB) GetStageWinRateViewsByUserID(userID int64) ([]*StageWinRateView, error) {
+  sqlStatement := `
+    SELECT
+      stages.stage_id                                      AS stage_id,
+      stages.stage_name                                    AS stage_name,
+      COUNT(*) FILTER (WHERE matches.user_win = true)      AS wins,
+      COUNT(*) FILTER (WHERE matches.user_win = false)     AS losses
+    FROM
+      matches
+    INNER JOIN stages ON stages.stage_id = matches.stage_id
+    WHERE
+      matches.user_id = $1
+      AND matches.deleted_at IS NULL
+    GROUP BY
+      stages.stage_id,
+      stages.stage_name
+    ORDER BY
+      stages.stage_id
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  stageWinRateViews := make([]*StageWinRateView, 0)
+  for rows.Next() {
+    stageWinRateView := new(StageWinRateView)
+    err := rows.Scan(
+      &stageWinRateView.StageID,
+      &stageWinRateView.StageName,
+      &stageWinRateView.Wins,
+      &stageWinRateView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    stageWinRateView.calculateWinRate()
+    stageWinRateViews = append(stageWinRateViews, stageWinRateView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return stageWinRateViews, nil
+}
+
+
+// GetStageMatchupWinRateViewsByUserID gets a user's win rate on every
+// stage they've recorded a match on, broken down by opponent character
+func (db *DB) GetStageMatchupWinRateViewsByUserID(userID int64) ([]*StageMatchupWinRateView, error) {
+  sqlStatement := `
+    SELECT
+      stages.stage_id                                      AS stage_id,
+      stages.stage_name                                    AS stage_name,
+      opponent_character.character_id                      AS opponent_character_id,
+      opponent_character.character_name                    AS opponent_character_name,
+      COUNT(*) FILTER (WHERE matches.user_win = true)      AS wins,
+      COUNT(*) FILTER (WHERE matches.user_win = false)     AS losses
+    FROM
+      matches
+    INNER JOIN stages ON stages.stage_id = matches.stage_id
+    INNER JOIN characters opponent_character ON opponent_character.character_id = matches.opponent_character_id
+    WHERE
+      matches.user_id = $1
+      AND matches.deleted_at IS NULL
+    GROUP BY
+      stages.stage_id,
+      stages.stage_name,
+      opponent_character.character_id,
+      opponent_character.character_name
+    ORDER BY
+      stages.stage_id,
+      opponent_character.character_id
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  stageMatchupWinRateViews := make([]*StageMatchupWinRateView, 0)
+  for rows.Next() {
+    stageMatchupWinRateView := new(StageMatchupWinRateView)
+    err := rows.Scan(
+      &stageMatchupWinRateView.StageID,
+      &stageMatchupWinRateView.StageName,
+      &stageMatchupWinRateView.OpponentCharacterID,
+      &stageMatchupWinRateView.OpponentCharacterName,
+      &stageMatchupWinRateView.Wins,
+      &stageMatchupWinRateView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    stageMatchupWinRateView.calculateWinRate()
+    stageMatchupWinRateViews = append(stageMatchupWinRateViews, stageMatchupWinRateView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return stageMatchupWinRateViews, nil
+}
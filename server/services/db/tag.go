@@ -1,5 +1,16 @@
 package db
 
+import (
+  "database/sql"
+  "errors"
+
+  "github.com/lib/pq"
+)
+
+
+// ErrTagInUse is returned when deleting a tag that's still on matches without cascading
+var ErrTagInUse = errors.New("tag is still used by matches")
+
 
 /*---------------------------------
           Data Structures
@@ -8,30 +19,68 @@ package db
 // Tag describes the required data needed
 // to create a new tag in our tags table
 type Tag struct {
-  TagID    int     `json:"tagId"`
-  TagName  string  `json:"tagName"`
+  TagID            int             `json:"tagId"`
+  TagName          string          `json:"tagName"`
+  // Null for global tags; otherwise the only user who can see and use the tag
+  UserID           NullInt64JSON   `json:"userId"`
+  TagCategoryID    NullInt64JSON   `json:"tagCategoryId"`
+  ParentTagID      NullInt64JSON   `json:"parentTagId"`
+
+  // Data from tag_categories
+  TagCategoryName  NullStringJSON  `json:"tagCategoryName"`
+}
+
+
+// TagTreeNode describes a tag along with all of the tags nested under it
+type TagTreeNode struct {
+  *Tag
+  ChildTags  []*TagTreeNode  `json:"childTags"`
 }
 
 
 // TagCreate describes the data needed
 // to create a new tag in our database
 type TagCreate struct {
-  TagName  string  `json:"tagName"`
+  TagName        string         `json:"tagName"`
+  UserID         NullInt64JSON  `json:"userId"`
+  TagCategoryID  NullInt64JSON  `json:"tagCategoryId"`
+  ParentTagID    NullInt64JSON  `json:"parentTagId"`
 }
 
 
 // TagUpdate describes the data needed 
 // to update a given tag in our database
 type TagUpdate struct {
-  TagID    int     `json:"tagId"`
-  TagName  string  `json:"tagName"`
+  TagID          int            `json:"tagId"`
+  TagName        string         `json:"tagName"`
+  TagCategoryID  NullInt64JSON  `json:"tagCategoryId"`
+  ParentTagID    NullInt64JSON  `json:"parentTagId"`
 }
 
 
 // TagDelete describes the data needed 
 // to delete a given tag in our database
 type TagDelete struct {
-  TagID  int64  `json:"tagId"`
+  TagID    int64  `json:"tagId"`
+  // Tags still on matches are only deleted (along with their match tags) if this is set
+  Cascade  bool   `json:"cascade"`
+}
+
+
+// TagMerge describes the data needed to merge a set of
+// source tags into a single target tag in our database
+type TagMerge struct {
+  SourceTagIDs  []int64  `json:"sourceTagIds"`
+  TargetTagID   int64    `json:"targetTagId"`
+}
+
+
+// TagMergeResult describes what merging tags changed
+type TagMergeResult struct {
+  // Match tags moved over to the target tag; matches that already had it aren't counted
+  NumMatchTagsMoved  int64     `json:"numMatchTagsMoved"`
+  // Names of the source tags, which are now aliases of the target tag
+  MergedTagNames     []string  `json:"mergedTagNames"`
 }
 
 
@@ -42,12 +91,14 @@ type TagDelete struct {
 // TagManager describes all of the methods used
 // to interact with the tags table in our database
 type TagManager interface {
-  GetAllTags() ([]*Tag, error)
+  GetAllTagsByUserID(userID int64) ([]*Tag, error)
   GetTagByTagID(tagID int) (*Tag, error)
+  GetTagDescendantIDs(tagID int) ([]int, error)
 
   CreateTag(tagCreate *TagCreate) (int, error)
   UpdateTag(tagUpdate *TagUpdate) (int, error)
-  DeleteTagByTagID(tagID int64) (int64, error)
+  DeleteTagByTagID(tagID int64, cascade bool) (int64, error)
+  MergeTags(tagMerge *TagMerge) (*TagMergeResult, error)
 }
 
 
@@ -55,16 +106,26 @@ type TagManager interface {
        Method Implementations
 ----------------------------------*/
 
-// GetAllTags gets all of the tags we have in our database
-func (db *DB) GetAllTags() ([]*Tag, error) {
+// GetAllTagsByUserID gets all of the tags a given user can see,
+// which are all of the global tags plus the user's own private ones
+func (db *DB) GetAllTagsByUserID(userID int64) ([]*Tag, error) {
   sqlStatement := `
     SELECT
-      tag_id,
-      tag_name
+      tags.tag_id                         AS  tag_id,
+      tags.tag_name                       AS  tag_name,
+      tags.user_id                        AS  user_id,
+      tags.tag_category_id                AS  tag_category_id,
+      tags.parent_tag_id                  AS  parent_tag_id,
+      tag_categories.tag_category_name    AS  tag_category_name
     FROM
       tags
+    LEFT JOIN tag_categories ON tag_categories.tag_category_id = tags.tag_category_id
+    WHERE
+      tags.user_id IS NULL OR tags.user_id = $1
+    ORDER BY
+      tags.tag_name
   `
-  rows, err := db.Query(sqlStatement)
+  rows, err := db.Query(sqlStatement, userID)
   if err != nil {
     return nil, err
   }
@@ -77,6 +138,10 @@ func (db *DB) GetAllTags() ([]*Tag, error) {
     err := rows.Scan(
       &tag.TagID,
       &tag.TagName,
+      &tag.UserID,
+      &tag.TagCategoryID,
+      &tag.ParentTagID,
+      &tag.TagCategoryName,
     )
     if err != nil {
       return nil, err
@@ -98,12 +163,17 @@ func (db *DB) GetAllTags() ([]*Tag, error) {
 func (db *DB) GetTagByTagID(tagID int) (*Tag, error) {
   sqlStatement := `
     SELECT
-      tag_id,
-      tag_name
+      tags.tag_id                         AS  tag_id,
+      tags.tag_name                       AS  tag_name,
+      tags.user_id                        AS  user_id,
+      tags.tag_category_id                AS  tag_category_id,
+      tags.parent_tag_id                  AS  parent_tag_id,
+      tag_categories.tag_category_name    AS  tag_category_name
     FROM
       tags
+    LEFT JOIN tag_categories ON tag_categories.tag_category_id = tags.tag_category_id
     WHERE
-      tag_id = $1
+      tags.tag_id = $1
   `
   row := db.QueryRow(sqlStatement, tagID)
 
@@ -111,6 +181,10 @@ func (db *DB) GetTagByTagID(tagID int) (*Tag, error) {
   err := row.Scan(
     &tag.TagID,
     &tag.TagName,
+    &tag.UserID,
+    &tag.TagCategoryID,
+    &tag.ParentTagID,
+    &tag.TagCategoryName,
   )
   if err != nil {
     return nil, err
@@ -120,17 +194,63 @@ func (db *DB) GetTagByTagID(tagID int) (*Tag, error) {
 }
 
 
+// GetTagDescendantIDs gets the IDs of every tag nested under
+// a given tag (its children, their children, and so on)
+func (db *DB) GetTagDescendantIDs(tagID int) ([]int, error) {
+  sqlStatement := `
+    WITH RECURSIVE descendant_tags AS (
+      SELECT tag_id FROM tags WHERE parent_tag_id = $1
+      UNION
+      SELECT tags.tag_id FROM tags INNER JOIN descendant_tags ON tags.parent_tag_id = descendant_tags.tag_id
+    )
+    SELECT
+      tag_id
+    FROM
+      descendant_tags
+  `
+  rows, err := db.Query(sqlStatement, tagID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  descendantTagIDs := make([]int, 0)
+  for rows.Next() {
+    var descendantTagID int
+    err := rows.Scan(&descendantTagID)
+    if err != nil {
+      return nil, err
+    }
+
+    descendantTagIDs = append(descendantTagIDs, descendantTagID)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return descendantTagIDs, nil
+}
+
+
 // CreateTag adds a new entry to the tags table
 func (db *DB) CreateTag(tagCreate *TagCreate) (int, error) {
   sqlStatement := `
     INSERT INTO tags
-      (tag_name)
+      (tag_name, user_id, tag_category_id, parent_tag_id)
     VALUES
-      ($1)
+      ($1, $2, $3, $4)
     RETURNING
       tag_id
   `
-  row := db.QueryRow(sqlStatement, tagCreate.TagName)
+  row := db.QueryRow(
+    sqlStatement,
+    tagCreate.TagName,
+    tagCreate.UserID,
+    tagCreate.TagCategoryID,
+    tagCreate.ParentTagID,
+  )
 
   var tagID int
   err := row.Scan(&tagID)
@@ -148,15 +268,19 @@ func (db *DB) UpdateTag(tagUpdate *TagUpdate) (int, error) {
     UPDATE
       tags
     SET
-      tag_name = $1
+      tag_name = $1,
+      tag_category_id = $2,
+      parent_tag_id = $3
     WHERE
-      tag_id = $2
+      tag_id = $4
     RETURNING
       tag_id
   `
   row := db.QueryRow(
     sqlStatement,
     tagUpdate.TagName,
+    tagUpdate.TagCategoryID,
+    tagUpdate.ParentTagID,
     tagUpdate.TagID,
   )
 
@@ -170,8 +294,46 @@ func (db *DB) UpdateTag(tagUpdate *TagUpdate) (int, error) {
 }
 
 
-// DeleteTagByTagID deletes an existing entry in the tags table
-func (db *DB) DeleteTagByTagID(tagID int64) (int64, error) {
+// DeleteTagByTagID deletes an existing entry in the tags table. If the tag is still on
+// any matches, this returns ErrTagInUse unless cascade is set, in which case
+// the tag is removed from those matches as well. Links shared with the tag are revoked
+func (db *DB) DeleteTagByTagID(tagID int64, cascade bool) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  if cascade {
+    _, err = tx.Exec(`DELETE FROM match_tags WHERE tag_id = $1`, tagID)
+    if err != nil {
+      return 0, err
+    }
+  } else {
+    var numMatchTags int64
+    err = tx.QueryRow(`SELECT COUNT(*) FROM match_tags WHERE tag_id = $1`, tagID).Scan(&numMatchTags)
+    if err != nil {
+      return 0, err
+    }
+    if numMatchTags > 0 {
+      return 0, ErrTagInUse
+    }
+  }
+
+  // Links shared with this tag as their filter stop working, rather than showing every match
+  _, err = tx.Exec(`
+    UPDATE
+      share_links
+    SET
+      revoked_at = CURRENT_TIMESTAMP
+    WHERE
+      tag_id = $1
+      AND revoked_at IS NULL
+  `, tagID)
+  if err != nil {
+    return 0, err
+  }
+
   var deletedTagID int64
   sqlStatement := `
     DELETE FROM
@@ -181,12 +343,153 @@ func (db *DB) DeleteTagByTagID(tagID int64) (int64, error) {
     RETURNING
       tag_id
   `
-  row := db.QueryRow(sqlStatement, tagID)
+  row := tx.QueryRow(sqlStatement, tagID)
+
+  err = row.Scan(&deletedTagID)
+  if err != nil {
+    return 0, err
+  }
 
-  err := row.Scan(&deletedTagID)
+  err = tx.Commit()
   if err != nil {
-    return 0, nil
+    return 0, err
   }
 
   return deletedTagID, nil
 }
+
+
+// MergeTags moves every match tag from the source tags over to the target tag (skipping matches
+// that already have it), nests the source tags' children and shared links under the target tag, keeps
+// the source tags' names as aliases of the target tag, then deletes the source tags; all in one transaction.
+// Returns sql.ErrNoRows if any of the source tags don't exist
+func (db *DB) MergeTags(tagMerge *TagMerge) (*TagMergeResult, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return nil, err
+  }
+  defer tx.Rollback()
+
+  sourceTagIDs := pq.Array(tagMerge.SourceTagIDs)
+  tagMergeResult := new(TagMergeResult)
+  tagMergeResult.MergedTagNames = make([]string, 0)
+
+  // Lock the source tags so nobody tags a match with them mid-merge
+  rows, err := tx.Query(`SELECT tag_name FROM tags WHERE tag_id = ANY($1) ORDER BY tag_name FOR UPDATE`, sourceTagIDs)
+  if err != nil {
+    return nil, err
+  }
+  for rows.Next() {
+    var tagName string
+    err := rows.Scan(&tagName)
+    if err != nil {
+      rows.Close()
+      return nil, err
+    }
+
+    tagMergeResult.MergedTagNames = append(tagMergeResult.MergedTagNames, tagName)
+  }
+  rows.Close()
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+  if len(tagMergeResult.MergedTagNames) != len(tagMerge.SourceTagIDs) {
+    return nil, sql.ErrNoRows
+  }
+
+  result, err := tx.Exec(`
+    INSERT INTO match_tags
+      (match_id, tag_id)
+    SELECT DISTINCT
+      match_id,
+      $2::INTEGER
+    FROM
+      match_tags
+    WHERE
+      tag_id = ANY($1)
+    ON CONFLICT (match_id, tag_id) DO NOTHING
+  `, sourceTagIDs, tagMerge.TargetTagID)
+  if err != nil {
+    return nil, err
+  }
+  tagMergeResult.NumMatchTagsMoved, err = result.RowsAffected()
+  if err != nil {
+    return nil, err
+  }
+
+  _, err = tx.Exec(`DELETE FROM match_tags WHERE tag_id = ANY($1)`, sourceTagIDs)
+  if err != nil {
+    return nil, err
+  }
+
+  // Keep both the source tags' names and any of their own old names around as aliases
+  _, err = tx.Exec(`
+    INSERT INTO tag_aliases
+      (tag_id, tag_alias_name)
+    SELECT $2::INTEGER, tag_name FROM tags WHERE tag_id = ANY($1)
+    UNION
+    SELECT $2::INTEGER, tag_alias_name FROM tag_aliases WHERE tag_id = ANY($1)
+    ON CONFLICT (tag_id, tag_alias_name) DO NOTHING
+  `, sourceTagIDs, tagMerge.TargetTagID)
+  if err != nil {
+    return nil, err
+  }
+
+  // Shared links filtered on a source tag keep working, filtered on the tag it was merged into
+  _, err = tx.Exec(`UPDATE share_links SET tag_id = $2 WHERE tag_id = ANY($1)`, sourceTagIDs, tagMerge.TargetTagID)
+  if err != nil {
+    return nil, err
+  }
+
+  _, err = tx.Exec(
+    `UPDATE tags SET parent_tag_id = $2 WHERE parent_tag_id = ANY($1) AND tag_id <> $2`,
+    sourceTagIDs,
+    tagMerge.TargetTagID,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  _, err = tx.Exec(`DELETE FROM tags WHERE tag_id = ANY($1)`, sourceTagIDs)
+  if err != nil {
+    return nil, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return nil, err
+  }
+
+  return tagMergeResult, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// MakeTagTree nests a flat list of tags under their parents. Any tag
+// whose parent isn't in the list ends up at the top level of the tree
+func MakeTagTree(tags []*Tag) []*TagTreeNode {
+  tagTreeNodesByID := make(map[int]*TagTreeNode)
+  for _, tag := range tags {
+    tagTreeNodesByID[tag.TagID] = &TagTreeNode{Tag: tag, ChildTags: make([]*TagTreeNode, 0)}
+  }
+
+  tagTree := make([]*TagTreeNode, 0)
+  for _, tag := range tags {
+    tagTreeNode := tagTreeNodesByID[tag.TagID]
+    if tag.ParentTagID.Valid {
+      parentTagTreeNode, exists := tagTreeNodesByID[int(tag.ParentTagID.Int64)]
+      if exists {
+        parentTagTreeNode.ChildTags = append(parentTagTreeNode.ChildTags, tagTreeNode)
+        continue
+      }
+    }
+
+    tagTree = append(tagTree, tagTreeNode)
+  }
+
+  return tagTree
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TagAliasManager describes all of the methods used
+// to interact with the tag_aliases table in our database
+type TagAliasManager interface {
+  GetTagAliasesByTagID(tagID int) ([]*TagAlias, error)
+  ResolveTagName(tagName string, userID int64) (*Tag, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// TagAlias describes an old name for a tag, left behind when another tag was merged into it
+type TagAlias struct {
+  TagAliasID    int64      `json:"tagAliasId"`
+  TagID         int64      `json:"tagId"`
+  TagAliasName  string     `json:"tagAliasName"`
+  Created       time.Time  `json:"created"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetTagAliasesByTagID gets all of the old names for a given tag
+func (db *DB) GetTagAliasesByTagID(tagID int) ([]*TagAlias, error) {
+  sqlStatement := `
+    SELECT
+      tag_alias_id,
+      tag_id,
+      tag_alias_name,
+      created
+    FROM
+      tag_aliases
+    WHERE
+      tag_id = $1
+    ORDER BY
+      tag_alias_name
+  `
+  rows, err := db.Query(sqlStatement, tagID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  tagAliases := make([]*TagAlias, 0)
+  for rows.Next() {
+    tagAlias := new(TagAlias)
+    err := rows.Scan(
+      &tagAlias.TagAliasID,
+      &tagAlias.TagID,
+      &tagAlias.TagAliasName,
+      &tagAlias.Created,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    tagAliases = append(tagAliases, tagAlias)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return tagAliases, nil
+}
+
+
+// ResolveTagName finds the tag a given user means by a tag name, ignoring case. Tags that
+// currently have the name win over tags that only have it as an alias, and the user's own
+// private tags win over global ones. Returns sql.ErrNoRows if nothing matches
+func (db *DB) ResolveTagName(tagName string, userID int64) (*Tag, error) {
+  sqlStatement := `
+    SELECT
+      tags.tag_id                         AS  tag_id,
+      tags.tag_name                       AS  tag_name,
+      tags.user_id                        AS  user_id,
+      tags.tag_category_id                AS  tag_category_id,
+      tags.parent_tag_id                  AS  parent_tag_id,
+      tag_categories.tag_category_name    AS  tag_category_name
+    FROM
+      tags
+    LEFT JOIN tag_categories ON tag_categories.tag_category_id = tags.tag_category_id
+    WHERE
+      (tags.user_id IS NULL OR tags.user_id = $2)
+      AND (
+        LOWER(tags.tag_name) = LOWER($1)
+        OR tags.tag_id IN (SELECT tag_id FROM tag_aliases WHERE LOWER(tag_alias_name) = LOWER($1))
+      )
+    ORDER BY
+      LOWER(tags.tag_name) = LOWER($1) DESC,
+      tags.user_id IS NULL,
+      tags.tag_id
+    LIMIT 1
+  `
+  row := db.QueryRow(sqlStatement, tagName, userID)
+
+  tag := new(Tag)
+  err := row.Scan(
+    &tag.TagID,
+    &tag.TagName,
+    &tag.UserID,
+    &tag.TagCategoryID,
+    &tag.ParentTagID,
+    &tag.TagCategoryName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return tag, nil
+}
@@ -0,0 +1,201 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TagCategoryManager describes all of the methods used
+// to interact with the tag_categories table in our database
+type TagCategoryManager interface {
+  GetAllTagCategories() ([]*TagCategory, error)
+  GetTagCategoryByTagCategoryID(tagCategoryID int64) (*TagCategory, error)
+
+  CreateTagCategory(tagCategoryCreate *TagCategoryCreate) (*TagCategory, error)
+  UpdateTagCategory(tagCategoryUpdate *TagCategoryUpdate) (*TagCategory, error)
+  DeleteTagCategoryByTagCategoryID(tagCategoryID int64) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// TagCategory describes a group of related tags (i.e. "Connection", "Mistake")
+type TagCategory struct {
+  TagCategoryID    int64   `json:"tagCategoryId"`
+  TagCategoryName  string  `json:"tagCategoryName"`
+}
+
+
+// TagCategoryCreate describes the data needed
+// to create a given tag category in our db
+type TagCategoryCreate struct {
+  TagCategoryName  string  `json:"tagCategoryName"`
+}
+
+
+// TagCategoryUpdate describes the data needed
+// to update a given tag category in our db
+type TagCategoryUpdate struct {
+  TagCategoryID    int64   `json:"tagCategoryId"`
+  TagCategoryName  string  `json:"tagCategoryName"`
+}
+
+
+// TagCategoryDelete describes the data needed
+// to delete a given tag category in our db
+type TagCategoryDelete struct {
+  TagCategoryID  int64  `json:"tagCategoryId"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetAllTagCategories gets all of the tag categories we have in our database
+func (db *DB) GetAllTagCategories() ([]*TagCategory, error) {
+  sqlStatement := `
+    SELECT
+      tag_category_id,
+      tag_category_name
+    FROM
+      tag_categories
+    ORDER BY
+      tag_category_name
+  `
+  rows, err := db.Query(sqlStatement)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  tagCategories := make([]*TagCategory, 0)
+  for rows.Next() {
+    tagCategory := new(TagCategory)
+    err := rows.Scan(
+      &tagCategory.TagCategoryID,
+      &tagCategory.TagCategoryName,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    tagCategories = append(tagCategories, tagCategory)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return tagCategories, nil
+}
+
+
+// GetTagCategoryByTagCategoryID gets a specific tag category given its ID
+func (db *DB) GetTagCategoryByTagCategoryID(tagCategoryID int64) (*TagCategory, error) {
+  sqlStatement := `
+    SELECT
+      tag_category_id,
+      tag_category_name
+    FROM
+      tag_categories
+    WHERE
+      tag_category_id = $1
+  `
+  row := db.QueryRow(sqlStatement, tagCategoryID)
+
+  tagCategory := new(TagCategory)
+  err := row.Scan(
+    &tagCategory.TagCategoryID,
+    &tagCategory.TagCategoryName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return tagCategory, nil
+}
+
+
+// CreateTagCategory adds a new entry to the tag_categories table
+func (db *DB) CreateTagCategory(tagCategoryCreate *TagCategoryCreate) (*TagCategory, error) {
+  sqlStatement := `
+    INSERT INTO tag_categories
+      (tag_category_name)
+    VALUES
+      ($1)
+    RETURNING
+      tag_category_id,
+      tag_category_name
+  `
+  row := db.QueryRow(sqlStatement, tagCategoryCreate.TagCategoryName)
+
+  tagCategory := new(TagCategory)
+  err := row.Scan(
+    &tagCategory.TagCategoryID,
+    &tagCategory.TagCategoryName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return tagCategory, nil
+}
+
+
+// UpdateTagCategory updates an existing entry in the tag_categories table
+func (db *DB) UpdateTagCategory(tagCategoryUpdate *TagCategoryUpdate) (*TagCategory, error) {
+  sqlStatement := `
+    UPDATE
+      tag_categories
+    SET
+      tag_category_name = $1
+    WHERE
+      tag_category_id = $2
+    RETURNING
+      tag_category_id,
+      tag_category_name
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    tagCategoryUpdate.TagCategoryName,
+    tagCategoryUpdate.TagCategoryID,
+  )
+
+  tagCategory := new(TagCategory)
+  err := row.Scan(
+    &tagCategory.TagCategoryID,
+    &tagCategory.TagCategoryName,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return tagCategory, nil
+}
+
+
+// DeleteTagCategoryByTagCategoryID deletes an existing entry in the
+// tag_categories table; its tags are kept, just without a category
+func (db *DB) DeleteTagCategoryByTagCategoryID(tagCategoryID int64) (int64, error) {
+  var deletedTagCategoryID int64
+  sqlStatement := `
+    DELETE FROM
+      tag_categories
+    WHERE
+      tag_category_id = $1
+    RETURNING
+      tag_category_id
+  `
+  row := db.QueryRow(sqlStatement, tagCategoryID)
+
+  err := row.Scan(&deletedTagCategoryID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedTagCategoryID, nil
+}
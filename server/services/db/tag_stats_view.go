@@ -0,0 +1,194 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TagStatsViewManager describes all of the methods used to get aggregated
+// match results by tag (data joined between matches, match_tags, and tags)
+type TagStatsViewManager interface {
+  GetTagUsageViews(tagStatsFilter *TagStatsFilter) ([]*TagUsageView, error)
+  GetTagPairViews(tagStatsFilter *TagStatsFilter) ([]*TagPairView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// TagStatsFilter describes which matches and tags go into our tag stats
+type TagStatsFilter struct {
+  // Only count this user's matches; null counts everyone's
+  UserID        NullInt64JSON  `json:"userId"`
+  // The user looking at the stats; tags private to anyone else are left out
+  ViewerUserID  int64          `json:"-"`
+}
+
+
+// TagUsageView describes how often a tag is used, and how
+// matches with the tag went compared to matches without it
+type TagUsageView struct {
+  TagID       int64      `json:"tagId"`
+  TagName     string     `json:"tagName"`
+  NumMatches  int64      `json:"numMatches"`
+  WithTag     WinRecord  `json:"withTag"`
+  WithoutTag  WinRecord  `json:"withoutTag"`
+}
+
+
+// TagPairView describes how often two tags are used on the same match,
+// and how the matches with both of them went
+type TagPairView struct {
+  TagID         int64   `json:"tagId"`
+  TagName       string  `json:"tagName"`
+  OtherTagID    int64   `json:"otherTagId"`
+  OtherTagName  string  `json:"otherTagName"`
+  NumMatches    int64   `json:"numMatches"`
+  WinRecord
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetTagUsageViews gets the number of matches for every tag used in the filtered
+// matches, along with the win rate of the filtered matches with and without the tag
+func (db *DB) GetTagUsageViews(tagStatsFilter *TagStatsFilter) ([]*TagUsageView, error) {
+  sqlStatement := `
+    WITH filtered_matches AS (
+      SELECT match_id, user_win FROM matches WHERE deleted_at IS NULL AND ($1::INTEGER IS NULL OR user_id = $1)
+    ), match_totals AS (
+      SELECT
+        COUNT(*) FILTER (WHERE user_win = true)    AS wins,
+        COUNT(*) FILTER (WHERE user_win = false)   AS losses
+      FROM
+        filtered_matches
+    )
+    SELECT
+      tags.tag_id                                                                      AS tag_id,
+      tags.tag_name                                                                    AS tag_name,
+      COUNT(*)                                                                         AS num_matches,
+      COUNT(*) FILTER (WHERE filtered_matches.user_win = true)                         AS with_wins,
+      COUNT(*) FILTER (WHERE filtered_matches.user_win = false)                        AS with_losses,
+      match_totals.wins - COUNT(*) FILTER (WHERE filtered_matches.user_win = true)     AS without_wins,
+      match_totals.losses - COUNT(*) FILTER (WHERE filtered_matches.user_win = false)  AS without_losses
+    FROM
+      match_tags
+    INNER JOIN filtered_matches ON filtered_matches.match_id = match_tags.match_id
+    INNER JOIN tags ON tags.tag_id = match_tags.tag_id
+    CROSS JOIN match_totals
+    WHERE
+      tags.user_id IS NULL OR tags.user_id = $2
+    GROUP BY
+      tags.tag_id,
+      tags.tag_name,
+      match_totals.wins,
+      match_totals.losses
+    ORDER BY
+      num_matches DESC,
+      tags.tag_name
+  `
+  rows, err := db.Query(sqlStatement, tagStatsFilter.UserID, tagStatsFilter.ViewerUserID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  tagUsageViews := make([]*TagUsageView, 0)
+  for rows.Next() {
+    tagUsageView := new(TagUsageView)
+    err := rows.Scan(
+      &tagUsageView.TagID,
+      &tagUsageView.TagName,
+      &tagUsageView.NumMatches,
+      &tagUsageView.WithTag.Wins,
+      &tagUsageView.WithTag.Losses,
+      &tagUsageView.WithoutTag.Wins,
+      &tagUsageView.WithoutTag.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    tagUsageView.WithTag.calculateWinRate()
+    tagUsageView.WithoutTag.calculateWinRate()
+    tagUsageViews = append(tagUsageViews, tagUsageView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return tagUsageViews, nil
+}
+
+
+// GetTagPairViews gets every pair of tags that show up together on the
+// filtered matches, along with the win rate of the matches with both
+func (db *DB) GetTagPairViews(tagStatsFilter *TagStatsFilter) ([]*TagPairView, error) {
+  sqlStatement := `
+    SELECT
+      tag.tag_id                                        AS tag_id,
+      tag.tag_name                                      AS tag_name,
+      other_tag.tag_id                                  AS other_tag_id,
+      other_tag.tag_name                                AS other_tag_name,
+      COUNT(*)                                          AS num_matches,
+      COUNT(*) FILTER (WHERE matches.user_win = true)   AS wins,
+      COUNT(*) FILTER (WHERE matches.user_win = false)  AS losses
+    FROM
+      match_tags
+    INNER JOIN match_tags other_match_tag ON other_match_tag.match_id = match_tags.match_id AND other_match_tag.tag_id > match_tags.tag_id
+    INNER JOIN matches ON matches.match_id = match_tags.match_id
+    INNER JOIN tags tag ON tag.tag_id = match_tags.tag_id
+    INNER JOIN tags other_tag ON other_tag.tag_id = other_match_tag.tag_id
+    WHERE
+      matches.deleted_at IS NULL
+      AND ($1::INTEGER IS NULL OR matches.user_id = $1)
+      AND (tag.user_id IS NULL OR tag.user_id = $2)
+      AND (other_tag.user_id IS NULL OR other_tag.user_id = $2)
+    GROUP BY
+      tag.tag_id,
+      tag.tag_name,
+      other_tag.tag_id,
+      other_tag.tag_name
+    ORDER BY
+      num_matches DESC,
+      tag.tag_name,
+      other_tag.tag_name
+  `
+  rows, err := db.Query(sqlStatement, tagStatsFilter.UserID, tagStatsFilter.ViewerUserID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  tagPairViews := make([]*TagPairView, 0)
+  for rows.Next() {
+    tagPairView := new(TagPairView)
+    err := rows.Scan(
+      &tagPairView.TagID,
+      &tagPairView.TagName,
+      &tagPairView.OtherTagID,
+      &tagPairView.OtherTagName,
+      &tagPairView.NumMatches,
+      &tagPairView.Wins,
+      &tagPairView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    tagPairView.calculateWinRate()
+    tagPairViews = append(tagPairViews, tagPairView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return tagPairViews, nil
+}
@@ -0,0 +1,425 @@
+package db
+
+import (
+  "time"
+)
+
+
+// The roles a user can have on a team, from most to least trusted
+const (
+  TeamRoleOwner   = "owner"
+  TeamRoleAdmin   = "admin"
+  TeamRoleMember  = "member"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TeamManager describes all of the methods used to interact
+// with the teams and team_members tables in our database
+type TeamManager interface {
+  GetUserTeamViewsByUserID(userID int64) ([]*UserTeamView, error)
+  GetTeamByTeamID(teamID int64) (*Team, error)
+  GetTeamMembersByTeamID(teamID int64) ([]*TeamMember, error)
+  GetTeamMember(teamID int64, userID int64) (*TeamMember, error)
+
+  CreateTeam(teamCreate *TeamCreate) (int64, error)
+  UpdateTeam(teamUpdate *TeamUpdate) (int64, error)
+  DeleteTeamByTeamID(teamID int64) (int64, error)
+
+  UpdateTeamMemberRole(teamMemberUpdate *TeamMemberUpdate) (int64, error)
+  DeleteTeamMember(teamMemberDelete *TeamMemberDelete) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Team describes the data in the teams table
+type Team struct {
+  TeamID    int64      `json:"teamId"`
+  TeamName  string     `json:"teamName"`
+  Created   time.Time  `json:"created"`
+}
+
+
+// UserTeamView describes a team a user is on, along with their role on it
+type UserTeamView struct {
+  TeamID      int64      `json:"teamId"`
+  TeamName    string     `json:"teamName"`
+  Created     time.Time  `json:"created"`
+  TeamRole    string     `json:"teamRole"`
+  NumMembers  int64      `json:"numMembers"`
+}
+
+
+// TeamMember describes a user on a team, joined with their user name
+type TeamMember struct {
+  TeamMemberID  int64      `json:"teamMemberId"`
+  TeamID        int64      `json:"teamId"`
+  UserID        int64      `json:"userId"`
+  UserName      string     `json:"userName"`
+  TeamRole      string     `json:"teamRole"`
+  Created       time.Time  `json:"created"`
+}
+
+
+// TeamCreate describes the data needed to create a new
+// team in our db; the user creating it becomes its owner
+type TeamCreate struct {
+  TeamName  string  `json:"teamName"`
+  UserID    int64   `json:"-"`
+}
+
+
+// TeamUpdate describes the data needed
+// to update a given team in our db
+type TeamUpdate struct {
+  TeamID    int64   `json:"teamId"`
+  TeamName  string  `json:"teamName"`
+}
+
+
+// TeamMemberUpdate describes the data needed
+// to change a given team member's role
+type TeamMemberUpdate struct {
+  TeamID    int64   `json:"teamId"`
+  UserID    int64   `json:"userId"`
+  TeamRole  string  `json:"teamRole"`
+}
+
+
+// TeamMemberDelete describes the data needed
+// to remove a given member from a team
+type TeamMemberDelete struct {
+  TeamID  int64  `json:"teamId"`
+  UserID  int64  `json:"userId"`
+}
+
+
+/*---------------------------------
+        Shared SQL Statements
+----------------------------------*/
+
+// teamMemberSelectStatement is the SELECT shared by all of our team member queries
+const teamMemberSelectStatement = `
+    SELECT
+      team_members.team_member_id  AS  team_member_id,
+      team_members.team_id         AS  team_id,
+      team_members.user_id         AS  user_id,
+      users.user_name              AS  user_name,
+      team_members.team_role       AS  team_role,
+      team_members.created         AS  created
+    FROM
+      team_members
+    INNER JOIN users ON users.user_id = team_members.user_id
+`
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetUserTeamViewsByUserID gets every team a user is on, oldest first
+func (db *DB) GetUserTeamViewsByUserID(userID int64) ([]*UserTeamView, error) {
+  sqlStatement := `
+    SELECT
+      teams.team_id            AS  team_id,
+      teams.team_name          AS  team_name,
+      teams.created            AS  created,
+      team_members.team_role   AS  team_role,
+      (
+        SELECT
+          COUNT(*)
+        FROM
+          team_members all_members
+        INNER JOIN users ON users.user_id = all_members.user_id
+        WHERE
+          all_members.team_id = teams.team_id
+          AND users.deleted_at IS NULL
+      )                        AS  num_members
+    FROM
+      team_members
+    INNER JOIN teams ON teams.team_id = team_members.team_id
+    WHERE
+      team_members.user_id = $1
+    ORDER BY
+      teams.created
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  userTeamViews := make([]*UserTeamView, 0)
+  for rows.Next() {
+    userTeamView := new(UserTeamView)
+    err := rows.Scan(
+      &userTeamView.TeamID,
+      &userTeamView.TeamName,
+      &userTeamView.Created,
+      &userTeamView.TeamRole,
+      &userTeamView.NumMembers,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    userTeamViews = append(userTeamViews, userTeamView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return userTeamViews, nil
+}
+
+
+// GetTeamByTeamID gets a single team; returns sql.ErrNoRows if it doesn't exist
+func (db *DB) GetTeamByTeamID(teamID int64) (*Team, error) {
+  sqlStatement := `
+    SELECT
+      team_id,
+      team_name,
+      created
+    FROM
+      teams
+    WHERE
+      team_id = $1
+  `
+  row := db.QueryRow(sqlStatement, teamID)
+
+  team := new(Team)
+  err := row.Scan(
+    &team.TeamID,
+    &team.TeamName,
+    &team.Created,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return team, nil
+}
+
+
+// GetTeamMembersByTeamID gets everyone on a team, in the order they joined;
+// deleted users are left out, but they're still on the team if they come back
+func (db *DB) GetTeamMembersByTeamID(teamID int64) ([]*TeamMember, error) {
+  sqlStatement := teamMemberSelectStatement + `
+    WHERE
+      team_members.team_id = $1
+      AND users.deleted_at IS NULL
+    ORDER BY
+      team_members.created
+  `
+  rows, err := db.Query(sqlStatement, teamID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  teamMembers := make([]*TeamMember, 0)
+  for rows.Next() {
+    teamMember, err := scanTeamMember(rows)
+    if err != nil {
+      return nil, err
+    }
+
+    teamMembers = append(teamMembers, teamMember)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return teamMembers, nil
+}
+
+
+// GetTeamMember gets a user's membership on a team;
+// returns sql.ErrNoRows if they aren't on it
+func (db *DB) GetTeamMember(teamID int64, userID int64) (*TeamMember, error) {
+  sqlStatement := teamMemberSelectStatement + `
+    WHERE
+      team_members.team_id = $1
+      AND team_members.user_id = $2
+      AND users.deleted_at IS NULL
+  `
+  row := db.QueryRow(sqlStatement, teamID, userID)
+
+  return scanTeamMember(row)
+}
+
+
+// CreateTeam adds a new entry to the teams table in
+// our database, with the user creating it as its owner
+func (db *DB) CreateTeam(teamCreate *TeamCreate) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  var teamID int64
+  sqlStatement := `
+    INSERT INTO teams
+      (team_name)
+    VALUES
+      ($1)
+    RETURNING
+      team_id
+  `
+  err = tx.QueryRow(sqlStatement, teamCreate.TeamName).Scan(&teamID)
+  if err != nil {
+    return 0, err
+  }
+
+  _, err = tx.Exec(`
+    INSERT INTO team_members
+      (team_id, user_id, team_role)
+    VALUES
+      ($1, $2, $3)
+  `, teamID, teamCreate.UserID, TeamRoleOwner)
+  if err != nil {
+    return 0, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return 0, err
+  }
+
+  return teamID, nil
+}
+
+
+// UpdateTeam updates an existing entry in the teams table
+func (db *DB) UpdateTeam(teamUpdate *TeamUpdate) (int64, error) {
+  var teamID int64
+  sqlStatement := `
+    UPDATE
+      teams
+    SET
+      team_name = $1
+    WHERE
+      team_id = $2
+    RETURNING
+      team_id
+  `
+  row := db.QueryRow(sqlStatement, teamUpdate.TeamName, teamUpdate.TeamID)
+
+  err := row.Scan(&teamID)
+  if err != nil {
+    return 0, err
+  }
+
+  return teamID, nil
+}
+
+
+// DeleteTeamByTeamID removes a team, along with its members and invites
+func (db *DB) DeleteTeamByTeamID(teamID int64) (int64, error) {
+  var deletedTeamID int64
+  sqlStatement := `
+    DELETE FROM
+      teams
+    WHERE
+      team_id = $1
+    RETURNING
+      team_id
+  `
+  row := db.QueryRow(sqlStatement, teamID)
+
+  err := row.Scan(&deletedTeamID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedTeamID, nil
+}
+
+
+// UpdateTeamMemberRole changes a member's role on a team;
+// returns sql.ErrNoRows if they aren't on it
+func (db *DB) UpdateTeamMemberRole(teamMemberUpdate *TeamMemberUpdate) (int64, error) {
+  var teamMemberID int64
+  sqlStatement := `
+    UPDATE
+      team_members
+    SET
+      team_role = $1
+    WHERE
+      team_id = $2
+      AND user_id = $3
+    RETURNING
+      team_member_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    teamMemberUpdate.TeamRole,
+    teamMemberUpdate.TeamID,
+    teamMemberUpdate.UserID,
+  )
+
+  err := row.Scan(&teamMemberID)
+  if err != nil {
+    return 0, err
+  }
+
+  return teamMemberID, nil
+}
+
+
+// DeleteTeamMember removes a member from a team;
+// returns sql.ErrNoRows if they aren't on it
+func (db *DB) DeleteTeamMember(teamMemberDelete *TeamMemberDelete) (int64, error) {
+  var teamMemberID int64
+  sqlStatement := `
+    DELETE FROM
+      team_members
+    WHERE
+      team_id = $1
+      AND user_id = $2
+    RETURNING
+      team_member_id
+  `
+  row := db.QueryRow(sqlStatement, teamMemberDelete.TeamID, teamMemberDelete.UserID)
+
+  err := row.Scan(&teamMemberID)
+  if err != nil {
+    return 0, err
+  }
+
+  return teamMemberID, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// scanTeamMember scans a single row selected with teamMemberSelectStatement into a TeamMember
+func scanTeamMember(row rowScanner) (*TeamMember, error) {
+  teamMember := new(TeamMember)
+  err := row.Scan(
+    &teamMember.TeamMemberID,
+    &teamMember.TeamID,
+    &teamMember.UserID,
+    &teamMember.UserName,
+    &teamMember.TeamRole,
+    &teamMember.Created,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return teamMember, nil
+}
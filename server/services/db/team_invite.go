@@ -0,0 +1,284 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TeamInviteManager describes all of the methods used
+// to interact with the team_invites table in our database
+type TeamInviteManager interface {
+  GetPendingTeamInvitesByTeamID(teamID int64) ([]*TeamInvite, error)
+  GetTeamInviteByHashedToken(hashedToken string) (*TeamInvite, error)
+
+  CreateTeamInvite(teamInviteCreate *TeamInviteCreate) (int64, error)
+  AcceptTeamInvite(teamInviteAccept *TeamInviteAccept) (int64, error)
+  RevokeTeamInvite(teamInviteRevoke *TeamInviteRevoke) (int64, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// TeamInvite describes an emailed invite to join a team with a given role;
+// the token itself is never stored, only a hash of it
+type TeamInvite struct {
+  TeamInviteID     int64          `json:"teamInviteId"`
+  TeamID           int64          `json:"teamId"`
+  TeamName         string         `json:"teamName"`
+  EmailAddress     string         `json:"emailAddress"`
+  TeamRole         string         `json:"teamRole"`
+  InvitedByUserID  NullInt64JSON  `json:"invitedByUserId"`
+  Created          time.Time      `json:"created"`
+  ExpiresAt        time.Time      `json:"expiresAt"`
+  AcceptedAt       NullTimeJSON   `json:"acceptedAt"`
+  RevokedAt        NullTimeJSON   `json:"revokedAt"`
+}
+
+
+// TeamInviteCreate describes the data needed
+// to create a new team invite in our db
+type TeamInviteCreate struct {
+  TeamID           int64      `json:"teamId"`
+  EmailAddress     string     `json:"emailAddress"`
+  TeamRole         string     `json:"teamRole"`
+  HashedToken      string     `json:"-"`
+  InvitedByUserID  int64      `json:"-"`
+  ExpiresAt        time.Time  `json:"-"`
+}
+
+
+// TeamInviteAccept describes the data needed for a user to accept a team invite
+type TeamInviteAccept struct {
+  TeamInviteID  int64  `json:"teamInviteId"`
+  UserID        int64  `json:"userId"`
+}
+
+
+// TeamInviteRevoke describes the data needed to revoke a team invite;
+// it has to belong to the team whoever's revoking it manages
+type TeamInviteRevoke struct {
+  TeamInviteID  int64  `json:"teamInviteId"`
+  TeamID        int64  `json:"teamId"`
+}
+
+
+/*---------------------------------
+        Shared SQL Statements
+----------------------------------*/
+
+// teamInviteSelectStatement is the SELECT shared by all of our team invite queries
+const teamInviteSelectStatement = `
+    SELECT
+      team_invites.team_invite_id      AS  team_invite_id,
+      team_invites.team_id             AS  team_id,
+      teams.team_name                  AS  team_name,
+      team_invites.email_address       AS  email_address,
+      team_invites.team_role           AS  team_role,
+      team_invites.invited_by_user_id  AS  invited_by_user_id,
+      team_invites.created             AS  created,
+      team_invites.expires_at          AS  expires_at,
+      team_invites.accepted_at         AS  accepted_at,
+      team_invites.revoked_at          AS  revoked_at
+    FROM
+      team_invites
+    INNER JOIN teams ON teams.team_id = team_invites.team_id
+`
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetPendingTeamInvitesByTeamID gets every invite to a team that
+// can still be accepted (not accepted, revoked or expired), newest first
+func (db *DB) GetPendingTeamInvitesByTeamID(teamID int64) ([]*TeamInvite, error) {
+  sqlStatement := teamInviteSelectStatement + `
+    WHERE
+      team_invites.team_id = $1
+      AND team_invites.accepted_at IS NULL
+      AND team_invites.revoked_at IS NULL
+      AND team_invites.expires_at > CURRENT_TIMESTAMP
+    ORDER BY
+      team_invites.created DESC
+  `
+  rows, err := db.Query(sqlStatement, teamID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  teamInvites := make([]*TeamInvite, 0)
+  for rows.Next() {
+    teamInvite, err := scanTeamInvite(rows)
+    if err != nil {
+      return nil, err
+    }
+
+    teamInvites = append(teamInvites, teamInvite)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return teamInvites, nil
+}
+
+
+// GetTeamInviteByHashedToken gets the team invite with the given token hash, but only if it can
+// still be accepted (not accepted, revoked or expired). Returns sql.ErrNoRows otherwise
+func (db *DB) GetTeamInviteByHashedToken(hashedToken string) (*TeamInvite, error) {
+  sqlStatement := teamInviteSelectStatement + `
+    WHERE
+      team_invites.hashed_token = $1
+      AND team_invites.accepted_at IS NULL
+      AND team_invites.revoked_at IS NULL
+      AND team_invites.expires_at > CURRENT_TIMESTAMP
+  `
+  row := db.QueryRow(sqlStatement, hashedToken)
+
+  return scanTeamInvite(row)
+}
+
+
+// CreateTeamInvite adds a new entry to the team_invites table in our database
+func (db *DB) CreateTeamInvite(teamInviteCreate *TeamInviteCreate) (int64, error) {
+  var teamInviteID int64
+  sqlStatement := `
+    INSERT INTO team_invites
+      (team_id, email_address, team_role, hashed_token, invited_by_user_id, expires_at)
+    VALUES
+      ($1, $2, $3, $4, $5, $6)
+    RETURNING
+      team_invite_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    teamInviteCreate.TeamID,
+    teamInviteCreate.EmailAddress,
+    teamInviteCreate.TeamRole,
+    teamInviteCreate.HashedToken,
+    teamInviteCreate.InvitedByUserID,
+    teamInviteCreate.ExpiresAt,
+  )
+
+  err := row.Scan(&teamInviteID)
+  if err != nil {
+    return 0, err
+  }
+
+  return teamInviteID, nil
+}
+
+
+// AcceptTeamInvite uses up a team invite and adds the user accepting it to the team. Returns
+// sql.ErrNoRows if the invite was already accepted, revoked, or expired in the meantime. Users
+// already on the team keep the role they have
+func (db *DB) AcceptTeamInvite(teamInviteAccept *TeamInviteAccept) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  var teamID int64
+  var teamRole string
+  sqlStatement := `
+    UPDATE
+      team_invites
+    SET
+      accepted_at = CURRENT_TIMESTAMP
+    WHERE
+      team_invite_id = $1
+      AND accepted_at IS NULL
+      AND revoked_at IS NULL
+      AND expires_at > CURRENT_TIMESTAMP
+    RETURNING
+      team_id,
+      team_role
+  `
+  err = tx.QueryRow(sqlStatement, teamInviteAccept.TeamInviteID).Scan(&teamID, &teamRole)
+  if err != nil {
+    return 0, err
+  }
+
+  _, err = tx.Exec(`
+    INSERT INTO team_members
+      (team_id, user_id, team_role)
+    VALUES
+      ($1, $2, $3)
+    ON CONFLICT (team_id, user_id) DO NOTHING
+  `, teamID, teamInviteAccept.UserID, teamRole)
+  if err != nil {
+    return 0, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return 0, err
+  }
+
+  return teamID, nil
+}
+
+
+// RevokeTeamInvite stops a team invite from working; returns sql.ErrNoRows
+// if the invite isn't for the given team or can't be accepted anymore anyway
+func (db *DB) RevokeTeamInvite(teamInviteRevoke *TeamInviteRevoke) (int64, error) {
+  var teamInviteID int64
+  sqlStatement := `
+    UPDATE
+      team_invites
+    SET
+      revoked_at = CURRENT_TIMESTAMP
+    WHERE
+      team_invite_id = $1
+      AND team_id = $2
+      AND accepted_at IS NULL
+      AND revoked_at IS NULL
+    RETURNING
+      team_invite_id
+  `
+  row := db.QueryRow(sqlStatement, teamInviteRevoke.TeamInviteID, teamInviteRevoke.TeamID)
+
+  err := row.Scan(&teamInviteID)
+  if err != nil {
+    return 0, err
+  }
+
+  return teamInviteID, nil
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// scanTeamInvite scans a single row selected with teamInviteSelectStatement into a TeamInvite
+func scanTeamInvite(row rowScanner) (*TeamInvite, error) {
+  teamInvite := new(TeamInvite)
+  err := row.Scan(
+    &teamInvite.TeamInviteID,
+    &teamInvite.TeamID,
+    &teamInvite.TeamName,
+    &teamInvite.EmailAddress,
+    &teamInvite.TeamRole,
+    &teamInvite.InvitedByUserID,
+    &teamInvite.Created,
+    &teamInvite.ExpiresAt,
+    &teamInvite.AcceptedAt,
+    &teamInvite.RevokedAt,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return teamInvite, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TeamStatsViewManager describes all of the methods used to get aggregated match
+// results across everyone on a team (data joined between matches, team_members, and characters)
+type TeamStatsViewManager interface {
+  GetTeamMatchupWinRateViewsByTeamID(teamID int64) ([]*TeamMatchupWinRateView, error)
+  GetTeamMemberMatchupWinRateViewsByTeamID(teamID int64) ([]*TeamMemberMatchupWinRateView, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// TeamMatchupWinRateView describes a whole team's
+// win rate against a given opponent character
+type TeamMatchupWinRateView struct {
+  OpponentCharacterID    int64   `json:"opponentCharacterId"`
+  OpponentCharacterName  string  `json:"opponentCharacterName"`
+  WinRecord
+}
+
+
+// TeamMemberMatchupWinRateView describes a single team
+// member's win rate against a given opponent character
+type TeamMemberMatchupWinRateView struct {
+  UserID                 int64   `json:"userId"`
+  UserName               string  `json:"userName"`
+  OpponentCharacterID    int64   `json:"opponentCharacterId"`
+  OpponentCharacterName  string  `json:"opponentCharacterName"`
+  WinRecord
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetTeamMatchupWinRateViewsByTeamID gets the team-wide win rate against every
+// opponent character anyone on the team has recorded a match against
+func (db *DB) GetTeamMatchupWinRateViewsByTeamID(teamID int64) ([]*TeamMatchupWinRateView, error) {
+  sqlStatement := `
+    SELECT
+      opponent_character.character_id                      AS opponent_character_id,
+      opponent_character.character_name                    AS opponent_character_name,
+      COUNT(*) FILTER (WHERE matches.user_win = true)      AS wins,
+      COUNT(*) FILTER (WHERE matches.user_win = false)     AS losses
+    FROM
+      matches
+    INNER JOIN team_members ON team_members.user_id = matches.user_id
+    INNER JOIN users ON users.user_id = matches.user_id
+    INNER JOIN characters opponent_character ON opponent_character.character_id = matches.opponent_character_id
+    WHERE
+      team_members.team_id = $1
+      AND users.deleted_at IS NULL
+      AND matches.deleted_at IS NULL
+    GROUP BY
+      opponent_character.character_id,
+      opponent_character.character_name
+    ORDER BY
+      opponent_character.character_id
+  `
+  rows, err := db.Query(sqlStatement, teamID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  teamMatchupWinRateViews := make([]*TeamMatchupWinRateView, 0)
+  for rows.Next() {
+    teamMatchupWinRateView := new(TeamMatchupWinRateView)
+    err := rows.Scan(
+      &teamMatchupWinRateView.OpponentCharacterID,
+      &teamMatchupWinRateView.OpponentCharacterName,
+      &teamMatchupWinRateView.Wins,
+      &teamMatchupWinRateView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    teamMatchupWinRateView.calculateWinRate()
+    teamMatchupWinRateViews = append(teamMatchupWinRateViews, teamMatchupWinRateView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return teamMatchupWinRateViews, nil
+}
+
+
+// GetTeamMemberMatchupWinRateViewsByTeamID gets every team member's win rate against every opponent
+// character they've recorded a match against, so the team can see who struggles against what
+func (db *DB) GetTeamMemberMatchupWinRateViewsByTeamID(teamID int64) ([]*TeamMemberMatchupWinRateView, error) {
+  sqlStatement := `
+    SELECT
+      users.user_id                                        AS user_id,
+      users.user_name                                      AS user_name,
+      opponent_character.character_id                      AS opponent_character_id,
+      opponent_character.character_name                    AS opponent_character_name,
+      COUNT(*) FILTER (WHERE matches.user_win = true)      AS wins,
+      COUNT(*) FILTER (WHERE matches.user_win = false)     AS losses
+    FROM
+      matches
+    INNER JOIN team_members ON team_members.user_id = matches.user_id
+    INNER JOIN users ON users.user_id = matches.user_id
+    INNER JOIN characters opponent_character ON opponent_character.character_id = matches.opponent_character_id
+    WHERE
+      team_members.team_id = $1
+      AND users.deleted_at IS NULL
+      AND matches.deleted_at IS NULL
+    GROUP BY
+      users.user_id,
+      users.user_name,
+      opponent_character.character_id,
+      opponent_character.character_name
+    ORDER BY
+      users.user_id,
+      opponent_character.character_id
+  `
+  rows, err := db.Query(sqlStatement, teamID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  teamMemberMatchupWinRateViews := make([]*TeamMemberMatchupWinRateView, 0)
+  for rows.Next() {
+    teamMemberMatchupWinRateView := new(TeamMemberMatchupWinRateView)
+    err := rows.Scan(
+      &teamMemberMatchupWinRateView.UserID,
+      &teamMemberMatchupWinRateView.UserName,
+      &teamMemberMatchupWinRateView.OpponentCharacterID,
+      &teamMemberMatchupWinRateView.OpponentCharacterName,
+      &teamMemberMatchupWinRateView.Wins,
+      &teamMemberMatchupWinRateView.Losses,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    teamMemberMatchupWinRateView.calculateWinRate()
+    teamMemberMatchupWinRateViews = append(teamMemberMatchupWinRateViews, teamMemberMatchupWinRateView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return teamMemberMatchupWinRateViews, nil
+}
@@ -0,0 +1,389 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TwoFactorManager describes all of the methods used to interact with
+// users' two-factor auth settings and the recovery_codes table in our database
+type TwoFactorManager interface {
+  GetUserTwoFactorByUserID(userID int64) (*UserTwoFactor, error)
+  GetNumUnusedRecoveryCodesByUserID(userID int64) (int64, error)
+
+  UpdateUserTwoFactor(twoFactorUpdate *UserTwoFactorUpdate) (int64, error)
+  UpdateUserTOTPLastStep(totpStepUpdate *UserTOTPStepUpdate) (int64, error)
+  ReplaceRecoveryCodes(recoveryCodesReplace *RecoveryCodesReplace) error
+  UseRecoveryCode(recoveryCodeUse *RecoveryCodeUse) (int64, error)
+  ResetUserTwoFactor(userID int64) (int64, error)
+
+  UpdateUserTwoFactorLoginToken(loginTokenUpdate *UserTwoFactorLoginTokenUpdate) (int64, error)
+  UseUserTwoFactorLoginToken(loginTokenUpdate *UserTwoFactorLoginTokenUpdate) (int64, error)
+  RecordTwoFactorFailure(twoFactorFailure *UserTwoFactorFailure) (bool, error)
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// UserTwoFactor describes a user's two-factor auth settings
+type UserTwoFactor struct {
+  UserID        int64           `json:"userId"`
+  TOTPSecret    NullStringJSON  `json:"-"`
+  TOTPEnabled   bool            `json:"totpEnabled"`
+  TOTPLastStep  NullInt64JSON   `json:"-"`
+  // The hash of the pending two-factor log in token, and how close the user is to being locked out
+  LoginToken      NullStringJSON  `json:"-"`
+  FailedAttempts  int64           `json:"-"`
+  LockedUntil     NullTimeJSON    `json:"-"`
+}
+
+
+// UserTwoFactorUpdate describes the data needed
+// to update a given user's TOTP secret and whether it's required
+type UserTwoFactorUpdate struct {
+  UserID       int64           `json:"userId"`
+  TOTPSecret   NullStringJSON  `json:"-"`
+  TOTPEnabled  bool            `json:"totpEnabled"`
+}
+
+
+// UserTOTPStepUpdate describes the data needed to record the time step of a TOTP code a user just used
+type UserTOTPStepUpdate struct {
+  UserID  int64  `json:"userId"`
+  Step    int64  `json:"step"`
+}
+
+
+// UserTwoFactorLoginTokenUpdate describes the data needed to give a user a new pending
+// two-factor log in token, or to use theirs up; only the hash of the token is stored
+type UserTwoFactorLoginTokenUpdate struct {
+  UserID            int64   `json:"userId"`
+  HashedLoginToken  string  `json:"-"`
+}
+
+
+// UserTwoFactorFailure describes the data needed to record a wrong two-factor code;
+// the user is locked out until LockedUntil once they reach MaxAttempts in a row
+type UserTwoFactorFailure struct {
+  UserID       int64      `json:"userId"`
+  MaxAttempts  int64      `json:"maxAttempts"`
+  LockedUntil  time.Time  `json:"lockedUntil"`
+}
+
+
+// RecoveryCodesReplace describes the data needed to
+// replace all of a user's recovery codes with new ones
+type RecoveryCodesReplace struct {
+  UserID        int64     `json:"userId"`
+  HashedCodes   []string  `json:"-"`
+}
+
+
+// RecoveryCodeUse describes the data needed to use up one of a user's recovery codes
+type RecoveryCodeUse struct {
+  UserID      int64   `json:"userId"`
+  HashedCode  string  `json:"-"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetUserTwoFactorByUserID gets a user's two-factor auth settings
+func (db *DB) GetUserTwoFactorByUserID(userID int64) (*UserTwoFactor, error) {
+  sqlStatement := `
+    SELECT
+      user_id,
+      totp_secret,
+      totp_enabled,
+      totp_last_step,
+      two_factor_login_token,
+      two_factor_failed_attempts,
+      two_factor_locked_until
+    FROM
+      users
+    WHERE
+      user_id = $1
+  `
+  row := db.QueryRow(sqlStatement, userID)
+  userTwoFactor := new(UserTwoFactor)
+  err := row.Scan(
+    &userTwoFactor.UserID,
+    &userTwoFactor.TOTPSecret,
+    &userTwoFactor.TOTPEnabled,
+    &userTwoFactor.TOTPLastStep,
+    &userTwoFactor.LoginToken,
+    &userTwoFactor.FailedAttempts,
+    &userTwoFactor.LockedUntil,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return userTwoFactor, nil
+}
+
+
+// GetNumUnusedRecoveryCodesByUserID gets how many recovery codes a user has left
+func (db *DB) GetNumUnusedRecoveryCodesByUserID(userID int64) (int64, error) {
+  var numRecoveryCodes int64
+  sqlStatement := `
+    SELECT
+      COUNT(*)
+    FROM
+      recovery_codes
+    WHERE
+      user_id = $1
+      AND used_at IS NULL
+  `
+  err := db.QueryRow(sqlStatement, userID).Scan(&numRecoveryCodes)
+  if err != nil {
+    return 0, err
+  }
+
+  return numRecoveryCodes, nil
+}
+
+
+// UpdateUserTwoFactor updates a user's TOTP secret and whether it's required at log in;
+// a new secret hasn't had any codes used for it yet, so the last used step is cleared
+func (db *DB) UpdateUserTwoFactor(twoFactorUpdate *UserTwoFactorUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      totp_secret = $1,
+      totp_enabled = $2,
+      totp_last_step = CASE WHEN totp_secret IS DISTINCT FROM $1 THEN NULL ELSE totp_last_step END
+    WHERE
+      user_id = $3
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    twoFactorUpdate.TOTPSecret,
+    twoFactorUpdate.TOTPEnabled,
+    twoFactorUpdate.UserID,
+  )
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// UpdateUserTOTPLastStep records the time step of a TOTP code a user just used, as long as it's
+// later than the last one. Returns sql.ErrNoRows if it isn't, meaning the code was already used
+func (db *DB) UpdateUserTOTPLastStep(totpStepUpdate *UserTOTPStepUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      totp_last_step = $1
+    WHERE
+      user_id = $2
+      AND (totp_last_step IS NULL OR totp_last_step < $1)
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(sqlStatement, totpStepUpdate.Step, totpStepUpdate.UserID)
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// ReplaceRecoveryCodes removes all of a user's recovery codes, used or not, and adds the new ones
+func (db *DB) ReplaceRecoveryCodes(recoveryCodesReplace *RecoveryCodesReplace) error {
+  tx, err := db.Begin()
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  _, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, recoveryCodesReplace.UserID)
+  if err != nil {
+    return err
+  }
+
+  for _, hashedCode := range recoveryCodesReplace.HashedCodes {
+    _, err = tx.Exec(
+      `INSERT INTO recovery_codes (user_id, hashed_code) VALUES ($1, $2)`,
+      recoveryCodesReplace.UserID,
+      hashedCode,
+    )
+    if err != nil {
+      return err
+    }
+  }
+
+  return tx.Commit()
+}
+
+
+// UseRecoveryCode marks one of a user's unused recovery codes as used.
+// Returns sql.ErrNoRows if the user has no unused code with the given hash
+func (db *DB) UseRecoveryCode(recoveryCodeUse *RecoveryCodeUse) (int64, error) {
+  var recoveryCodeID int64
+  sqlStatement := `
+    UPDATE
+      recovery_codes
+    SET
+      used_at = CURRENT_TIMESTAMP
+    WHERE
+      recovery_code_id = (
+        SELECT recovery_code_id FROM recovery_codes
+        WHERE user_id = $1 AND hashed_code = $2 AND used_at IS NULL
+        LIMIT 1
+      )
+    RETURNING
+      recovery_code_id
+  `
+  row := db.QueryRow(sqlStatement, recoveryCodeUse.UserID, recoveryCodeUse.HashedCode)
+  err := row.Scan(&recoveryCodeID)
+  if err != nil {
+    return 0, err
+  }
+
+  return recoveryCodeID, nil
+}
+
+
+// ResetUserTwoFactor turns off a user's two-factor auth entirely, removing
+// their TOTP secret and recovery codes; they can enroll again afterwards
+func (db *DB) ResetUserTwoFactor(userID int64) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  _, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+  if err != nil {
+    return 0, err
+  }
+
+  var resetUserID int64
+  err = tx.QueryRow(`
+    UPDATE
+      users
+    SET
+      totp_secret = NULL,
+      totp_enabled = false,
+      totp_last_step = NULL,
+      two_factor_login_token = NULL,
+      two_factor_failed_attempts = 0,
+      two_factor_locked_until = NULL
+    WHERE
+      user_id = $1
+    RETURNING
+      user_id
+  `, userID).Scan(&resetUserID)
+  if err != nil {
+    return 0, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return 0, err
+  }
+
+  return resetUserID, nil
+}
+
+
+// UpdateUserTwoFactorLoginToken gives a user a new pending two-factor log in token,
+// replacing any earlier one so only the latest log in can be finished
+func (db *DB) UpdateUserTwoFactorLoginToken(loginTokenUpdate *UserTwoFactorLoginTokenUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      two_factor_login_token = $1
+    WHERE
+      user_id = $2
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(sqlStatement, loginTokenUpdate.HashedLoginToken, loginTokenUpdate.UserID)
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// UseUserTwoFactorLoginToken uses up a user's pending two-factor log in token after a right code,
+// and clears their failed attempts. Returns sql.ErrNoRows if it isn't their pending token anymore
+func (db *DB) UseUserTwoFactorLoginToken(loginTokenUpdate *UserTwoFactorLoginTokenUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      two_factor_login_token = NULL,
+      two_factor_failed_attempts = 0
+    WHERE
+      user_id = $1
+      AND two_factor_login_token = $2
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(sqlStatement, loginTokenUpdate.UserID, loginTokenUpdate.HashedLoginToken)
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// RecordTwoFactorFailure counts a wrong two-factor code against a user. Once they've hit the most
+// attempts in a row, they're locked out, their count starts over, and their pending log in token is
+// thrown out; returns true when this failure locked them out
+func (db *DB) RecordTwoFactorFailure(twoFactorFailure *UserTwoFactorFailure) (bool, error) {
+  var locked bool
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      two_factor_failed_attempts = CASE WHEN two_factor_failed_attempts + 1 >= $2::INTEGER THEN 0 ELSE two_factor_failed_attempts + 1 END,
+      two_factor_locked_until = CASE WHEN two_factor_failed_attempts + 1 >= $2::INTEGER THEN $3::TIMESTAMP ELSE two_factor_locked_until END,
+      two_factor_login_token = CASE WHEN two_factor_failed_attempts + 1 >= $2::INTEGER THEN NULL ELSE two_factor_login_token END
+    WHERE
+      user_id = $1
+    RETURNING
+      two_factor_failed_attempts = 0
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    twoFactorFailure.UserID,
+    twoFactorFailure.MaxAttempts,
+    twoFactorFailure.LockedUntil,
+  )
+  err := row.Scan(&locked)
+  if err != nil {
+    return false, err
+  }
+
+  return locked, nil
+}
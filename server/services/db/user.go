@@ -10,15 +10,22 @@ package db
 type UserManager interface {
   GetAllUsers() ([]*User, error)
   GetUserIDByEmail(email string) (int64, error)
+  GetUserIDByUserName(userName string) (int64, error)
   GetUserResetPasswordTokenByUserID(int64) (string, error)
+  GetUserRefreshTokenByUserID(userID int64) (string, error)
 
   UpdateUserProfile(profileUpdate *UserProfileUpdate) (int64, error)
   UpdateUserRefreshToken(refreshUpdate *UserRefreshUpdate) (int64, error)
   UpdateUserResetPasswordToken(resetPasswordUpdate *UserResetPasswordUpdate) (int64, error)
   UpdateUserHashedPassword(hashedPasswordUpdate *UserHashedPasswordUpdate) (int64, error)
   UpdateUserDefaultUserCharacter(userCharUpdate *UserDefaultUserCharacterUpdate) (int64, error)
+  UpdateUserDisabled(userDisabledUpdate *UserDisabledUpdate) (int64, error)
+  UpdateUserPublicProfile(publicProfileUpdate *UserPublicProfileUpdate) (int64, error)
+  UpdateUserFeedOptOut(feedOptOutUpdate *UserFeedOptOutUpdate) (int64, error)
 
   CreateUser(userCreate *UserCreate) (int64, error)
+  SoftDeleteUserByUserID(userID int64) (int64, error)
+  DeleteUserByUserID(userID int64) (int64, error)
 }
 
 
@@ -72,6 +79,31 @@ type UserHashedPasswordUpdate struct {
   HashedPassword  string  `json:"hashedPassword"`
 }
 
+
+// UserDisabledUpdate describes the data
+// needed to disable or enable a given user
+type UserDisabledUpdate struct {
+  UserID    int64  `json:"userId"`
+  Disabled  bool   `json:"disabled"`
+}
+
+
+// UserPublicProfileUpdate describes the data needed
+// to opt a given user into or out of a public profile
+type UserPublicProfileUpdate struct {
+  UserID         int64  `json:"userId"`
+  PublicProfile  bool   `json:"publicProfile"`
+}
+
+
+// UserFeedOptOutUpdate describes the data needed to opt
+// a given user into or out of their followers' feeds
+type UserFeedOptOutUpdate struct {
+  UserID      int64  `json:"userId"`
+  FeedOptOut  bool   `json:"feedOptOut"`
+}
+
+
 // UserCreate describes the data needed
 // to create a new user in our db
 type UserCreate struct {
@@ -85,7 +117,7 @@ type UserCreate struct {
        Method Implementations
 ----------------------------------*/
 
-// GetAllUsers fetches userId/userName for all users
+// GetAllUsers fetches userId/userName for all users that haven't been deleted
 func (db *DB) GetAllUsers() ([]*User, error) {
   sqlStatement := `
     SELECT
@@ -93,6 +125,8 @@ func (db *DB) GetAllUsers() ([]*User, error) {
       user_name
     FROM
       users
+    WHERE
+      deleted_at IS NULL
   `
   rows, err := db.Query(sqlStatement)
   if err != nil {
@@ -169,6 +203,28 @@ func (db *DB) GetUserResetPasswordTokenByUserID(userID int64) (string, error) {
 }
 
 
+// GetUserRefreshTokenByUserID gets the refresh token we last gave a user; this
+// is empty if they've logged out or have been logged out by an admin
+func (db *DB) GetUserRefreshTokenByUserID(userID int64) (string, error) {
+  var refreshToken string
+  sqlStatement := `
+    SELECT
+      COALESCE(refresh_token, '')
+    FROM
+      users
+    WHERE
+      user_id = $1
+  `
+  row := db.QueryRow(sqlStatement, userID)
+  err := row.Scan(&refreshToken)
+  if err != nil {
+    return "", err
+  }
+
+  return refreshToken, nil
+}
+
+
 // CreateUser adds a new entry to the users table in our database
 func (db *DB) CreateUser(userCreate *UserCreate) (int64, error) {
   var userID int64
@@ -196,6 +252,28 @@ func (db *DB) CreateUser(userCreate *UserCreate) (int64, error) {
 }
 
 
+// GetUserIDByUserName gets a specific user's id from the users table by user name;
+// user names are unique regardless of case, so this ignores case too
+func (db *DB) GetUserIDByUserName(userName string) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    SELECT
+      user_id
+    FROM
+      users
+    WHERE
+      LOWER(user_name) = LOWER($1)
+  `
+  row := db.QueryRow(sqlStatement, userName)
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
 // UpdateUserProfile updates an entry in the users table with the given data
 func (db *DB) UpdateUserProfile(profileUpdate *UserProfileUpdate) (int64, error) {
   var userID int64
@@ -333,3 +411,165 @@ func (db *DB) UpdateUserDefaultUserCharacter(userCharUpdate *UserDefaultUserChar
 
   return userID, nil
 }
+
+
+// UpdateUserDisabled disables or enables a user; deleted users stay disabled
+func (db *DB) UpdateUserDisabled(userDisabledUpdate *UserDisabledUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      disabled = $1
+    WHERE
+      user_id = $2 AND deleted_at IS NULL
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    userDisabledUpdate.Disabled,
+    userDisabledUpdate.UserID,
+  )
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// UpdateUserPublicProfile opts a user into or out of having a public profile
+func (db *DB) UpdateUserPublicProfile(publicProfileUpdate *UserPublicProfileUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      public_profile = $1
+    WHERE
+      user_id = $2
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    publicProfileUpdate.PublicProfile,
+    publicProfileUpdate.UserID,
+  )
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// UpdateUserFeedOptOut opts a user into or out of showing up in their followers' feeds
+func (db *DB) UpdateUserFeedOptOut(feedOptOutUpdate *UserFeedOptOutUpdate) (int64, error) {
+  var userID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      feed_opt_out = $1
+    WHERE
+      user_id = $2
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    feedOptOutUpdate.FeedOptOut,
+    feedOptOutUpdate.UserID,
+  )
+  err := row.Scan(&userID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userID, nil
+}
+
+
+// SoftDeleteUserByUserID marks a user as deleted and disables them, but keeps
+// their row and matches around; they're hidden from everyone but admins
+func (db *DB) SoftDeleteUserByUserID(userID int64) (int64, error) {
+  var deletedUserID int64
+  sqlStatement := `
+    UPDATE
+      users
+    SET
+      deleted_at = CURRENT_TIMESTAMP,
+      disabled = true,
+      refresh_token = NULL,
+      reset_password_token = NULL
+    WHERE
+      user_id = $1 AND deleted_at IS NULL
+    RETURNING
+      user_id
+  `
+  row := db.QueryRow(sqlStatement, userID)
+  err := row.Scan(&deletedUserID)
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedUserID, nil
+}
+
+
+// DeleteUserByUserID completely removes a user along with their matches, saved
+// characters, opponents and private tags, and scrubs their data from the audit log
+func (db *DB) DeleteUserByUserID(userID int64) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  // Match tags block their tags from being deleted, so clear out the user's own match
+  // tags and any other match tags on their private tags before cascading the rest
+  _, err = tx.Exec(`
+    DELETE FROM
+      match_tags
+    WHERE
+      match_id IN (SELECT match_id FROM matches WHERE user_id = $1)
+      OR tag_id IN (SELECT tag_id FROM tags WHERE user_id = $1)
+  `, userID)
+  if err != nil {
+    return 0, err
+  }
+
+  // The audit log outlives the user, but not their data; snapshots of the user themselves (i.e. their
+  // profile, with their email and user name) and of anything else of theirs are emptied out
+  _, err = tx.Exec(`
+    UPDATE
+      audit_log
+    SET
+      before_data = NULL,
+      after_data = NULL
+    WHERE
+      (entity_type = 'user' AND entity_id = $1)
+      OR before_data->>'userId' = $1::TEXT
+      OR after_data->>'userId' = $1::TEXT
+  `, userID)
+  if err != nil {
+    return 0, err
+  }
+
+  var deletedUserID int64
+  err = tx.QueryRow("DELETE FROM users WHERE user_id = $1 RETURNING user_id", userID).Scan(&deletedUserID)
+  if err != nil {
+    return 0, err
+  }
+
+  err = tx.Commit()
+  if err != nil {
+    return 0, err
+  }
+
+  return deletedUserID, nil
+}
@@ -1,5 +1,10 @@
 package db
 
+import (
+  "database/sql"
+  "time"
+)
+
 
 /*---------------------------------
           Data Structures
@@ -45,6 +50,19 @@ type UserCharacterDelete struct {
 }
 
 
+// GspHistory describes a single change to a "saved character"'s GSP;
+// OldGsp is null for the first GSP a character was saved with
+type GspHistory struct {
+  GspHistoryID     int64          `json:"gspHistoryId"`
+  UserCharacterID  int64          `json:"userCharacterId"`
+  UserID           int64          `json:"userId"`
+  CharacterID      int64          `json:"characterId"`
+  OldGsp           NullInt64JSON  `json:"oldGsp"`
+  NewGsp           int64          `json:"newGsp"`
+  Created          time.Time      `json:"created"`
+}
+
+
 /*---------------------------------
             Interface
 ----------------------------------*/
@@ -53,6 +71,7 @@ type UserCharacterDelete struct {
 // to int64eract with the user_characters table in our database
 type UserCharacterManager interface {
   GetUserCharactersByUserID(userID int64) ([]*UserCharacter, error)
+  GetGspHistoryByUserID(userID int64) ([]*GspHistory, error)
 
   CreateUserCharacter(userCharacterCreate *UserCharacterCreate) (int64, error)
   UpdateUserCharacter(userCharacterUpdate *UserCharacterUpdate) (int64, error)
@@ -111,8 +130,67 @@ func (db *DB) GetUserCharactersByUserID(userID int64) ([]*UserCharacter, error)
 }
 
 
-// CreateUserCharacter adds a new entry to the user_characters table
+// GetGspHistoryByUserID gets every GSP change to a user's saved characters, oldest first
+func (db *DB) GetGspHistoryByUserID(userID int64) ([]*GspHistory, error) {
+  sqlStatement := `
+    SELECT
+      gsp_history_id,
+      user_character_id,
+      user_id,
+      character_id,
+      old_gsp,
+      new_gsp,
+      created
+    FROM
+      gsp_history
+    WHERE
+      user_id = $1
+    ORDER BY
+      created
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  gspHistory := make([]*GspHistory, 0)
+  for rows.Next() {
+    gspChange := new(GspHistory)
+    err := rows.Scan(
+      &gspChange.GspHistoryID,
+      &gspChange.UserCharacterID,
+      &gspChange.UserID,
+      &gspChange.CharacterID,
+      &gspChange.OldGsp,
+      &gspChange.NewGsp,
+      &gspChange.Created,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    gspHistory = append(gspHistory, gspChange)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return gspHistory, nil
+}
+
+
+// CreateUserCharacter adds a new entry to the user_characters table,
+// and records its GSP in the gsp_history table if it has one
 func (db *DB) CreateUserCharacter(userCharacterCreate *UserCharacterCreate) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
   var userCharID int64
   sqlStatement := `
     INSERT INTO user_characters
@@ -122,7 +200,7 @@ func (db *DB) CreateUserCharacter(userCharacterCreate *UserCharacterCreate) (int
     RETURNING
       user_character_id
   `
-  row := db.QueryRow(
+  row := tx.QueryRow(
     sqlStatement,
     userCharacterCreate.UserID,
     userCharacterCreate.CharacterID,
@@ -130,7 +208,17 @@ func (db *DB) CreateUserCharacter(userCharacterCreate *UserCharacterCreate) (int
     userCharacterCreate.AltCostume,
   )
 
-  err := row.Scan(&userCharID)
+  err = row.Scan(&userCharID)
+  if err != nil {
+    return 0, err
+  }
+
+  err = insertGspHistory(tx, userCharID, NullInt64JSON{})
+  if err != nil {
+    return 0, err
+  }
+
+  err = tx.Commit()
   if err != nil {
     return 0, err
   }
@@ -139,9 +227,35 @@ func (db *DB) CreateUserCharacter(userCharacterCreate *UserCharacterCreate) (int
 }
 
 
-// UpdateUserCharacter updates an existing entry in the user_characters table
+// UpdateUserCharacter updates an existing entry in the user_characters table,
+// and records the change in the gsp_history table if its GSP changed
 func (db *DB) UpdateUserCharacter(userCharacterUpdate *UserCharacterUpdate) (int64, error) {
+  tx, err := db.Begin()
+  if err != nil {
+    return 0, err
+  }
+  defer tx.Rollback()
+
+  // Lock the row so the old GSP we record is the one we're actually replacing
+  var oldCharacterID int64
+  var oldGsp NullInt64JSON
+  err = tx.QueryRow(`
+    SELECT
+      character_id,
+      character_gsp
+    FROM
+      user_characters
+    WHERE
+      user_character_id = $1
+    FOR UPDATE
+  `, userCharacterUpdate.UserCharacterID).Scan(&oldCharacterID, &oldGsp)
+  if err != nil {
+    return 0, err
+  }
+
   var userCharID int64
+  var newCharacterID int64
+  var newGsp NullInt64JSON
   sqlStatement := `
     UPDATE
       user_characters
@@ -153,9 +267,11 @@ func (db *DB) UpdateUserCharacter(userCharacterUpdate *UserCharacterUpdate) (int
     WHERE
       user_character_id = $5
     RETURNING
-      user_character_id
+      user_character_id,
+      character_id,
+      character_gsp
   `
-  row := db.QueryRow(
+  row := tx.QueryRow(
     sqlStatement,
     userCharacterUpdate.UserID,
     userCharacterUpdate.CharacterID,
@@ -164,7 +280,23 @@ func (db *DB) UpdateUserCharacter(userCharacterUpdate *UserCharacterUpdate) (int
     userCharacterUpdate.UserCharacterID,
   )
 
-  err := row.Scan(&userCharID)
+  err = row.Scan(&userCharID, &newCharacterID, &newGsp)
+  if err != nil {
+    return 0, err
+  }
+
+  // Switching a saved character to a different character starts its GSP over
+  if newCharacterID != oldCharacterID {
+    oldGsp = NullInt64JSON{}
+  }
+  if newGsp != oldGsp {
+    err = insertGspHistory(tx, userCharID, oldGsp)
+    if err != nil {
+      return 0, err
+    }
+  }
+
+  err = tx.Commit()
   if err != nil {
     return 0, err
   }
@@ -193,3 +325,30 @@ func (db *DB) DeleteUserCharacterByID(userCharacterID int64) (int64, error) {
 
   return deletedUserCharID, nil
 }
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// insertGspHistory records a saved character's current GSP in the gsp_history table, along
+// with what it was before; a character without a GSP has nothing to record
+func insertGspHistory(tx *sql.Tx, userCharacterID int64, oldGsp NullInt64JSON) error {
+  _, err := tx.Exec(`
+    INSERT INTO gsp_history
+      (user_character_id, user_id, character_id, old_gsp, new_gsp)
+    SELECT
+      user_character_id,
+      user_id,
+      character_id,
+      $2::INTEGER,
+      character_gsp
+    FROM
+      user_characters
+    WHERE
+      user_character_id = $1
+      AND character_gsp IS NOT NULL
+  `, userCharacterID, oldGsp)
+
+  return err
+}
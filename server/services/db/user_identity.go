@@ -0,0 +1,186 @@
+package db
+
+import (
+  "time"
+)
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// UserIdentityManager describes all of the methods used
+// to interact with the user_identities table in our database
+type UserIdentityManager interface {
+  GetUserIdentitiesByUserID(userID int64) ([]*UserIdentity, error)
+  GetUserIdentityByIssuerAndSubject(issuer string, subject string) (*UserIdentity, error)
+
+  CreateUserIdentity(userIdentityCreate *UserIdentityCreate) (int64, error)
+  UpdateUserIdentityLastLogin(userIdentityID int64) error
+}
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// UserIdentity describes a user's account with an
+// OpenID Connect provider they can log in with
+type UserIdentity struct {
+  UserIdentityID  int64           `json:"userIdentityId"`
+  UserID          int64           `json:"userId"`
+  Issuer          string          `json:"issuer"`
+  Subject         string          `json:"subject"`
+  EmailAddress    NullStringJSON  `json:"emailAddress"`
+  Created         time.Time       `json:"created"`
+  LastLogin       NullTimeJSON    `json:"lastLogin"`
+}
+
+
+// UserIdentityCreate describes the data needed
+// to link a new identity to a user in our db
+type UserIdentityCreate struct {
+  UserID        int64           `json:"userId"`
+  Issuer        string          `json:"issuer"`
+  Subject       string          `json:"subject"`
+  EmailAddress  NullStringJSON  `json:"emailAddress"`
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// GetUserIdentitiesByUserID gets every identity linked to a user
+func (db *DB) GetUserIdentitiesByUserID(userID int64) ([]*UserIdentity, error) {
+  sqlStatement := `
+    SELECT
+      user_identity_id,
+      user_id,
+      issuer,
+      subject,
+      email_address,
+      created,
+      last_login
+    FROM
+      user_identities
+    WHERE
+      user_id = $1
+    ORDER BY
+      created
+  `
+  rows, err := db.Query(sqlStatement, userID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  userIdentities := make([]*UserIdentity, 0)
+  for rows.Next() {
+    userIdentity, err := scanUserIdentity(rows)
+    if err != nil {
+      return nil, err
+    }
+
+    userIdentities = append(userIdentities, userIdentity)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return userIdentities, nil
+}
+
+
+// GetUserIdentityByIssuerAndSubject gets the identity a provider knows
+// a user by; returns sql.ErrNoRows if it isn't linked to anyone
+func (db *DB) GetUserIdentityByIssuerAndSubject(issuer string, subject string) (*UserIdentity, error) {
+  sqlStatement := `
+    SELECT
+      user_identity_id,
+      user_id,
+      issuer,
+      subject,
+      email_address,
+      created,
+      last_login
+    FROM
+      user_identities
+    WHERE
+      issuer = $1
+      AND subject = $2
+  `
+  row := db.QueryRow(sqlStatement, issuer, subject)
+
+  return scanUserIdentity(row)
+}
+
+
+// CreateUserIdentity adds a new entry to the user_identities table in our database
+func (db *DB) CreateUserIdentity(userIdentityCreate *UserIdentityCreate) (int64, error) {
+  var userIdentityID int64
+  sqlStatement := `
+    INSERT INTO user_identities
+      (user_id, issuer, subject, email_address)
+    VALUES
+      ($1, $2, $3, $4)
+    RETURNING
+      user_identity_id
+  `
+  row := db.QueryRow(
+    sqlStatement,
+    userIdentityCreate.UserID,
+    userIdentityCreate.Issuer,
+    userIdentityCreate.Subject,
+    userIdentityCreate.EmailAddress,
+  )
+
+  err := row.Scan(&userIdentityID)
+  if err != nil {
+    return 0, err
+  }
+
+  return userIdentityID, nil
+}
+
+
+// UpdateUserIdentityLastLogin records that a user just logged in with one of their identities
+func (db *DB) UpdateUserIdentityLastLogin(userIdentityID int64) error {
+  sqlStatement := `
+    UPDATE
+      user_identities
+    SET
+      last_login = CURRENT_TIMESTAMP
+    WHERE
+      user_identity_id = $1
+  `
+  _, err := db.Exec(sqlStatement, userIdentityID)
+
+  return err
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// scanUserIdentity scans a single row from the user_identities table into a UserIdentity
+func scanUserIdentity(row rowScanner) (*UserIdentity, error) {
+  userIdentity := new(UserIdentity)
+  err := row.Scan(
+    &userIdentity.UserIdentityID,
+    &userIdentity.UserID,
+    &userIdentity.Issuer,
+    &userIdentity.Subject,
+    &userIdentity.EmailAddress,
+    &userIdentity.Created,
+    &userIdentity.LastLogin,
+  )
+  if err != nil {
+    return nil, err
+  }
+
+  return userIdentity, nil
+}
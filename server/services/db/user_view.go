@@ -16,6 +16,9 @@ type UserProfileView struct {
   UserName                      string          `json:"userName"`
   EmailAddress                  string          `json:"emailAddress"`
   Created                       time.Time       `json:"created"`
+  PublicProfile                 bool            `json:"publicProfile"`
+  TwoFactorEnabled              bool            `json:"twoFactorEnabled"`
+  FeedOptOut                    bool            `json:"feedOptOut"`
 
   // Data from characters
   DefaultCharacterID            NullInt64JSON   `json:"defaultCharacterId"`
@@ -27,15 +30,20 @@ type UserProfileView struct {
 
   // Data from user_roles
   UserRoles                     []*UserRoleView  `json:"userRoles"`
+
+  // Data from role_permissions; every permission granted by the user's roles
+  UserPermissions               []string         `json:"userPermissions"`
 }
 
 // UserCredentialsView describes all of the data
 // needed for a user's authentication credentials
 type UserCredentialsView struct {
-  EmailAddress    string  `json:"email"`
-  UserID          int64   `json:"userId"`
-  UserName        string  `json:"userName"`
-  HashedPassword  string  `json:"hashedPassword"`
+  EmailAddress      string  `json:"email"`
+  UserID            int64   `json:"userId"`
+  UserName          string  `json:"userName"`
+  HashedPassword    string  `json:"hashedPassword"`
+  Disabled          bool    `json:"disabled"`
+  TwoFactorEnabled  bool    `json:"twoFactorEnabled"`
 }
 
 /*---------------------------------
@@ -47,6 +55,8 @@ type UserCredentialsView struct {
 type UserViewManager interface {
   GetUserProfileViewByUserID(userID int64) (*UserProfileView, error)
   GetUserCredentialsViewByEmail(email string) (*UserCredentialsView, error)
+  GetUserCredentialsViewsByEmailIgnoringCase(email string) ([]*UserCredentialsView, error)
+  GetUserCredentialsViewByUserID(userID int64) (*UserCredentialsView, error)
 }
 
 /*---------------------------------
@@ -62,6 +72,9 @@ func (db *DB) GetUserProfileViewByUserID(userID int64) (*UserProfileView, error)
       users.user_name                    AS  user_name,
       users.email_address                AS  email_address,
       users.created                      AS  created,
+      users.public_profile               AS  public_profile,
+      users.totp_enabled                 AS  two_factor_enabled,
+      users.feed_opt_out                 AS  feed_opt_out,
       characters.character_id            AS  default_character_id,
       characters.character_name          AS  default_character_name,
       user_characters.user_character_id  AS  default_user_character_id,
@@ -80,6 +93,9 @@ func (db *DB) GetUserProfileViewByUserID(userID int64) (*UserProfileView, error)
     &userProfileView.UserName,
     &userProfileView.EmailAddress,
     &userProfileView.Created,
+    &userProfileView.PublicProfile,
+    &userProfileView.TwoFactorEnabled,
+    &userProfileView.FeedOptOut,
     &userProfileView.DefaultCharacterID,
     &userProfileView.DefaultCharacterName,
     &userProfileView.DefaultUserCharacterID,
@@ -101,7 +117,9 @@ func (db *DB) GetUserCredentialsViewByEmail(email string) (*UserCredentialsView,
       user_id,
       user_name,
       email_address,
-      hashed_password
+      hashed_password,
+      disabled,
+      totp_enabled
     FROM
       users
     WHERE
@@ -114,6 +132,94 @@ func (db *DB) GetUserCredentialsViewByEmail(email string) (*UserCredentialsView,
     &userCredentialsView.UserName,
     &userCredentialsView.EmailAddress,
     &userCredentialsView.HashedPassword,
+    &userCredentialsView.Disabled,
+    &userCredentialsView.TwoFactorEnabled,
+  )
+
+  if err != nil {
+    return nil, err
+  }
+
+  return userCredentialsView, nil
+}
+
+
+// GetUserCredentialsViewsByEmailIgnoringCase gets the auth related information of every user whose
+// email matches regardless of case; emails are only unique as typed, so there can be more than one
+func (db *DB) GetUserCredentialsViewsByEmailIgnoringCase(email string) ([]*UserCredentialsView, error) {
+  sqlStatement := `
+    SELECT
+      user_id,
+      user_name,
+      email_address,
+      hashed_password,
+      disabled,
+      totp_enabled
+    FROM
+      users
+    WHERE
+      LOWER(email_address) = LOWER($1)
+    ORDER BY
+      user_id
+  `
+  rows, err := db.Query(sqlStatement, email)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  userCredentialsViews := make([]*UserCredentialsView, 0)
+  for rows.Next() {
+    userCredentialsView := new(UserCredentialsView)
+    err := rows.Scan(
+      &userCredentialsView.UserID,
+      &userCredentialsView.UserName,
+      &userCredentialsView.EmailAddress,
+      &userCredentialsView.HashedPassword,
+      &userCredentialsView.Disabled,
+      &userCredentialsView.TwoFactorEnabled,
+    )
+    if err != nil {
+      return nil, err
+    }
+
+    userCredentialsViews = append(userCredentialsViews, userCredentialsView)
+  }
+
+  err = rows.Err()
+  if err != nil {
+    return nil, err
+  }
+
+  return userCredentialsViews, nil
+}
+
+
+// GetUserCredentialsViewByUserID gets a user's auth related information by
+// their ID; used when they've logged in some other way than their email
+func (db *DB) GetUserCredentialsViewByUserID(userID int64) (*UserCredentialsView, error) {
+  sqlStatement := `
+    SELECT
+      user_id,
+      user_name,
+      email_address,
+      hashed_password,
+      disabled,
+      totp_enabled
+    FROM
+      users
+    WHERE
+      user_id = $1
+  `
+  row := db.QueryRow(sqlStatement, userID)
+  userCredentialsView := new(UserCredentialsView)
+  err := row.Scan(
+    &userCredentialsView.UserID,
+    &userCredentialsView.UserName,
+    &userCredentialsView.EmailAddress,
+    &userCredentialsView.HashedPassword,
+    &userCredentialsView.Disabled,
+    &userCredentialsView.TwoFactorEnabled,
   )
 
   if err != nil {
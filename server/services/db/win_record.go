@@ -0,0 +1,31 @@
+package db
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// WinRecord describes an aggregated win/loss record; embedded
+// in any of our views that report win rates for a group of matches
+type WinRecord struct {
+  Wins     int64    `json:"wins"`
+  Losses   int64    `json:"losses"`
+  WinRate  float64  `json:"winRate"`
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// calculateWinRate fills in the win rate from the scanned wins and losses;
+// matches without a recorded result are never counted in either
+func (wr *WinRecord) calculateWinRate() {
+  total := wr.Wins + wr.Losses
+  if total == 0 {
+    wr.WinRate = 0
+    return
+  }
+
+  wr.WinRate = float64(wr.Wins) / float64(total)
+}
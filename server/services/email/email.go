@@ -10,6 +10,7 @@ type Email struct {}
 // aspecs of our email layer into one
 type Emailer interface {
   PasswordEmailer
+  TeamInviteEmailer
 }
 
 
@@ -0,0 +1,81 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// TeamInviteInfo is a convenience data structure for holding
+// all relevant information for inviting someone to a team
+type TeamInviteInfo struct {
+	UserEmail   string    `json:"userEmail"`
+	TeamName    string    `json:"teamName"`
+	InviterName string    `json:"inviterName"`
+	InviteURL   string    `json:"inviteUrl"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// TeamInviteEmailer describes all of the methods
+// used for sending emails related to teams
+type TeamInviteEmailer interface {
+	SendTeamInviteEmail(teamInviteInfo *TeamInviteInfo) (bool, error)
+}
+
+// SendTeamInviteEmail sends an email to someone
+// inviting them to join a team
+func (e *Email) SendTeamInviteEmail(teamInviteInfo *TeamInviteInfo) (bool, error) {
+	from := mail.NewEmail("Cakebin", "cae@cakeforge.co")
+	subject := fmt.Sprintf("You've been invited to join %s on smush-tracker", teamInviteInfo.TeamName)
+	to := mail.NewEmail("Smusher", teamInviteInfo.UserEmail)
+
+	// Team and user names are picked by users, so they're escaped before going in the html
+	teamInviteBody := fmt.Sprintf(`
+   <p>Hallo friend,</p>
+
+   <p>%s invited you to join their team, %s. You can accept by logging in and visiting the following link:</p>
+
+   <a href="%s">%s</a>
+
+   <p>The invite expires on %s. If you don't want to join, you can safely ignore it.</p>
+
+   <p>Keep smushing! :)</p>
+   `,
+		html.EscapeString(teamInviteInfo.InviterName),
+		html.EscapeString(teamInviteInfo.TeamName),
+		teamInviteInfo.InviteURL,
+		teamInviteInfo.InviteURL,
+		teamInviteInfo.ExpiresAt.UTC().Format("January 2, 2006 at 15:04 UTC"),
+	)
+	content := mail.NewContent("text/html", teamInviteBody)
+
+	m := mail.NewV3MailInit(from, subject, to, content)
+
+	request := sendgrid.GetRequest(
+		os.Getenv("SENDGRID_API_KEY"),
+		"/v3/mail/send",
+		"https://api.sendgrid.com",
+	)
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(m)
+
+	response, err := sendgrid.API(request)
+	if err != nil {
+		return false, err
+	}
+
+	if response.StatusCode != 202 {
+		return false, errors.New(response.Body)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+  "sync"
+)
+
+
+// defaultReplaySize is how many of the latest events we keep around for
+// subscribers that reconnect, when New isn't given a size
+const defaultReplaySize = 1000
+
+
+// Events is the struct we use to implement all of our EventManager interfaces;
+// it's an in-process hub, so only subscribers on this server see its events
+type Events struct {
+  mutex          sync.Mutex
+  lastEventID    int64
+  replayBuffer   []*Event
+  replayNext     int
+  subscriptions  map[*Subscription]bool
+}
+
+
+// EventManager combines all of the various
+// aspects of our events layer into one
+type EventManager interface {
+  Publisher
+  Subscriber
+}
+
+
+// New makes a new Events struct which implements all of the "EventManager"
+// methods, keeping the given number of events around for replays
+func New(replaySize int) *Events {
+  if replaySize <= 0 {
+    replaySize = defaultReplaySize
+  }
+
+  return &Events{
+    replayBuffer:   make([]*Event, replaySize),
+    subscriptions:  make(map[*Subscription]bool),
+  }
+}
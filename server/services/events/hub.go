@@ -0,0 +1,151 @@
+package events
+
+import (
+  "time"
+)
+
+
+// subscriptionBufferSize is how many events a subscriber can fall behind by before we drop it;
+// a dropped subscriber can reconnect and catch up from the replay buffer instead
+const subscriptionBufferSize = 64
+
+
+/*---------------------------------
+          Data Structures
+----------------------------------*/
+
+// Event describes something that happened that subscribers may want to hear about. Event IDs
+// only ever go up, so subscribers can say which was the last one they saw when they reconnect
+type Event struct {
+  EventID       int64
+  EventType     string
+  Created       time.Time
+  // Who and which characters the event is about, so subscribers can filter on them
+  UserID        int64
+  CharacterIDs  []int64
+  Data          interface{}
+}
+
+
+// Subscription describes a single subscriber's feed of events; Events is
+// closed when the subscriber falls too far behind or unsubscribes
+type Subscription struct {
+  Events  chan *Event
+}
+
+
+/*---------------------------------
+            Interface
+----------------------------------*/
+
+// Publisher describes all of the methods used to send out events
+type Publisher interface {
+  Publish(eventType string, userID int64, characterIDs []int64, data interface{}) *Event
+}
+
+
+// Subscriber describes all of the methods used to listen for events
+type Subscriber interface {
+  Subscribe(lastEventID int64) (*Subscription, []*Event, bool)
+  Unsubscribe(subscription *Subscription)
+}
+
+
+/*---------------------------------
+       Method Implementations
+----------------------------------*/
+
+// Publish sends a new event to every subscriber, and keeps it in the replay buffer
+func (e *Events) Publish(eventType string, userID int64, characterIDs []int64, data interface{}) *Event {
+  e.mutex.Lock()
+  defer e.mutex.Unlock()
+
+  e.lastEventID++
+  event := &Event{
+    EventID:       e.lastEventID,
+    EventType:     eventType,
+    Created:       time.Now(),
+    UserID:        userID,
+    CharacterIDs:  characterIDs,
+    Data:          data,
+  }
+
+  e.replayBuffer[e.replayNext] = event
+  e.replayNext = (e.replayNext + 1) % len(e.replayBuffer)
+
+  for subscription := range e.subscriptions {
+    select {
+    case subscription.Events <- event:
+    default:
+      // Publishing never waits on a slow subscriber
+      delete(e.subscriptions, subscription)
+      close(subscription.Events)
+    }
+  }
+
+  return event
+}
+
+
+// Subscribe starts a new subscription, along with every buffered event after lastEventID (0 for none).
+// The bool is false when some of the events after lastEventID are gone from the buffer (or are from
+// before the server restarted), so the subscriber knows it has to reload everything instead
+func (e *Events) Subscribe(lastEventID int64) (*Subscription, []*Event, bool) {
+  e.mutex.Lock()
+  defer e.mutex.Unlock()
+
+  subscription := &Subscription{Events: make(chan *Event, subscriptionBufferSize)}
+  e.subscriptions[subscription] = true
+
+  replayEvents := make([]*Event, 0)
+  if lastEventID <= 0 {
+    return subscription, replayEvents, true
+  }
+  if lastEventID > e.lastEventID {
+    return subscription, replayEvents, false
+  }
+
+  // Walk the ring buffer from oldest to newest
+  complete := lastEventID == e.lastEventID
+  for i := 0; i < len(e.replayBuffer); i++ {
+    event := e.replayBuffer[(e.replayNext + i) % len(e.replayBuffer)]
+    if event == nil || event.EventID <= lastEventID {
+      continue
+    }
+
+    if event.EventID == lastEventID + 1 {
+      complete = true
+    }
+    replayEvents = append(replayEvents, event)
+  }
+
+  return subscription, replayEvents, complete
+}
+
+
+// Unsubscribe stops sending events to a subscription
+func (e *Events) Unsubscribe(subscription *Subscription) {
+  e.mutex.Lock()
+  defer e.mutex.Unlock()
+
+  if e.subscriptions[subscription] {
+    delete(e.subscriptions, subscription)
+    close(subscription.Events)
+  }
+}
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// HasCharacter checks if an event is about a given character
+func (event *Event) HasCharacter(characterID int64) bool {
+  for _, eventCharacterID := range event.CharacterIDs {
+    if eventCharacterID == characterID {
+      return true
+    }
+  }
+
+  return false
+}
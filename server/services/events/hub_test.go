@@ -0,0 +1,152 @@
+package events
+
+import (
+  "testing"
+)
+
+
+/*---------------------------------
+            Helpers
+----------------------------------*/
+
+// newTestEvents makes a hub that keeps three events around for
+// replays, with five published to it so the oldest two are gone
+func newTestEvents() *Events {
+  e := New(3)
+  for i := 0; i < 5; i++ {
+    e.Publish("test_event", 7, []int64{12}, nil)
+  }
+
+  return e
+}
+
+
+func eventIDs(events []*Event) []int64 {
+  ids := make([]int64, 0)
+  for _, event := range events {
+    ids = append(ids, event.EventID)
+  }
+  return ids
+}
+
+
+func sameIDs(a []int64, b []int64) bool {
+  if len(a) != len(b) {
+    return false
+  }
+  for i := range a {
+    if a[i] != b[i] {
+      return false
+    }
+  }
+  return true
+}
+
+
+/*---------------------------------
+              Tests
+----------------------------------*/
+
+func TestSubscribeReplay(t *testing.T) {
+  tests := []struct {
+    name         string
+    lastEventID  int64
+    expectedIDs  []int64
+    complete     bool
+  }{
+    {"new subscriber", 0, []int64{}, true},
+    {"caught up subscriber", 5, []int64{}, true},
+    {"subscriber within the buffer", 3, []int64{4, 5}, true},
+    {"subscriber at the oldest buffered event", 2, []int64{3, 4, 5}, true},
+    {"subscriber past the buffer", 1, []int64{3, 4, 5}, false},
+    {"subscriber from before a restart", 9, []int64{}, false},
+  }
+  for _, test := range tests {
+    e := newTestEvents()
+
+    subscription, replayEvents, complete := e.Subscribe(test.lastEventID)
+    if subscription == nil {
+      t.Fatalf("Subscribe for %s returned no subscription", test.name)
+    }
+    if ids := eventIDs(replayEvents); !sameIDs(ids, test.expectedIDs) {
+      t.Errorf("Subscribe for %s replayed %v, expected %v", test.name, ids, test.expectedIDs)
+    }
+    if complete != test.complete {
+      t.Errorf("Subscribe for %s said complete was %t, expected %t", test.name, complete, test.complete)
+    }
+  }
+}
+
+
+func TestSubscribeReplayEmptyBuffer(t *testing.T) {
+  e := New(3)
+
+  _, replayEvents, complete := e.Subscribe(1)
+  if len(replayEvents) != 0 || complete {
+    t.Errorf("Subscribing after an event a fresh hub never sent should be incomplete, got %d events, complete %t", len(replayEvents), complete)
+  }
+}
+
+
+func TestPublishDropsSlowSubscriber(t *testing.T) {
+  e := New(0)
+  slowSubscription, _, _ := e.Subscribe(0)
+  fastSubscription, _, _ := e.Subscribe(0)
+
+  // The slow subscriber never reads, so the publish after its buffer fills drops it
+  for i := 0; i < subscriptionBufferSize + 1; i++ {
+    event := e.Publish("test_event", 7, nil, nil)
+
+    received := <-fastSubscription.Events
+    if received != event {
+      t.Fatalf("Fast subscriber got event %d, expected %d", received.EventID, event.EventID)
+    }
+  }
+
+  // It still gets everything that fit, then sees its feed closed
+  for i := 1; i <= subscriptionBufferSize; i++ {
+    event, ok := <-slowSubscription.Events
+    if !ok {
+      t.Fatalf("Slow subscriber's feed closed after %d events, expected %d", i - 1, subscriptionBufferSize)
+    }
+    if event.EventID != int64(i) {
+      t.Errorf("Slow subscriber got event %d, expected %d", event.EventID, i)
+    }
+  }
+  if _, ok := <-slowSubscription.Events; ok {
+    t.Error("Slow subscriber's feed should be closed once it falls too far behind")
+  }
+  if e.subscriptions[slowSubscription] {
+    t.Error("Slow subscriber should no longer be subscribed")
+  }
+
+  // Dropping one subscriber leaves the rest alone
+  if !e.subscriptions[fastSubscription] {
+    t.Fatal("Fast subscriber should still be subscribed")
+  }
+  event := e.Publish("test_event", 7, nil, nil)
+  if received := <-fastSubscription.Events; received != event {
+    t.Errorf("Fast subscriber got event %d after the drop, expected %d", received.EventID, event.EventID)
+  }
+
+  // Unsubscribing after being dropped (like a stream handler's deferred one) is fine
+  e.Unsubscribe(slowSubscription)
+}
+
+
+func TestUnsubscribe(t *testing.T) {
+  e := New(0)
+  subscription, _, _ := e.Subscribe(0)
+
+  e.Unsubscribe(subscription)
+  if _, ok := <-subscription.Events; ok {
+    t.Error("Unsubscribing should close the subscription's feed")
+  }
+
+  // Nothing is sent to it anymore, and unsubscribing again doesn't close it twice
+  e.Publish("test_event", 7, nil, nil)
+  e.Unsubscribe(subscription)
+  if len(e.subscriptions) != 0 {
+    t.Errorf("Expected no subscriptions, got %d", len(e.subscriptions))
+  }
+}